@@ -0,0 +1,173 @@
+package bgcode
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Magic 文件头标识
+var Magic = []byte("GCDE")
+
+// 块类型
+const (
+	BlockFileMetadata    = 0
+	BlockGCode           = 1
+	BlockSlicerMetadata  = 2
+	BlockPrinterMetadata = 3
+	BlockPrintMetadata   = 4
+	BlockThumbnail       = 5
+)
+
+// 压缩方式
+const (
+	CompressionNone         = 0
+	CompressionDeflate      = 1
+	CompressionHeatshrink11 = 2 // heatshrink 窗口11位、前瞻4位
+	CompressionHeatshrink12 = 3 // heatshrink 窗口12位、前瞻4位
+)
+
+// G-code块编码
+const (
+	EncodingNone             = 0
+	EncodingMeatPack         = 1
+	EncodingMeatPackComments = 2
+)
+
+// 校验方式
+const (
+	ChecksumNone  = 0
+	ChecksumCRC32 = 1
+)
+
+// maxBlockSize 单个块解压后的最大大小，防止异常文件占用过多内存
+const maxBlockSize = 64 * 1024 * 1024
+
+// Block 一个数据块
+type Block struct {
+	Type        uint16
+	Compression uint16
+	Params      []byte // 块参数，G-code和元数据块为编码方式，缩略图为格式和尺寸
+	Data        []byte // 解压后的数据
+}
+
+// Encoding 块参数中的编码方式
+func (b *Block) Encoding() uint16 {
+	if len(b.Params) < 2 {
+		return 0
+	}
+	return binary.LittleEndian.Uint16(b.Params)
+}
+
+// Reader 按顺序读取 .bgcode 文件中的块
+type Reader struct {
+	r            io.Reader
+	Version      uint32
+	ChecksumType uint16
+}
+
+// NewReader 读取并校验文件头
+func NewReader(r io.Reader) (*Reader, error) {
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("读取bgcode文件头失败: %v", err)
+	}
+	if !bytes.Equal(header[:4], Magic) {
+		return nil, errors.New("不是bgcode文件")
+	}
+	br := &Reader{
+		r:            r,
+		Version:      binary.LittleEndian.Uint32(header[4:8]),
+		ChecksumType: binary.LittleEndian.Uint16(header[8:10]),
+	}
+	if br.ChecksumType != ChecksumNone && br.ChecksumType != ChecksumCRC32 {
+		return nil, fmt.Errorf("不支持的bgcode校验方式: %d", br.ChecksumType)
+	}
+	return br, nil
+}
+
+// Next 读取下一个块，文件结束时返回 io.EOF
+func (br *Reader) Next() (*Block, error) {
+	header := make([]byte, 8, 12)
+	n, err := io.ReadFull(br.r, header)
+	if err == io.EOF || (err == io.ErrUnexpectedEOF && n == 0) {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取块头失败: %v", err)
+	}
+
+	block := &Block{
+		Type:        binary.LittleEndian.Uint16(header[0:2]),
+		Compression: binary.LittleEndian.Uint16(header[2:4]),
+	}
+	size := binary.LittleEndian.Uint32(header[4:8])
+	compressedSize := size
+	if block.Compression != CompressionNone {
+		header = header[:12]
+		if _, err := io.ReadFull(br.r, header[8:12]); err != nil {
+			return nil, fmt.Errorf("读取块头失败: %v", err)
+		}
+		compressedSize = binary.LittleEndian.Uint32(header[8:12])
+	}
+	if size > maxBlockSize || compressedSize > maxBlockSize {
+		return nil, fmt.Errorf("块大小 %d 超出限制", max(size, compressedSize))
+	}
+
+	paramsSize := 2
+	if block.Type == BlockThumbnail {
+		paramsSize = 6
+	}
+	payload := make([]byte, paramsSize+int(compressedSize))
+	if _, err := io.ReadFull(br.r, payload); err != nil {
+		return nil, fmt.Errorf("读取块数据失败: %v", err)
+	}
+
+	if br.ChecksumType == ChecksumCRC32 {
+		sum := make([]byte, 4)
+		if _, err := io.ReadFull(br.r, sum); err != nil {
+			return nil, fmt.Errorf("读取块校验值失败: %v", err)
+		}
+		crc := crc32.NewIEEE()
+		crc.Write(header)
+		crc.Write(payload)
+		if crc.Sum32() != binary.LittleEndian.Uint32(sum) {
+			return nil, fmt.Errorf("块校验失败")
+		}
+	}
+
+	block.Params = payload[:paramsSize]
+	block.Data, err = decompress(payload[paramsSize:], block.Compression, int(size))
+	if err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// decompress 解压块数据
+func decompress(data []byte, compression uint16, size int) ([]byte, error) {
+	switch compression {
+	case CompressionNone:
+		return data, nil
+	case CompressionDeflate:
+		zr, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("解压块数据失败: %v", err)
+		}
+		defer zr.Close()
+		out := make([]byte, size)
+		if _, err := io.ReadFull(zr, out); err != nil {
+			return nil, fmt.Errorf("解压块数据失败: %v", err)
+		}
+		return out, nil
+	case CompressionHeatshrink11:
+		return heatshrinkDecode(data, 11, 4, size)
+	case CompressionHeatshrink12:
+		return heatshrinkDecode(data, 12, 4, size)
+	}
+	return nil, fmt.Errorf("不支持的压缩方式: %d", compression)
+}
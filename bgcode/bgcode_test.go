@@ -0,0 +1,257 @@
+package bgcode
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"strings"
+	"testing"
+)
+
+// testBlock 测试文件中的一个块，data 为压缩前的内容
+type testBlock struct {
+	typ         uint16
+	compression uint16
+	params      []byte
+	data        []byte
+}
+
+// encodeFile 按 bgcode 格式写出文件
+func encodeFile(t *testing.T, checksum uint16, blocks ...testBlock) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	buf.Write(Magic)
+	binary.Write(&buf, binary.LittleEndian, uint32(1))
+	binary.Write(&buf, binary.LittleEndian, checksum)
+	for _, b := range blocks {
+		var data []byte
+		switch b.compression {
+		case CompressionNone:
+			data = b.data
+		case CompressionDeflate:
+			var z bytes.Buffer
+			zw := zlib.NewWriter(&z)
+			zw.Write(b.data)
+			zw.Close()
+			data = z.Bytes()
+		case CompressionHeatshrink11:
+			data = heatshrinkLiterals(b.data)
+		default:
+			t.Fatalf("不支持的压缩方式 %d", b.compression)
+		}
+		var block bytes.Buffer
+		binary.Write(&block, binary.LittleEndian, b.typ)
+		binary.Write(&block, binary.LittleEndian, b.compression)
+		binary.Write(&block, binary.LittleEndian, uint32(len(b.data)))
+		if b.compression != CompressionNone {
+			binary.Write(&block, binary.LittleEndian, uint32(len(data)))
+		}
+		params := b.params
+		if params == nil {
+			params = []byte{0, 0}
+		}
+		block.Write(params)
+		block.Write(data)
+		buf.Write(block.Bytes())
+		if checksum == ChecksumCRC32 {
+			binary.Write(&buf, binary.LittleEndian, crc32.ChecksumIEEE(block.Bytes()))
+		}
+	}
+	return buf.Bytes()
+}
+
+// bitWriter 高位优先的位写入器
+type bitWriter struct {
+	data []byte
+	bits int
+}
+
+func (w *bitWriter) write(v uint32, n uint) {
+	for i := int(n) - 1; i >= 0; i-- {
+		if w.bits%8 == 0 {
+			w.data = append(w.data, 0)
+		}
+		w.data[len(w.data)-1] |= byte(v>>uint(i)&1) << (7 - uint(w.bits%8))
+		w.bits++
+	}
+}
+
+// heatshrinkLiterals 只用字面量编码 heatshrink 数据
+func heatshrinkLiterals(data []byte) []byte {
+	var w bitWriter
+	for _, c := range data {
+		w.write(1, 1)
+		w.write(uint32(c), 8)
+	}
+	return w.data
+}
+
+// meatpack 按 MeatPack 打包文本，文本以换行结束
+func meatpack(text string) []byte {
+	code := func(c byte) byte {
+		if i := bytes.IndexByte(meatpackTable[:], c); i >= 0 {
+			return byte(i)
+		}
+		return meatpackFull
+	}
+	out := []byte{meatpackSignal, meatpackSignal, meatpackEnablePacking}
+	for i := 0; i < len(text); {
+		a := text[i]
+		if a == '\n' {
+			out = append(out, code(a))
+			i++
+			continue
+		}
+		b := text[i+1]
+		ca, cb := code(a), code(b)
+		out = append(out, ca|cb<<4)
+		if ca == meatpackFull {
+			out = append(out, a)
+		}
+		if cb == meatpackFull {
+			out = append(out, b)
+		}
+		i += 2
+	}
+	return out
+}
+
+func TestGCodeReader(t *testing.T) {
+	const text = "; generated by PrusaSlicer\nM104 S215\nG1 X10.5 Y-2 E0.3\nG1 Z.2 F720\n"
+	meta := testBlock{typ: BlockPrinterMetadata, data: []byte("printer_model=MK4\nnozzle_diameter = 0.4\n")}
+	tests := []struct {
+		name     string
+		checksum uint16
+		block    testBlock
+	}{
+		{"不压缩", ChecksumCRC32, testBlock{typ: BlockGCode, data: []byte(text)}},
+		{"deflate", ChecksumCRC32, testBlock{typ: BlockGCode, compression: CompressionDeflate, data: []byte(text)}},
+		{"heatshrink", ChecksumNone, testBlock{typ: BlockGCode, compression: CompressionHeatshrink11, data: []byte(text)}},
+		{"MeatPack", ChecksumCRC32, testBlock{typ: BlockGCode, params: []byte{EncodingMeatPack, 0}, data: meatpack(text)}},
+		{"MeatPack 和 heatshrink", ChecksumCRC32, testBlock{typ: BlockGCode, compression: CompressionHeatshrink11, params: []byte{EncodingMeatPackComments, 0}, data: meatpack(text)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := encodeFile(t, tt.checksum, meta, tt.block, tt.block)
+			r, err := NewGCodeReader(bytes.NewReader(file))
+			if err != nil {
+				t.Fatalf("NewGCodeReader: %v", err)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("ReadAll: %v", err)
+			}
+			if string(got) != text+text {
+				t.Errorf("got %q, want %q", got, text+text)
+			}
+			if m := r.Metadata().Printer; m["printer_model"] != "MK4" || m["nozzle_diameter"] != "0.4" {
+				t.Errorf("Printer = %v", m)
+			}
+		})
+	}
+}
+
+func TestHeatshrinkDecode(t *testing.T) {
+	// 字面量 abc，然后回溯 3 复制 6 个字节
+	var w bitWriter
+	for _, c := range []byte("abc") {
+		w.write(1, 1)
+		w.write(uint32(c), 8)
+	}
+	w.write(0, 1)
+	w.write(3-1, 12)
+	w.write(6-1, 4)
+	got, err := heatshrinkDecode(w.data, 12, 4, 9)
+	if err != nil || string(got) != "abcabcabc" {
+		t.Errorf("heatshrinkDecode = %q, %v", got, err)
+	}
+	if _, err := heatshrinkDecode(w.data, 12, 4, 20); err == nil {
+		t.Error("数据不足时应该返回错误")
+	}
+}
+
+func TestMeatpackDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"不打包", []byte("G1 X1\n"), "G1 X1\n"},
+		{"打包", meatpack("G1 X10.5\n"), "G1 X10.5\n"},
+		{"完整字节", meatpack("M104 S215\nT0\n"), "M104 S215\nT0\n"},
+		{"省略空格", append([]byte{meatpackSignal, meatpackSignal, meatpackEnableNoSpaces}, meatpack("G1 1\n")...), "G1E1\n"},
+		{"关闭打包", append(meatpack("G1\n"), meatpackSignal, meatpackSignal, meatpackDisablePacking, 'M', '2', '\n'), "G1\nM2\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var d meatpackDecoder
+			if got := string(d.decode(tt.data, nil)); got != tt.want {
+				t.Errorf("decode = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	gcode := testBlock{typ: BlockGCode, data: []byte("G1 X1\n")}
+	corrupt := encodeFile(t, ChecksumCRC32, gcode)
+	corrupt[len(corrupt)-5] ^= 0xFF
+
+	huge := encodeFile(t, ChecksumNone, gcode)
+	binary.LittleEndian.PutUint32(huge[14:], maxBlockSize+1)
+
+	tests := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"文件头", []byte("GCODE G1 X1"), "不是bgcode文件"},
+		{"校验失败", corrupt, "块校验失败"},
+		{"块大小", huge, "块大小 67108865 超出限制"},
+		{"G-code 编码", encodeFile(t, ChecksumNone, testBlock{typ: BlockGCode, params: []byte{7, 0}, data: []byte("G1")}), "不支持的G-code编码"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewGCodeReader(bytes.NewReader(tt.data))
+			if err == nil {
+				_, err = io.ReadAll(r)
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("err = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestDecompressUnknown(t *testing.T) {
+	if _, err := decompress([]byte("G1"), 9, 2); err == nil || !strings.Contains(err.Error(), "不支持的压缩方式: 9") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestReadMetadata(t *testing.T) {
+	thumbnail := testBlock{typ: BlockThumbnail, params: []byte{0, 0, 16, 0, 12, 0}, data: make([]byte, 100)}
+	file := encodeFile(t, ChecksumCRC32,
+		testBlock{typ: BlockFileMetadata, data: []byte("Producer=PrusaSlicer 2.7.0\n")},
+		thumbnail,
+		testBlock{typ: BlockGCode, data: []byte("G1 X1\n")},
+		testBlock{typ: BlockSlicerMetadata, data: []byte("layer_height=0.2\n")},
+	)
+	meta, err := ReadMetadata(bytes.NewReader(file))
+	if err != nil {
+		t.Fatalf("ReadMetadata: %v", err)
+	}
+	if meta.File["Producer"] != "PrusaSlicer 2.7.0" || meta.Slicer != nil {
+		t.Errorf("meta = %+v", meta)
+	}
+	if len(meta.Thumbnails) != 1 || meta.Thumbnails[0] != (Thumbnail{Format: "PNG", Width: 16, Height: 12, Size: 100}) {
+		t.Errorf("Thumbnails = %+v", meta.Thumbnails)
+	}
+	manifest, err := meta.Manifest()
+	if err != nil || !bytes.Contains(manifest, []byte(`"file.Producer":"PrusaSlicer 2.7.0"`)) ||
+		!bytes.Contains(manifest, []byte(`"thumbnail[0]":"PNG 16x12"`)) {
+		t.Errorf("Manifest = %s, %v", manifest, err)
+	}
+}
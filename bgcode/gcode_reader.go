@@ -0,0 +1,66 @@
+package bgcode
+
+import (
+	"fmt"
+	"io"
+)
+
+// GCodeReader 依次解码 .bgcode 文件中的G-code块，输出与文本G-code相同的内容
+// 每次只在内存中保留一个块，读取过程中遇到的元数据块记录在 Metadata 中
+type GCodeReader struct {
+	r        *Reader
+	meta     *Metadata
+	meatpack meatpackDecoder
+	buf      []byte
+	err      error
+}
+
+// NewGCodeReader 创建G-code读取器
+func NewGCodeReader(r io.Reader) (*GCodeReader, error) {
+	br, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return &GCodeReader{r: br, meta: &Metadata{Version: br.Version}}, nil
+}
+
+// Metadata 已读取的元数据，元数据块位于G-code块之前，读取到G-code后即完整
+func (g *GCodeReader) Metadata() *Metadata {
+	return g.meta
+}
+
+// Read 实现 io.Reader
+func (g *GCodeReader) Read(p []byte) (int, error) {
+	for len(g.buf) == 0 {
+		if g.err != nil {
+			return 0, g.err
+		}
+		g.err = g.nextBlock()
+	}
+	n := copy(p, g.buf)
+	g.buf = g.buf[n:]
+	return n, nil
+}
+
+// nextBlock 读取下一个块，G-code块解码后放入缓冲区
+func (g *GCodeReader) nextBlock() error {
+	block, err := g.r.Next()
+	if err != nil {
+		return err
+	}
+	if block.Type != BlockGCode {
+		return g.meta.add(block)
+	}
+
+	switch block.Encoding() {
+	case EncodingNone:
+		g.buf = block.Data
+	case EncodingMeatPack, EncodingMeatPackComments:
+		// 每个块独立编码，解码状态不跨块保留
+		g.meatpack = meatpackDecoder{}
+		g.buf = g.meatpack.decode(block.Data, g.buf[:0])
+	default:
+		return fmt.Errorf("不支持的G-code编码: %d", block.Encoding())
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package bgcode
+
+import "fmt"
+
+// heatshrinkDecode 解压heatshrink(LZSS)数据
+// 数据为按高位优先排列的位流：标志位1后跟8位字面量；标志位0后跟回溯距离和长度，均存储为实际值减1
+func heatshrinkDecode(data []byte, windowBits, lookaheadBits uint, size int) ([]byte, error) {
+	out := make([]byte, 0, size)
+	br := bitReader{data: data}
+	for len(out) < size {
+		tag, ok := br.read(1)
+		if !ok {
+			break
+		}
+		if tag == 1 {
+			c, ok := br.read(8)
+			if !ok {
+				break
+			}
+			out = append(out, byte(c))
+			continue
+		}
+
+		index, ok := br.read(windowBits)
+		if !ok {
+			break
+		}
+		count, ok := br.read(lookaheadBits)
+		if !ok {
+			break
+		}
+		offset := int(index) + 1
+		for i := 0; i <= int(count) && len(out) < size; i++ {
+			// 窗口初始内容为0
+			var c byte
+			if p := len(out) - offset; p >= 0 {
+				c = out[p]
+			}
+			out = append(out, c)
+		}
+	}
+	if len(out) != size {
+		return nil, fmt.Errorf("heatshrink解压后大小为 %d，应为 %d", len(out), size)
+	}
+	return out, nil
+}
+
+// bitReader 高位优先的位读取器
+type bitReader struct {
+	data []byte
+	pos  int // 已读取的位数
+}
+
+// read 读取n位，剩余位数不足时返回false
+func (r *bitReader) read(n uint) (uint32, bool) {
+	if r.pos+int(n) > len(r.data)*8 {
+		return 0, false
+	}
+	var v uint32
+	for i := uint(0); i < n; i++ {
+		bit := r.data[r.pos/8] >> (7 - uint(r.pos%8)) & 1
+		v = v<<1 | uint32(bit)
+		r.pos++
+	}
+	return v, true
+}
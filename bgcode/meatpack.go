@@ -0,0 +1,120 @@
+package bgcode
+
+// MeatPack 命令，以两个 0xFF 开头
+const (
+	meatpackSignal         = 0xFF
+	meatpackEnablePacking  = 251
+	meatpackDisablePacking = 250
+	meatpackResetAll       = 249
+	meatpackEnableNoSpaces = 247
+	meatpackDisableNoSpace = 246
+)
+
+// meatpackTable 4位编码对应的字符，0b1111表示后面跟一个完整字节
+var meatpackTable = [15]byte{'0', '1', '2', '3', '4', '5', '6', '7', '8', '9', '.', ' ', '\n', 'G', 'X'}
+
+// meatpackFull 表示未打包的4位编码
+const meatpackFull = 0x0F
+
+// meatpackDecoder MeatPack解码器
+// 每个字节包含两个4位编码，低4位为第一个字符；
+// 省略空格模式下空格编码表示字符 'E'
+type meatpackDecoder struct {
+	packing   bool
+	noSpaces  bool
+	signal    bool // 已收到一个 0xFF
+	command   bool // 下一个字节为命令
+	fullChars int  // 等待的完整字节数
+	pending   byte // 完整字节之后输出的字符
+}
+
+// decode 解码一段数据，追加到out
+func (d *meatpackDecoder) decode(data []byte, out []byte) []byte {
+	for _, c := range data {
+		if c == meatpackSignal {
+			if d.signal {
+				d.command = true
+				d.signal = false
+			} else {
+				d.signal = true
+			}
+			continue
+		}
+		if d.command {
+			d.handleCommand(c)
+			d.command = false
+			continue
+		}
+		if d.signal {
+			// 单个 0xFF 是普通数据
+			out = d.char(meatpackSignal, out)
+			d.signal = false
+		}
+		out = d.char(c, out)
+	}
+	return out
+}
+
+// handleCommand 处理MeatPack命令
+func (d *meatpackDecoder) handleCommand(c byte) {
+	switch c {
+	case meatpackEnablePacking:
+		d.packing = true
+	case meatpackDisablePacking:
+		d.packing = false
+	case meatpackResetAll:
+		d.packing = false
+		d.noSpaces = false
+	case meatpackEnableNoSpaces:
+		d.noSpaces = true
+	case meatpackDisableNoSpace:
+		d.noSpaces = false
+	}
+}
+
+// char 处理一个数据字节
+func (d *meatpackDecoder) char(c byte, out []byte) []byte {
+	if !d.packing {
+		return append(out, c)
+	}
+	if d.fullChars > 0 {
+		out = append(out, c)
+		if d.pending != 0 {
+			out = append(out, d.pending)
+			d.pending = 0
+		}
+		d.fullChars--
+		return out
+	}
+
+	low, high := c&0x0F, c>>4
+	if low == meatpackFull {
+		d.fullChars++
+		if high == meatpackFull {
+			d.fullChars++
+		} else {
+			d.pending = d.unpack(high)
+		}
+		return out
+	}
+	first := d.unpack(low)
+	out = append(out, first)
+	// 换行后的高4位为填充
+	if first == '\n' {
+		return out
+	}
+	if high == meatpackFull {
+		d.fullChars++
+		return out
+	}
+	return append(out, d.unpack(high))
+}
+
+// unpack 4位编码转换为字符
+func (d *meatpackDecoder) unpack(code byte) byte {
+	c := meatpackTable[code]
+	if c == ' ' && d.noSpaces {
+		return 'E'
+	}
+	return c
+}
@@ -0,0 +1,124 @@
+package bgcode
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// 缩略图格式
+var thumbnailFormats = map[uint16]string{0: "PNG", 1: "JPG", 2: "QOI"}
+
+// Metadata 文件中的元数据块
+type Metadata struct {
+	Version    uint32            `json:"version"`
+	File       map[string]string `json:"file,omitempty"`
+	Printer    map[string]string `json:"printer,omitempty"`
+	Print      map[string]string `json:"print,omitempty"`
+	Slicer     map[string]string `json:"slicer,omitempty"`
+	Thumbnails []Thumbnail       `json:"thumbnails,omitempty"`
+}
+
+// Thumbnail 缩略图信息
+type Thumbnail struct {
+	Format string `json:"format"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Size   int    `json:"size"` // 图片数据大小(字节)
+}
+
+// add 记录一个元数据或缩略图块
+func (m *Metadata) add(block *Block) error {
+	var dst *map[string]string
+	switch block.Type {
+	case BlockFileMetadata:
+		dst = &m.File
+	case BlockPrinterMetadata:
+		dst = &m.Printer
+	case BlockPrintMetadata:
+		dst = &m.Print
+	case BlockSlicerMetadata:
+		dst = &m.Slicer
+	case BlockThumbnail:
+		format := binary.LittleEndian.Uint16(block.Params[0:2])
+		name, ok := thumbnailFormats[format]
+		if !ok {
+			name = fmt.Sprintf("unknown(%d)", format)
+		}
+		m.Thumbnails = append(m.Thumbnails, Thumbnail{
+			Format: name,
+			Width:  int(binary.LittleEndian.Uint16(block.Params[2:4])),
+			Height: int(binary.LittleEndian.Uint16(block.Params[4:6])),
+			Size:   len(block.Data),
+		})
+		return nil
+	default:
+		return nil
+	}
+
+	if block.Encoding() != 0 {
+		return fmt.Errorf("不支持的元数据编码: %d", block.Encoding())
+	}
+	if *dst == nil {
+		*dst = make(map[string]string)
+	}
+	// INI格式，每行一个 key=value
+	for _, line := range strings.Split(string(block.Data), "\n") {
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		(*dst)[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return nil
+}
+
+// Manifest 将元数据转换为manifest格式的JSON，用于与其他版本比较
+// 文件、打印机、打印和切片元数据以 "<类别>.<键>" 的形式放在 params 中
+func (m *Metadata) Manifest() ([]byte, error) {
+	params := make(map[string]interface{})
+	for prefix, values := range map[string]map[string]string{
+		"file":    m.File,
+		"printer": m.Printer,
+		"print":   m.Print,
+		"slicer":  m.Slicer,
+	} {
+		for key, value := range values {
+			params[prefix+"."+key] = value
+		}
+	}
+	for i, t := range m.Thumbnails {
+		params[fmt.Sprintf("thumbnail[%d]", i)] = fmt.Sprintf("%s %dx%d", t.Format, t.Width, t.Height)
+	}
+	return json.Marshal(map[string]interface{}{
+		"version": fmt.Sprintf("bgcode v%d", m.Version),
+		"params":  params,
+		"bgcode":  m,
+	})
+}
+
+// ReadMetadata 读取第一个G-code块之前的所有元数据
+func ReadMetadata(r io.Reader) (*Metadata, error) {
+	br, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	meta := &Metadata{Version: br.Version}
+	for {
+		block, err := br.Next()
+		if err == io.EOF {
+			return meta, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if block.Type == BlockGCode {
+			return meta, nil
+		}
+		if err := meta.add(block); err != nil {
+			return nil, err
+		}
+	}
+}
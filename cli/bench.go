@@ -0,0 +1,158 @@
+package cli
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"ok/gcode"
+	"ok/input"
+	"ok/service"
+	"os"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+func init() {
+	commands["bench"] = command{usage: "测试G-code解析和分析的吞吐量(MB/s)", run: runBench}
+}
+
+// benchStage 一个被测试的处理阶段
+type benchStage struct {
+	name string
+	run  func(data []byte) error
+}
+
+// runBench 执行 bench 子命令
+func runBench(args []string) int {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	size := fs.Int("size", 64, "未指定文件时生成的G-code大小(MB)")
+	count := fs.Int("n", 3, "每个阶段的运行次数，取最快的一次")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: gcodelens bench [参数] [G-code文件]")
+		fmt.Fprintln(fs.Output(), "未指定文件时使用生成的G-code，文件会先完整读入内存，只测量解析和分析的耗时")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 1 || *size <= 0 || *count <= 0 {
+		fs.Usage()
+		return 2
+	}
+
+	var data []byte
+	name := fmt.Sprintf("生成的G-code (%d MB)", *size)
+	if fs.NArg() == 1 {
+		in, err := input.OpenFile(fs.Arg(0))
+		if err != nil {
+			return fail("打开G-code文件失败: %v", err)
+		}
+		data, err = io.ReadAll(in)
+		in.Close()
+		if err != nil {
+			return fail("读取G-code文件失败: %v", err)
+		}
+		name = fs.Arg(0)
+	} else {
+		data = benchGCode(*size << 20)
+	}
+	lines := bytes.Count(data, []byte("\n"))
+
+	// 分析过程的日志会影响计时
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	gcodeService := service.NewGCodeService()
+	stages := []benchStage{
+		{"词法分析", benchLexer},
+		{"路径分析", func(data []byte) error {
+			_, err := gcodeService.AnalyzeGCode(bytes.NewReader(data))
+			return err
+		}},
+		{"解释执行", func(data []byte) error {
+			return gcode.Run(bytes.NewReader(data), gcode.NewInterpreter(), func(*gcode.Block, []gcode.Segment) error {
+				return nil
+			})
+		}},
+	}
+
+	fmt.Printf("输入: %s, %.1f MB, %d 行, %d 次取最快\n", name, float64(len(data))/(1<<20), lines, *count)
+	fmt.Printf("%-10s %12s %12s %14s\n", "阶段", "耗时", "吞吐量", "每行内存分配")
+	for _, stage := range stages {
+		elapsed, allocs, err := benchRun(stage.run, data, *count)
+		if err != nil {
+			return fail("%s失败: %v", stage.name, err)
+		}
+		mbps := float64(len(data)) / (1 << 20) / elapsed.Seconds()
+		fmt.Printf("%-10s %12s %9.1f MB/s %14.2f\n", stage.name, elapsed.Round(time.Millisecond), mbps, float64(allocs)/float64(max(lines, 1)))
+	}
+	return 0
+}
+
+// benchRun 运行count次，返回最快一次的耗时和该次的内存分配次数
+func benchRun(run func(data []byte) error, data []byte, count int) (time.Duration, uint64, error) {
+	var best time.Duration
+	var bestAllocs uint64
+	var before, after runtime.MemStats
+	for i := 0; i < count; i++ {
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		start := time.Now()
+		if err := run(data); err != nil {
+			return 0, 0, err
+		}
+		elapsed := time.Since(start)
+		runtime.ReadMemStats(&after)
+		if i == 0 || elapsed < best {
+			best = elapsed
+			bestAllocs = after.Mallocs - before.Mallocs
+		}
+	}
+	return best, bestAllocs, nil
+}
+
+// benchLexer 对每一行做词法分析
+func benchLexer(data []byte) error {
+	var lex gcode.Lexer
+	var tok gcode.Token
+	for len(data) > 0 {
+		line := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line, data = data[:i], data[i+1:]
+		} else {
+			data = nil
+		}
+		lex.Reset(line)
+		for lex.Next(&tok) {
+		}
+	}
+	return nil
+}
+
+// benchGCode 生成约size字节的G-code，包含行号、注释、校验和、直线和圆弧
+func benchGCode(size int) []byte {
+	r := rand.New(rand.NewSource(1))
+	buf := bytes.NewBuffer(make([]byte, 0, size+256))
+	buf.WriteString("; GcodeLens bench\nG21 G90\nM3 S1000\n")
+	coord := func(max float64) string {
+		return strconv.FormatFloat(r.Float64()*max, 'f', 3, 64)
+	}
+	for n := 1; buf.Len() < size; n++ {
+		switch {
+		case n%500 == 0:
+			fmt.Fprintf(buf, "(element %d)\n", n/500)
+		case n%50 == 0:
+			fmt.Fprintf(buf, "G0 X%s Y%s\n", coord(500), coord(300))
+		case n%20 == 0:
+			fmt.Fprintf(buf, "N%d G2 X%s Y%s I%s J%s F1200*%d\n", n, coord(500), coord(300), coord(5), coord(5), n%256)
+		default:
+			fmt.Fprintf(buf, "G1 X%s Y%s F%d ; cut\n", coord(500), coord(300), 1000+n%3*1000)
+		}
+	}
+	buf.WriteString("M5\nM30\n")
+	return buf.Bytes()
+}
@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"ok/gcode"
+	"ok/input"
+	"ok/service"
+	"os"
+)
+
+func init() {
+	commands["canonicalize"] = command{usage: "将G-code改写为规范形式，消除不同后处理器的格式差异", run: runCanonicalize}
+}
+
+// runCanonicalize 执行 canonicalize 子命令
+func runCanonicalize(args []string) int {
+	fs := flag.NewFlagSet("canonicalize", flag.ContinueOnError)
+	output := fs.String("o", "", "输出文件，默认输出到标准输出")
+	precision := fs.Int("precision", gcode.DefaultPrecision, "小数位数")
+	keepComments := fs.Bool("comments", false, "保留注释")
+	trimZeros := fs.Bool("trim-zeros", false, "去掉小数末尾的0")
+	profilePath := fs.String("profile", "", "机器配置JSON文件，按其中的控制器方言解释和输出")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: gcodelens canonicalize [参数] <G-code文件>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	gcodeService := service.NewGCodeService()
+	profile, err := readProfile(gcodeService, *profilePath)
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	in, err := input.OpenFile(fs.Arg(0))
+	if err != nil {
+		return fail("打开G-code文件失败: %v", err)
+	}
+	defer in.Close()
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return fail("创建输出文件失败: %v", err)
+		}
+		defer f.Close()
+		out = f
+	}
+	bw := bufio.NewWriter(out)
+
+	opts := gcode.CanonicalOptions{Precision: *precision, KeepComments: *keepComments, TrimZeros: *trimZeros}
+	if err := gcodeService.Canonicalize(bw, in, profile, opts); err != nil {
+		return fail("%v", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return fail("写入输出失败: %v", err)
+	}
+	return 0
+}
@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"ok/model"
+	"ok/service"
+	"os"
+	"sort"
+)
+
+// command 命令行子命令
+type command struct {
+	usage string                  // 用法说明
+	run   func(args []string) int // 执行函数，返回退出码
+}
+
+// commands 已注册的子命令
+var commands = map[string]command{}
+
+// Run 执行命令行子命令，返回进程退出码
+func Run(args []string) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printUsage(os.Stdout)
+		return 0
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "未知命令: %s\n\n", args[0])
+		printUsage(os.Stderr)
+		return 2
+	}
+	return cmd.run(args[1:])
+}
+
+// IsCommand 判断参数是否为子命令
+func IsCommand(name string) bool {
+	_, ok := commands[name]
+	return ok || name == "help" || name == "-h" || name == "--help"
+}
+
+// printUsage 打印所有子命令用法
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "用法: gcodelens <命令> [参数]")
+	fmt.Fprintln(w, "不带参数运行时启动Web服务")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "命令:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-10s %s\n", name, commands[name].usage)
+	}
+}
+
+// fail 打印错误并返回退出码1
+func fail(format string, args ...interface{}) int {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	return 1
+}
+
+// readOptional 读取可选文件，路径为空时返回nil
+func readOptional(path string) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+	return os.ReadFile(path)
+}
+
+// readProfile 读取可选的机器配置文件，路径为空时返回nil
+func readProfile(gcodeService *service.GCodeService, path string) (*model.MachineProfile, error) {
+	if path == "" {
+		return nil, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取机器配置失败: %v", err)
+	}
+	return gcodeService.LoadMachineProfile(nil, content)
+}
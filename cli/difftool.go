@@ -0,0 +1,132 @@
+package cli
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"ok/export"
+	"ok/input"
+	"ok/service"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+func init() {
+	commands["difftool"] = command{usage: "比较两个版本的G-code并打开或输出对比报告，用作 git difftool", run: runDifftool}
+}
+
+// emptyManifest 未指定manifest时使用的空manifest
+var emptyManifest = []byte("{}")
+
+// runDifftool 执行 difftool 子命令
+func runDifftool(args []string) int {
+	fs := flag.NewFlagSet("difftool", flag.ContinueOnError)
+	format := fs.String("format", "html", "报告格式: html(在浏览器中打开)、markdown、diff(输出到标准输出)")
+	output := fs.String("o", "", "输出文件，默认html报告写入临时目录，其余格式输出到标准输出")
+	name := fs.String("name", "", "文件在仓库中的路径，用于报告标题，如 git 的 $MERGED")
+	manifestA := fs.String("manifest-a", "", "版本A的Manifest文件")
+	manifestB := fs.String("manifest-b", "", "版本B的Manifest文件")
+	profilePath := fs.String("profile", "", "机器配置JSON文件")
+	canonical := fs.Bool("canonical", false, "比较前先规范化G-code，忽略格式上的差异")
+	open := fs.Bool("open", true, "html报告生成后在浏览器中打开")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: gcodelens difftool [参数] <版本A> <版本B>")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "配置 git difftool:")
+		fmt.Fprintln(fs.Output(), `  git config difftool.gcodelens.cmd 'gcodelens difftool -name "$MERGED" "$LOCAL" "$REMOTE"'`)
+		fmt.Fprintln(fs.Output(), "  git difftool -t gcodelens HEAD~1 -- part.nc")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	a, err := loadVersion(fs.Arg(0), *manifestA)
+	if err != nil {
+		return fail("%v", err)
+	}
+	b, err := loadVersion(fs.Arg(1), *manifestB)
+	if err != nil {
+		a.Close()
+		return fail("%v", err)
+	}
+	for _, v := range []*input.Bundle{a, b} {
+		if v.Manifest == nil {
+			v.Manifest = emptyManifest
+		}
+		// git 传入的是临时文件，使用仓库中的路径作为显示名称
+		if *name != "" {
+			v.GCodeName = *name
+		}
+	}
+
+	gcodeService := service.NewGCodeService()
+	stored, err := compareVersions(gcodeService, a, b, *profilePath, *canonical)
+	if err != nil {
+		return fail("%v", err)
+	}
+	defer stored.Close()
+
+	buf := new(bytes.Buffer)
+	switch *format {
+	case "html":
+		err = gcodeService.ExportHTML(buf, stored)
+	case "markdown", "md":
+		err = gcodeService.ExportMarkdown(buf, stored)
+	case "diff":
+		err = gcodeService.ExportUnifiedDiff(buf, stored, export.DefaultContext)
+	default:
+		return fail("不支持的报告格式: %s", *format)
+	}
+	if err != nil {
+		return fail("导出报告失败: %v", err)
+	}
+
+	if *format != "html" && *output == "" {
+		if _, err := os.Stdout.Write(buf.Bytes()); err != nil {
+			return fail("输出失败: %v", err)
+		}
+		return 0
+	}
+
+	path := *output
+	if path == "" {
+		f, err := os.CreateTemp("", "gcodelens-*.html")
+		if err != nil {
+			return fail("创建临时文件失败: %v", err)
+		}
+		f.Close()
+		path = f.Name()
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return fail("写入输出文件失败: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "已生成 %s\n", path)
+
+	if *format == "html" && *open {
+		if err := openBrowser(path); err != nil {
+			fmt.Fprintf(os.Stderr, "打开浏览器失败: %v\n", err)
+		}
+	}
+	return 0
+}
+
+// openBrowser 使用系统默认程序打开文件
+func openBrowser(path string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", path)
+	case "windows":
+		cmd = exec.Command("cmd", "/c", "start", "", strings.ReplaceAll(path, "&", "^&"))
+	default:
+		cmd = exec.Command("xdg-open", path)
+	}
+	return cmd.Start()
+}
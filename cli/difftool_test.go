@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFile 在临时目录中写入文件，返回路径
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDifftool(t *testing.T) {
+	dir := t.TempDir()
+	a := writeFile(t, dir, "a.nc", "G21 G90\nG0 X0 Y0\nG1 X10 F600\nG1 Y10\n")
+	// 与A路径相同，只是写法不同
+	same := writeFile(t, dir, "same.nc", "G21 G91\nG0 X0 Y0\nG1 X10 F600\nY10\n")
+	changed := writeFile(t, dir, "changed.nc", "G21 G90\nG0 X0 Y0\nG1 X10 F600\nG1 Y20\n")
+
+	tests := []struct {
+		name string
+		args []string
+		b    string
+		want []string // 输出中应包含的内容
+		not  []string // 输出中不应包含的内容
+	}{
+		{"逐行比较", nil, same, []string{"-G1 Y10", "+Y10"}, nil},
+		{"规范化后相同", []string{"-canonical"}, same, nil, []string{"@@"}},
+		{"规范化后不同", []string{"-canonical"}, changed, []string{"-G1 X10.000 Y10.000", "+G1 X10.000 Y20.000"}, nil},
+		{"使用仓库中的路径", []string{"-name", "parts/bracket.nc"}, changed, []string{"--- a/bracket.nc", "+++ b/bracket.nc"}, []string{"changed.nc"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := filepath.Join(t.TempDir(), "out.diff")
+			args := append([]string{"-format", "diff", "-o", out}, tt.args...)
+			if code := runDifftool(append(args, a, tt.b)); code != 0 {
+				t.Fatalf("退出码 %d", code)
+			}
+			data, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := string(data)
+			for _, text := range tt.want {
+				if !strings.Contains(got, text) {
+					t.Errorf("输出中没有 %q:\n%s", text, got)
+				}
+			}
+			for _, text := range tt.not {
+				if strings.Contains(got, text) {
+					t.Errorf("输出中有 %q:\n%s", text, got)
+				}
+			}
+		})
+	}
+}
+
+func TestDifftoolArgs(t *testing.T) {
+	dir := t.TempDir()
+	a := writeFile(t, dir, "a.nc", "G0 X0\n")
+	tests := []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"缺少文件", []string{a}, 2},
+		{"不支持的格式", []string{"-format", "pdf", a, a}, 1},
+		{"文件不存在", []string{a, filepath.Join(dir, "missing.nc")}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := runDifftool(tt.args); code != tt.code {
+				t.Errorf("退出码 %d, want %d", code, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"ok/gcode"
+	"ok/input"
+	"ok/lint"
+	"ok/model"
+	"ok/service"
+)
+
+func init() {
+	commands["lint"] = command{usage: "检查G-code文件中的问题", run: runLint}
+}
+
+// runLint 执行 lint 子命令
+func runLint(args []string) int {
+	fs := flag.NewFlagSet("lint", flag.ContinueOnError)
+	manifestPath := fs.String("manifest", "", "manifest文件，用于读取机器参数")
+	profilePath := fs.String("profile", "", "机器配置JSON文件")
+	configPath := fs.String("config", "", "检查规则配置JSON文件")
+	format := fs.String("format", "text", "输出格式: text/json/sarif，多个文件时 json 输出数组，sarif 输出一个日志")
+	listRules := fs.Bool("rules", false, "列出所有检查规则")
+	dialect := fs.String("dialect", "", "控制器方言，覆盖机器配置中的设置")
+	listDialects := fs.Bool("dialects", false, "列出所有控制器方言")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: gcodelens lint [参数] <G-code文件>...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if *listRules {
+		for _, meta := range lint.Rules() {
+			fmt.Printf("%-22s %-8s %s\n", meta.ID, meta.Severity, meta.Description)
+		}
+		return 0
+	}
+	if *listDialects {
+		for _, d := range gcode.Dialects() {
+			fmt.Printf("%-10s %s\n", d.Name(), d.Description())
+		}
+		return 0
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	gcodeService := service.NewGCodeService()
+
+	manifestContent, err := readOptional(*manifestPath)
+	if err != nil {
+		return fail("读取Manifest文件失败: %v", err)
+	}
+	profileContent, err := readOptional(*profilePath)
+	if err != nil {
+		return fail("读取机器配置失败: %v", err)
+	}
+	configContent, err := readOptional(*configPath)
+	if err != nil {
+		return fail("读取检查配置失败: %v", err)
+	}
+
+	profile, err := gcodeService.LoadMachineProfile(manifestContent, profileContent)
+	if err != nil {
+		return fail("%v", err)
+	}
+	if *dialect != "" {
+		if _, ok := gcode.LookupDialect(*dialect); !ok {
+			return fail("未知的控制器方言: %s", *dialect)
+		}
+		profile.Dialect = *dialect
+	}
+	cfg, err := lint.ParseConfig(configContent)
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	switch *format {
+	case "text", "json", "sarif":
+	default:
+		return fail("不支持的输出格式: %s", *format)
+	}
+
+	exitCode := 0
+	reports := make([]*model.LintReport, 0, fs.NArg())
+	for _, path := range fs.Args() {
+		report, err := lintFile(gcodeService, path, profile, cfg)
+		if err != nil {
+			return fail("检查文件 %s 失败: %v", path, err)
+		}
+		reports = append(reports, report)
+		if report.Summary.Errors > 0 {
+			exitCode = 1
+		}
+	}
+	if err := printLintReports(reports, *format); err != nil {
+		return fail("%v", err)
+	}
+	return exitCode
+}
+
+// lintFile 检查单个文件
+func lintFile(gcodeService *service.GCodeService, path string, profile *model.MachineProfile, cfg *lint.Config) (*model.LintReport, error) {
+	f, err := input.OpenFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return gcodeService.Lint(path, f, profile, cfg)
+}
+
+// printLintReports 按指定格式输出检查报告
+// json 格式只有一个文件时输出报告对象，多个文件时输出报告数组；sarif 格式输出一个包含所有文件结果的日志
+func printLintReports(reports []*model.LintReport, format string) error {
+	switch format {
+	case "json":
+		var v interface{} = reports
+		if len(reports) == 1 {
+			v = reports[0]
+		}
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	case "sarif":
+		data, err := lint.ToSARIFReports(reports)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	case "text":
+		for _, report := range reports {
+			for _, issue := range report.Issues {
+				fmt.Printf("%s:%d: %s [%s] %s\n", report.File, issue.Line, issue.Severity, issue.RuleID, issue.Message)
+			}
+			fmt.Printf("%s: %d 个错误, %d 个警告, %d 个提示\n",
+				report.File, report.Summary.Errors, report.Summary.Warnings, report.Summary.Infos)
+			if report.Truncated {
+				fmt.Printf("问题太多，只显示前%d个\n", lint.MaxIssues)
+			}
+		}
+	default:
+		return fmt.Errorf("不支持的输出格式: %s", format)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"ok/input"
+	"ok/service"
+	"os"
+)
+
+func init() {
+	commands["optimize"] = command{usage: "按最短空行程重新排列切割顺序并输出G-code", run: runOptimize}
+}
+
+// runOptimize 执行 optimize 子命令
+func runOptimize(args []string) int {
+	fs := flag.NewFlagSet("optimize", flag.ContinueOnError)
+	output := fs.String("o", "", "输出文件，默认输出到标准输出")
+	profilePath := fs.String("profile", "", "机器配置JSON文件")
+	rapid := fs.Float64("rapid", 6000, "快速移动速度(mm/min)，用于估算节省的时间")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: gcodelens optimize [参数] <G-code文件>")
+		fmt.Fprintln(fs.Output(), "只在同一元素、同一刀具和坐标系的连续切割路径之间重新排序，包含固定循环或刀具半径补偿的部分保持原顺序")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	gcodeService := service.NewGCodeService()
+	profile, err := readProfile(gcodeService, *profilePath)
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	in, err := input.OpenFile(fs.Arg(0))
+	if err != nil {
+		return fail("打开G-code文件失败: %v", err)
+	}
+	defer in.Close()
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return fail("创建输出文件失败: %v", err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	report, err := gcodeService.OptimizeTravel(out, in, profile, *rapid)
+	if err != nil {
+		return fail("%v", err)
+	}
+	fmt.Fprintf(os.Stderr, "切割路径 %d 条，空行程 %.1f mm → %.1f mm，可节省 %.1f mm(约 %.1f 秒)",
+		report.Contours, report.Travel, report.Optimized, report.Savings, report.TimeSavings)
+	if report.Fixed > 0 {
+		fmt.Fprintf(os.Stderr, "，%d 组保持原顺序", report.Fixed)
+	}
+	fmt.Fprintln(os.Stderr)
+	return 0
+}
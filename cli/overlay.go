@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"ok/input"
+	"ok/render"
+	"ok/service"
+	"os"
+)
+
+func init() {
+	commands["overlay"] = command{usage: "将两个版本的路径叠加渲染为PNG图片", run: runOverlay}
+}
+
+// runOverlay 执行 overlay 子命令
+func runOverlay(args []string) int {
+	defaults := render.DefaultOverlayOptions()
+	fs := flag.NewFlagSet("overlay", flag.ContinueOnError)
+	output := fs.String("o", "overlay.png", "输出文件")
+	width := fs.Int("width", defaults.Width, "图片宽度(px)")
+	viewport := fs.String("viewport", "", "显示区域 minX,minY,maxX,maxY(mm)")
+	zoom := fs.Float64("zoom", 1, "缩放倍数")
+	zoomDiff := fs.Bool("zoom-diff", false, "缩放到差异区域")
+	lineWidth := fs.Int("line-width", defaults.LineWidth, "线宽(px)")
+	tolerance := fs.Int("tolerance", defaults.Tolerance, "判断为共有路径时允许的偏差(px)")
+	rapids := fs.Bool("rapids", false, "包含快速移动")
+	profilePath := fs.String("profile", "", "机器配置JSON文件，按其中的刀具直径计算刀具半径补偿")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: gcodelens overlay [参数] <G-code A> <G-code B>")
+		fmt.Fprintln(fs.Output(), "仅A有的路径为红色，仅B有的路径为绿色，共有路径为灰色")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	opts := render.OverlayOptions{
+		Width:         *width,
+		Zoom:          *zoom,
+		ZoomToDiff:    *zoomDiff,
+		LineWidth:     *lineWidth,
+		Tolerance:     *tolerance,
+		IncludeRapids: *rapids,
+	}
+	if *viewport != "" {
+		vp, err := render.ParseViewport(*viewport)
+		if err != nil {
+			return fail("%v", err)
+		}
+		opts.Viewport = vp
+	}
+
+	gcodeService := service.NewGCodeService()
+	profile, err := readProfile(gcodeService, *profilePath)
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	inA, err := input.OpenFile(fs.Arg(0))
+	if err != nil {
+		return fail("读取G-code文件A失败: %v", err)
+	}
+	defer inA.Close()
+	inB, err := input.OpenFile(fs.Arg(1))
+	if err != nil {
+		return fail("读取G-code文件B失败: %v", err)
+	}
+	defer inB.Close()
+
+	buf := new(bytes.Buffer)
+	stats, err := gcodeService.RenderOverlayPNG(buf, inA, inB, profile, profile, opts)
+	if err != nil {
+		return fail("%v", err)
+	}
+	if err := os.WriteFile(*output, buf.Bytes(), 0644); err != nil {
+		return fail("写入输出文件失败: %v", err)
+	}
+
+	fmt.Printf("已生成 %s: 共有 %d px, 仅A %d px, 仅B %d px\n",
+		*output, stats.CommonPixels, stats.OnlyAPixels, stats.OnlyBPixels)
+	return 0
+}
@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"ok/input"
+	"ok/render"
+	"ok/service"
+	"os"
+	"strings"
+)
+
+func init() {
+	commands["render"] = command{usage: "将G-code渲染为SVG图片", run: runRender}
+}
+
+// runRender 执行 render 子命令
+func runRender(args []string) int {
+	fs := flag.NewFlagSet("render", flag.ContinueOnError)
+	output := fs.String("o", "", "输出文件，默认输出到标准输出")
+	width := fs.Int("width", 800, "图片宽度(px)")
+	viewport := fs.String("viewport", "", "显示区域 minX,minY,maxX,maxY(mm)")
+	zoom := fs.Float64("zoom", 1, "缩放倍数")
+	layers := fs.String("layers", strings.Join(render.DefaultLayers, ","), "显示的图层: rapids,cuts,arcs,power,holes")
+	profilePath := fs.String("profile", "", "机器配置JSON文件，按其中的刀具直径计算刀具半径补偿")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: gcodelens render [参数] <G-code文件>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	opts := render.Options{Width: *width, Zoom: *zoom, Layers: strings.Split(*layers, ",")}
+	if *viewport != "" {
+		vp, err := render.ParseViewport(*viewport)
+		if err != nil {
+			return fail("%v", err)
+		}
+		opts.Viewport = vp
+	}
+
+	gcodeService := service.NewGCodeService()
+	profile, err := readProfile(gcodeService, *profilePath)
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	in, err := input.OpenFile(fs.Arg(0))
+	if err != nil {
+		return fail("打开G-code文件失败: %v", err)
+	}
+	defer in.Close()
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return fail("创建输出文件失败: %v", err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	if err := gcodeService.RenderSVG(out, in, profile, opts); err != nil {
+		return fail("渲染失败: %v", err)
+	}
+	return 0
+}
@@ -0,0 +1,110 @@
+package cli
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"ok/export"
+	"ok/input"
+	"ok/service"
+	"os"
+)
+
+func init() {
+	commands["report"] = command{usage: "比较两个版本并导出对比报告", run: runReport}
+}
+
+// runReport 执行 report 子命令
+func runReport(args []string) int {
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	output := fs.String("o", "", "输出文件，- 表示标准输出 (默认 report.<扩展名>)")
+	format := fs.String("format", "html", "报告格式: html、csv(所有表格的zip压缩包)、xlsx、markdown、diff")
+	diffContext := fs.Int("context", export.DefaultContext, "diff格式的上下文行数")
+	profilePath := fs.String("profile", "", "机器配置JSON文件")
+	canonical := fs.Bool("canonical", false, "比较前先规范化G-code，忽略格式上的差异")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: gcodelens report [参数] <G-code A> <Manifest A> <G-code B> <Manifest B>")
+		fmt.Fprintln(fs.Output(), "  或: gcodelens report [参数] <压缩包 A> <压缩包 B>")
+		fmt.Fprintln(fs.Output(), "压缩包为包含G-code和manifest的zip文件，G-code和manifest也可以用gzip/zstd压缩")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 && fs.NArg() != 4 {
+		fs.Usage()
+		return 2
+	}
+
+	gcodeService := service.NewGCodeService()
+	stored, err := compareFiles(gcodeService, fs.Args(), *profilePath, *canonical)
+	if err != nil {
+		return fail("%v", err)
+	}
+	defer stored.Close()
+
+	buf := new(bytes.Buffer)
+	var ext string
+	switch *format {
+	case "html":
+		ext = "html"
+		err = gcodeService.ExportHTML(buf, stored)
+	case "csv":
+		ext = "csv.zip"
+		err = gcodeService.ExportCSV(buf, stored, "")
+	case "xlsx":
+		ext = "xlsx"
+		err = gcodeService.ExportXLSX(buf, stored)
+	case "markdown", "md":
+		ext = "md"
+		err = gcodeService.ExportMarkdown(buf, stored)
+	case "diff":
+		ext = "diff"
+		err = gcodeService.ExportUnifiedDiff(buf, stored, *diffContext)
+	default:
+		return fail("不支持的报告格式: %s", *format)
+	}
+	if err != nil {
+		return fail("导出报告失败: %v", err)
+	}
+
+	if *output == "-" {
+		if _, err := os.Stdout.Write(buf.Bytes()); err != nil {
+			return fail("输出失败: %v", err)
+		}
+		return 0
+	}
+	if *output == "" {
+		*output = "report." + ext
+	}
+	if err := os.WriteFile(*output, buf.Bytes(), 0644); err != nil {
+		return fail("写入输出文件失败: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "已生成 %s\n", *output)
+	return 0
+}
+
+// compareFiles 比较命令行指定的两个版本
+// paths 为 G-code A、Manifest A、G-code B、Manifest B 四个文件，或两个zip压缩包
+func compareFiles(gcodeService *service.GCodeService, paths []string, profilePath string, canonical bool) (*service.StoredResult, error) {
+	var versions [2]*input.Bundle
+	for i := range versions {
+		gcodePath, manifestPath := paths[i], ""
+		if len(paths) == 4 {
+			gcodePath, manifestPath = paths[2*i], paths[2*i+1]
+		}
+		v, err := loadVersion(gcodePath, manifestPath)
+		if err == nil && v.Manifest == nil {
+			v.Close()
+			err = fmt.Errorf("%s 中没有找到manifest", gcodePath)
+		}
+		if err != nil {
+			if i > 0 {
+				versions[0].Close()
+			}
+			return nil, err
+		}
+		versions[i] = v
+	}
+	return compareVersions(gcodeService, versions[0], versions[1], profilePath, canonical)
+}
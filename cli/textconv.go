@@ -0,0 +1,52 @@
+package cli
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"ok/input"
+	"ok/service"
+	"os"
+	"path/filepath"
+)
+
+func init() {
+	commands["textconv"] = command{usage: "输出规范化的G-code列表，用作 git diff 的 textconv", run: runTextconv}
+}
+
+// runTextconv 执行 textconv 子命令
+func runTextconv(args []string) int {
+	fs := flag.NewFlagSet("textconv", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: gcodelens textconv <G-code文件>")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "配置 git diff 显示规范化的G-code:")
+		fmt.Fprintln(fs.Output(), "  echo '*.nc diff=gcode' >> .gitattributes")
+		fmt.Fprintln(fs.Output(), "  echo '*.gcode diff=gcode' >> .gitattributes")
+		fmt.Fprintln(fs.Output(), "  git config diff.gcode.textconv 'gcodelens textconv'")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	in, err := input.OpenFile(fs.Arg(0))
+	if err != nil {
+		return fail("打开G-code文件失败: %v", err)
+	}
+	defer in.Close()
+
+	out := bufio.NewWriter(os.Stdout)
+	gcodeService := service.NewGCodeService()
+	if err := gcodeService.ExportListing(out, in, filepath.Base(fs.Arg(0))); err != nil {
+		return fail("生成列表失败: %v", err)
+	}
+	if err := out.Flush(); err != nil {
+		return fail("输出失败: %v", err)
+	}
+	return 0
+}
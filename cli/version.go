@@ -0,0 +1,92 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"ok/gcode"
+	"ok/input"
+	"ok/service"
+	"os"
+	"path/filepath"
+)
+
+// loadVersion 读取一个版本的文件，gzip/zstd压缩的文件会被自动解压
+// gcodePath 为zip压缩包时从中查找G-code和manifest，为 .bgcode 时使用其中的元数据作为manifest，
+// manifestPath 不为空时优先使用；没有manifest时 Manifest 为空。
+// 较大的G-code转存到临时文件，使用完后需要调用 Close
+func loadVersion(gcodePath, manifestPath string) (*input.Bundle, error) {
+	f, err := os.Open(gcodePath)
+	if err != nil {
+		return nil, fmt.Errorf("读取文件失败: %v", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("读取文件失败: %v", err)
+	}
+	v, err := input.Load(f, info.Size(), filepath.Base(gcodePath))
+	if err != nil {
+		return nil, fmt.Errorf("读取 %s 失败: %v", gcodePath, err)
+	}
+
+	if manifestPath != "" {
+		data, err := os.ReadFile(manifestPath)
+		if err != nil {
+			v.Close()
+			return nil, fmt.Errorf("读取文件失败: %v", err)
+		}
+		if v.Manifest, err = input.ReadAll(bytes.NewReader(data)); err != nil {
+			v.Close()
+			return nil, fmt.Errorf("读取 %s 失败: %v", manifestPath, err)
+		}
+		v.ManifestName = manifestPath
+	}
+	return v, nil
+}
+
+// compareVersions 比较两个版本，canonical 为true时比较前先规范化G-code
+// 两个版本的G-code内容交由返回的结果持有，使用完后调用结果的 Close 释放
+func compareVersions(gcodeService *service.GCodeService, a, b *input.Bundle, profilePath string, canonical bool) (*service.StoredResult, error) {
+	profile, err := readOptional(profilePath)
+	if err != nil {
+		a.Close()
+		b.Close()
+		return nil, fmt.Errorf("读取机器配置失败: %v", err)
+	}
+
+	gcodeA, gcodeB := a.GCode, b.GCode
+	if canonical {
+		// 按各版本的机器配置规范化，与比较时解释G-code的方言一致
+		profileA, err := gcodeService.LoadMachineProfile(a.Manifest, profile)
+		if err != nil {
+			a.Close()
+			b.Close()
+			return nil, fmt.Errorf("G-code文件A: %v", err)
+		}
+		profileB, err := gcodeService.LoadMachineProfile(b.Manifest, profile)
+		if err != nil {
+			a.Close()
+			b.Close()
+			return nil, fmt.Errorf("G-code文件B: %v", err)
+		}
+		opts := gcode.DefaultCanonicalOptions()
+		if gcodeA, err = gcodeService.CanonicalizeContent(gcodeA, profileA, opts); err != nil {
+			gcodeB.Close()
+			return nil, fmt.Errorf("G-code文件A: %v", err)
+		}
+		if gcodeB, err = gcodeService.CanonicalizeContent(gcodeB, profileB, opts); err != nil {
+			gcodeA.Close()
+			return nil, fmt.Errorf("G-code文件B: %v", err)
+		}
+	}
+
+	result, err := gcodeService.CompareVersions(gcodeA, a.Manifest, gcodeB, b.Manifest, profile)
+	if err != nil {
+		return nil, err
+	}
+	result.File1Name = a.DisplayName()
+	result.File2Name = b.DisplayName()
+
+	stored, _ := gcodeService.GetResult(result.ID)
+	return stored, nil
+}
@@ -1,21 +1,35 @@
 package config
 
-import "os"
+import (
+	"os"
+	"strconv"
+)
 
 type Config struct {
-	ServerPort string
-	Timeout    int
-	BasePort   string
+	ServerPort          string
+	Timeout             int
+	BasePort            string
+	MaxDecompressedSize int64 // 上传文件每一层解压后的最大大小(字节)，0 表示不限制
 }
 
 func GetConfig() *Config {
 	return &Config{
-		ServerPort: getEnv("SERVER_PORT", ":8200"),
-		Timeout:    3,
-		BasePort:   getEnv("BASE_PORT", "8080"),
+		ServerPort:          getEnv("SERVER_PORT", ":8200"),
+		Timeout:             3,
+		BasePort:            getEnv("BASE_PORT", "8080"),
+		MaxDecompressedSize: getEnvInt64("MAX_DECOMPRESSED_SIZE", 16<<30),
 	}
 }
 
+func getEnvInt64(key string, defaultValue int64) int64 {
+	if value, exists := os.LookupEnv(key); exists {
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return n
+		}
+	}
+	return defaultValue
+}
+
 func getEnv(key, defaultValue string) string {
 	if value, exists := os.LookupEnv(key); exists {
 		return value
@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"ok/gcode"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CanonicalizeFile 将上传的G-code改写为规范形式
+// 参数: precision 小数位数，comments=keep 保留注释，trim_zeros=true 去掉小数末尾的0；可以同时上传机器配置 profile
+func (c *GCodeController) CanonicalizeFile(ctx *gin.Context) {
+	gcodeFile, err := ctx.FormFile("gcode")
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": "请上传G-code文件",
+		})
+		return
+	}
+
+	opts, err := parseCanonicalOptions(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// 机器配置是可选的，按其中的控制器方言解释和输出
+	profileContent, err := readOptionalFile(ctx, "profile")
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("读取机器配置失败: %v", err),
+		})
+		return
+	}
+	profile, err := c.gcodeService.LoadMachineProfile(nil, profileContent)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	f, err := openUpload(gcodeFile)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("打开G-code文件失败: %v", err),
+		})
+		return
+	}
+	defer f.Close()
+
+	buf := new(bytes.Buffer)
+	if err := c.gcodeService.Canonicalize(buf, f, profile, opts); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	ctx.Data(http.StatusOK, "text/plain; charset=utf-8", buf.Bytes())
+}
+
+// parseCanonicalOptions 解析规范化参数
+func parseCanonicalOptions(ctx *gin.Context) (gcode.CanonicalOptions, error) {
+	opts := gcode.DefaultCanonicalOptions()
+	if v := ctx.Query("precision"); v != "" {
+		precision, err := strconv.Atoi(v)
+		if err != nil || precision < 0 || precision > 10 {
+			return opts, fmt.Errorf("precision参数必须是0到10之间的整数")
+		}
+		opts.Precision = precision
+	}
+	opts.KeepComments = ctx.Query("comments") == "keep"
+	opts.TrimZeros = ctx.Query("trim_zeros") == "1" || ctx.Query("trim_zeros") == "true"
+	return opts, nil
+}
@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"ok/export"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExportResult 导出保存的比较结果
+// format: html(默认)、csv、xlsx、markdown、diff
+// format=diff 时可通过context参数指定上下文行数
+// format=csv 时默认导出所有表格的zip压缩包，table参数可指定单个表格
+func (c *GCodeController) ExportResult(ctx *gin.Context) {
+	stored, ok := c.gcodeService.GetResult(ctx.Param("id"))
+	if !ok {
+		ctx.JSON(http.StatusNotFound, gin.H{
+			"error": "比较结果不存在或已过期",
+		})
+		return
+	}
+
+	format := ctx.DefaultQuery("format", "html")
+	buf := new(bytes.Buffer)
+	var contentType, ext string
+	var err error
+	switch format {
+	case "html":
+		contentType, ext = "text/html; charset=utf-8", "html"
+		err = c.gcodeService.ExportHTML(buf, stored)
+	case "csv":
+		table := ctx.Query("table")
+		if table == "" {
+			contentType, ext = "application/zip", "csv.zip"
+		} else {
+			if _, ok := export.FindTable(export.Tables(stored.Result), table); !ok {
+				ctx.JSON(http.StatusBadRequest, gin.H{
+					"error": fmt.Sprintf("未知的表格: %s", table),
+				})
+				return
+			}
+			contentType, ext = "text/csv; charset=utf-8", table+".csv"
+		}
+		err = c.gcodeService.ExportCSV(buf, stored, table)
+	case "markdown", "md":
+		contentType, ext = "text/markdown; charset=utf-8", "md"
+		err = c.gcodeService.ExportMarkdown(buf, stored)
+	case "diff":
+		diffContext := export.DefaultContext
+		if v := ctx.Query("context"); v != "" {
+			if diffContext, err = strconv.Atoi(v); err != nil || diffContext < 0 {
+				ctx.JSON(http.StatusBadRequest, gin.H{
+					"error": "context参数必须是非负整数",
+				})
+				return
+			}
+		}
+		contentType, ext = "text/x-diff; charset=utf-8", "diff"
+		err = c.gcodeService.ExportUnifiedDiff(buf, stored, diffContext)
+	case "xlsx":
+		contentType, ext = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "xlsx"
+		err = c.gcodeService.ExportXLSX(buf, stored)
+	default:
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("不支持的导出格式: %s", format),
+		})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("导出失败: %v", err),
+		})
+		return
+	}
+
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="gcodelens-%s.%s"`, stored.Result.ID, ext))
+	ctx.Data(http.StatusOK, contentType, buf.Bytes())
+}
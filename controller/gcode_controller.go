@@ -1,11 +1,11 @@
 package controller
 
 import (
-	"bytes"
 	"fmt"
-	"io"
 	"mime/multipart"
 	"net/http"
+	"ok/input"
+	"ok/lint"
 	"ok/service"
 
 	"github.com/gin-gonic/gin"
@@ -28,57 +28,87 @@ func (c *GCodeController) ShowGCodeCompare(ctx *gin.Context) {
 
 // CompareFiles 比较两个文件
 func (c *GCodeController) CompareFiles(ctx *gin.Context) {
-	// 获取版本A的文件
-	gcodeA, err1 := ctx.FormFile("gcodeA")
-	manifestA, err2 := ctx.FormFile("manifestA")
-	// 获取版本B的文件
-	gcodeB, err3 := ctx.FormFile("gcodeB")
-	manifestB, err4 := ctx.FormFile("manifestB")
-
-	if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+	// 机器配置是可选的
+	profileContent, err := readOptionalFile(ctx, "profile")
+	if err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{
-			"error": "请确保上传了所有需要的文件",
+			"error": fmt.Sprintf("读取机器配置失败: %v", err),
 		})
 		return
 	}
 
-	// 读取文件内容
-	gcodeContentA, err1 := readFileContent(gcodeA)
-	if err1 != nil {
+	// 可选：比较前先规范化G-code，忽略格式上的差异
+	canonical := ctx.Query("canonical") == "1" || ctx.Query("canonical") == "true"
+	opts, err := parseCanonicalOptions(ctx)
+	if canonical && err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{
-			"error": fmt.Sprintf("读取G-code文件A失败: %v", err1),
+			"error": err.Error(),
 		})
 		return
 	}
 
-	manifestContentA, err2 := readFileContent(manifestA)
-	if err2 != nil {
+	// 读取两个版本的文件，每个版本可以分别上传G-code和manifest，
+	// 也可以上传一个同时包含两者的zip压缩包，gzip/zstd压缩的文件会被自动解压，
+	// 较大的G-code会转存到临时文件中，分析时流式读取
+	versionA, err := readVersion(ctx, "A")
+	if err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{
-			"error": fmt.Sprintf("读取Manifest文件A失败: %v", err2),
+			"error": err.Error(),
 		})
 		return
 	}
-
-	gcodeContentB, err3 := readFileContent(gcodeB)
-	if err3 != nil {
+	versionB, err := readVersion(ctx, "B")
+	if err != nil {
+		versionA.Close()
 		ctx.JSON(http.StatusBadRequest, gin.H{
-			"error": fmt.Sprintf("读取G-code文件B失败: %v", err3),
+			"error": err.Error(),
 		})
 		return
 	}
-
-	manifestContentB, err4 := readFileContent(manifestB)
-	if err4 != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{
-			"error": fmt.Sprintf("读取Manifest文件B失败: %v", err4),
-		})
-		return
+	gcodeContentA, manifestContentA := versionA.GCode, versionA.Manifest
+	gcodeContentB, manifestContentB := versionB.GCode, versionB.Manifest
+
+	if canonical {
+		// 按各版本的机器配置规范化，与比较时解释G-code的方言一致
+		profileA, err := c.gcodeService.LoadMachineProfile(manifestContentA, profileContent)
+		if err != nil {
+			versionA.Close()
+			versionB.Close()
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("G-code文件A: %v", err),
+			})
+			return
+		}
+		profileB, err := c.gcodeService.LoadMachineProfile(manifestContentB, profileContent)
+		if err != nil {
+			versionA.Close()
+			versionB.Close()
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("G-code文件B: %v", err),
+			})
+			return
+		}
+		if gcodeContentA, err = c.gcodeService.CanonicalizeContent(gcodeContentA, profileA, opts); err != nil {
+			gcodeContentB.Close()
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("G-code文件A: %v", err),
+			})
+			return
+		}
+		if gcodeContentB, err = c.gcodeService.CanonicalizeContent(gcodeContentB, profileB, opts); err != nil {
+			gcodeContentA.Close()
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("G-code文件B: %v", err),
+			})
+			return
+		}
 	}
 
-	// 比较两个版本的文件
+	// 比较两个版本的文件，G-code内容由保存的结果持有
 	result, err := c.gcodeService.CompareVersions(
 		gcodeContentA, manifestContentA,
 		gcodeContentB, manifestContentB,
+		profileContent,
 	)
 
 	if err != nil {
@@ -89,13 +119,105 @@ func (c *GCodeController) CompareFiles(ctx *gin.Context) {
 	}
 
 	// 设置文件名
-	result.File1Name = fmt.Sprintf("%s / %s", gcodeA.Filename, manifestA.Filename)
-	result.File2Name = fmt.Sprintf("%s / %s", gcodeB.Filename, manifestB.Filename)
+	result.File1Name = versionA.DisplayName()
+	result.File2Name = versionB.DisplayName()
 
 	// 返回结果
 	ctx.JSON(http.StatusOK, result)
 }
 
+// LintFile 检查G-code文件
+func (c *GCodeController) LintFile(ctx *gin.Context) {
+	gcodeFile, err := ctx.FormFile("gcode")
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": "请上传G-code文件",
+		})
+		return
+	}
+
+	// manifest、机器配置和检查配置都是可选的
+	manifestContent, err := readOptionalFile(ctx, "manifest")
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("读取Manifest文件失败: %v", err),
+		})
+		return
+	}
+	profileContent, err := readOptionalFile(ctx, "profile")
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("读取机器配置失败: %v", err),
+		})
+		return
+	}
+	configContent, err := readOptionalFile(ctx, "config")
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("读取检查配置失败: %v", err),
+		})
+		return
+	}
+
+	profile, err := c.gcodeService.LoadMachineProfile(manifestContent, profileContent)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	cfg, err := lint.ParseConfig(configContent)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	f, err := openUpload(gcodeFile)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("打开G-code文件失败: %v", err),
+		})
+		return
+	}
+	defer f.Close()
+
+	report, err := c.gcodeService.Lint(gcodeFile.Filename, f, profile, cfg)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("检查文件失败: %v", err),
+		})
+		return
+	}
+
+	if ctx.Query("format") == "sarif" {
+		data, err := lint.ToSARIF(report)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": fmt.Sprintf("生成SARIF失败: %v", err),
+			})
+			return
+		}
+		ctx.Data(http.StatusOK, "application/sarif+json", data)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, report)
+}
+
+// readOptionalFile 读取可选的上传文件，未上传时返回nil
+func readOptionalFile(ctx *gin.Context, field string) ([]byte, error) {
+	file, err := ctx.FormFile(field)
+	if err != nil {
+		if err == http.ErrMissingFile {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return readFileContent(file)
+}
+
 // readFileContent 读取文件内容
 func readFileContent(file *multipart.FileHeader) ([]byte, error) {
 	f, err := file.Open()
@@ -104,10 +226,11 @@ func readFileContent(file *multipart.FileHeader) ([]byte, error) {
 	}
 	defer f.Close()
 
-	buf := new(bytes.Buffer)
-	if _, err := io.Copy(buf, f); err != nil {
+	// 压缩的文件自动解压
+	data, err := input.ReadAll(f)
+	if err != nil {
 		return nil, fmt.Errorf("读取文件内容失败: %v", err)
 	}
 
-	return buf.Bytes(), nil
+	return data, nil
 } 
\ No newline at end of file
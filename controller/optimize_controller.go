@@ -0,0 +1,60 @@
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OptimizeResult 将保存的比较结果中指定版本的G-code按最短空行程重新排列切割顺序后下载
+func (c *GCodeController) OptimizeResult(ctx *gin.Context) {
+	stored, ok := c.gcodeService.GetResult(ctx.Param("id"))
+	if !ok {
+		ctx.JSON(http.StatusNotFound, gin.H{
+			"error": "比较结果不存在或已过期",
+		})
+		return
+	}
+	version := ctx.Param("version")
+	content, ok := stored.GCode(version)
+	if !ok {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": "版本参数只能是 a 或 b",
+		})
+		return
+	}
+
+	rapid := 6000.0
+	if v := ctx.Query("rapid"); v != "" {
+		value, err := strconv.ParseFloat(v, 64)
+		if err != nil || value <= 0 {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": "rapid参数必须是正数",
+			})
+			return
+		}
+		rapid = value
+	}
+
+	r, err := content.Open()
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{
+			"error": "比较结果不存在或已过期",
+		})
+		return
+	}
+	defer r.Close()
+
+	buf := new(bytes.Buffer)
+	if _, err := c.gcodeService.OptimizeTravel(buf, r, stored.Profile(version), rapid); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="gcodelens-%s-%s-optimized.nc"`, stored.Result.ID, version))
+	ctx.Data(http.StatusOK, "text/plain; charset=utf-8", buf.Bytes())
+}
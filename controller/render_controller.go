@@ -0,0 +1,201 @@
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"ok/render"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetResult 获取保存的比较结果
+func (c *GCodeController) GetResult(ctx *gin.Context) {
+	stored, ok := c.gcodeService.GetResult(ctx.Param("id"))
+	if !ok {
+		ctx.JSON(http.StatusNotFound, gin.H{
+			"error": "比较结果不存在或已过期",
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, stored.Result)
+}
+
+// RenderFile 将上传的G-code文件渲染为SVG
+func (c *GCodeController) RenderFile(ctx *gin.Context) {
+	opts, err := parseRenderOptions(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	gcodeFile, err := ctx.FormFile("gcode")
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": "请上传G-code文件",
+		})
+		return
+	}
+	f, err := openUpload(gcodeFile)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("打开G-code文件失败: %v", err),
+		})
+		return
+	}
+	defer f.Close()
+
+	buf := new(bytes.Buffer)
+	if err := c.gcodeService.RenderSVG(buf, f, nil, opts); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("渲染失败: %v", err),
+		})
+		return
+	}
+	ctx.Data(http.StatusOK, "image/svg+xml", buf.Bytes())
+}
+
+// RenderResult 将保存的比较结果中指定版本的G-code渲染为SVG
+func (c *GCodeController) RenderResult(ctx *gin.Context) {
+	stored, ok := c.gcodeService.GetResult(ctx.Param("id"))
+	if !ok {
+		ctx.JSON(http.StatusNotFound, gin.H{
+			"error": "比较结果不存在或已过期",
+		})
+		return
+	}
+	content, ok := stored.GCode(ctx.Param("version"))
+	if !ok {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": "版本参数只能是 a 或 b",
+		})
+		return
+	}
+
+	opts, err := parseRenderOptions(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	r, err := content.Open()
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{
+			"error": "比较结果不存在或已过期",
+		})
+		return
+	}
+	defer r.Close()
+
+	buf := new(bytes.Buffer)
+	if err := c.gcodeService.RenderSVG(buf, r, stored.Profile(ctx.Param("version")), opts); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("渲染失败: %v", err),
+		})
+		return
+	}
+	ctx.Data(http.StatusOK, "image/svg+xml", buf.Bytes())
+}
+
+// RenderOverlay 将保存的比较结果中A、B两个版本叠加渲染为PNG
+func (c *GCodeController) RenderOverlay(ctx *gin.Context) {
+	stored, ok := c.gcodeService.GetResult(ctx.Param("id"))
+	if !ok {
+		ctx.JSON(http.StatusNotFound, gin.H{
+			"error": "比较结果不存在或已过期",
+		})
+		return
+	}
+
+	opts, err := parseOverlayOptions(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	_, err = c.gcodeService.RenderStoredOverlayPNG(buf, stored, opts)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("渲染失败: %v", err),
+		})
+		return
+	}
+	ctx.Data(http.StatusOK, "image/png", buf.Bytes())
+}
+
+// parseOverlayOptions 从查询参数解析叠加图参数
+// 除通用的 width/viewport/zoom 外，还支持 zoom_diff、line_width、tolerance、rapids
+func parseOverlayOptions(ctx *gin.Context) (render.OverlayOptions, error) {
+	opts := render.DefaultOverlayOptions()
+
+	base, err := parseRenderOptions(ctx)
+	if err != nil {
+		return opts, err
+	}
+	if ctx.Query("width") != "" {
+		opts.Width = base.Width
+	}
+	opts.Viewport = base.Viewport
+	opts.Zoom = base.Zoom
+	opts.ZoomToDiff = ctx.Query("zoom_diff") == "1" || ctx.Query("zoom_diff") == "true"
+	opts.IncludeRapids = ctx.Query("rapids") == "1" || ctx.Query("rapids") == "true"
+
+	if v := ctx.Query("line_width"); v != "" {
+		width, err := strconv.Atoi(v)
+		if err != nil || width <= 0 || width > 50 {
+			return opts, fmt.Errorf("线宽无效: %s", v)
+		}
+		opts.LineWidth = width
+	}
+	if v := ctx.Query("tolerance"); v != "" {
+		tolerance, err := strconv.Atoi(v)
+		if err != nil || tolerance < 0 || tolerance > 50 {
+			return opts, fmt.Errorf("容差无效: %s", v)
+		}
+		opts.Tolerance = tolerance
+	}
+
+	return opts, nil
+}
+
+// parseRenderOptions 从查询参数解析渲染参数
+// width: 图片宽度(px)；viewport: minX,minY,maxX,maxY(mm)；zoom: 缩放倍数，不超过 render.MaxZoom；layers: 逗号分隔的图层
+func parseRenderOptions(ctx *gin.Context) (render.Options, error) {
+	opts := render.DefaultOptions()
+
+	if v := ctx.Query("width"); v != "" {
+		width, err := strconv.Atoi(v)
+		if err != nil || width <= 0 || width > 10000 {
+			return opts, fmt.Errorf("图片宽度无效: %s", v)
+		}
+		opts.Width = width
+	}
+	if v := ctx.Query("viewport"); v != "" {
+		vp, err := render.ParseViewport(v)
+		if err != nil {
+			return opts, err
+		}
+		opts.Viewport = vp
+	}
+	if v := ctx.Query("zoom"); v != "" {
+		zoom, err := strconv.ParseFloat(v, 64)
+		if err != nil || zoom <= 0 || zoom > render.MaxZoom {
+			return opts, fmt.Errorf("缩放倍数无效: %s，范围为 0-%d", v, render.MaxZoom)
+		}
+		opts.Zoom = zoom
+	}
+	if v := ctx.Query("layers"); v != "" {
+		opts.Layers = strings.Split(v, ",")
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"ok/input"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readVersion 读取一个版本(A/B)上传的文件
+// 字段 archive<版本> 或 gcode<版本> 为zip压缩包时从中查找G-code和manifest，
+// 为 .bgcode 时使用其中的元数据作为manifest，同时上传的 manifest<版本> 优先；
+// 较大的G-code转存到临时文件，使用完后需要调用 Close
+func readVersion(ctx *gin.Context, version string) (*input.Bundle, error) {
+	file, err := ctx.FormFile("archive" + version)
+	if err == http.ErrMissingFile {
+		file, err = ctx.FormFile("gcode" + version)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("请上传G-code文件%s", version)
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("打开G-code文件%s失败: %v", version, err)
+	}
+	defer f.Close()
+
+	v, err := input.Load(f, file.Size, file.Filename)
+	if err != nil {
+		return nil, fmt.Errorf("读取G-code文件%s失败: %v", version, err)
+	}
+
+	manifest, err := ctx.FormFile("manifest" + version)
+	switch {
+	case err == nil:
+		if v.Manifest, err = readFileContent(manifest); err != nil {
+			v.Close()
+			return nil, fmt.Errorf("读取Manifest文件%s失败: %v", version, err)
+		}
+		v.ManifestName = manifest.Filename
+	case v.Manifest == nil:
+		v.Close()
+		return nil, fmt.Errorf("请上传Manifest文件%s", version)
+	}
+	return v, nil
+}
+
+// openUpload 打开上传的G-code文件，压缩文件会被透明解压，zip压缩包返回其中的G-code
+func openUpload(file *multipart.FileHeader) (io.ReadCloser, error) {
+	f, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	return input.OpenFrom(f, file.Size)
+}
@@ -0,0 +1,51 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"fmt"
+	"io"
+)
+
+// utf8BOM 写在CSV开头，使Excel能正确识别中文
+const utf8BOM = "\xEF\xBB\xBF"
+
+// CSV 将单个表格写为CSV
+func CSV(w io.Writer, t Table) error {
+	if _, err := io.WriteString(w, utf8BOM); err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(t.Header); err != nil {
+		return err
+	}
+	record := make([]string, len(t.Header))
+	for _, row := range t.Rows {
+		for i := range record {
+			record[i] = ""
+			if i < len(row) {
+				record[i] = cellText(row[i])
+			}
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// CSVZip 将多个表格分别写为CSV并打包为zip
+func CSVZip(w io.Writer, tables []Table) error {
+	zw := zip.NewWriter(w)
+	for _, t := range tables {
+		f, err := zw.Create(t.File + ".csv")
+		if err != nil {
+			return fmt.Errorf("创建 %s.csv 失败: %v", t.File, err)
+		}
+		if err := CSV(f, t); err != nil {
+			return fmt.Errorf("写入 %s.csv 失败: %v", t.File, err)
+		}
+	}
+	return zw.Close()
+}
@@ -0,0 +1,107 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"ok/model"
+	"ok/templates"
+	"time"
+)
+
+// maxReportHunks HTML报告中最多显示的差异组数量
+const maxReportHunks = 200
+
+// hunkGap 相邻变化归为同一组的最大行号间隔
+const hunkGap = 3
+
+// reportTemplate HTML报告模板
+var reportTemplate = template.Must(template.New("report.html").Funcs(template.FuncMap{
+	"value": formatParam,
+}).ParseFS(templates.FS, "report.html"))
+
+// Previews 报告中的路径预览图，均为 data URI
+type Previews struct {
+	A       template.URL // 版本A的SVG
+	B       template.URL // 版本B的SVG
+	Overlay template.URL // A/B叠加PNG
+}
+
+// reportData 报告模板数据
+type reportData struct {
+	Result          *model.CompareResult
+	GeneratedAt     time.Time
+	PreviewA        template.URL
+	PreviewB        template.URL
+	Overlay         template.URL
+	Metrics         []Metric
+	DifferentParams int
+	Hunks           []Hunk
+	HunksTruncated  bool
+	Notes           []string
+}
+
+// HTML 将比较结果渲染为独立的HTML报告，样式和图片均内嵌，可离线查看
+func HTML(w io.Writer, result *model.CompareResult, previews Previews) error {
+	data := reportData{
+		Result:          result,
+		GeneratedAt:     time.Now(),
+		PreviewA:        previews.A,
+		PreviewB:        previews.B,
+		Overlay:         previews.Overlay,
+		DifferentParams: countDifferentParams(result.ManifestDiff),
+	}
+
+	if result.GCodeDiff != nil {
+		data.Metrics = Metrics(result.GCodeDiff)
+		data.Hunks = Hunks(result.GCodeDiff.LineChanges, hunkGap)
+		if len(data.Hunks) > maxReportHunks {
+			data.Hunks = data.Hunks[:maxReportHunks]
+			data.HunksTruncated = true
+		}
+		for _, change := range result.GCodeDiff.LineChanges {
+			if change.Type == "info" {
+				data.Notes = append(data.Notes, change.Content)
+			}
+		}
+	}
+
+	if err := reportTemplate.Execute(w, data); err != nil {
+		return fmt.Errorf("生成HTML报告失败: %v", err)
+	}
+	return nil
+}
+
+// countDifferentParams 统计有差异的参数数量
+func countDifferentParams(diff *model.ManifestDiff) int {
+	if diff == nil {
+		return 0
+	}
+	count := 0
+	for _, module := range diff.Modules {
+		for _, param := range module.Parameters {
+			if param.Different {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// formatParam 格式化manifest参数值，复杂结构输出为JSON
+func formatParam(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return "-"
+	case string:
+		return value
+	case float64, bool, int:
+		return fmt.Sprint(value)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
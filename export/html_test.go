@@ -0,0 +1,78 @@
+package export
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"ok/model"
+)
+
+func TestHTML(t *testing.T) {
+	result := &model.CompareResult{
+		File1Name: "a<script>.nc",
+		File2Name: "b.nc",
+		GCodeDiff: &model.GCodeDiff{
+			Statistics: model.GCodeStatistics{TotalLines: 3, ChangedLines: 1},
+			LineChanges: []model.GCodeChange{
+				{LineNum: 2, Type: "change", Content: "G1 X5", OldContent: "G1 X1"},
+				{Type: "info", Content: "文件较大，只比较了前 1000 行"},
+			},
+		},
+		ManifestDiff: &model.ManifestDiff{Modules: []model.ModuleReport{{
+			Name:      "切割",
+			Different: true,
+			Parameters: []model.Parameter{
+				{Name: "power", Value1: 50.0, Value2: 60.0, Different: true},
+				{Name: "layers", Value1: []interface{}{1.0, 2.0}, Value2: nil},
+			},
+		}}},
+	}
+
+	var buf bytes.Buffer
+	if err := HTML(&buf, result, Previews{A: "data:image/png;base64,AAAA"}); err != nil {
+		t.Fatal(err)
+	}
+	html := buf.String()
+	tests := []struct {
+		name string
+		text string
+		want bool
+	}{
+		{"文件名转义", "a&lt;script&gt;.nc", true},
+		{"不输出未转义的文件名", "a<script>.nc", false},
+		{"差异组", "@@ 第 2-2 行 · 修改 1 · 新增 0 · 删除 0 @@", true},
+		{"原内容", "G1 X1", true},
+		{"提示信息", "文件较大，只比较了前 1000 行", true},
+		{"参数值", "<td class=\"code\">60</td>", true},
+		{"复杂参数输出为JSON", "[1,2]", true},
+		{"空参数", "<td class=\"code\">-</td>", true},
+		{"内嵌预览图", "data:image/png;base64,AAAA", true},
+		{"没有叠加图时不输出", "A/B叠加对比", false},
+		{"不引用外部资源", "src=\"http", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strings.Contains(html, tt.text); got != tt.want {
+				t.Errorf("报告中包含 %q = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetricFormatChange(t *testing.T) {
+	tests := []struct {
+		a, b float64
+		want string
+	}{
+		{100, 100, "-"},
+		{100, 150, "+50.0%"},
+		{100, 75, "-25.0%"},
+		{0, 10, "新增"},
+	}
+	for _, tt := range tests {
+		if got := (Metric{A: tt.a, B: tt.b}).FormatChange(); got != tt.want {
+			t.Errorf("FormatChange(%v, %v) = %q, want %q", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
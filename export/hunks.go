@@ -0,0 +1,46 @@
+package export
+
+import "ok/model"
+
+// Hunk 一组相邻的行变化
+type Hunk struct {
+	StartLine int                 // 起始行号
+	EndLine   int                 // 结束行号
+	Changes   []model.GCodeChange // 行变化
+	Added     int                 // 新增行数
+	Removed   int                 // 删除行数
+	Changed   int                 // 修改行数
+}
+
+// Size 变化行数
+func (h *Hunk) Size() int {
+	return len(h.Changes)
+}
+
+// Hunks 将行变化按行号分组，行号间隔不超过gap的变化归为同一组
+// 类型为 info 的提示信息不参与分组
+func Hunks(changes []model.GCodeChange, gap int) []Hunk {
+	var hunks []Hunk
+	for _, change := range changes {
+		if change.LineNum <= 0 {
+			continue
+		}
+		n := len(hunks)
+		if n == 0 || change.LineNum-hunks[n-1].EndLine > gap {
+			hunks = append(hunks, Hunk{StartLine: change.LineNum})
+			n++
+		}
+		h := &hunks[n-1]
+		h.EndLine = change.LineNum
+		h.Changes = append(h.Changes, change)
+		switch change.Type {
+		case "add":
+			h.Added++
+		case "remove":
+			h.Removed++
+		default:
+			h.Changed++
+		}
+	}
+	return hunks
+}
@@ -0,0 +1,75 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"ok/gcode"
+	"ok/utils"
+)
+
+// listingSummary 规范化列表的汇总信息
+type listingSummary struct {
+	Blocks      int
+	Elements    int
+	CutLength   float64
+	RapidLength float64
+}
+
+// Listing 输出规范化、带注释的G代码列表，用作 git textconv
+// 程序段经过规范化处理，每个连续加工的元素前加标记，并在开头输出汇总信息，
+// 使单位、坐标模式或写法不同但路径相同的文件输出一致，git diff 只显示实质变化
+func Listing(w io.Writer, r io.Reader, name string) error {
+	body := new(bytes.Buffer)
+	var summary listingSummary
+	inElement := false
+
+	canon := gcode.NewCanonicalizer(gcode.CanonicalOptions{
+		Precision:    gcode.DefaultPrecision,
+		TrimZeros:    true,
+		KeepComments: true,
+	})
+	interp := gcode.NewInterpreter()
+	err := gcode.Run(r, interp, func(b *gcode.Block, segments []gcode.Segment) error {
+		for i := range segments {
+			seg := &segments[i]
+			if seg.IsRapid() {
+				summary.RapidLength += seg.Length()
+				inElement = false
+				continue
+			}
+			summary.CutLength += seg.Length()
+			if !inElement {
+				summary.Elements++
+				// 不输出行号，避免插入或删除一行导致之后所有标记都变化
+				fmt.Fprintf(body, "; ==== 元素 %d ====\n", summary.Elements)
+				inElement = true
+			}
+		}
+		if !interp.State.SpindleOn {
+			inElement = false
+		}
+
+		line := canon.Format(b, segments, &interp.State)
+		if line == "" {
+			return nil
+		}
+		if !b.Empty() {
+			summary.Blocks++
+		}
+		body.WriteString(line)
+		body.WriteByte('\n')
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "; GcodeLens 规范化列表: %s\n", name)
+	fmt.Fprintln(w, "; 单位: mm  坐标: 绝对")
+	fmt.Fprintf(w, "; 程序段: %d  元素: %d  加工长度: %s  快速移动长度: %s\n",
+		summary.Blocks, summary.Elements, utils.FormatLength(summary.CutLength), utils.FormatLength(summary.RapidLength))
+	fmt.Fprintln(w)
+	_, err = body.WriteTo(w)
+	return err
+}
@@ -0,0 +1,53 @@
+package export
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func listing(t *testing.T, src string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Listing(&buf, strings.NewReader(src), "part.nc"); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestListingEquivalent(t *testing.T) {
+	base := "G21 G90\nG0 X10 Y0\nM3 S500\nG1 X20 Y0 F600\nG1 X20 Y10\nM5\n"
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{"相对坐标", "G21 G91\nG0 X10 Y0\nM3 S500\nG1 X10 Y0 F600\nG1 X0 Y10\nM5\n"},
+		{"英制", "G20 G90\nG0 X0.3937008 Y0\nM3 S500\nG1 X0.7874016 Y0 F23.6220472\nG1 X0.7874016 Y0.3937008\nM5\n"},
+		{"行号和小写", "n10 g21 g90\nn20 g0 x10 y0\nn30 m3 s500\nn40 g1 x20 y0 f600\nn50 x20 y10\nn60 m5\n"},
+		{"省略的坐标", "G21 G90\nG0 X10 Y0\nM3 S500\nG1 X20 F600\nY10\nM5\n"},
+	}
+	want := listing(t, base)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := listing(t, tt.src); got != want {
+				t.Errorf("Listing =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestListing(t *testing.T) {
+	src := "G0 X0 Y0\nM3 S500\nG1 X10 F600 ; 第一段\nM5\nG0 X20\nM3 S500\nG1 X30\nG1 X40\nM5\n"
+	// 快速移动之间连续的加工为一个元素，标记不带行号
+	want := "; GcodeLens 规范化列表: part.nc\n" +
+		"; 单位: mm  坐标: 绝对\n" +
+		"; 程序段: 9  元素: 2  加工长度: 30.00 mm  快速移动长度: 10.00 mm\n" +
+		"\n" +
+		"G0 X0 Y0\nS500 M3\n" +
+		"; ==== 元素 1 ====\nG1 X10 Y0 F600 ; 第一段\nM5\n" +
+		"G0 X20 Y0\nM3\n" +
+		"; ==== 元素 2 ====\nG1 X30 Y0\nG1 X40 Y0\nM5\n"
+	if got := listing(t, src); got != want {
+		t.Errorf("Listing =\n%s\nwant\n%s", got, want)
+	}
+}
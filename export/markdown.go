@@ -0,0 +1,106 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"ok/model"
+	"ok/templates"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// maxMarkdownHunks Markdown摘要中最多显示的差异组数量
+const maxMarkdownHunks = 10
+
+// markdownTemplate Markdown摘要模板
+var markdownTemplate = template.Must(template.New("report.md").Funcs(template.FuncMap{
+	"cell":  markdownCell,
+	"value": func(v interface{}) string { return markdownCode(formatParam(v)) },
+}).ParseFS(templates.FS, "report.md"))
+
+// changedParam 有差异的manifest参数
+type changedParam struct {
+	Module string
+	model.Parameter
+}
+
+// markdownData Markdown模板数据
+type markdownData struct {
+	Result          *model.CompareResult
+	Metrics         []Metric
+	DifferentParams int
+	Params          []changedParam
+	Hunks           []Hunk
+	TotalHunks      int
+	HunksTruncated  bool
+	Notes           []string
+}
+
+// Markdown 将比较结果输出为Markdown摘要，适合粘贴到合并请求中
+// 包含统计对比表、有变化的manifest参数和变化最多的几组G-code差异
+func Markdown(w io.Writer, result *model.CompareResult) error {
+	data := markdownData{
+		Result:          result,
+		DifferentParams: countDifferentParams(result.ManifestDiff),
+	}
+
+	if result.ManifestDiff != nil {
+		for _, module := range result.ManifestDiff.Modules {
+			for _, param := range module.Parameters {
+				if param.Different {
+					data.Params = append(data.Params, changedParam{Module: module.Name, Parameter: param})
+				}
+			}
+		}
+	}
+
+	if result.GCodeDiff != nil {
+		data.Metrics = Metrics(result.GCodeDiff)
+		hunks := Hunks(result.GCodeDiff.LineChanges, hunkGap)
+		data.Hunks = topHunks(hunks, maxMarkdownHunks)
+		data.TotalHunks = len(hunks)
+		data.HunksTruncated = data.TotalHunks > len(data.Hunks)
+		for _, change := range result.GCodeDiff.LineChanges {
+			if change.Type == "info" {
+				data.Notes = append(data.Notes, change.Content)
+			}
+		}
+	}
+
+	if err := markdownTemplate.Execute(w, data); err != nil {
+		return fmt.Errorf("生成Markdown摘要失败: %v", err)
+	}
+	return nil
+}
+
+// topHunks 取变化行数最多的n组，并按行号排序
+func topHunks(hunks []Hunk, n int) []Hunk {
+	if len(hunks) <= n {
+		return hunks
+	}
+	top := make([]Hunk, len(hunks))
+	copy(top, hunks)
+	sort.SliceStable(top, func(i, j int) bool { return top[i].Size() > top[j].Size() })
+	top = top[:n]
+	sort.Slice(top, func(i, j int) bool { return top[i].StartLine < top[j].StartLine })
+	return top
+}
+
+// markdownCell 转义表格单元格中的特殊字符
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.NewReplacer("\r\n", " ", "\n", " ").Replace(s)
+}
+
+// markdownCode 将值格式化为表格中的行内代码
+func markdownCode(s string) string {
+	s = markdownCell(s)
+	if s == "" || s == "-" {
+		return s
+	}
+	if strings.Contains(s, "`") {
+		return "`` " + s + " ``"
+	}
+	return "`" + s + "`"
+}
@@ -0,0 +1,134 @@
+package export
+
+import (
+	"fmt"
+	"ok/model"
+	"ok/utils"
+	"strconv"
+)
+
+// 指标单位
+const (
+	UnitCount    = ""
+	UnitLength   = "mm"
+	UnitArea     = "mm²"
+	UnitSpeed    = "mm/min"
+	UnitDuration = "s"
+)
+
+// Metric A/B两个版本的对比指标
+type Metric struct {
+	Key  string  // 英文键名，用于CSV等机器可读格式
+	Name string  // 显示名称
+	Unit string  // 单位
+	A, B float64 // 两个版本的值
+}
+
+// Change 变化率(%)，A为0时返回0
+func (m Metric) Change() float64 {
+	if m.A == 0 {
+		return 0
+	}
+	return (m.B - m.A) / m.A * 100
+}
+
+// Changed 两个版本的值是否不同
+func (m Metric) Changed() bool {
+	return m.A != m.B
+}
+
+// FormatA 格式化A版本的值
+func (m Metric) FormatA() string { return formatValue(m.A, m.Unit) }
+
+// FormatB 格式化B版本的值
+func (m Metric) FormatB() string { return formatValue(m.B, m.Unit) }
+
+// FormatChange 格式化变化率
+func (m Metric) FormatChange() string {
+	if !m.Changed() {
+		return "-"
+	}
+	if m.A == 0 {
+		return "新增"
+	}
+	return fmt.Sprintf("%+.1f%%", m.Change())
+}
+
+// formatValue 按单位格式化数值
+func formatValue(v float64, unit string) string {
+	switch unit {
+	case UnitLength:
+		return utils.FormatLength(v)
+	case UnitArea:
+		return utils.FormatArea(v)
+	case UnitSpeed:
+		return utils.FormatSpeed(v)
+	case UnitDuration:
+		return utils.FormatDuration(v)
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// Metrics 从G-code差异中提取对比指标
+func Metrics(diff *model.GCodeDiff) []Metric {
+	if diff == nil {
+		return nil
+	}
+	a, b := &diff.AnalysisA, &diff.AnalysisB
+	return []Metric{
+		{"g0_count", "快速移动(G0)", UnitCount, float64(a.Commands.G0Count), float64(b.Commands.G0Count)},
+		{"g1_count", "直线加工(G1)", UnitCount, float64(a.Commands.G1Count), float64(b.Commands.G1Count)},
+		{"g2_count", "顺时针圆弧(G2)", UnitCount, float64(a.Commands.G2Count), float64(b.Commands.G2Count)},
+		{"g3_count", "逆时针圆弧(G3)", UnitCount, float64(a.Commands.G3Count), float64(b.Commands.G3Count)},
+		{"total_length", "总路径长度", UnitLength, a.Path.TotalLength, b.Path.TotalLength},
+		{"working_length", "加工长度", UnitLength, a.Path.WorkingLength, b.Path.WorkingLength},
+		{"rapid_length", "快速移动长度", UnitLength, a.Path.RapidLength, b.Path.RapidLength},
+		{"area_width", "加工区域宽度", UnitLength, a.Path.Area.Width, b.Path.Area.Width},
+		{"area_height", "加工区域高度", UnitLength, a.Path.Area.Height, b.Path.Area.Height},
+		{"area_size", "加工区域面积", UnitArea, a.Path.Area.Size, b.Path.Area.Size},
+		{"max_speed", "最大速度", UnitSpeed, a.Speed.MaxSpeed, b.Speed.MaxSpeed},
+		{"min_speed", "最小速度", UnitSpeed, a.Speed.MinSpeed, b.Speed.MinSpeed},
+		{"avg_speed", "平均速度", UnitSpeed, a.Speed.AvgSpeed, b.Speed.AvgSpeed},
+		{"total_time", "总加工时间", UnitDuration, a.Time.TotalTime, b.Time.TotalTime},
+		{"working_time", "加工时间", UnitDuration, a.Time.WorkingTime, b.Time.WorkingTime},
+		{"rapid_time", "快速移动时间", UnitDuration, a.Time.RapidTime, b.Time.RapidTime},
+		{"accel_time", "加减速时间", UnitDuration, a.Time.AccelTime, b.Time.AccelTime},
+		{"dwell_time", "孔底暂停时间", UnitDuration, a.Time.DwellTime, b.Time.DwellTime},
+		{"envelope_x_min", "包络 X 最小值", UnitLength, a.Envelope.Work.X.Min, b.Envelope.Work.X.Min},
+		{"envelope_x_max", "包络 X 最大值", UnitLength, a.Envelope.Work.X.Max, b.Envelope.Work.X.Max},
+		{"envelope_y_min", "包络 Y 最小值", UnitLength, a.Envelope.Work.Y.Min, b.Envelope.Work.Y.Min},
+		{"envelope_y_max", "包络 Y 最大值", UnitLength, a.Envelope.Work.Y.Max, b.Envelope.Work.Y.Max},
+		{"envelope_z_min", "包络 Z 最小值", UnitLength, a.Envelope.Work.Z.Min, b.Envelope.Work.Z.Min},
+		{"envelope_z_max", "包络 Z 最大值", UnitLength, a.Envelope.Work.Z.Max, b.Envelope.Work.Z.Max},
+		{"machine_x_min", "机床坐标 X 最小值", UnitLength, a.Envelope.Machine.X.Min, b.Envelope.Machine.X.Min},
+		{"machine_x_max", "机床坐标 X 最大值", UnitLength, a.Envelope.Machine.X.Max, b.Envelope.Machine.X.Max},
+		{"machine_y_min", "机床坐标 Y 最小值", UnitLength, a.Envelope.Machine.Y.Min, b.Envelope.Machine.Y.Min},
+		{"machine_y_max", "机床坐标 Y 最大值", UnitLength, a.Envelope.Machine.Y.Max, b.Envelope.Machine.Y.Max},
+		{"machine_z_min", "机床坐标 Z 最小值", UnitLength, a.Envelope.Machine.Z.Min, b.Envelope.Machine.Z.Min},
+		{"machine_z_max", "机床坐标 Z 最大值", UnitLength, a.Envelope.Machine.Z.Max, b.Envelope.Machine.Z.Max},
+		{"limit_violations", "超出行程的移动", UnitCount, float64(a.Envelope.ViolationCount), float64(b.Envelope.ViolationCount)},
+		{"tools_used", "使用刀具数", UnitCount, float64(len(a.Tooling.Tools)), float64(len(b.Tooling.Tools))},
+		{"tool_changes", "换刀次数", UnitCount, float64(a.Tooling.ToolChanges), float64(b.Tooling.ToolChanges)},
+		{"spindle_min", "最低主轴转速", UnitCount, a.Tooling.Spindle.Range.Min, b.Tooling.Spindle.Range.Min},
+		{"spindle_max", "最高主轴转速", UnitCount, a.Tooling.Spindle.Range.Max, b.Tooling.Spindle.Range.Max},
+		{"spindle_starts", "主轴启动次数", UnitCount, float64(a.Tooling.Spindle.Starts), float64(b.Tooling.Spindle.Starts)},
+		{"spindle_off_length", "主轴关闭时的加工长度", UnitLength, a.Tooling.Spindle.OffLength, b.Tooling.Spindle.OffLength},
+		{"flood_length", "冷却液加工长度", UnitLength, a.Tooling.Coolant.FloodLength, b.Tooling.Coolant.FloodLength},
+		{"mist_length", "雾状冷却加工长度", UnitLength, a.Tooling.Coolant.MistLength, b.Tooling.Coolant.MistLength},
+		{"dry_length", "无冷却加工长度", UnitLength, a.Tooling.Coolant.DryLength, b.Tooling.Coolant.DryLength},
+		{"compensated_length", "半径补偿后的加工长度", UnitLength, a.Tooling.Compensation.CompensatedLength, b.Tooling.Compensation.CompensatedLength},
+		{"compensation_issues", "半径补偿问题", UnitCount, float64(len(a.Tooling.Compensation.Issues)), float64(len(b.Tooling.Compensation.Issues))},
+		{"hole_count", "孔数", UnitCount, float64(a.Holes.Count), float64(b.Holes.Count)},
+		{"pierces", "穿孔次数", UnitCount, float64(a.Cutting.Pierces), float64(b.Cutting.Pierces)},
+		{"pierce_time", "穿孔暂停时间", UnitDuration, a.Cutting.PierceTime, b.Cutting.PierceTime},
+		{"closed_contours", "闭合轮廓", UnitCount, float64(a.Cutting.Closed), float64(b.Cutting.Closed)},
+		{"lead_ins", "引入线", UnitCount, float64(a.Cutting.LeadIns), float64(b.Cutting.LeadIns)},
+		{"lead_outs", "引出线", UnitCount, float64(a.Cutting.LeadOuts), float64(b.Cutting.LeadOuts)},
+		{"overcut_length", "过切长度", UnitLength, a.Cutting.OvercutLength, b.Cutting.OvercutLength},
+		{"travel", "切割路径间空行程", UnitLength, a.Travel.Travel, b.Travel.Travel},
+		{"travel_optimized", "优化顺序后的空行程", UnitLength, a.Travel.Optimized, b.Travel.Optimized},
+		{"travel_time_savings", "优化顺序可节省的时间", UnitDuration, a.Travel.TimeSavings, b.Travel.TimeSavings},
+		{"executed_lines", "展开后执行的行数", UnitCount, float64(a.Program.ExecutedLines), float64(b.Program.ExecutedLines)},
+		{"subprogram_calls", "子程序执行次数", UnitCount, float64(a.Program.Calls), float64(b.Program.Calls)},
+	}
+}
@@ -0,0 +1,260 @@
+package export
+
+import (
+	"fmt"
+	"ok/model"
+	"strconv"
+)
+
+// Table 二维表格，用于CSV和XLSX导出
+// 单元格为 string、float64、int 或 bool
+type Table struct {
+	Name   string          // 表名(XLSX工作表名称)
+	File   string          // CSV文件名(不含扩展名)
+	Header []string        // 表头
+	Rows   [][]interface{} // 数据行
+}
+
+// Tables 将比较结果转换为表格：分析对比、变化分析、刀具、孔、切缝补偿、穿孔、空行程、Manifest参数、行变化
+func Tables(result *model.CompareResult) []Table {
+	return []Table{
+		analysisTable(result.GCodeDiff),
+		changeAnalysisTable(result.GCodeDiff),
+		toolsTable(result.GCodeDiff),
+		holesTable(result.GCodeDiff),
+		kerfTable(result.GCodeDiff),
+		cuttingTable(result.GCodeDiff),
+		travelTable(result.GCodeDiff),
+		parametersTable(result.ManifestDiff),
+		lineChangesTable(result.GCodeDiff),
+	}
+}
+
+// FindTable 按CSV文件名查找表格
+func FindTable(tables []Table, file string) (Table, bool) {
+	for _, t := range tables {
+		if t.File == file {
+			return t, true
+		}
+	}
+	return Table{}, false
+}
+
+// analysisTable 两个版本的G-code分析结果
+func analysisTable(diff *model.GCodeDiff) Table {
+	t := Table{
+		Name:   "分析对比",
+		File:   "analysis",
+		Header: []string{"key", "指标", "单位", "版本A", "版本B", "差值", "变化率(%)"},
+	}
+	for _, m := range Metrics(diff) {
+		t.Rows = append(t.Rows, []interface{}{m.Key, m.Name, m.Unit, m.A, m.B, m.B - m.A, m.Change()})
+	}
+	return t
+}
+
+// changeAnalysisTable 变化分析
+func changeAnalysisTable(diff *model.GCodeDiff) Table {
+	t := Table{
+		Name:   "变化分析",
+		File:   "change_analysis",
+		Header: []string{"key", "指标", "值"},
+	}
+	if diff == nil {
+		return t
+	}
+	c := diff.Analysis
+	t.Rows = [][]interface{}{
+		{"path_length_change", "路径长度变化率(%)", c.PathLengthChange},
+		{"area_change", "加工区域变化率(%)", c.AreaChange},
+		{"speed_change", "速度变化率(%)", c.SpeedChange},
+		{"command_change", "命令结构变化率(%)", c.CommandChange},
+		{"envelope_x_min_delta", "包络 X 最小值变化(mm)", c.Envelope.X.MinDelta},
+		{"envelope_x_max_delta", "包络 X 最大值变化(mm)", c.Envelope.X.MaxDelta},
+		{"envelope_x_size_delta", "包络 X 尺寸变化(mm)", c.Envelope.X.SizeDelta},
+		{"envelope_y_min_delta", "包络 Y 最小值变化(mm)", c.Envelope.Y.MinDelta},
+		{"envelope_y_max_delta", "包络 Y 最大值变化(mm)", c.Envelope.Y.MaxDelta},
+		{"envelope_y_size_delta", "包络 Y 尺寸变化(mm)", c.Envelope.Y.SizeDelta},
+		{"envelope_z_min_delta", "包络 Z 最小值变化(mm)", c.Envelope.Z.MinDelta},
+		{"envelope_z_max_delta", "包络 Z 最大值变化(mm)", c.Envelope.Z.MaxDelta},
+		{"envelope_z_size_delta", "包络 Z 尺寸变化(mm)", c.Envelope.Z.SizeDelta},
+		{"envelope_same", "包络相同", c.Envelope.Same},
+		{"a_fits", "版本A在行程内", c.Envelope.AFits},
+		{"b_fits", "版本B在行程内", c.Envelope.BFits},
+		{"tool_sequence_same", "刀具顺序相同", c.Tooling.Same},
+		{"tool_changes_delta", "换刀次数变化", c.Tooling.ToolChangesDelta},
+		{"holes_same", "孔相同", c.Holes.Same},
+		{"holes_added", "新增的孔", len(c.Holes.Added)},
+		{"holes_removed", "删除的孔", len(c.Holes.Removed)},
+		{"holes_modified", "修改的孔", len(c.Holes.Modified)},
+		{"kerf_mismatches", "切缝补偿不一致的元素", c.Kerf.Mismatches},
+		{"cutting_same", "穿孔和引入引出相同", c.Cutting.Same},
+		{"pierces_delta", "穿孔次数变化", c.Cutting.PiercesDelta},
+		{"pierce_time_delta", "穿孔暂停时间变化(秒)", c.Cutting.PierceTimeDelta},
+	}
+	return t
+}
+
+// toolsTable 两个版本每把刀具的使用情况
+func toolsTable(diff *model.GCodeDiff) Table {
+	t := Table{
+		Name:   "刀具",
+		File:   "tools",
+		Header: []string{"版本", "刀具", "加工长度(mm)", "快速移动长度(mm)", "时间(s)", "最低转速", "最高转速", "装入次数"},
+	}
+	if diff == nil {
+		return t
+	}
+	for _, v := range []struct {
+		name  string
+		tools []model.ToolUsage
+	}{{"A", diff.AnalysisA.Tooling.Tools}, {"B", diff.AnalysisB.Tooling.Tools}} {
+		for _, u := range v.tools {
+			t.Rows = append(t.Rows, []interface{}{v.name, u.Tool, u.WorkingLength, u.RapidLength, u.Time, u.Spindle.Min, u.Spindle.Max, u.Loads})
+		}
+	}
+	return t
+}
+
+// holesTable 两个版本之间变化的孔
+func holesTable(diff *model.GCodeDiff) Table {
+	t := Table{
+		Name:   "孔",
+		File:   "holes",
+		Header: []string{"类型", "X", "Y", "行号A", "循环A", "刀具A", "孔底A", "行号B", "循环B", "刀具B", "孔底B"},
+	}
+	if diff == nil {
+		return t
+	}
+	c := diff.Analysis.Holes
+	for _, h := range c.Removed {
+		t.Rows = append(t.Rows, []interface{}{"remove", h.X, h.Y, h.Line, h.Cycle, h.Tool, h.Bottom, "", "", "", ""})
+	}
+	for _, h := range c.Added {
+		t.Rows = append(t.Rows, []interface{}{"add", h.X, h.Y, "", "", "", "", h.Line, h.Cycle, h.Tool, h.Bottom})
+	}
+	for _, m := range c.Modified {
+		t.Rows = append(t.Rows, []interface{}{"change", m.B.X, m.B.Y, m.A.Line, m.A.Cycle, m.A.Tool, m.A.Bottom, m.B.Line, m.B.Cycle, m.B.Tool, m.B.Bottom})
+	}
+	return t
+}
+
+// kerfTable 各元素的切缝补偿检查
+func kerfTable(diff *model.GCodeDiff) Table {
+	t := Table{
+		Name:   "切缝补偿",
+		File:   "kerf",
+		Header: []string{"元素", "名称", "切缝A(mm)", "切缝B(mm)", "声明变化(mm)", "实际偏移(mm)", "平均距离(mm)", "闭合轮廓", "结果", "说明"},
+	}
+	if diff == nil {
+		return t
+	}
+	for _, e := range diff.Analysis.Kerf.Elements {
+		t.Rows = append(t.Rows, []interface{}{e.Index, e.Name, e.KerfA, e.KerfB, e.Expected, e.Observed, e.MeanDistance, e.Contours, e.Status, e.Note})
+	}
+	return t
+}
+
+// cuttingTable 各元素在A/B两个版本中的穿孔和引入引出
+func cuttingTable(diff *model.GCodeDiff) Table {
+	t := Table{
+		Name: "穿孔",
+		File: "cutting",
+		Header: []string{"元素", "名称", "穿孔A", "穿孔B", "穿孔暂停A(秒)", "穿孔暂停B(秒)", "闭合轮廓A", "闭合轮廓B",
+			"引入线A", "引入线B", "引出线A", "引出线B", "过切距离A(mm)", "过切距离B(mm)", "平均过切A(mm)", "平均过切B(mm)", "不同"},
+	}
+	if diff == nil {
+		return t
+	}
+	for _, e := range diff.Analysis.Cutting.Elements {
+		name := e.B.Name
+		if name == "" {
+			name = e.A.Name
+		}
+		t.Rows = append(t.Rows, []interface{}{e.Index, name, e.A.Pierces, e.B.Pierces, e.A.PierceTime, e.B.PierceTime,
+			e.A.Closed, e.B.Closed, e.A.LeadIns, e.B.LeadIns, e.A.LeadOuts, e.B.LeadOuts,
+			e.A.OverDist, e.B.OverDist, e.A.MeanOvercut(), e.B.MeanOvercut(), e.Different})
+	}
+	return t
+}
+
+// travelTable 两个版本各元素的空行程和优化顺序后的空行程
+func travelTable(diff *model.GCodeDiff) Table {
+	t := Table{
+		Name:   "空行程",
+		File:   "travel",
+		Header: []string{"版本", "元素", "名称", "切割路径", "空行程(mm)", "优化后(mm)", "可节省(mm)"},
+	}
+	if diff == nil {
+		return t
+	}
+	for _, v := range []struct {
+		name     string
+		elements []model.ElementTravel
+	}{{"A", diff.AnalysisA.Travel.Elements}, {"B", diff.AnalysisB.Travel.Elements}} {
+		for _, e := range v.elements {
+			t.Rows = append(t.Rows, []interface{}{v.name, e.Index, e.Name, e.Contours, e.Travel, e.Optimized, e.Savings})
+		}
+	}
+	return t
+}
+
+// parametersTable 所有模块的manifest参数
+func parametersTable(diff *model.ManifestDiff) Table {
+	t := Table{
+		Name:   "Manifest参数",
+		File:   "parameters",
+		Header: []string{"模块", "参数", "版本A", "版本B", "是否不同"},
+	}
+	if diff == nil {
+		return t
+	}
+	for _, module := range diff.Modules {
+		for _, p := range module.Parameters {
+			t.Rows = append(t.Rows, []interface{}{module.Name, p.Name, cellValue(p.Value1), cellValue(p.Value2), p.Different})
+		}
+	}
+	return t
+}
+
+// lineChangesTable G-code行变化
+func lineChangesTable(diff *model.GCodeDiff) Table {
+	t := Table{
+		Name:   "行变化",
+		File:   "line_changes",
+		Header: []string{"行号", "类型", "原内容", "新内容"},
+	}
+	if diff == nil {
+		return t
+	}
+	for _, c := range diff.LineChanges {
+		oldContent, newContent := c.OldContent, c.Content
+		if c.Type == "remove" {
+			oldContent, newContent = c.Content, ""
+		}
+		t.Rows = append(t.Rows, []interface{}{c.LineNum, c.Type, oldContent, newContent})
+	}
+	return t
+}
+
+// cellValue 将manifest参数值转换为单元格值，数值保持为数值，其余转换为文本
+func cellValue(v interface{}) interface{} {
+	switch v.(type) {
+	case float64, bool, int:
+		return v
+	case nil:
+		return ""
+	}
+	return formatParam(v)
+}
+
+// cellText 单元格的文本形式
+func cellText(v interface{}) string {
+	switch value := v.(type) {
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,165 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"ok/model"
+)
+
+func TestCSV(t *testing.T) {
+	table := Table{
+		File:   "test",
+		Header: []string{"名称", "值", "启用"},
+		Rows: [][]interface{}{
+			{"a,b", 1.5, true},
+			{"短行"},
+			{"整数", 3, false},
+		},
+	}
+	var buf bytes.Buffer
+	if err := CSV(&buf, table); err != nil {
+		t.Fatal(err)
+	}
+	want := utf8BOM + "名称,值,启用\n\"a,b\",1.5,true\n短行,,\n整数,3,false\n"
+	if got := buf.String(); got != want {
+		t.Errorf("CSV = %q, want %q", got, want)
+	}
+}
+
+// readZip 读取zip中所有文件的内容
+func readZip(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = string(content)
+	}
+	return files
+}
+
+func TestCSVZip(t *testing.T) {
+	tables := []Table{
+		{File: "a", Header: []string{"x"}, Rows: [][]interface{}{{1.0}}},
+		{File: "b", Header: []string{"y"}},
+	}
+	var buf bytes.Buffer
+	if err := CSVZip(&buf, tables); err != nil {
+		t.Fatal(err)
+	}
+	files := readZip(t, buf.Bytes())
+	if len(files) != 2 || files["a.csv"] != utf8BOM+"x\n1\n" || files["b.csv"] != utf8BOM+"y\n" {
+		t.Errorf("files = %q", files)
+	}
+}
+
+func TestXLSX(t *testing.T) {
+	tables := []Table{
+		{Name: "分析/对比", Header: []string{"名称", "值"}, Rows: [][]interface{}{
+			{"<G1>", 1.5},
+			{"整数", 3},
+			{"布尔", true},
+		}},
+		{Name: "", Header: []string{"空表"}},
+	}
+	var buf bytes.Buffer
+	if err := XLSX(&buf, tables); err != nil {
+		t.Fatal(err)
+	}
+	files := readZip(t, buf.Bytes())
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml", "xl/worksheets/sheet1.xml", "xl/worksheets/sheet2.xml"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("缺少 %s", name)
+		}
+	}
+
+	tests := []struct {
+		name, file, text string
+	}{
+		{"表头加粗", "xl/worksheets/sheet1.xml", `<c r="A1" s="1" t="inlineStr"><is><t xml:space="preserve">名称</t></is></c>`},
+		{"文本转义", "xl/worksheets/sheet1.xml", `<c r="A2" t="inlineStr"><is><t xml:space="preserve">&lt;G1&gt;</t></is></c>`},
+		{"小数", "xl/worksheets/sheet1.xml", `<c r="B2"><v>1.5</v></c>`},
+		{"整数", "xl/worksheets/sheet1.xml", `<c r="B3"><v>3</v></c>`},
+		{"布尔", "xl/worksheets/sheet1.xml", `<c r="B4" t="b"><v>1</v></c>`},
+		{"工作表名称去掉非法字符", "xl/workbook.xml", `name="分析_对比"`},
+		{"空名称的工作表", "xl/workbook.xml", `name="Sheet2"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !strings.Contains(files[tt.file], tt.text) {
+				t.Errorf("%s 中没有 %s", tt.file, tt.text)
+			}
+		})
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	tests := []struct {
+		col  int
+		want string
+	}{
+		{0, "A"}, {25, "Z"}, {26, "AA"}, {27, "AB"}, {701, "ZZ"}, {702, "AAA"},
+	}
+	for _, tt := range tests {
+		if got := columnName(tt.col); got != tt.want {
+			t.Errorf("columnName(%d) = %q, want %q", tt.col, got, tt.want)
+		}
+	}
+}
+
+func TestTables(t *testing.T) {
+	result := &model.CompareResult{
+		GCodeDiff: &model.GCodeDiff{
+			LineChanges: []model.GCodeChange{{LineNum: 2, Type: "change", Content: "G1 X5", OldContent: "G1 X1"}},
+		},
+		ManifestDiff: &model.ManifestDiff{Modules: []model.ModuleReport{{
+			Name:       "切割",
+			Parameters: []model.Parameter{{Name: "power", Value1: 50.0, Value2: nil, Different: true}},
+		}}},
+	}
+	tables := Tables(result)
+	seen := map[string]bool{}
+	for _, table := range tables {
+		if seen[table.File] {
+			t.Errorf("CSV文件名 %s 重复", table.File)
+		}
+		seen[table.File] = true
+		for i, row := range table.Rows {
+			if len(row) != len(table.Header) {
+				t.Errorf("%s 第 %d 行有 %d 列，表头 %d 列", table.File, i, len(row), len(table.Header))
+			}
+		}
+	}
+
+	params, ok := FindTable(tables, "parameters")
+	if !ok || len(params.Rows) != 1 {
+		t.Fatalf("parameters = %+v, %v", params, ok)
+	}
+	// 数值保持为数值，空值为空字符串
+	if got, want := fmt.Sprint(params.Rows[0]), "[切割 power 50  true]"; got != want {
+		t.Errorf("parameters 行 = %v, want %v", got, want)
+	}
+	if _, ok := FindTable(tables, "missing"); ok {
+		t.Error("FindTable 找到了不存在的表")
+	}
+	// 没有比较结果时仍然生成所有表格
+	if got := len(Tables(&model.CompareResult{})); got != len(tables) {
+		t.Errorf("空结果生成 %d 个表格, want %d", got, len(tables))
+	}
+}
@@ -0,0 +1,338 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// DefaultContext 统一差异格式默认的上下文行数
+const DefaultContext = 3
+
+// maxSplitCost 一次分割最多搜索的编辑数，超过后按前进最远的位置分割，避免差异很大时耗时过长
+const maxSplitCost = 1024
+
+// 编辑操作
+const (
+	opEqual  = ' '
+	opDelete = '-'
+	opInsert = '+'
+)
+
+// edit 一行的编辑操作
+type edit struct {
+	op   byte
+	a, b int // 在A、B中的行下标(从0开始)
+}
+
+// Unified 输出A、B两个文本的统一差异格式(unified diff)，与 diff -u / git diff 兼容
+// 两个文本相同时不输出任何内容
+func Unified(w io.Writer, nameA, nameB string, a, b []byte, context int) error {
+	if context < 0 {
+		context = DefaultContext
+	}
+	linesA, linesB := splitLines(a), splitLines(b)
+	edits := diffLines(linesA, linesB)
+
+	bw := bufio.NewWriter(w)
+	header := false
+	for _, h := range unifiedHunks(edits, context) {
+		if !header {
+			fmt.Fprintf(bw, "--- %s\n+++ %s\n", nameA, nameB)
+			header = true
+		}
+		startA, countA, startB, countB := hunkRange(edits[h[0]:h[1]])
+		fmt.Fprintf(bw, "@@ -%s +%s @@\n", unifiedRange(startA, countA), unifiedRange(startB, countB))
+		for _, e := range edits[h[0]:h[1]] {
+			switch e.op {
+			case opDelete:
+				writeDiffLine(bw, '-', linesA[e.a])
+			case opInsert:
+				writeDiffLine(bw, '+', linesB[e.b])
+			default:
+				writeDiffLine(bw, ' ', linesA[e.a])
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// splitLines 按行拆分文本，去掉行尾的 \r\n
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	text := strings.TrimSuffix(string(data), "\n")
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	return lines
+}
+
+// writeDiffLine 输出一行差异
+func writeDiffLine(w *bufio.Writer, prefix byte, line string) {
+	w.WriteByte(prefix)
+	w.WriteString(line)
+	w.WriteByte('\n')
+}
+
+// unifiedRange 格式化差异组的行范围，行数为1时省略
+func unifiedRange(start, count int) string {
+	if count == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// hunkRange 计算差异组在A、B中的起始行号(从1开始)和行数
+func hunkRange(edits []edit) (startA, countA, startB, countB int) {
+	first := edits[0]
+	startA, startB = first.a+1, first.b+1
+	for _, e := range edits {
+		if e.op != opInsert {
+			countA++
+		}
+		if e.op != opDelete {
+			countB++
+		}
+	}
+	// 行数为0时，起始行号为变化位置的前一行
+	if countA == 0 {
+		startA--
+	}
+	if countB == 0 {
+		startB--
+	}
+	return
+}
+
+// unifiedHunks 将编辑序列按上下文行数分组，返回每组在edits中的 [开始, 结束) 下标
+func unifiedHunks(edits []edit, context int) [][2]int {
+	var hunks [][2]int
+	for i := 0; i < len(edits); {
+		if edits[i].op == opEqual {
+			i++
+			continue
+		}
+		start := max(i-context, 0)
+		// 向后查找，直到连续相同的行超过两倍上下文
+		last := i
+		for j := i + 1; j < len(edits) && j-last <= 2*context+1; j++ {
+			if edits[j].op != opEqual {
+				last = j
+			}
+		}
+		end := min(last+1+context, len(edits))
+		if n := len(hunks); n > 0 && start <= hunks[n-1][1] {
+			hunks[n-1][1] = end
+		} else {
+			hunks = append(hunks, [2]int{start, end})
+		}
+		i = end
+	}
+	return hunks
+}
+
+// diffLines 计算两组行之间的编辑序列
+// 使用线性空间的 Myers 分治算法：查找中间蛇形把问题分成两半，内存占用与行数成正比；
+// 一次分割的编辑数超过 maxSplitCost 时按前进最远的位置分割，结果接近最短但不保证最短
+func diffLines(a, b []string) []edit {
+	ids := map[string]int{}
+	d := &differ{a: lineIDs(a, ids), b: lineIDs(b, ids)}
+	d.off = len(b) + 1
+	d.fwd = make([]int, len(a)+len(b)+3)
+	d.bwd = make([]int, len(a)+len(b)+3)
+	d.edits = make([]edit, 0, len(a)+len(b))
+	d.compare(0, len(a), 0, len(b))
+	return groupChanges(d.edits)
+}
+
+// lineIDs 把每行映射为编号，内容相同的行编号相同
+func lineIDs(lines []string, ids map[string]int) []int {
+	out := make([]int, len(lines))
+	for i, line := range lines {
+		id, ok := ids[line]
+		if !ok {
+			id = len(ids)
+			ids[line] = id
+		}
+		out[i] = id
+	}
+	return out
+}
+
+// differ 差异计算的状态，fwd、bwd 为前向和后向搜索在每条对角线(x-y)上到达的位置
+type differ struct {
+	a, b     []int
+	fwd, bwd []int
+	off      int // 对角线k在 fwd、bwd 中的下标为 k+off
+	edits    []edit
+}
+
+// compare 比较 a[aLo:aHi] 和 b[bLo:bHi]，按顺序追加编辑操作
+func (d *differ) compare(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		d.edits = append(d.edits, edit{op: opEqual, a: aLo, b: bLo})
+		aLo++
+		bLo++
+	}
+	suffix := 0
+	for aHi-suffix > aLo && bHi-suffix > bLo && d.a[aHi-1-suffix] == d.b[bHi-1-suffix] {
+		suffix++
+	}
+	aHi -= suffix
+	bHi -= suffix
+
+	switch {
+	case aLo == aHi:
+		for j := bLo; j < bHi; j++ {
+			d.edits = append(d.edits, edit{op: opInsert, a: aLo, b: j})
+		}
+	case bLo == bHi:
+		for i := aLo; i < aHi; i++ {
+			d.edits = append(d.edits, edit{op: opDelete, a: i, b: bLo})
+		}
+	default:
+		x, y := d.split(aLo, aHi, bLo, bHi)
+		d.compare(aLo, x, bLo, y)
+		d.compare(x, aHi, y, bHi)
+	}
+
+	for i := 0; i < suffix; i++ {
+		d.edits = append(d.edits, edit{op: opEqual, a: aHi + i, b: bHi + i})
+	}
+}
+
+// split 同时从两端搜索，返回中间蛇形的起点作为分割点
+// 编辑数超过 maxSplitCost 时返回前向或后向搜索中前进最远的位置
+func (d *differ) split(xoff, xlim, yoff, ylim int) (int, int) {
+	fd, bd, o := d.fwd, d.bwd, d.off
+	dmin, dmax := xoff-ylim, xlim-yoff
+	fmid, bmid := xoff-yoff, xlim-ylim
+	fmin, fmax, bmin, bmax := fmid, fmid, bmid, bmid
+	odd := (fmid-bmid)&1 != 0
+	fd[fmid+o], bd[bmid+o] = xoff, xlim
+
+	for c := 1; ; c++ {
+		if fmin > dmin {
+			fmin--
+			fd[fmin-1+o] = -1
+		} else {
+			fmin++
+		}
+		if fmax < dmax {
+			fmax++
+			fd[fmax+1+o] = -1
+		} else {
+			fmax--
+		}
+		for k := fmax; k >= fmin; k -= 2 {
+			x := fd[k+1+o]
+			if lo := fd[k-1+o]; lo >= x {
+				x = lo + 1
+			}
+			y := x - k
+			for x < xlim && y < ylim && d.a[x] == d.b[y] {
+				x++
+				y++
+			}
+			fd[k+o] = x
+			if odd && bmin <= k && k <= bmax && bd[k+o] <= x {
+				return x, y
+			}
+		}
+
+		if bmin > dmin {
+			bmin--
+			bd[bmin-1+o] = math.MaxInt
+		} else {
+			bmin++
+		}
+		if bmax < dmax {
+			bmax++
+			bd[bmax+1+o] = math.MaxInt
+		} else {
+			bmax--
+		}
+		for k := bmax; k >= bmin; k -= 2 {
+			x := bd[k-1+o]
+			if hi := bd[k+1+o]; x >= hi {
+				x = hi - 1
+			}
+			y := x - k
+			for x > xoff && y > yoff && d.a[x-1] == d.b[y-1] {
+				x--
+				y--
+			}
+			bd[k+o] = x
+			if !odd && fmin <= k && k <= fmax && x <= fd[k+o] {
+				return x, y
+			}
+		}
+
+		if c >= maxSplitCost {
+			return d.furthest(xoff, xlim, yoff, ylim, fmin, fmax, bmin, bmax)
+		}
+	}
+}
+
+// furthest 返回前向和后向搜索中前进最远的位置
+func (d *differ) furthest(xoff, xlim, yoff, ylim, fmin, fmax, bmin, bmax int) (int, int) {
+	fd, bd, o := d.fwd, d.bwd, d.off
+	fbest, fx := -1, 0
+	for k := fmax; k >= fmin; k -= 2 {
+		x := min(fd[k+o], xlim)
+		y := x - k
+		if y > ylim {
+			x, y = ylim+k, ylim
+		}
+		if x+y > fbest {
+			fbest, fx = x+y, x
+		}
+	}
+	bbest, bx := math.MaxInt, 0
+	for k := bmax; k >= bmin; k -= 2 {
+		x := max(bd[k+o], xoff)
+		y := x - k
+		if y < yoff {
+			x, y = yoff+k, yoff
+		}
+		if x+y < bbest {
+			bbest, bx = x+y, x
+		}
+	}
+	if (xlim+ylim)-bbest < fbest-(xoff+yoff) {
+		return fx, fbest - fx
+	}
+	return bx, bbest - bx
+}
+
+// groupChanges 每段连续的变化中，删除的行排在新增的行之前，与 diff -u 相同
+func groupChanges(edits []edit) []edit {
+	for i := 0; i < len(edits); {
+		if edits[i].op == opEqual {
+			i++
+			continue
+		}
+		// 第一个操作的位置就是这段变化在A、B中的起点
+		startA, startB := edits[i].a, edits[i].b
+		j, deleted := i, 0
+		for ; j < len(edits) && edits[j].op != opEqual; j++ {
+			if edits[j].op == opDelete {
+				deleted++
+			}
+		}
+		for k := i; k < j; k++ {
+			if n := k - i; n < deleted {
+				edits[k] = edit{op: opDelete, a: startA + n, b: startB}
+			} else {
+				edits[k] = edit{op: opInsert, a: startA + deleted, b: startB + n - deleted}
+			}
+		}
+		i = j
+	}
+	return edits
+}
@@ -0,0 +1,94 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"ok/model"
+)
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    string
+		context int
+		want    string
+	}{
+		{"相同", "G0 X0\nG1 X1\n", "G0 X0\nG1 X1\n", 3, ""},
+		{"修改", "G0 X0\nG1 X1\nG1 X2\n", "G0 X0\nG1 X5\nG1 X2\n", 3,
+			"--- a\n+++ b\n@@ -1,3 +1,3 @@\n G0 X0\n-G1 X1\n+G1 X5\n G1 X2\n"},
+		{"新增", "", "G0 X0\n", 3, "--- a\n+++ b\n@@ -0,0 +1 @@\n+G0 X0\n"},
+		{"CRLF", "G0 X0\r\nG1 X1\r\n", "G0 X0\nG1 X1\n", 3, ""},
+		{"无上下文", "A\nB\nC\nD\n", "A\nX\nC\nY\n", 0,
+			"--- a\n+++ b\n@@ -2 +2 @@\n-B\n+X\n@@ -4 +4 @@\n-D\n+Y\n"},
+		{"先删除后新增", "A\nB\nC\n", "X\nB\nY\n", 0,
+			"--- a\n+++ b\n@@ -1 +1 @@\n-A\n+X\n@@ -3 +3 @@\n-C\n+Y\n"},
+		{"完全不同", "A\nB\n", "X\nY\nZ\n", 3,
+			"--- a\n+++ b\n@@ -1,2 +1,3 @@\n-A\n-B\n+X\n+Y\n+Z\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Unified(&buf, "a", "b", []byte(tt.a), []byte(tt.b), tt.context); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("Unified =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnifiedManyChanges(t *testing.T) {
+	// 变化很多时仍然逐处输出，不整体替换
+	var a, b strings.Builder
+	for i := 0; i < 20000; i++ {
+		fmt.Fprintf(&a, "G1 X%d\n", i)
+		if i%10 == 0 {
+			fmt.Fprintf(&b, "G1 X%d F100\n", i)
+		} else {
+			fmt.Fprintf(&b, "G1 X%d\n", i)
+		}
+	}
+	var buf bytes.Buffer
+	if err := Unified(&buf, "a", "b", []byte(a.String()), []byte(b.String()), 0); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if hunks, removed := strings.Count(out, "@@ -"), strings.Count(out, "\n-G1"); hunks != 2000 || removed != 2000 {
+		t.Errorf("hunks = %d, removed = %d, want 2000, 2000", hunks, removed)
+	}
+}
+
+func TestHunks(t *testing.T) {
+	changes := []model.GCodeChange{
+		{LineNum: 0, Type: "info"},
+		{LineNum: 2, Type: "add"},
+		{LineNum: 4, Type: "modify"},
+		{LineNum: 20, Type: "remove"},
+	}
+	tests := []struct {
+		gap  int
+		want [][2]int
+	}{
+		{0, [][2]int{{2, 2}, {4, 4}, {20, 20}}},
+		{2, [][2]int{{2, 4}, {20, 20}}},
+		{100, [][2]int{{2, 20}}},
+	}
+	for _, tt := range tests {
+		hunks := Hunks(changes, tt.gap)
+		if len(hunks) != len(tt.want) {
+			t.Fatalf("gap %d: %d 组, want %d", tt.gap, len(hunks), len(tt.want))
+		}
+		for i, h := range hunks {
+			if h.StartLine != tt.want[i][0] || h.EndLine != tt.want[i][1] {
+				t.Errorf("gap %d: hunk %d = %d-%d, want %v", tt.gap, i, h.StartLine, h.EndLine, tt.want[i])
+			}
+		}
+	}
+	if h := Hunks(changes, 100)[0]; h.Added != 1 || h.Removed != 1 || h.Changed != 1 || h.Size() != 3 {
+		t.Errorf("统计 = %+v", h)
+	}
+}
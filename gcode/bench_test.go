@@ -0,0 +1,86 @@
+package gcode
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+// benchGCode 生成约size字节的G-code，包含行号、注释、校验和、直线和圆弧
+func benchGCode(size int) []byte {
+	r := rand.New(rand.NewSource(1))
+	buf := bytes.NewBuffer(make([]byte, 0, size+256))
+	buf.WriteString("; bench\nG21 G90\nM3 S1000\n")
+	coord := func(max float64) string {
+		return strconv.FormatFloat(r.Float64()*max, 'f', 3, 64)
+	}
+	for n := 1; buf.Len() < size; n++ {
+		switch {
+		case n%500 == 0:
+			fmt.Fprintf(buf, "(element %d)\n", n/500)
+		case n%50 == 0:
+			fmt.Fprintf(buf, "G0 X%s Y%s\n", coord(500), coord(300))
+		case n%20 == 0:
+			fmt.Fprintf(buf, "N%d G2 X%s Y%s I%s J%s F1200*%d\n", n, coord(500), coord(300), coord(5), coord(5), n%256)
+		default:
+			fmt.Fprintf(buf, "G1 X%s Y%s F%d ; cut\n", coord(500), coord(300), 1000+n%3*1000)
+		}
+	}
+	buf.WriteString("M5\nM30\n")
+	return buf.Bytes()
+}
+
+func BenchmarkLexer(b *testing.B) {
+	data := benchGCode(1 << 20)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	var lex Lexer
+	var tok Token
+	for i := 0; i < b.N; i++ {
+		for rest := data; len(rest) > 0; {
+			line := rest
+			if j := bytes.IndexByte(rest, '\n'); j >= 0 {
+				line, rest = rest[:j], rest[j+1:]
+			} else {
+				rest = nil
+			}
+			lex.Reset(line)
+			for lex.Next(&tok) {
+			}
+		}
+	}
+}
+
+func BenchmarkParseLine(b *testing.B) {
+	lines := bytes.Split(benchGCode(1<<20), []byte("\n"))
+	texts := make([]string, len(lines))
+	size := 0
+	for i, line := range lines {
+		texts[i] = string(line)
+		size += len(line) + 1
+	}
+	b.SetBytes(int64(size))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for n, text := range texts {
+			ParseLine(text, n+1)
+		}
+	}
+}
+
+func BenchmarkRun(b *testing.B) {
+	data := benchGCode(1 << 20)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := Run(bytes.NewReader(data), NewInterpreter(), func(*Block, []Segment) error { return nil })
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
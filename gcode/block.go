@@ -0,0 +1,187 @@
+package gcode
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+// Word G代码字，由地址字母和数值组成，如 X10.5
+type Word struct {
+	Letter byte    // 地址字母(大写)
+	Value  float64 // 数值
+	Text   string  // 原始数值文本
+}
+
+// Block 程序段，对应G代码文件中的一行
+type Block struct {
+	Line     int      // 行号(从1开始)
+	Raw      string   // 原始内容
+	Words    []Word   // 代码字列表，不含行首的程序段号
+	Comment  string   // 所有注释内容，以空格连接
+	Comments []string // 各条注释，按出现顺序
+
+	Number      int  // 行首的程序段号，如 N120
+	HasNumber   bool // 是否有程序段号
+	Checksum    int  // * 之后的校验和(RepRap)
+	ChecksumPos int  // 校验和的 * 在 Raw 中的位置
+	HasChecksum bool // 是否有校验和
+	ChecksumOK  bool // 校验和是否与 * 之前的内容一致
+
+	Command string            // 扩展命令名，如 Klipper 的 SET_VELOCITY_LIMIT，由方言识别
+	Params  map[string]string // 扩展命令的参数，如 ACCEL=3000
+
+	Jump bool // 展开子程序或循环后与上一段在源文件中不连续，见 Expand
+}
+
+// ParseLine 解析一行G代码
+// 支持 ; 和括号注释、行首的 N 程序段号以及 RepRap 风格的 * 校验和
+func ParseLine(line string, lineNum int) *Block {
+	b := &Block{}
+	b.parse(line, lineNum)
+	return b
+}
+
+// parse 解析一行G代码，重复使用程序段中已分配的代码字和注释列表
+// 代码字的数值文本和注释都引用 line 中的内容，不复制
+func (b *Block) parse(line string, lineNum int) {
+	*b = Block{Line: lineNum, Raw: line, Words: b.Words[:0], Comments: b.Comments[:0]}
+
+	// 词法分析器只读取，不修改字符串的内容
+	data := unsafe.Slice(unsafe.StringData(line), len(line))
+	var lex Lexer
+	var tok Token
+	lex.Reset(data)
+	for lex.Next(&tok) {
+		switch tok.Kind {
+		case TokenComment:
+			b.addComment(line[tok.TextAt : tok.TextAt+len(tok.Text)])
+		case TokenLineNumber:
+			b.Number = int(tok.Value)
+			b.HasNumber = true
+		case TokenChecksum:
+			b.Checksum = int(tok.Value)
+			b.ChecksumPos = tok.Pos
+			b.HasChecksum = true
+			b.ChecksumOK = Checksum(data[:tok.Pos]) == b.Checksum
+		case TokenWord:
+			b.Words = append(b.Words, Word{Letter: tok.Letter, Value: tok.Value, Text: line[tok.TextAt : tok.TextAt+len(tok.Text)]})
+		}
+	}
+}
+
+// Checksum 计算 RepRap 校验和，即 * 之前所有字节的异或值
+func Checksum(data []byte) int {
+	var sum byte
+	for _, c := range data {
+		sum ^= c
+	}
+	return int(sum)
+}
+
+// addComment 追加注释内容
+func (b *Block) addComment(text string) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+	b.Comments = append(b.Comments, text)
+	if b.Comment == "" {
+		b.Comment = text
+	} else {
+		b.Comment += " " + text
+	}
+}
+
+// Empty 是否为空行(只有注释或空白)
+func (b *Block) Empty() bool {
+	return len(b.Words) == 0
+}
+
+// Get 获取指定字母的值
+func (b *Block) Get(letter byte) (float64, bool) {
+	for _, w := range b.Words {
+		if w.Letter == letter {
+			return w.Value, true
+		}
+	}
+	return 0, false
+}
+
+// Has 是否包含指定字母
+func (b *Block) Has(letter byte) bool {
+	_, ok := b.Get(letter)
+	return ok
+}
+
+// Codes 返回程序段中的G/M/T命令，如 G1、M3
+func (b *Block) Codes() []string {
+	var codes []string
+	for _, w := range b.Words {
+		if w.Letter == 'G' || w.Letter == 'M' {
+			codes = append(codes, CodeName(w.Letter, w.Value))
+		}
+	}
+	return codes
+}
+
+// HasCode 是否包含指定命令，不分配内存
+func (b *Block) HasCode(code string) bool {
+	if len(code) < 2 {
+		return false
+	}
+	value, err := strconv.ParseFloat(code[1:], 64)
+	if err != nil {
+		return false
+	}
+	for _, w := range b.Words {
+		if w.Letter == code[0] && w.Value == value && (w.Letter == 'G' || w.Letter == 'M') {
+			return true
+		}
+	}
+	return false
+}
+
+// maxCachedCode 预先生成名称的最大整数命令号
+const maxCachedCode = 1000
+
+// gCodeNames, mCodeNames 整数 G/M 命令的名称，避免每次生成
+var gCodeNames, mCodeNames = codeNames('G'), codeNames('M')
+
+func codeNames(letter byte) []string {
+	names := make([]string, maxCachedCode)
+	for i := range names {
+		names[i] = string(letter) + strconv.Itoa(i)
+	}
+	return names
+}
+
+// CodeName 生成规范化的命令名称，如 G01 -> G1，G38.2 保持不变
+// 常用的整数 G/M 命令返回预先生成的名称，不分配内存
+func CodeName(letter byte, value float64) string {
+	if value >= 0 && value < maxCachedCode && value == math.Trunc(value) {
+		switch letter {
+		case 'G':
+			return gCodeNames[int(value)]
+		case 'M':
+			return mCodeNames[int(value)]
+		}
+	}
+	return string(letter) + strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func upper(c byte) byte {
+	if c >= 'a' && c <= 'z' {
+		return c - 'a' + 'A'
+	}
+	return c
+}
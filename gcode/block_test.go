@@ -0,0 +1,105 @@
+package gcode
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		line        string
+		words       string
+		comment     string
+		number      int
+		checksum    int
+		hasChecksum bool
+		checksumOK  bool
+	}{
+		{"G1 X10.5 Y-2 F1200", "[G1 X10.5 Y-2 F1200]", "", 0, 0, false, false},
+		{"g01x1y2", "[G01 X1 Y2]", "", 0, 0, false, false},
+		{"G1 X 10 ; cut", "[G1 X10]", "cut", 0, 0, false, false},
+		{"(start) G0 X0 (rapid)", "[G0 X0]", "start rapid", 0, 0, false, false},
+		{"N10 G1 X1", "[G1 X1]", "", 10, 0, false, false},
+		{"N3 T0*57", "[T0]", "", 3, 57, true, true},
+		{"N3 T0*56", "[T0]", "", 3, 56, true, false},
+		{"N3 T0*57 ; a*b", "[T0]", "a*b", 3, 57, true, true},
+		{"G1 X.5 Y+1.", "[G1 X.5 Y+1.]", "", 0, 0, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			b := ParseLine(tt.line, 7)
+			var words []string
+			for _, w := range b.Words {
+				words = append(words, string(w.Letter)+w.Text)
+			}
+			if got := fmt.Sprint(words); got != tt.words {
+				t.Errorf("words = %s, want %s", got, tt.words)
+			}
+			if b.Comment != tt.comment {
+				t.Errorf("comment = %q, want %q", b.Comment, tt.comment)
+			}
+			if b.Line != 7 || b.Number != tt.number || b.HasNumber != (tt.number != 0) {
+				t.Errorf("line = %d, number = %d %v", b.Line, b.Number, b.HasNumber)
+			}
+			if b.Checksum != tt.checksum || b.HasChecksum != tt.hasChecksum || b.ChecksumOK != tt.checksumOK {
+				t.Errorf("checksum = %d %v %v, want %d %v %v", b.Checksum, b.HasChecksum, b.ChecksumOK, tt.checksum, tt.hasChecksum, tt.checksumOK)
+			}
+		})
+	}
+}
+
+func TestParseReuse(t *testing.T) {
+	b := &Block{}
+	b.parse("G1 X1 Y2 Z3 ; first", 1)
+	b.parse("G0 X5", 2)
+	if len(b.Words) != 2 || b.Comment != "" || len(b.Comments) != 0 || b.Line != 2 {
+		t.Errorf("重复使用后残留上一行的内容: %+v", b)
+	}
+}
+
+func TestLexNumber(t *testing.T) {
+	tests := []struct {
+		text  string
+		value float64
+		ok    bool
+	}{
+		{"10", 10, true},
+		{"-0.125", -0.125, true},
+		{"+3.", 3, true},
+		{".5", 0.5, true},
+		{"12345678901234567890", 12345678901234567890, true},
+		{"0.1234567890123456789012345", 0.1234567890123456789012345, true},
+		{"-", 0, false},
+		{".", 0, false},
+	}
+	for _, tt := range tests {
+		_, value, ok := lexNumber([]byte(tt.text), 0)
+		if ok != tt.ok || (ok && value != tt.value) {
+			t.Errorf("lexNumber(%q) = %v %v, want %v %v", tt.text, value, ok, tt.value, tt.ok)
+		}
+	}
+}
+
+func TestHasCode(t *testing.T) {
+	b := ParseLine("G01 G4.0 M3 X98 P98", 1)
+	for code, want := range map[string]bool{"G1": true, "G4": true, "M3": true, "M98": false, "G0": false, "X98": false, "": false} {
+		if got := b.HasCode(code); got != want {
+			t.Errorf("HasCode(%q) = %v, want %v", code, got, want)
+		}
+	}
+}
+
+func TestCodeName(t *testing.T) {
+	tests := []struct {
+		letter byte
+		value  float64
+		want   string
+	}{
+		{'G', 1, "G1"}, {'M', 30, "M30"}, {'G', 38.2, "G38.2"}, {'G', 59.1, "G59.1"}, {'M', 1000, "M1000"}, {'T', 2, "T2"},
+	}
+	for _, tt := range tests {
+		if got := CodeName(tt.letter, tt.value); got != tt.want {
+			t.Errorf("CodeName(%c, %v) = %s, want %s", tt.letter, tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package gcode
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DefaultPrecision 规范化输出默认的小数位数
+const DefaultPrecision = 3
+
+// canonicalSkipCodes 规范化后不再需要的模态命令，坐标统一输出为绝对坐标、毫米
+var canonicalSkipCodes = map[string]bool{
+	"G20": true, "G21": true, "G90": true, "G91": true,
+}
+
+// canonicalResolvedWords 由解释器状态重新生成的代码字
+var canonicalResolvedWords = map[byte]bool{
+	'N': true, 'X': true, 'Y': true, 'Z': true, 'I': true, 'J': true, 'K': true, 'R': true, 'F': true, 'S': true,
+}
+
+// CanonicalOptions 规范化参数
+type CanonicalOptions struct {
+	Precision    int  // 小数位数
+	TrimZeros    bool // 去掉小数末尾的0
+	KeepComments bool // 保留注释
+}
+
+// DefaultCanonicalOptions 默认规范化参数
+func DefaultCanonicalOptions() CanonicalOptions {
+	return CanonicalOptions{Precision: DefaultPrecision}
+}
+
+// Canonicalizer 基于解释器将程序段改写为稳定的形式：
+// 大写字母、固定小数位数、绝对坐标和毫米单位、每个运动段都写出运动命令和完整坐标、
+// 圆弧统一为 I/J 形式、F/S只在数值变化时输出、去掉行号
+// 后处理器不同但等价的程序规范化后内容相同
+type Canonicalizer struct {
+	Options CanonicalOptions
+
+	feed, power       float64
+	feedSet, powerSet bool
+	compensated       bool // 上一段的刀具半径补偿已计入运动段
+	decimalPoint      bool // 坐标总是写出小数点，方言把不带小数点的坐标按最小设定单位解释
+	dwellMillis       bool // 暂停时间按毫秒输出
+}
+
+// NewCanonicalizer 创建规范化器
+func NewCanonicalizer(opts CanonicalOptions) *Canonicalizer {
+	if opts.Precision < 0 {
+		opts.Precision = DefaultPrecision
+	}
+	return &Canonicalizer{Options: opts}
+}
+
+// SetDialect 按方言读取数值的方式输出：Fanuc 等方言的坐标总是带小数点，G4 P 按毫秒输出
+func (c *Canonicalizer) SetDialect(d Dialect) {
+	defaults := d.Defaults()
+	c.decimalPoint, c.dwellMillis = defaults.DecimalPoint, defaults.DwellMillis
+}
+
+// Format 规范化一个已执行的程序段，st为执行后的解释器状态
+// 产生多个运动段时(如 G28 经过中间点、固定循环)每段输出一行；没有需要输出的内容时返回空字符串
+// 方言识别的扩展命令和控制器专用命令(如 Klipper 的 SET_VELOCITY_LIMIT、Marlin 的 M104)不是通用语义，原样输出
+func (c *Canonicalizer) Format(b *Block, segments []Segment, st *State) string {
+	if b.Command != "" {
+		return c.withComment(b, commandText(b))
+	}
+	var codes, others []string
+	dwellLetter, dwell, isDwell := dwellWord(b)
+	cycle := IsCycle(st.Motion)
+	comp := hasCutterComp(b)
+	// 刀具半径补偿已计入运动段时去掉 G40/G41/G42 和 D；没有刀具直径等原因没有补偿时保留，
+	// 否则补偿和不补偿、左补偿和右补偿的程序规范化后相同
+	applied := st.CutterComp != "" && st.CompRadius > 0 && st.Plane == "G17"
+	dropComp := applied || (c.compensated && st.CutterComp == "")
+	c.compensated = applied
+	for _, word := range b.Words {
+		switch {
+		case word.Letter == 'G':
+			code := CodeName('G', word.Value)
+			switch code {
+			case MotionRapid, MotionLinear, MotionCW, MotionCCW, "G28", "G30", "G53", "G4", "G80", "G98", "G99":
+				// 运动和回参考点由运动段重新生成，暂停时间统一输出为 G4 P<秒>
+				// 固定循环展开为直线运动，不再需要取消和退回方式
+			case "G73", "G81", "G82", "G83", "G84", "G85", "G86", "G87", "G88", "G89":
+			case "G40", "G41", "G42", "G41.1", "G42.1":
+				if !dropComp {
+					codes = append(codes, code)
+					if d, ok := b.Get('D'); ok && code != "G40" {
+						codes = append(codes, c.compWord(code, d, st))
+					}
+				}
+			default:
+				if !canonicalSkipCodes[code] {
+					codes = append(codes, code)
+				}
+			}
+		case word.Letter == 'M' || word.Letter == 'T':
+			others = append(others, CodeName(word.Letter, word.Value))
+		case isDwell && word.Letter == 'P':
+		case comp && word.Letter == 'D':
+		case cycle && (word.Letter == 'P' || word.Letter == 'Q' || word.Letter == 'L'):
+		case !canonicalResolvedWords[word.Letter]:
+			others = append(others, c.word(word.Letter, word.Value))
+		}
+	}
+
+	var lines []string
+	parts := codes
+	for i := range segments {
+		if i > 0 {
+			lines = append(lines, strings.Join(parts, " "))
+			parts = nil
+		}
+		seg := &segments[i]
+		parts = append(parts, seg.Motion, c.word('X', seg.To.X), c.word('Y', seg.To.Y))
+		if seg.To.Z != 0 || seg.From.Z != 0 {
+			parts = append(parts, c.word('Z', seg.To.Z))
+		}
+		if seg.IsArc() {
+			parts = append(parts, c.word('I', seg.Center.X-seg.From.X), c.word('J', seg.Center.Y-seg.From.Y))
+		}
+		if !seg.IsRapid() && (!c.feedSet || c.feed != st.Feed) && st.FeedSet {
+			parts = append(parts, "F"+c.number(st.Feed))
+			c.feed, c.feedSet = st.Feed, true
+		}
+		if seg.Dwell > 0 {
+			// 固定循环的孔底暂停
+			lines = append(lines, strings.Join(parts, " "))
+			parts = []string{"G4", c.dwell(seg.Dwell)}
+		}
+	}
+	if b.HasCode("G10") || b.HasCode("G43.1") {
+		// 坐标系原点和刀具长度不是运动目标，换算为毫米后原样输出
+		for _, axis := range []byte{'X', 'Y', 'Z'} {
+			if v, ok := b.Get(axis); ok {
+				if st.Inches {
+					v *= inchToMM
+				}
+				parts = append(parts, c.word(axis, v))
+			}
+		}
+	}
+	if len(segments) == 0 && b.HasCode("G92") {
+		// G92 设置后的当前坐标
+		p := st.Position
+		parts = append(parts, c.word('X', p.X), c.word('Y', p.Y), c.word('Z', p.Z))
+	}
+	if isDwell {
+		parts = append(parts, "G4", c.dwell(dwell))
+	}
+	if b.Has('S') && dwellLetter != 'S' && (!c.powerSet || c.power != st.Power) {
+		parts = append(parts, "S"+c.number(st.Power))
+		c.power, c.powerSet = st.Power, true
+	}
+	parts = append(parts, others...)
+
+	line := c.withComment(b, strings.Join(parts, " "))
+	return strings.Join(append(lines, line), "\n")
+}
+
+// withComment 需要保留注释时在行尾加上程序段的注释
+func (c *Canonicalizer) withComment(b *Block, line string) string {
+	if c.Options.KeepComments && b.Comment != "" {
+		if line != "" {
+			line += " "
+		}
+		line += "; " + b.Comment
+	}
+	return line
+}
+
+// commandText 扩展命令的原文，去掉程序段号、校验和与注释
+func commandText(b *Block) string {
+	line := b.Raw
+	if b.HasChecksum {
+		line = line[:b.ChecksumPos]
+	}
+	if i := strings.IndexByte(line, ';'); i >= 0 {
+		line = line[:i]
+	}
+	line = strings.TrimSpace(line)
+	if b.HasNumber {
+		line = strings.TrimSpace(strings.TrimLeft(line[1:], "0123456789"))
+	}
+	return line
+}
+
+// compWord 刀具半径补偿的 D 字：G41/G42 为刀具直径表中的刀号，G41.1/G42.1 为刀具直径，换算为毫米
+func (c *Canonicalizer) compWord(code string, d float64, st *State) string {
+	if code == "G41" || code == "G42" {
+		return CodeName('D', d)
+	}
+	if st.Inches {
+		d *= inchToMM
+	}
+	return c.word('D', d)
+}
+
+// word 格式化代码字，方言要求时坐标总是带小数点
+func (c *Canonicalizer) word(letter byte, v float64) string {
+	s := c.number(v)
+	if c.decimalPoint && decimalPointLetters[letter] && !strings.Contains(s, ".") {
+		s += "."
+	}
+	return string(letter) + s
+}
+
+// dwell 暂停时间的 P 字，v 为秒；方言按毫秒读取时输出整数毫秒
+func (c *Canonicalizer) dwell(v float64) string {
+	if c.dwellMillis {
+		return "P" + strconv.FormatFloat(math.Round(v*1000), 'f', -1, 64)
+	}
+	return "P" + c.number(v)
+}
+
+// number 按固定小数位数格式化数值
+func (c *Canonicalizer) number(v float64) string {
+	s := strconv.FormatFloat(v, 'f', c.Options.Precision, 64)
+	if c.Options.TrimZeros && strings.Contains(s, ".") {
+		s = strings.TrimRight(s, "0")
+		s = strings.TrimSuffix(s, ".")
+	}
+	if strings.TrimLeft(s, "-0.") == "" {
+		// 去掉 -0.000 的负号
+		s = strings.TrimPrefix(s, "-")
+	}
+	return s
+}
+
+// Canonicalize 将整个G代码输入改写为规范形式
+// interp 决定控制器方言、刀具表等，为nil时按通用方言执行；输出的数值按方言读取的单位写出
+func Canonicalize(w io.Writer, r io.Reader, interp *Interpreter, opts CanonicalOptions) error {
+	if interp == nil {
+		interp = NewInterpreter()
+	}
+	bw := bufio.NewWriter(w)
+	// 输出统一为绝对坐标、毫米单位
+	bw.WriteString("G21 G90\n")
+
+	c := NewCanonicalizer(opts)
+	c.SetDialect(interp.Dialect)
+	err := Run(r, interp, func(b *Block, segments []Segment) error {
+		line := c.Format(b, segments, &interp.State)
+		if line == "" {
+			return nil
+		}
+		bw.WriteString(line)
+		return bw.WriteByte('\n')
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,203 @@
+package gcode
+
+import (
+	"strings"
+	"testing"
+)
+
+// canonicalText 用解释器 in 执行程序并规范化每个程序段
+func canonicalText(t *testing.T, in *Interpreter, src string, opts CanonicalOptions) string {
+	t.Helper()
+	c := NewCanonicalizer(opts)
+	var lines []string
+	err := Run(strings.NewReader(src), in, func(b *Block, segments []Segment) error {
+		if line := c.Format(b, segments, &in.State); line != "" {
+			lines = append(lines, line)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestCanonical(t *testing.T) {
+	trim := CanonicalOptions{Precision: 3, TrimZeros: true}
+	tests := []struct {
+		name string
+		src  string
+		opts CanonicalOptions
+		want string
+	}{
+		{
+			name: "固定小数位数",
+			src:  "G1 X1 Y2.5 F100",
+			opts: DefaultCanonicalOptions(),
+			want: "G1 X1.000 Y2.500 F100.000",
+		},
+		{
+			name: "去掉行号、小写和多余的模态命令",
+			src:  "n10 g21 g90 g0 x1 y1",
+			opts: trim,
+			want: "G0 X1 Y1",
+		},
+		{
+			name: "相对坐标改为绝对坐标，省略的坐标补全",
+			src:  "G91\nG1 X10 F100\nY5",
+			opts: trim,
+			want: "G1 X10 Y0 F100\nG1 X10 Y5",
+		},
+		{
+			name: "英制换算为毫米",
+			src:  "G20 G1 X1 F10",
+			opts: trim,
+			want: "G1 X25.4 Y0 F254",
+		},
+		{
+			name: "R 形式的圆弧改为 I/J",
+			src:  "G0 X0 Y0\nG2 X10 Y0 R5 F100",
+			opts: trim,
+			want: "G0 X0 Y0\nG2 X10 Y0 I5 J0 F100",
+		},
+		{
+			name: "F/S 只在变化时输出",
+			src:  "M3 S500\nG1 X1 F100\nG1 X2 F100 S500\nG1 X3 F200 S600",
+			opts: trim,
+			want: "S500 M3\nG1 X1 Y0 F100\nG1 X2 Y0\nG1 X3 Y0 F200 S600",
+		},
+		{
+			name: "固定循环展开为直线运动",
+			src:  "G0 Z5\nG81 X1 Y1 Z-2 R1 F100\nG80",
+			opts: trim,
+			want: "G0 X0 Y0 Z5\nG0 X1 Y1 Z5\nG0 X1 Y1 Z1\nG1 X1 Y1 Z-2 F100\nG0 X1 Y1 Z5",
+		},
+		{
+			name: "暂停时间统一为秒",
+			src:  "G4 P0.5",
+			opts: trim,
+			want: "G4 P0.5",
+		},
+		{
+			name: "默认去掉注释",
+			src:  "G0 X1 ; 移动\n(只有注释)",
+			opts: trim,
+			want: "G0 X1 Y0",
+		},
+		{
+			name: "保留注释",
+			src:  "G0 X1 ; 移动\n(只有注释)",
+			opts: CanonicalOptions{Precision: 3, TrimZeros: true, KeepComments: true},
+			want: "G0 X1 Y0 ; 移动\n; 只有注释",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canonicalText(t, NewInterpreter(), tt.src, tt.opts); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalCompensation(t *testing.T) {
+	opts := CanonicalOptions{Precision: 3, TrimZeros: true}
+	tests := []struct {
+		name      string
+		src       string
+		diameters map[int]float64
+		want      string
+	}{
+		{
+			name: "没有刀具直径时保留补偿命令",
+			src:  "G41 D1 G1 X10 Y0 F500\nG40 G1 X20",
+			want: "G41 D1 G1 X10 Y0 F500\nG40 G1 X20 Y0",
+		},
+		{
+			name: "右补偿与左补偿不同",
+			src:  "G42 D1 G1 X10 Y0 F500\nG40 G1 X20",
+			want: "G42 D1 G1 X10 Y0 F500\nG40 G1 X20 Y0",
+		},
+		{
+			name:      "补偿计入运动段后去掉补偿命令",
+			src:       "G0 X0 Y-5\nG41 D1 G1 Y0 F100\nY10\nG40 G1 X5",
+			diameters: map[int]float64{1: 2},
+			want:      "G0 X0 Y-5\nG1 X-1 Y0 F100\nG1 X-1 Y10\nG1 X5 Y10",
+		},
+		{
+			name: "不在 G17 平面时保留补偿，直径换算为毫米",
+			src:  "G20 G18\nG41.1 D0.1 G1 X1 F10\nG40",
+			want: "G18\nG41.1 D2.54 G1 X25.4 Y0 F254\nG40",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := NewInterpreter()
+			for tool, d := range tt.diameters {
+				in.Diameters[tool] = d
+			}
+			if got := canonicalText(t, in, tt.src, opts); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalizeDialect(t *testing.T) {
+	opts := CanonicalOptions{Precision: 3, TrimZeros: true}
+	tests := []struct {
+		name    string
+		dialect string
+		src     string
+		want    string
+	}{
+		{
+			name:    "Fanuc 不带小数点的坐标按 0.001mm 解释，输出总是带小数点",
+			dialect: "fanuc",
+			src:     "G0 X100 Y2.\nG1 X50.5 F500",
+			want:    "G0 X0.1 Y2.\nG1 X50.5 Y2. F500",
+		},
+		{
+			name:    "Fanuc 暂停时间按毫秒输出",
+			dialect: "fanuc",
+			src:     "G4 P1500",
+			want:    "G4 P1500",
+		},
+		{
+			name:    "Klipper 扩展命令原样输出",
+			dialect: "klipper",
+			src:     "SET_VELOCITY_LIMIT ACCEL=3000 ; 加速度\nG1 X1 F600",
+			want:    "SET_VELOCITY_LIMIT ACCEL=3000\nG1 X1 Y0 F600",
+		},
+		{
+			name:    "Marlin 控制器专用命令原样输出",
+			dialect: "marlin",
+			src:     "N10 M104 S200*98\nG4 S1",
+			want:    "M104 S200\nG4 P1000",
+		},
+		{
+			name:    "通用方言",
+			dialect: "generic",
+			src:     "G0 X100\nG4 P1.5",
+			want:    "G0 X100 Y0\nG4 P1.5",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, ok := LookupDialect(tt.dialect)
+			if !ok {
+				t.Fatalf("未知的方言 %s", tt.dialect)
+			}
+			in := NewInterpreter()
+			in.Dialect = d
+			var out strings.Builder
+			if err := Canonicalize(&out, strings.NewReader(tt.src), in, opts); err != nil {
+				t.Fatalf("Canonicalize: %v", err)
+			}
+			want := "G21 G90\n" + tt.want + "\n"
+			if out.String() != want {
+				t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package gcode
+
+// supportedCodes 解释器支持的G/M命令
+var supportedCodes = map[string]string{
+	"G0":    "快速移动",
+	"G1":    "直线插补",
+	"G2":    "顺时针圆弧",
+	"G3":    "逆时针圆弧",
+	"G4":    "暂停",
+	"G10":   "设置工件坐标系原点/刀具长度",
+	"G17":   "XY平面",
+	"G18":   "XZ平面",
+	"G19":   "YZ平面",
+	"G20":   "英制单位",
+	"G21":   "公制单位",
+	"G25":   "光栅扫描(设备自定义)",
+	"G28":   "回原点",
+	"G28.1": "设置G28参考点",
+	"G30":   "回第二参考点",
+	"G30.1": "设置G30参考点",
+	"G40":   "取消刀具半径补偿",
+	"G41":   "刀具半径左补偿",
+	"G42":   "刀具半径右补偿",
+	"G43":   "刀具长度补偿",
+	"G43.1": "动态刀具长度补偿",
+	"G49":   "取消刀具长度补偿",
+	"G53":   "机器坐标移动",
+	"G54":   "工件坐标系1",
+	"G55":   "工件坐标系2",
+	"G56":   "工件坐标系3",
+	"G57":   "工件坐标系4",
+	"G58":   "工件坐标系5",
+	"G59":   "工件坐标系6",
+	"G59.1": "工件坐标系7",
+	"G59.2": "工件坐标系8",
+	"G59.3": "工件坐标系9",
+	"G73":   "断屑钻孔循环",
+	"G80":   "取消固定循环",
+	"G81":   "钻孔循环",
+	"G82":   "孔底暂停钻孔循环",
+	"G83":   "啄钻循环",
+	"G84":   "攻丝循环",
+	"G85":   "镗孔循环(进给退回)",
+	"G86":   "镗孔循环(主轴停止退回)",
+	"G87":   "背镗循环",
+	"G88":   "镗孔循环(手动退回)",
+	"G89":   "镗孔循环(暂停后进给退回)",
+	"G90":   "绝对坐标",
+	"G91":   "相对坐标",
+	"G92":   "设置当前坐标",
+	"G92.1": "取消G92坐标偏移",
+	"G92.2": "暂停G92坐标偏移",
+	"G92.3": "恢复G92坐标偏移",
+	"G98":   "固定循环退回起始高度",
+	"G99":   "固定循环退回R平面",
+	"M0":    "程序暂停",
+	"M1":    "选择性暂停",
+	"M2":    "程序结束",
+	"M3":    "主轴正转/激光开启",
+	"M4":    "主轴反转/动态激光开启",
+	"M5":    "主轴停止/激光关闭",
+	"M6":    "换刀",
+	"M7":    "雾状冷却",
+	"M8":    "冷却液开",
+	"M9":    "冷却关闭",
+	"M30":   "程序结束并复位",
+	"M110":  "设置当前行号",
+}
+
+// IsSupported 命令是否被支持
+func IsSupported(code string) bool {
+	_, ok := supportedCodes[code]
+	return ok
+}
+
+// CodeDescription 返回命令说明
+func CodeDescription(code string) string {
+	return supportedCodes[code]
+}
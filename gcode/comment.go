@@ -0,0 +1,72 @@
+package gcode
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxMetadataKey 元数据键的最大长度，过长的通常是普通注释
+const maxMetadataKey = 64
+
+// markerKinds 表示程序分段的注释关键字，如 ;LAYER:3、(element 2)、; ==== 元素 1 ====
+var markerKinds = map[string]string{
+	"layer":     "layer",
+	"图层":        "layer",
+	"element":   "element",
+	"元素":        "element",
+	"operation": "operation",
+	"op":        "operation",
+	"工序":        "operation",
+	"type":      "type",
+	"feature":   "type",
+	"tool":      "tool",
+	"刀具":        "tool",
+}
+
+// ParseComment 解析 CAM 软件写入的元数据注释，如 "FLAVOR:Marlin"、"layer_height = 0.2"
+// 键以字母开头，与值之间用冒号或等号分隔
+func ParseComment(text string) (key, value string, ok bool) {
+	i := strings.IndexAny(text, ":=")
+	if i <= 0 {
+		return "", "", false
+	}
+	key = strings.TrimSpace(text[:i])
+	value = strings.TrimSpace(text[i+1:])
+	if key == "" || len(key) > maxMetadataKey || !startsWithLetter(key) {
+		return "", "", false
+	}
+	return key, value, true
+}
+
+// Marker 识别表示程序分段的注释，返回分段类型(layer/element/operation/type/tool)和名称
+// 如 ";LAYER:3" 返回 layer、3，"(element 2)" 返回 element、2
+func Marker(text string) (kind, name string, ok bool) {
+	text = strings.Trim(text, "=-# \t")
+	end := 0
+	for end < len(text) {
+		r, size := utf8.DecodeRuneInString(text[end:])
+		if !unicode.IsLetter(r) {
+			break
+		}
+		end += size
+	}
+	// layer_height 之类的键不是分段标记
+	if end == 0 || (end < len(text) && text[end] == '_') {
+		return "", "", false
+	}
+	kind, ok = markerKinds[strings.ToLower(text[:end])]
+	if !ok {
+		return "", "", false
+	}
+	name = strings.TrimSpace(strings.TrimLeft(text[end:], ":= \t"))
+	return kind, name, true
+}
+
+// startsWithLetter 是否以字母开头
+func startsWithLetter(s string) bool {
+	for _, r := range s {
+		return unicode.IsLetter(r)
+	}
+	return false
+}
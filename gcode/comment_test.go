@@ -0,0 +1,45 @@
+package gcode
+
+import "testing"
+
+func TestParseComment(t *testing.T) {
+	tests := []struct {
+		text       string
+		key, value string
+		ok         bool
+	}{
+		{"FLAVOR:Marlin", "FLAVOR", "Marlin", true},
+		{" layer_height = 0.2", "layer_height", "0.2", true},
+		{"材料: 钢", "材料", "钢", true},
+		{"12:30", "", "", false},
+		{"no separator", "", "", false},
+		{":value", "", "", false},
+	}
+	for _, tt := range tests {
+		key, value, ok := ParseComment(tt.text)
+		if key != tt.key || value != tt.value || ok != tt.ok {
+			t.Errorf("ParseComment(%q) = %q, %q, %v", tt.text, key, value, ok)
+		}
+	}
+}
+
+func TestMarker(t *testing.T) {
+	tests := []struct {
+		text       string
+		kind, name string
+		ok         bool
+	}{
+		{"LAYER:3", "layer", "3", true},
+		{"element 2", "element", "2", true},
+		{" ==== 元素 1 ====", "element", "1", true},
+		{"TYPE:WALL-OUTER", "type", "WALL-OUTER", true},
+		{"layer_height = 0.2", "", "", false},
+		{"cut outline", "", "", false},
+	}
+	for _, tt := range tests {
+		kind, name, ok := Marker(tt.text)
+		if kind != tt.kind || name != tt.name || ok != tt.ok {
+			t.Errorf("Marker(%q) = %q, %q, %v", tt.text, kind, name, ok)
+		}
+	}
+}
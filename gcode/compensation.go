@@ -0,0 +1,427 @@
+package gcode
+
+import (
+	"fmt"
+	"math"
+)
+
+// compEpsilon 刀具半径补偿的几何容差(mm)
+const compEpsilon = 1e-6
+
+// CompIssue 刀具半径补偿的问题，如内拐角过切、圆弧半径小于刀具半径
+type CompIssue struct {
+	Line    int    // 行号
+	Message string // 问题说明
+}
+
+// CompReport 刀具半径补偿的统计，长度只统计补偿生效期间(包括建立和取消补偿的移动)的进给运动
+type CompReport struct {
+	Used        bool        // 是否使用了 G41/G42
+	Programmed  float64     // 编程路径长度(mm)
+	Compensated float64     // 补偿后刀具中心路径长度(mm)，包括外拐角的过渡圆弧
+	Issues      []CompIssue // 补偿问题
+}
+
+// compIssue 记录刀具半径补偿的问题，循环中同一行的相同问题只记录一次
+func (in *Interpreter) compIssue(line int, format string, args ...interface{}) {
+	issue := CompIssue{Line: line, Message: fmt.Sprintf(format, args...)}
+	if in.compIssued == nil {
+		in.compIssued = map[CompIssue]bool{}
+	}
+	if in.compIssued[issue] {
+		return
+	}
+	in.compIssued[issue] = true
+	in.Comp.Issues = append(in.Comp.Issues, issue)
+}
+
+// hasCutterComp 程序段中是否有 G40/G41/G42 命令
+func hasCutterComp(b *Block) bool {
+	for _, w := range b.Words {
+		if w.Letter == 'G' && modalGroups[CodeName('G', w.Value)] == GroupCutterComp {
+			return true
+		}
+	}
+	return false
+}
+
+// pendingBlock 等待输出的程序段，state 为该段执行后的解释器状态
+type pendingBlock struct {
+	block    *Block
+	segments []Segment
+	state    State
+}
+
+// segmentRef 等待输出的运动段在 pending 中的位置
+type segmentRef struct {
+	block, index int
+}
+
+// compensator 按刀具半径补偿把编程路径换算为刀具中心路径
+// G41/G42 生效时刀具中心沿路径法向偏移一个刀具半径，每段的终点要由下一段运动确定：
+// 内拐角两段都裁剪到偏移路径的交点，外拐角绕编程拐角点插入过渡圆弧。
+// 因此补偿生效时程序段延迟到下一个平面运动之后输出，输出时解释器状态恢复为该段执行后的状态
+type compensator struct {
+	interp  *Interpreter
+	fn      func(b *Block, segments []Segment) error
+	pending []pendingBlock
+	open    segmentRef   // 终点待定的补偿段，block 为 -1 时没有
+	program Segment      // open 对应的编程段
+	follow  []segmentRef // open 之后只有 Z 移动的段，XY 跟随 open 的终点
+	pos     Point        // 刀具中心的当前位置
+	offset  bool         // 刀具中心是否偏离编程位置
+	line    int          // 最后执行的行号
+}
+
+// newCompensator 创建补偿器，fn 按执行顺序接收补偿后的程序段
+func newCompensator(interp *Interpreter, fn func(b *Block, segments []Segment) error) *compensator {
+	return &compensator{interp: interp, fn: fn, open: segmentRef{-1, -1}}
+}
+
+// add 处理一个已执行的程序段，没有使用补偿时直接输出
+func (c *compensator) add(b *Block, segments []Segment) error {
+	st := &c.interp.State
+	c.line = b.Line
+	if len(c.pending) == 0 && !c.offset && st.CutterComp == "" {
+		return c.fn(b, segments)
+	}
+	c.pending = append(c.pending, pendingBlock{block: b, state: *st})
+	for i := range segments {
+		c.segment(segments[i], st)
+	}
+	if c.open.block < 0 {
+		return c.flush(len(c.pending))
+	}
+	return c.flush(c.open.block)
+}
+
+// holding 是否有等待输出的程序段，此时这些程序段不能重复使用
+func (c *compensator) holding() bool {
+	return len(c.pending) > 0
+}
+
+// finish 程序结束，输出所有等待的程序段
+func (c *compensator) finish() error {
+	if c.interp.State.CutterComp != "" {
+		c.interp.compIssue(c.line, "程序结束时刀具半径补偿仍然生效，缺少 G40")
+	}
+	c.close()
+	return c.flush(len(c.pending))
+}
+
+// segment 补偿一个运动段，结果加入最后一个等待的程序段
+func (c *compensator) segment(p Segment, st *State) {
+	report := &c.interp.Comp
+	if !p.IsRapid() {
+		report.Programmed += p.Length()
+	}
+	side := 0.0
+	switch st.CutterComp {
+	case "G41":
+		side = 1
+	case "G42":
+		side = -1
+	}
+	if side != 0 {
+		report.Used = true
+		switch {
+		case st.Plane != "G17":
+			c.interp.compIssue(p.Line, "刀具半径补偿只支持 G17 平面，按编程路径计算")
+			side = 0
+		case p.Cycle != "":
+			c.interp.compIssue(p.Line, "刀具半径补偿生效时不能使用固定循环 %s", p.Cycle)
+			side = 0
+		}
+	}
+	if side == 0 || st.CompRadius <= 0 {
+		// 取消补偿后的第一段从刀具中心位置移动到编程位置
+		c.close()
+		if c.offset {
+			p.From = c.pos
+			c.offset = false
+		}
+		c.emit(p)
+		return
+	}
+
+	r := st.CompRadius
+	if !p.IsArc() && math.Hypot(p.To.X-p.From.X, p.To.Y-p.From.Y) < compEpsilon {
+		// 只有 Z 的移动，刀具中心的 XY 不变
+		if c.offset {
+			p.From.X, p.From.Y = c.pos.X, c.pos.Y
+			p.To.X, p.To.Y = c.pos.X, c.pos.Y
+		}
+		ref := c.emit(p)
+		if c.open.block >= 0 {
+			c.follow = append(c.follow, ref)
+		}
+		return
+	}
+
+	el, ok := offsetSegment(p, side, r)
+	if !ok {
+		c.interp.compIssue(p.Line, "圆弧半径 %.3f 不大于刀具半径 %.3f，无法在内侧补偿", p.Radius(), r)
+	}
+	if c.open.block < 0 {
+		// 建立补偿：从当前位置移动到第一段偏移后的终点
+		if !c.offset && p.IsArc() {
+			c.interp.compIssue(p.Line, "不能在圆弧上建立刀具半径补偿")
+		}
+		if c.offset {
+			el.From = c.pos
+		} else {
+			el.From = p.From
+		}
+	} else {
+		c.corner(p, &el, side)
+	}
+	c.open = c.emit(el)
+	c.program = p
+	c.follow = nil
+	c.offset = true
+}
+
+// corner 连接终点待定的补偿段和下一段：相切时直接连接，内拐角两段都裁剪到交点，
+// 外拐角(包括折返)绕编程拐角点插入刀具半径的过渡圆弧，圆弧属于下一段
+func (c *compensator) corner(p Segment, el *Segment, side float64) {
+	open := c.at(c.open)
+	in, out := tangentAt(&c.program, c.program.To), tangentAt(&p, p.From)
+	cross := in.X*out.Y - in.Y*out.X
+	dot := in.X*out.X + in.Y*out.Y
+	switch {
+	case math.Abs(cross) < compEpsilon && dot > 0:
+		el.From = c.pos
+	case math.Abs(cross) >= compEpsilon && side*cross > 0:
+		x, ok := intersect(open, el, p.From)
+		if !ok {
+			c.interp.compIssue(p.Line, "内拐角处补偿后的路径不相交，无法补偿")
+			link := p
+			link.From, link.To = c.pos, el.From
+			link.Motion = MotionLinear
+			if p.IsRapid() {
+				link.Motion = MotionRapid
+			}
+			link.Cycle, link.Hole, link.Dwell = "", false, 0
+			c.emit(link)
+			return
+		}
+		if trimReverses(open, x, true) {
+			c.interp.compIssue(c.program.Line, "内拐角过切：移动距离小于刀具半径补偿需要的距离")
+		}
+		if trimReverses(el, x, false) {
+			c.interp.compIssue(p.Line, "内拐角过切：移动距离小于刀具半径补偿需要的距离")
+		}
+		c.moveOpenEnd(x)
+		el.From.X, el.From.Y = x.X, x.Y
+	default:
+		arc := p
+		arc.From, arc.To = c.pos, el.From
+		arc.Center = p.From
+		arc.Cycle, arc.Hole, arc.Dwell = "", false, 0
+		switch {
+		case p.IsRapid():
+			// 快速移动直线连接
+		case side > 0:
+			arc.Motion = MotionCW
+		default:
+			arc.Motion = MotionCCW
+		}
+		c.emit(arc)
+	}
+}
+
+// emit 把运动段加入最后一个等待的程序段
+func (c *compensator) emit(s Segment) segmentRef {
+	last := len(c.pending) - 1
+	blk := &c.pending[last]
+	blk.segments = append(blk.segments, s)
+	c.pos = s.To
+	return segmentRef{last, len(blk.segments) - 1}
+}
+
+// at 返回等待输出的运动段
+func (c *compensator) at(ref segmentRef) *Segment {
+	return &c.pending[ref.block].segments[ref.index]
+}
+
+// close 确定终点待定的补偿段
+func (c *compensator) close() {
+	c.open = segmentRef{-1, -1}
+	c.follow = nil
+}
+
+// moveOpenEnd 把终点待定的补偿段及其后的 Z 移动的 XY 移到 x
+func (c *compensator) moveOpenEnd(x Point) {
+	open := c.at(c.open)
+	open.To.X, open.To.Y = x.X, x.Y
+	for _, ref := range c.follow {
+		s := c.at(ref)
+		s.From.X, s.From.Y = x.X, x.Y
+		s.To.X, s.To.Y = x.X, x.Y
+	}
+	c.pos.X, c.pos.Y = x.X, x.Y
+}
+
+// flush 输出前 n 个等待的程序段
+func (c *compensator) flush(n int) error {
+	if n <= 0 {
+		return nil
+	}
+	current := c.interp.State
+	defer func() { c.interp.State = current }()
+	for i := 0; i < n; i++ {
+		pb := &c.pending[i]
+		for j := range pb.segments {
+			if !pb.segments[j].IsRapid() {
+				c.interp.Comp.Compensated += pb.segments[j].Length()
+			}
+		}
+		c.interp.State = pb.state
+		if err := c.fn(pb.block, pb.segments); err != nil {
+			return err
+		}
+	}
+	c.pending = c.pending[:copy(c.pending, c.pending[n:])]
+	if c.open.block >= 0 {
+		c.open.block -= n
+	}
+	for i := range c.follow {
+		c.follow[i].block -= n
+	}
+	return nil
+}
+
+// offsetSegment 把编程段沿法向偏移刀具半径 r，side 为 1 时刀具在路径左侧(G41)，-1 时在右侧(G42)
+// 圆弧的圆心不变，半径增减 r；内侧补偿时圆弧半径不大于 r 返回 false
+func offsetSegment(p Segment, side, r float64) (Segment, bool) {
+	if !p.IsArc() {
+		dx, dy := p.To.X-p.From.X, p.To.Y-p.From.Y
+		l := math.Hypot(dx, dy)
+		nx, ny := -dy/l*side*r, dx/l*side*r
+		p.From.X, p.From.Y = p.From.X+nx, p.From.Y+ny
+		p.To.X, p.To.Y = p.To.X+nx, p.To.Y+ny
+		return p, true
+	}
+	dir := 1.0
+	if p.Motion == MotionCW {
+		dir = -1
+	}
+	radius := p.Radius() - side*dir*r
+	if radius <= compEpsilon {
+		return p, false
+	}
+	for _, q := range []*Point{&p.From, &p.To} {
+		dx, dy := q.X-p.Center.X, q.Y-p.Center.Y
+		l := math.Hypot(dx, dy)
+		q.X, q.Y = p.Center.X+dx/l*radius, p.Center.Y+dy/l*radius
+	}
+	return p, true
+}
+
+// tangentAt 运动段经过 q 点时的单位切线方向(XY)
+func tangentAt(s *Segment, q Point) Point {
+	if !s.IsArc() {
+		dx, dy := s.To.X-s.From.X, s.To.Y-s.From.Y
+		l := math.Hypot(dx, dy)
+		return Point{X: dx / l, Y: dy / l}
+	}
+	rx, ry := q.X-s.Center.X, q.Y-s.Center.Y
+	l := math.Hypot(rx, ry)
+	if s.Motion == MotionCCW {
+		return Point{X: -ry / l, Y: rx / l}
+	}
+	return Point{X: ry / l, Y: -rx / l}
+}
+
+// trimReverses 把运动段的终点(end)或起点移到 x 后方向是否反转，即刀具会反向切入工件
+func trimReverses(s *Segment, x Point, end bool) bool {
+	t := *s
+	if end {
+		t.To.X, t.To.Y = x.X, x.Y
+	} else {
+		t.From.X, t.From.Y = x.X, x.Y
+	}
+	if math.Hypot(t.To.X-t.From.X, t.To.Y-t.From.Y) < compEpsilon {
+		return false
+	}
+	if !s.IsArc() {
+		return (s.To.X-s.From.X)*(t.To.X-t.From.X)+(s.To.Y-s.From.Y)*(t.To.Y-t.From.Y) < 0
+	}
+	return math.Abs(t.Sweep()) > math.Abs(s.Sweep())+compEpsilon
+}
+
+// intersect 求两个补偿段所在直线或圆的交点(XY)，有两个交点时取离 near 最近的
+func intersect(a, b *Segment, near Point) (Point, bool) {
+	var points []Point
+	switch {
+	case !a.IsArc() && !b.IsArc():
+		points = lineLine(a, b)
+	case !a.IsArc():
+		points = lineCircle(a, b)
+	case !b.IsArc():
+		points = lineCircle(b, a)
+	default:
+		points = circleCircle(a, b)
+	}
+	if len(points) == 0 {
+		return Point{}, false
+	}
+	best := points[0]
+	for _, p := range points[1:] {
+		if math.Hypot(p.X-near.X, p.Y-near.Y) < math.Hypot(best.X-near.X, best.Y-near.Y) {
+			best = p
+		}
+	}
+	return best, true
+}
+
+// lineLine 两条直线的交点，平行时没有交点
+func lineLine(a, b *Segment) []Point {
+	ax, ay := a.To.X-a.From.X, a.To.Y-a.From.Y
+	bx, by := b.To.X-b.From.X, b.To.Y-b.From.Y
+	denom := ax*by - ay*bx
+	if math.Abs(denom) < compEpsilon*math.Hypot(ax, ay)*math.Hypot(bx, by) {
+		return nil
+	}
+	t := ((b.From.X-a.From.X)*by - (b.From.Y-a.From.Y)*bx) / denom
+	return []Point{{X: a.From.X + t*ax, Y: a.From.Y + t*ay}}
+}
+
+// lineCircle 直线与圆弧所在圆的交点
+func lineCircle(l, c *Segment) []Point {
+	dx, dy := l.To.X-l.From.X, l.To.Y-l.From.Y
+	n := math.Hypot(dx, dy)
+	dx, dy = dx/n, dy/n
+	fx, fy := l.From.X-c.Center.X, l.From.Y-c.Center.Y
+	r := c.Radius()
+	b := fx*dx + fy*dy
+	disc := b*b - (fx*fx + fy*fy - r*r)
+	if disc < 0 {
+		if disc < -compEpsilon {
+			return nil
+		}
+		disc = 0
+	}
+	s := math.Sqrt(disc)
+	return []Point{
+		{X: l.From.X + (-b-s)*dx, Y: l.From.Y + (-b-s)*dy},
+		{X: l.From.X + (-b+s)*dx, Y: l.From.Y + (-b+s)*dy},
+	}
+}
+
+// circleCircle 两个圆弧所在圆的交点
+func circleCircle(a, b *Segment) []Point {
+	r0, r1 := a.Radius(), b.Radius()
+	dx, dy := b.Center.X-a.Center.X, b.Center.Y-a.Center.Y
+	d := math.Hypot(dx, dy)
+	if d < compEpsilon || d > r0+r1+compEpsilon || d < math.Abs(r0-r1)-compEpsilon {
+		return nil
+	}
+	along := (r0*r0 - r1*r1 + d*d) / (2 * d)
+	h := math.Sqrt(math.Max(r0*r0-along*along, 0))
+	mx, my := a.Center.X+along*dx/d, a.Center.Y+along*dy/d
+	return []Point{
+		{X: mx - h*dy/d, Y: my + h*dx/d},
+		{X: mx + h*dy/d, Y: my - h*dx/d},
+	}
+}
@@ -0,0 +1,100 @@
+package gcode
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestCompensator(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		line  int    // 检查该行最后一段的终点
+		want  Point  // 刀具中心位置
+		moves int    // 该行的运动段数
+		issue string // 期望的补偿问题，为空时没有问题
+	}{
+		{
+			name:  "左侧补偿直线",
+			src:   "G0 X0 Y-5\nG41 D1 G1 Y0 F100\nY10\nX10\nG40 G1 X15\n",
+			line:  3,
+			want:  Point{X: -1, Y: 10},
+			moves: 1,
+		},
+		{
+			name:  "外拐角插入过渡圆弧",
+			src:   "G0 X0 Y-5\nG41 D1 G1 Y0 F100\nY10\nX10\nG40 G1 X15\n",
+			line:  4,
+			want:  Point{X: 10, Y: 11},
+			moves: 2,
+		},
+		{
+			name:  "内拐角裁剪到交点",
+			src:   "G0 X0 Y-5\nG42 D1 G1 Y0 F100\nY10\nX10\nG40 G1 X15\n",
+			line:  3,
+			want:  Point{X: 1, Y: 9},
+			moves: 1,
+		},
+		{
+			name:  "取消补偿回到编程位置",
+			src:   "G0 X0 Y-5\nG41 D1 G1 Y0 F100\nY10\nX10\nG40 G1 X15\n",
+			line:  5,
+			want:  Point{X: 15, Y: 10},
+			moves: 1,
+		},
+		{
+			name:  "缺少 G40",
+			src:   "G0 X0 Y-5\nG41 D1 G1 Y0 F100\nY10\n",
+			line:  3,
+			want:  Point{X: -1, Y: 10},
+			moves: 1,
+			issue: "缺少 G40",
+		},
+		{
+			name:  "内侧圆弧半径过小",
+			src:   "G0 X0 Y-5\nG42 D1 G1 Y0 F100\nG2 X1 Y0 I0.5 J0\nG40 G1 Y-5\n",
+			line:  4,
+			want:  Point{X: 1, Y: -5},
+			moves: 1,
+			issue: "无法在内侧补偿",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := NewInterpreter()
+			in.Diameters[1] = 2
+			segments := runSegments(t, in, tt.src)[tt.line]
+			if len(segments) != tt.moves {
+				t.Fatalf("第 %d 行有 %d 段，want %d: %+v", tt.line, len(segments), tt.moves, segments)
+			}
+			got := segments[len(segments)-1].To
+			if math.Abs(got.X-tt.want.X) > 1e-9 || math.Abs(got.Y-tt.want.Y) > 1e-9 {
+				t.Errorf("第 %d 行终点 = (%v, %v)，want (%v, %v)", tt.line, got.X, got.Y, tt.want.X, tt.want.Y)
+			}
+			var messages []string
+			for _, issue := range in.Comp.Issues {
+				messages = append(messages, issue.Message)
+			}
+			joined := strings.Join(messages, "; ")
+			if tt.issue == "" && joined != "" || !strings.Contains(joined, tt.issue) {
+				t.Errorf("Issues = %q，want %q", joined, tt.issue)
+			}
+		})
+	}
+}
+
+func TestCompensatorLength(t *testing.T) {
+	in := NewInterpreter()
+	in.Diameters[1] = 2
+	runSegments(t, in, "G0 X0 Y-5\nG41 D1 G1 Y0 F100\nY10\nX10\nG40 G1 X15\n")
+	// 外拐角多出四分之一圆，建立和取消补偿的斜线比编程路径稍长
+	want := math.Hypot(1, 5) + 10 + math.Pi/2 + 10 + math.Hypot(5, 1)
+	if !in.Comp.Used || math.Abs(in.Comp.Compensated-want) > 1e-9 {
+		t.Errorf("Compensated = %v，want %v", in.Comp.Compensated, want)
+	}
+	if in.Comp.Programmed != 30 {
+		t.Errorf("Programmed = %v，want 30", in.Comp.Programmed)
+	}
+}
@@ -0,0 +1,119 @@
+package gcode
+
+import "math"
+
+// ContourTolerance 判断运动段首尾相连、轮廓闭合的距离容差(mm)
+const ContourTolerance = 0.01
+
+// Contour 一段连续的加工路径，由首尾相连的非快速移动段组成，终点回到起点时为闭合轮廓
+// 只比较 XY，下刀、抬刀等 Z 移动属于所在的轮廓
+type Contour struct {
+	Segments []Segment
+	Closed   bool
+}
+
+// Contours 在快速移动和不相连处把运动段分成轮廓，快速移动不属于任何轮廓
+func Contours(segments []Segment) []Contour {
+	var contours []Contour
+	start := -1
+	finish := func(end int) {
+		if start >= 0 {
+			c := Contour{Segments: segments[start:end:end]}
+			c.Closed = planarDistance(c.Start(), c.End()) <= ContourTolerance && c.Length() > ContourTolerance
+			contours = append(contours, c)
+		}
+		start = -1
+	}
+	for i := range segments {
+		s := &segments[i]
+		if s.IsRapid() {
+			finish(i)
+			continue
+		}
+		if start >= 0 && planarDistance(segments[i-1].To, s.From) > ContourTolerance {
+			finish(i)
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	finish(len(segments))
+	return contours
+}
+
+// Start 轮廓的起点
+func (c *Contour) Start() Point {
+	return c.Segments[0].From
+}
+
+// End 轮廓的终点
+func (c *Contour) End() Point {
+	return c.Segments[len(c.Segments)-1].To
+}
+
+// Length 轮廓在 XY 平面上的长度(mm)
+func (c *Contour) Length() float64 {
+	length := 0.0
+	for i := range c.Segments {
+		length += c.Segments[i].PlanarLength()
+	}
+	return length
+}
+
+// Area 轮廓围成的有向面积(mm²)，逆时针为正，圆弧按弧形精确计算；开放轮廓按首尾相连计算
+func (c *Contour) Area() float64 {
+	area := 0.0
+	for i := range c.Segments {
+		s := &c.Segments[i]
+		area += (s.From.X*s.To.Y - s.To.X*s.From.Y) / 2
+		if s.IsArc() {
+			// 弦与圆弧之间的弓形面积
+			r, sweep := s.Radius(), s.Sweep()
+			area += r * r / 2 * (sweep - math.Sin(sweep))
+		}
+	}
+	end, start := c.End(), c.Start()
+	return area + (end.X*start.Y-start.X*end.Y)/2
+}
+
+// Points 将轮廓离散为 XY 折线点，圆弧按给定弦高误差细分
+func (c *Contour) Points(tolerance float64) []Point {
+	var points []Point
+	for i := range c.Segments {
+		pts := c.Segments[i].Points(tolerance)
+		if len(points) > 0 {
+			pts = pts[1:]
+		}
+		points = append(points, pts...)
+	}
+	return points
+}
+
+// Bounds 轮廓的包围盒
+func (c *Contour) Bounds() (min, max Point) {
+	min, max = c.Segments[0].Bounds()
+	for i := range c.Segments[1:] {
+		lo, hi := c.Segments[i+1].Bounds()
+		min = Point{math.Min(min.X, lo.X), math.Min(min.Y, lo.Y), math.Min(min.Z, lo.Z)}
+		max = Point{math.Max(max.X, hi.X), math.Max(max.Y, hi.Y), math.Max(max.Z, hi.Z)}
+	}
+	return min, max
+}
+
+// Contains 点是否在闭合轮廓内部(XY)，按射线法判断
+func (c *Contour) Contains(p Point, tolerance float64) bool {
+	points := c.Points(tolerance)
+	inside := false
+	for i, j := 0, len(points)-1; i < len(points); j, i = i, i+1 {
+		a, b := points[i], points[j]
+		if (a.Y > p.Y) != (b.Y > p.Y) && p.X < (b.X-a.X)*(p.Y-a.Y)/(b.Y-a.Y)+a.X {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// planarDistance 两点在 XY 平面上的距离
+func planarDistance(a, b Point) float64 {
+	return math.Hypot(b.X-a.X, b.Y-a.Y)
+}
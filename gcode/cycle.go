@@ -0,0 +1,123 @@
+package gcode
+
+import "math"
+
+// peckClearance 啄钻返回孔内时停在上次深度上方的距离，也是 G73 断屑的回退距离(mm)
+// 与 LinuxCNC 相同，为 0.010 英寸
+const peckClearance = 0.254
+
+// MaxPecks 每个孔最多的啄钻次数，Q 过小时按该次数平分孔深，避免展开出过多的运动段
+const MaxPecks = 1000
+
+// cycleCodes 固定循环命令
+var cycleCodes = map[string]bool{
+	"G73": true, "G81": true, "G82": true, "G83": true, "G84": true,
+	"G85": true, "G86": true, "G87": true, "G88": true, "G89": true,
+}
+
+// IsCycle 是否为固定循环命令
+func IsCycle(code string) bool {
+	return cycleCodes[code]
+}
+
+// blockMotion 程序段执行后的运动模式，程序段中没有运动命令时为当前的模态运动
+func blockMotion(b *Block, st *State) string {
+	motion := st.Motion
+	for _, w := range b.Words {
+		if w.Letter != 'G' {
+			continue
+		}
+		if code := CodeName('G', w.Value); modalGroups[code] == GroupMotion {
+			motion = code
+		}
+	}
+	return motion
+}
+
+// Cycle 固定循环中一个孔的参数，坐标为工件坐标(mm)，只支持 G17 平面
+type Cycle struct {
+	Code   string  // G73、G81-G89
+	R      float64 // R 平面
+	Bottom float64 // 孔底 Z
+	Clear  float64 // 完成后退回的高度，G98 为起始高度和 R 的较大值，G99 为 R
+	Peck   float64 // G73/G83 每次进给的深度(Q)，0 表示一次钻到孔底
+	Dwell  float64 // 孔底暂停时间(秒)，G82/G86/G88/G89 使用
+}
+
+// CycleMove 固定循环展开后的一段直线移动
+type CycleMove struct {
+	To    Point
+	Rapid bool
+	Dwell float64 // 到达终点后暂停的时间(秒)
+}
+
+// Pecks G73/G83 按 Q 钻到孔底需要的进给次数，Q 为0时为1
+func (c *Cycle) Pecks() int {
+	depth := c.R - c.Bottom
+	if depth <= 0 {
+		return 0
+	}
+	if c.Peck <= 0 {
+		return 1
+	}
+	return int(math.Min(math.Ceil(depth/c.Peck), math.MaxInt32))
+}
+
+// Expand 展开在 (x, y) 处钻一个孔的移动，from 为当前位置
+// 当前高度低于 R 时先快速抬到 R，然后快速移动到孔位、下降到 R，按循环类型加工到孔底后退回 Clear：
+// G81/G87 进给到孔底；G82/G86/G88 孔底暂停后快速退回；G84/G85 进给退回 R；G89 暂停后进给退回 R；
+// G83 每次进给 Q 后快速退回 R；G73 每次进给 Q 后回退一小段断屑，超过 MaxPecks 次时按 MaxPecks 次平分。G87 背镗按 G81 处理，不展开 I/J 偏移
+func (c *Cycle) Expand(from Point, x, y float64) []CycleMove {
+	var moves []CycleMove
+	pos := from
+	to := func(p Point, rapid bool, dwell float64) {
+		if p != pos || dwell > 0 {
+			moves = append(moves, CycleMove{To: p, Rapid: rapid, Dwell: dwell})
+			pos = p
+		}
+	}
+	atZ := func(z float64) Point {
+		return Point{X: pos.X, Y: pos.Y, Z: z}
+	}
+
+	if pos.Z < c.R {
+		to(atZ(c.R), true, 0)
+	}
+	to(Point{X: x, Y: y, Z: pos.Z}, true, 0)
+	to(atZ(c.R), true, 0)
+
+	switch c.Code {
+	case "G73", "G83":
+		peck := c.Peck
+		if c.Pecks() > MaxPecks {
+			peck = (c.R - c.Bottom) / MaxPecks
+		}
+		depth := c.R
+		for depth > c.Bottom {
+			next := c.Bottom
+			if peck > 0 {
+				next = math.Max(depth-peck, c.Bottom)
+			}
+			to(atZ(next), false, 0)
+			if next > c.Bottom {
+				if c.Code == "G83" {
+					to(atZ(c.R), true, 0)
+				}
+				to(atZ(next+peckClearance), true, 0)
+			}
+			depth = next
+		}
+	case "G82", "G86", "G88":
+		to(atZ(c.Bottom), false, c.Dwell)
+	case "G84", "G85":
+		to(atZ(c.Bottom), false, 0)
+		to(atZ(c.R), false, 0)
+	case "G89":
+		to(atZ(c.Bottom), false, c.Dwell)
+		to(atZ(c.R), false, 0)
+	default:
+		to(atZ(c.Bottom), false, 0)
+	}
+	to(atZ(c.Clear), true, 0)
+	return moves
+}
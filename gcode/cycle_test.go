@@ -0,0 +1,126 @@
+package gcode
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestCycle(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		holes []Point // 每个孔第一段进给的终点
+		end   Point   // 程序结束时的位置
+		feeds int     // 进给段数
+	}{
+		{
+			name:  "G99 返回 R 平面",
+			src:   "G0 X0 Y0 Z10\nG99 G81 X5 Y5 R2 Z-3 F100\n",
+			holes: []Point{{5, 5, -3}},
+			end:   Point{5, 5, 2},
+			feeds: 1,
+		},
+		{
+			name:  "G98 返回起始高度",
+			src:   "G0 X0 Y0 Z10\nG98 G81 X5 Y5 R2 Z-3 F100\n",
+			holes: []Point{{5, 5, -3}},
+			end:   Point{5, 5, 10},
+			feeds: 1,
+		},
+		{
+			name:  "模态循环继续钻孔",
+			src:   "G0 X0 Y0 Z10\nG99 G81 X5 Y5 R2 Z-3 F100\nX10\nG80 G0 Z10\n",
+			holes: []Point{{5, 5, -3}, {10, 5, -3}},
+			end:   Point{10, 5, 10},
+			feeds: 2,
+		},
+		{
+			name:  "G91 的 R 相对当前高度，Z 相对 R",
+			src:   "G0 X0 Y0 Z10\nG91 G98 G81 X10 R-8 Z-5 L3 F100\n",
+			holes: []Point{{10, 0, -3}, {20, 0, -3}, {30, 0, -3}},
+			end:   Point{30, 0, 10},
+			feeds: 3,
+		},
+		{
+			name:  "G83 每次进给 Q",
+			src:   "G0 X0 Y0 Z5\nG99 G83 X1 R1 Z-3 Q1.5 F100\n",
+			holes: []Point{{1, 0, -0.5}},
+			end:   Point{1, 0, 1},
+			feeds: 3,
+		},
+		{
+			name:  "英制单位",
+			src:   "G20\nG0 X0 Y0 Z1\nG99 G81 X1 R0.1 Z-0.1 F10\n",
+			holes: []Point{{25.4, 0, -2.54}},
+			end:   Point{25.4, 0, 2.54},
+			feeds: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := NewInterpreter()
+			var holes []Point
+			feeds := 0
+			for _, segments := range runSegments(t, in, tt.src) {
+				for _, seg := range segments {
+					if seg.Cycle == "" {
+						continue
+					}
+					if seg.Hole {
+						holes = append(holes, seg.To)
+					}
+					if !seg.IsRapid() {
+						feeds++
+					}
+				}
+			}
+			// runSegments 按行号收集，孔按 X 排序后比较
+			sort.Slice(holes, func(i, j int) bool { return holes[i].X < holes[j].X })
+			if !reflect.DeepEqual(holes, tt.holes) {
+				t.Errorf("holes = %v, want %v", holes, tt.holes)
+			}
+			if in.State.Position != tt.end {
+				t.Errorf("Position = %v, want %v", in.State.Position, tt.end)
+			}
+			if feeds != tt.feeds {
+				t.Errorf("feeds = %d, want %d", feeds, tt.feeds)
+			}
+		})
+	}
+}
+
+func TestCycleExpandPeck(t *testing.T) {
+	c := Cycle{Code: "G73", R: 1, Bottom: -2, Clear: 1, Peck: 1}
+	var feeds []float64
+	for _, m := range c.Expand(Point{Z: 5}, 0, 0) {
+		if !m.Rapid {
+			feeds = append(feeds, m.To.Z)
+		}
+	}
+	// G73 每次进给 Q 后回退 peckClearance 断屑
+	want := []float64{0, -1, -2}
+	if !reflect.DeepEqual(feeds, want) {
+		t.Errorf("feeds = %v, want %v", feeds, want)
+	}
+}
+
+func TestCycleExpandMaxPecks(t *testing.T) {
+	c := Cycle{Code: "G83", R: 0, Bottom: -1000, Clear: 0, Peck: 0.000001}
+	if got := c.Pecks(); got <= MaxPecks {
+		t.Fatalf("Pecks() = %d, want > %d", got, MaxPecks)
+	}
+	feeds := 0
+	last := Point{}
+	for _, m := range c.Expand(Point{}, 0, 0) {
+		if !m.Rapid {
+			feeds++
+			last = m.To
+		}
+	}
+	// Q 过小时按 MaxPecks 次平分孔深，最后一次进给到孔底
+	if feeds != MaxPecks || last.Z != -1000 {
+		t.Errorf("feeds = %d to Z%g, want %d to Z-1000", feeds, last.Z, MaxPecks)
+	}
+}
@@ -0,0 +1,77 @@
+package gcode
+
+import (
+	"bytes"
+	"sort"
+)
+
+// Dialect 控制器方言，描述不同控制器对同一代码的不同解释
+// 解释器按 RS-274/NGC (LinuxCNC) 的语义执行，方言在执行前把程序段调整为该语义，
+// 并提供控制器支持的命令和默认设置
+type Dialect interface {
+	// Name 方言名称，如 grbl、marlin
+	Name() string
+	// Description 说明
+	Description() string
+	// Defaults 控制器的默认设置
+	Defaults() DialectDefaults
+	// Describe 返回命令说明，控制器不支持该命令时返回false
+	Describe(code string) (string, bool)
+	// Prepare 执行前按控制器的规则调整程序段，st为执行前的状态
+	Prepare(b *Block, st *State)
+}
+
+// DialectDefaults 控制器的默认设置，数值为0表示不指定
+type DialectDefaults struct {
+	LaserMode          bool    // 支持激光模式：G0 移动时自动关闭激光(GRBL $32=1)，机器为激光设备时生效
+	DecimalPoint       bool    // 不带小数点的坐标按最小设定单位解释，如 Fanuc 的 X100 表示 0.1mm
+	HomeDirect         bool    // G28 的坐标字只选择回原点的轴，不经过中间点(Marlin/Klipper)
+	ToolChangeOnSelect bool    // T 立即换刀，不需要 M6(Marlin/Klipper 的 T 切换挤出机)
+	DwellMillis        bool    // G4 和固定循环的 P 以毫秒为单位
+	OWords             bool    // 支持 O 字子程序、条件和循环(LinuxCNC)
+	Subprograms        bool    // 支持 O 程序号、M98/M99 子程序和 WHILE/IF/GOTO 宏语句(Fanuc)
+	MaxPower           float64 // S 的最大值，如 GRBL 的 $30=1000、Marlin 的 255
+	Accel              float64 // 默认加速度(mm/s²)
+}
+
+// dialects 已注册的方言
+var dialects = map[string]Dialect{}
+
+// RegisterDialect 注册方言，重复注册会覆盖
+func RegisterDialect(d Dialect) {
+	dialects[d.Name()] = d
+}
+
+// LookupDialect 按名称查找方言，名称为空时返回通用方言
+func LookupDialect(name string) (Dialect, bool) {
+	if name == "" {
+		return Generic, true
+	}
+	d, ok := dialects[name]
+	return d, ok
+}
+
+// Dialects 返回所有已注册的方言，按名称排序
+func Dialects() []Dialect {
+	list := make([]Dialect, 0, len(dialects))
+	for _, d := range dialects {
+		list = append(list, d)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list
+}
+
+// decimalPointLetters 适用小数点规则的地址字
+var decimalPointLetters = [256]bool{'X': true, 'Y': true, 'Z': true, 'I': true, 'J': true, 'K': true, 'R': true, 'Q': true}
+
+// ScaleWord 按小数点规则换算代码字的值，text为原始数值文本
+// 不带小数点的坐标按最小设定单位(公制 0.001mm，英制 0.0001in)解释，其他代码字不变
+func ScaleWord(letter byte, text []byte, value float64, inches bool) float64 {
+	if !decimalPointLetters[letter] || bytes.IndexByte(text, '.') >= 0 {
+		return value
+	}
+	if inches {
+		return value / 10000
+	}
+	return value / 1000
+}
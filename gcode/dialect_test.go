@@ -0,0 +1,93 @@
+package gcode
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestScaleWord(t *testing.T) {
+	tests := []struct {
+		letter byte
+		text   string
+		inches bool
+		want   float64
+	}{
+		{'X', "100", false, 0.1},
+		{'X', "100.", false, 100},
+		{'Y', "-2500", false, -2.5},
+		{'Z', "100", true, 0.01},
+		{'Q', "500", false, 0.5},
+		{'F', "100", false, 100},
+		{'S', "1000", false, 1000},
+		{'P', "1500", false, 1500},
+	}
+	for _, tt := range tests {
+		value, _ := strconv.ParseFloat(tt.text, 64)
+		if got := ScaleWord(tt.letter, []byte(tt.text), value, tt.inches); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("ScaleWord(%c%s, inches=%v) = %v, want %v", tt.letter, tt.text, tt.inches, got, tt.want)
+		}
+	}
+}
+
+func TestDialectExecute(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect string
+		src     string
+		pos     Point
+		dwell   float64 // 累计暂停时间(秒)
+		power   float64
+	}{
+		{"Fanuc 不带小数点的坐标", "fanuc", "G0 X100 Y2.5 Z-1000\n", Point{X: 0.1, Y: 2.5, Z: -1}, 0, 0},
+		{"Fanuc 英制最小单位", "fanuc", "G20 G0 X100\n", Point{X: 0.01 * inchToMM}, 0, 0},
+		{"Fanuc 进给速度不按最小单位", "fanuc", "G1 X1. F100\nM3 S1000\n", Point{X: 1}, 0, 1000},
+		{"Fanuc G4 P 为毫秒", "fanuc", "G4 P1500\n", Point{}, 1.5, 0},
+		{"Fanuc 固定循环 P 为毫秒", "fanuc", "G0 Z5.\nG82 X0 Y0 Z-1. R1. P500 F100\n", Point{Z: 5}, 0.5, 0},
+		{"Marlin G4 P 为毫秒", "marlin", "G4 P500\n", Point{}, 0.5, 0},
+		{"Marlin G4 S 为秒", "marlin", "G4 S2\n", Point{}, 2, 0},
+		{"Marlin M104 S 是温度不是功率", "marlin", "M104 S200\n", Point{}, 0, 0},
+		{"Klipper 扩展命令不执行", "klipper", "SET_VELOCITY_LIMIT ACCEL=3000 X=5\n", Point{}, 0, 0},
+		{"通用方言 G4 P 为秒", "generic", "G4 P1.5\nG0 X100\n", Point{X: 100}, 1.5, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, ok := LookupDialect(tt.dialect)
+			if !ok {
+				t.Fatalf("未知的方言 %s", tt.dialect)
+			}
+			in := NewInterpreter()
+			in.Dialect = d
+			if err := Run(strings.NewReader(tt.src), in, func(b *Block, segments []Segment) error { return nil }); err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			st := &in.State
+			if p := st.Position; math.Abs(p.X-tt.pos.X) > 1e-9 || math.Abs(p.Y-tt.pos.Y) > 1e-9 || math.Abs(p.Z-tt.pos.Z) > 1e-9 {
+				t.Errorf("Position = %+v, want %+v", p, tt.pos)
+			}
+			if math.Abs(st.Dwell-tt.dwell) > 1e-9 {
+				t.Errorf("Dwell = %v, want %v", st.Dwell, tt.dwell)
+			}
+			if st.Power != tt.power {
+				t.Errorf("Power = %v, want %v", st.Power, tt.power)
+			}
+		})
+	}
+}
+
+func TestLookupDialect(t *testing.T) {
+	if d, ok := LookupDialect(""); !ok || d != Generic {
+		t.Errorf("LookupDialect(\"\") = %v, %v", d, ok)
+	}
+	if _, ok := LookupDialect("unknown"); ok {
+		t.Error("LookupDialect(\"unknown\") = true")
+	}
+	names := make([]string, 0)
+	for _, d := range Dialects() {
+		names = append(names, d.Name())
+	}
+	if got := strings.Join(names, ","); got != "fanuc,generic,grbl,klipper,linuxcnc,marlin,ruida" {
+		t.Errorf("Dialects() = %s", got)
+	}
+}
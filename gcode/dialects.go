@@ -0,0 +1,199 @@
+package gcode
+
+import "strings"
+
+// Generic 通用方言，按 RS-274/NGC 的语义执行，未指定控制器时使用
+var Generic Dialect = &controllerDialect{
+	name:        "generic",
+	description: "通用(RS-274/NGC)",
+	defaults:    DialectDefaults{OWords: true},
+}
+
+func init() {
+	RegisterDialect(Generic)
+	RegisterDialect(&controllerDialect{
+		name:        "grbl",
+		description: "GRBL，激光模式下 G0 自动关闭激光，S 默认范围 0-1000",
+		defaults:    DialectDefaults{LaserMode: true, MaxPower: 1000},
+		codes: map[string]string{
+			"G38.2": "探测", "G43.1": "动态刀具长度补偿", "G61": "精确停止", "G80": "取消运动模式",
+			"G93": "反比时间进给", "G94": "每分钟进给",
+		},
+		removed: codeSet(append(cycleCodeList, "G41", "G42", "G43", "G59.1", "G59.2", "G59.3", "G92.2", "G92.3", "M6")...),
+	})
+	RegisterDialect(&controllerDialect{
+		name:        "marlin",
+		description: "Marlin，G4 P 以毫秒为单位，G28 的坐标字只选择回原点的轴",
+		defaults:    DialectDefaults{HomeDirect: true, ToolChangeOnSelect: true, DwellMillis: true, MaxPower: 255, Accel: 3000},
+		codes:       marlinCodes,
+		removed:     codeSet(append(cycleCodeList, "G40", "G41", "G42", "G43", "G43.1", "G49", "G92.2", "G92.3", "M6")...),
+		passive:     codeSetOf(marlinCodes),
+	})
+	RegisterDialect(&controllerDialect{
+		name:        "klipper",
+		description: "Klipper，支持 SET_VELOCITY_LIMIT 等扩展命令，G4 P 以毫秒为单位",
+		defaults:    DialectDefaults{HomeDirect: true, ToolChangeOnSelect: true, DwellMillis: true, MaxPower: 255},
+		codes:       marlinCodes,
+		removed:     codeSet(append(cycleCodeList, "G40", "G41", "G42", "G43", "G43.1", "G49", "G53", "G54", "G55", "G56", "G57", "G58", "G59", "G92.2", "G92.3", "M6")...),
+		passive:     codeSetOf(marlinCodes),
+		extended:    true,
+	})
+	RegisterDialect(&controllerDialect{
+		name:        "linuxcnc",
+		description: "LinuxCNC，RS-274/NGC 的完整实现，支持 O 字子程序",
+		defaults:    DialectDefaults{OWords: true},
+		codes: map[string]string{
+			"G33": "螺纹切削", "G38.2": "探测", "G41.1": "动态刀具半径左补偿", "G42.1": "动态刀具半径右补偿", "G61": "精确停止", "G61.1": "精确路径", "G64": "连续路径",
+			"G80": "取消运动模式", "G93": "反比时间进给", "G94": "每分钟进给",
+			"M60": "托盘交换暂停",
+			"M62": "同步数字输出开", "M63": "同步数字输出关", "M64": "数字输出开", "M65": "数字输出关",
+			"M66": "等待输入", "M67": "同步模拟输出", "M68": "模拟输出",
+		},
+	})
+	RegisterDialect(&controllerDialect{
+		name:        "fanuc",
+		description: "Fanuc，不带小数点的坐标按 0.001mm 解释，G4 P 以毫秒为单位，支持 M98 子程序",
+		defaults:    DialectDefaults{DecimalPoint: true, DwellMillis: true, Subprograms: true},
+		codes: map[string]string{
+			"G80": "取消固定循环", "G94": "每分钟进给", "G98": "返回初始平面", "G99": "返回R平面",
+			"M6": "换刀", "M8": "冷却液开", "M9": "冷却关闭", "M98": "调用子程序", "M99": "子程序返回",
+		},
+		removed: codeSet("G28.1", "G30.1", "G43.1", "G92.1", "G92.2", "G92.3"),
+	})
+	RegisterDialect(&controllerDialect{
+		name:        "ruida",
+		description: "Ruida 类激光控制器，G0 不出光，S 为 0-100 的功率百分比",
+		defaults:    DialectDefaults{LaserMode: true, MaxPower: 100},
+		removed: codeSet(append(cycleCodeList, "G10", "G28.1", "G30", "G30.1", "G40", "G41", "G42", "G43", "G43.1", "G49", "G53",
+			"G54", "G55", "G56", "G57", "G58", "G59", "G59.1", "G59.2", "G59.3", "G92.1", "G92.2", "G92.3")...),
+	})
+}
+
+// cycleCodeList 固定循环及其退回方式，3D 打印和激光控制器不支持
+var cycleCodeList = []string{"G73", "G81", "G82", "G83", "G84", "G85", "G86", "G87", "G88", "G89", "G98", "G99"}
+
+// marlinCodes Marlin 和 Klipper 增加的命令
+var marlinCodes = map[string]string{
+	"G10": "固件回抽", "G11": "固件回抽恢复", "G29": "自动调平", "G30": "Z探针测量",
+	"M82": "挤出机绝对坐标", "M83": "挤出机相对坐标", "M84": "关闭电机",
+	"M104": "设置热端温度", "M109": "等待热端温度", "M140": "设置热床温度", "M190": "等待热床温度",
+	"M106": "风扇开", "M107": "风扇关", "M117": "显示消息", "M73": "设置进度",
+	"M201": "最大加速度", "M203": "最大速度", "M204": "加速度", "M205": "高级运动设置",
+	"M220": "速度倍率", "M221": "挤出倍率", "M400": "等待移动完成",
+}
+
+// controllerDialect 内置方言，在通用命令表的基础上增加或去掉部分命令
+type controllerDialect struct {
+	name        string
+	description string
+	defaults    DialectDefaults
+	codes       map[string]string // 增加或重新说明的命令
+	removed     map[string]bool   // 不支持的通用命令
+	passive     map[string]bool   // 控制器专用命令，参数不是通用语义(如 M104 S 为温度)，转为扩展命令不执行
+	extended    bool              // 支持 Klipper 风格的扩展命令，如 SET_VELOCITY_LIMIT ACCEL=3000
+}
+
+func (d *controllerDialect) Name() string              { return d.name }
+func (d *controllerDialect) Description() string       { return d.description }
+func (d *controllerDialect) Defaults() DialectDefaults { return d.defaults }
+
+func (d *controllerDialect) Describe(code string) (string, bool) {
+	if desc, ok := d.codes[code]; ok {
+		return desc, true
+	}
+	if d.removed[code] || !IsSupported(code) {
+		return "", false
+	}
+	return CodeDescription(code), true
+}
+
+func (d *controllerDialect) Prepare(b *Block, st *State) {
+	if d.extended && parseExtended(b) {
+		return
+	}
+	for _, w := range b.Words {
+		if w.Letter != 'G' && w.Letter != 'M' {
+			continue
+		}
+		if code := CodeName(w.Letter, w.Value); d.passive[code] {
+			toCommand(b, code)
+			return
+		}
+	}
+	if d.defaults.DecimalPoint {
+		// 最小设定单位按本段生效后的单位，"G20 X100" 表示 0.01 英寸
+		inches := st.Inches
+		if b.HasCode("G20") || b.HasCode("G21") {
+			inches = b.HasCode("G20")
+		}
+		for i := range b.Words {
+			w := &b.Words[i]
+			w.Value = ScaleWord(w.Letter, []byte(w.Text), w.Value, inches)
+		}
+	}
+	if d.defaults.DwellMillis && (b.HasCode("G4") || IsCycle(blockMotion(b, st))) {
+		for i := range b.Words {
+			if b.Words[i].Letter == 'P' {
+				b.Words[i].Value /= 1000
+			}
+		}
+	}
+}
+
+// parseExtended 解析 Klipper 风格的扩展命令，如 "SET_VELOCITY_LIMIT ACCEL=3000"
+// 命令名不是地址字母加数值的形式，参数为 名称=值；识别为扩展命令时清空代码字并返回true
+func parseExtended(b *Block) bool {
+	line := b.Raw
+	if i := strings.IndexByte(line, ';'); i >= 0 {
+		line = line[:i]
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 || len(fields[0]) < 2 || !isLetter(fields[0][0]) {
+		return false
+	}
+	// G1、M104、X10 之类的普通代码字
+	if c := fields[0][1]; isDigit(c) || c == '.' || c == '-' || c == '+' {
+		return false
+	}
+
+	b.Command = strings.ToUpper(fields[0])
+	b.Params = make(map[string]string, len(fields)-1)
+	for _, field := range fields[1:] {
+		if name, value, ok := strings.Cut(field, "="); ok {
+			b.Params[strings.ToUpper(name)] = value
+		}
+	}
+	b.Words = nil
+	return true
+}
+
+// toCommand 将控制器专用命令转为扩展命令，其他代码字作为参数，如 M204 S3000 的参数为 S=3000
+func toCommand(b *Block, code string) {
+	b.Command = code
+	b.Params = make(map[string]string, len(b.Words))
+	for _, w := range b.Words {
+		name := string(w.Letter)
+		if _, ok := b.Params[name]; !ok && w.Letter != 'G' && w.Letter != 'M' {
+			b.Params[name] = w.Text
+		}
+	}
+	b.Words = nil
+}
+
+// codeSetOf 返回命令表中的所有命令
+func codeSetOf(codes map[string]string) map[string]bool {
+	set := make(map[string]bool, len(codes))
+	for code := range codes {
+		set[code] = true
+	}
+	return set
+}
+
+// codeSet 创建命令集合
+func codeSet(codes ...string) map[string]bool {
+	set := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		set[code] = true
+	}
+	return set
+}
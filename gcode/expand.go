@@ -0,0 +1,1161 @@
+package gcode
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultMaxDepth 子程序最大调用深度，与 LinuxCNC 相同
+const DefaultMaxDepth = 10
+
+// DefaultMaxLines 循环和子程序最多重复执行的源程序行数，超过时按死循环处理
+// 按顺序第一次执行的主程序行不计入，普通程序不受行数限制
+const DefaultMaxLines = 5000000
+
+// ExpandOptions 子程序、宏和循环的展开选项
+type ExpandOptions struct {
+	OWords      bool // LinuxCNC 的 O 字子程序(sub/call)、条件(if)和循环(while/do/repeat)
+	Subprograms bool // Fanuc 的 O 程序号、M98 P 调用、M99 返回以及 WHILE/IF/GOTO 宏语句
+	MaxDepth    int  // 最大调用深度，0 使用 DefaultMaxDepth
+	MaxLines    int  // 循环和子程序最多重复执行的源程序行数，0 使用 DefaultMaxLines
+}
+
+// ExpandOptionsFor 返回控制器方言支持的展开选项
+func ExpandOptionsFor(d Dialect) ExpandOptions {
+	defaults := d.Defaults()
+	return ExpandOptions{OWords: defaults.OWords, Subprograms: defaults.Subprograms}
+}
+
+// SourceLine 展开后按执行顺序排列的一行
+type SourceLine struct {
+	Text  string // 代入参数后的内容
+	Line  int    // 在源文件中的行号
+	Depth int    // 子程序调用深度，0 为主程序
+	Jump  bool   // 与上一行之间发生了调用、返回或循环跳转，源文件中不连续
+}
+
+// SubprogramCall 子程序调用
+type SubprogramCall struct {
+	Name string // 子程序名，如 o<drill>、O1000
+	Line int    // 调用所在的行号
+}
+
+// Program 展开后的程序
+type Program struct {
+	Lines         []SourceLine     // 按执行顺序排列的各行，只有 Expand 保存
+	SourceLines   int              // 源文件行数
+	ExecutedLines int              // 展开后执行的行数
+	Expanded      bool             // 含有子程序、宏变量或流程控制，执行顺序与源文件不同
+	Calls         int              // 子程序执行次数，M98 L 的每次重复都计入
+	Loops         int              // 循环跳回的次数
+	MaxDepth      int              // 实际达到的最大调用深度
+	Unresolved    []SubprogramCall // 文件中找不到的子程序，调用被跳过
+}
+
+// lineKind 源程序行的类型
+type lineKind int
+
+const (
+	linePlain  lineKind = iota // 普通程序段
+	lineOWord                  // LinuxCNC O 字语句，如 o100 sub
+	lineHeader                 // Fanuc 程序号，如 O1000
+	lineMacro                  // Fanuc 宏语句 WHILE/END/IF/GOTO
+)
+
+// sourceInfo 流程控制语句和程序号的预处理结果，普通程序段不保存
+type sourceInfo struct {
+	kind      lineKind
+	label     string // O 字标号(小写，如 o100、o<drill>)或 Fanuc 程序号
+	keyword   string // O 字关键字(小写)或宏语句关键字(大写)
+	arg       string // 关键字之后的内容
+	number    int    // 行首的程序段号 N
+	hasNumber bool
+	region    int // Fanuc 程序的序号，0 为主程序
+	pair      int // 配对的开始或结束语句，没有时为 -1
+	owner     int // else/elseif、break/continue 所属的 if 或循环语句
+}
+
+// bound Fanuc 程序的分界，从 line 行开始属于 region 程序
+type bound struct {
+	line   int
+	region int
+}
+
+// owordOpeners O 字结束语句对应的开始语句
+var owordOpeners = map[string]string{"endsub": "sub", "endif": "if", "endwhile": "while", "endrepeat": "repeat"}
+
+// frameKind 调用帧的类型
+type frameKind int
+
+const (
+	frameMain    frameKind = iota // 主程序
+	frameSub                      // O 字子程序，有自己的局部参数
+	frameProgram                  // M98 调用的 Fanuc 子程序，与调用者共用参数
+)
+
+// frame 调用帧，保存执行位置和参数
+type frame struct {
+	kind     frameKind
+	pc       int // 下一行的序号
+	start    int // 子程序第一行，M98 L 重复时回到这里
+	region   int
+	repeat   int // M98 L 剩余的重复次数
+	counters map[int]int
+	locals   map[string]float64
+	globals  map[string]float64
+}
+
+func (f *frame) store(key string) map[string]float64 {
+	if isLocalParam(key) {
+		return f.locals
+	}
+	return f.globals
+}
+
+func (f *frame) lookup(key string) (float64, bool) {
+	v, ok := f.store(key)[key]
+	return v, ok
+}
+
+func (f *frame) get(key string) float64 {
+	v, _ := f.lookup(key)
+	return v
+}
+
+func (f *frame) set(key string, v float64) {
+	f.store(key)[key] = v
+}
+
+// expander 子程序展开器，按执行顺序逐行解释流程控制语句，输出代入参数后的程序段
+// 主程序开头不需要跳转的部分逐行处理；遇到流程控制语句后扫描一遍源程序，
+// 只记录流程控制语句和跳转目标的位置，执行时按位置重新读取源程序
+type expander struct {
+	opts        ExpandOptions
+	src         *lineSource
+	fn          func(l *SourceLine) error
+	base        int                 // src 第一行在源文件中的序号
+	cur         int                 // src 下一次读取的行的序号
+	lines       int                 // 源文件行数
+	history     []byte              // 源程序不能重新读取时保留的已执行行，Fanuc 的 GOTO 可以跳回这些行
+	historyBase int                 // history 第一行的序号
+	executable  bool                // 已读的行中是否有程序段
+	regions     int                 // 已读的 Fanuc 程序号数
+	controls    map[int]*sourceInfo // 流程控制语句和程序号，按行的序号索引
+	order       []int               // 流程控制语句和程序号的序号，从小到大
+	bounds      []bound             // Fanuc 程序的分界，从小到大
+	offsets     map[int]int64       // 跳转目标行在 src 中的位置
+	targets     map[[2]int]int      // 已找到的 GOTO 目标，(程序, 程序段号) -> 行的序号
+	subs        map[string]int      // O 字子程序标号 -> sub 语句的序号
+	programs    map[int]int         // Fanuc 程序号 -> 程序号所在行的序号
+	prog        *Program
+	stack       []*frame
+	steps       int // 重复执行的行数
+	reach       int // 主程序按顺序执行到的位置，之前的行再次执行时计入 steps
+	jumped      bool
+	lastLine    int
+	line        SourceLine // 输出的行，fn 返回后重复使用
+	block       *Block     // 判断 M98/M99 时解析程序段
+	reported    map[SubprogramCall]bool
+}
+
+// Expand 读取G代码并展开子程序、宏变量和循环，返回按执行顺序排列的程序段
+// 需要多次遍历展开结果时使用，只遍历一次时使用 Stream 或 RunProgram，不保存整个程序
+func Expand(r io.Reader, opts ExpandOptions) (*Program, error) {
+	var lines []SourceLine
+	prog, err := Stream(r, opts, func(l *SourceLine) error {
+		lines = append(lines, *l)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	prog.Lines = lines
+	return prog, nil
+}
+
+// Stream 读取G代码并展开子程序、宏变量和循环，按执行顺序对每一行调用fn，返回展开的统计
+// 源程序逐行处理，遇到 O 字语句、宏语句、程序号或 M98/M99 时扫描一遍之后的内容，
+// 只记录流程控制语句的位置，调用子程序和循环跳转时重新读取r，内存占用不随文件大小增长；
+// r 不能定位(io.Seeker)时把之后的内容读入内存。方言不支持时原样输出各行。
+// 调用深度或重复执行的行数超过限制时返回错误，此前的行已经输出。
+// 传给fn的行在fn返回后会被重复使用
+func Stream(r io.Reader, opts ExpandOptions, fn func(l *SourceLine) error) (*Program, error) {
+	if opts.MaxDepth <= 0 {
+		opts.MaxDepth = DefaultMaxDepth
+	}
+	if opts.MaxLines <= 0 {
+		opts.MaxLines = DefaultMaxLines
+	}
+
+	x := &expander{
+		opts:     opts,
+		src:      newLineSource(r),
+		fn:       fn,
+		controls: map[int]*sourceInfo{},
+		offsets:  map[int]int64{},
+		targets:  map[[2]int]int{},
+		subs:     map[string]int{},
+		programs: map[int]int{},
+		prog:     &Program{},
+		block:    &Block{},
+		reported: map[SubprogramCall]bool{},
+	}
+	if err := x.stream(); err != nil {
+		return nil, err
+	}
+	return x.prog, nil
+}
+
+// runner 逐行解析并执行展开后的程序段
+type runner struct {
+	interp *Interpreter
+	comp   *compensator
+	block  *Block
+}
+
+func newRunner(interp *Interpreter, fn func(b *Block, segments []Segment) error) *runner {
+	return &runner{interp: interp, comp: newCompensator(interp, fn), block: &Block{}}
+}
+
+// line 执行一行，刀具半径补偿等待输出的程序段不能重复使用
+func (r *runner) line(l *SourceLine) error {
+	if r.comp.holding() {
+		r.block = &Block{}
+	}
+	r.block.parse(l.Text, l.Line)
+	r.block.Jump = l.Jump
+	return r.comp.add(r.block, r.interp.Execute(r.block))
+}
+
+// Run 按执行顺序解析并执行展开后的程序段，每个程序段执行后调用fn
+// 程序段的行号为源文件中的行号；刀具半径补偿生效时运动段为补偿后的刀具中心路径。
+// 程序段和运动段在fn返回后会被重复使用，需要保留时复制
+func (p *Program) Run(interp *Interpreter, fn func(b *Block, segments []Segment) error) error {
+	run := newRunner(interp, fn)
+	for i := range p.Lines {
+		if err := run.line(&p.Lines[i]); err != nil {
+			return err
+		}
+	}
+	return run.comp.finish()
+}
+
+// Reader 返回展开后的程序文本
+func (p *Program) Reader() io.Reader {
+	return &programReader{lines: p.Lines}
+}
+
+// programReader 按行输出展开后的程序文本，不复制整个程序
+type programReader struct {
+	lines []SourceLine
+	rest  string
+}
+
+func (r *programReader) Read(buf []byte) (int, error) {
+	n := 0
+	for n < len(buf) {
+		if r.rest == "" {
+			if len(r.lines) == 0 {
+				break
+			}
+			r.rest = r.lines[0].Text + "\n"
+			r.lines = r.lines[1:]
+		}
+		c := copy(buf[n:], r.rest)
+		r.rest = r.rest[c:]
+		n += c
+	}
+	if n == 0 && len(buf) > 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// stream 逐行执行主程序开头的普通程序段，遇到需要跳转的语句时扫描源程序并解释执行
+func (x *expander) stream() error {
+	f := &frame{kind: frameMain, locals: map[string]float64{}, globals: map[string]float64{}}
+	x.stack = []*frame{f}
+	for i := 0; ; i++ {
+		line, err := x.src.readLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return readError(err)
+		}
+		text := string(line)
+		x.prog.SourceLines++
+		x.cur++
+		if !x.opts.OWords && !x.opts.Subprograms {
+			if err := x.emit(i, text); err != nil {
+				return err
+			}
+			continue
+		}
+
+		info := x.classifyLine(text)
+		if info.kind == lineHeader && x.regions == 0 && !x.executable {
+			// 主程序的程序号
+			x.regions = 1
+			continue
+		}
+		if info.kind != linePlain || x.opts.Subprograms && x.mayCallSubprogram(text) {
+			return x.index(f, i, text)
+		}
+		if x.src.seeker == nil && x.opts.Subprograms && (info.hasNumber || len(x.history) > 0) {
+			// GOTO 只能跳到有程序段号的行，从第一个程序段号开始保留
+			if len(x.history) == 0 {
+				x.historyBase = i
+			}
+			x.history = append(append(x.history, text...), '\n')
+		}
+		x.executable = x.executable || isExecutable(text)
+		if err := x.statement(f, i, text); err != nil {
+			return fmt.Errorf("第 %d 行: %v", i+1, err)
+		}
+	}
+}
+
+// index 扫描源程序，从第 start 行开始解释执行
+// 源程序可以重新读取时从头扫描，否则把保留的已执行行和之后的内容读入内存再扫描
+func (x *expander) index(f *frame, start int, text string) error {
+	regions, executable := 0, false
+	if x.src.seeker != nil {
+		if err := x.src.seek(0); err != nil {
+			return readError(err)
+		}
+		x.base = 0
+	} else {
+		if len(x.history) == 0 {
+			x.historyBase = start
+		}
+		data := append(append(x.history, text...), '\n')
+		rest, err := x.src.rest()
+		if err != nil {
+			return readError(err)
+		}
+		x.src = newLineSource(bytes.NewReader(append(data, rest...)))
+		x.base, x.history = x.historyBase, nil
+		regions, executable = x.regions, x.executable
+	}
+	x.cur = x.base
+
+	if err := x.prepare(regions, executable, start); err != nil {
+		return err
+	}
+	f.pc, x.reach = start, start
+	return x.run()
+}
+
+// mayCallSubprogram 一行是否有 M98/M99，或者代入参数后可能有
+func (x *expander) mayCallSubprogram(text string) bool {
+	if !strings.ContainsAny(text, "Mm") {
+		return false
+	}
+	if strings.ContainsAny(text, "#[") {
+		return true
+	}
+	if !hasSubprogramCode(text) {
+		return false
+	}
+	x.block.parse(text, 0)
+	return x.block.HasCode("M98") || x.block.HasCode("M99")
+}
+
+// readError 读取源程序的错误
+func readError(err error) error {
+	return fmt.Errorf("读取G-code失败: %v", err)
+}
+
+// isExecutable 是否为程序段，空行、注释和 % 不是
+func isExecutable(text string) bool {
+	return strings.TrimSpace(stripComment(text)) != "" && strings.TrimSpace(text) != "%"
+}
+
+// prepare 从 src 的第一行扫描到结尾，识别流程控制语句并配对开始和结束语句，划分 Fanuc 程序
+// regions、executable 为 src 之前的行中程序号的数量和是否有程序段；第 start 行是开始执行的位置
+func (x *expander) prepare(regions int, executable bool, start int) error {
+	open := map[string][]int{} // 每个 O 字标号未结束的语句
+	loops := map[int]int{}     // Fanuc DO 编号 -> WHILE 语句
+	region := 0                // 当前行所属的 Fanuc 程序
+	i := x.base
+	for ; ; i++ {
+		off := x.src.pos()
+		line, err := x.src.readLine()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return readError(err)
+		}
+		x.cur = i + 1
+		if i == start {
+			x.offsets[i] = off
+		}
+		text := string(line)
+		info := x.classifyLine(text)
+		if info.kind == linePlain {
+			executable = executable || isExecutable(text)
+			if region != 0 && strings.TrimSpace(text) == "%" {
+				// 程序结束标记之后的内容属于主程序
+				region = 0
+				x.bound(i, region, off)
+			}
+			continue
+		}
+
+		c := new(sourceInfo)
+		*c = info
+		c.pair, c.owner = -1, -1
+		x.controls[i] = c
+		x.order = append(x.order, i)
+		x.offsets[i], x.offsets[i+1] = off, x.src.pos()
+
+		switch c.kind {
+		case lineHeader:
+			n, _ := strconv.Atoi(c.label[1:])
+			if regions == 0 && !executable {
+				// 主程序的程序号
+				x.programs[n] = i
+				regions = 1
+				break
+			}
+			regions++
+			region = regions
+			x.programs[n] = i
+			x.bound(i, region, off)
+		case lineOWord:
+			stack := open[c.label]
+			top := -1
+			if len(stack) > 0 {
+				top = stack[len(stack)-1]
+			}
+			switch c.keyword {
+			case "sub", "if", "repeat", "do":
+				if c.keyword == "sub" {
+					x.subs[c.label] = i
+				}
+				open[c.label] = append(stack, i)
+			case "while":
+				if top >= 0 && x.controls[top].keyword == "do" {
+					// do ... while 的结束语句
+					x.pair(top, i)
+					open[c.label] = stack[:len(stack)-1]
+				} else {
+					open[c.label] = append(stack, i)
+				}
+			case "endsub", "endif", "endwhile", "endrepeat":
+				want := owordOpeners[c.keyword]
+				if top < 0 || x.controls[top].keyword != want {
+					return fmt.Errorf("第 %d 行: %s %s 没有对应的 %s", i+1, c.label, c.keyword, want)
+				}
+				x.pair(top, i)
+				open[c.label] = stack[:len(stack)-1]
+			case "else", "elseif", "break", "continue":
+				c.owner = top
+				if top < 0 {
+					return fmt.Errorf("第 %d 行: %s %s 不在条件或循环中", i+1, c.label, c.keyword)
+				}
+			case "return", "call":
+			default:
+				return fmt.Errorf("第 %d 行: 未知的 O 字语句 %s %s", i+1, c.label, c.keyword)
+			}
+		case lineMacro:
+			switch c.keyword {
+			case "WHILE":
+				if m, ok := loopNumber(c.arg, "DO"); ok {
+					loops[m] = i
+				}
+			case "END":
+				m, err := strconv.Atoi(strings.TrimSpace(stripComment(c.arg)))
+				start, ok := loops[m]
+				if err != nil || !ok {
+					return fmt.Errorf("第 %d 行: END%s 没有对应的 WHILE", i+1, strings.TrimSpace(c.arg))
+				}
+				x.pair(start, i)
+				delete(loops, m)
+			}
+		}
+		c.region = region
+	}
+	x.lines = i
+	x.prog.SourceLines = i
+
+	for label, stack := range open {
+		if len(stack) > 0 {
+			i := stack[len(stack)-1]
+			return fmt.Errorf("第 %d 行: %s %s 没有结束语句", i+1, label, x.controls[i].keyword)
+		}
+	}
+	return nil
+}
+
+// pair 记录配对的开始和结束语句
+func (x *expander) pair(start, end int) {
+	x.controls[start].pair = end
+	x.controls[end].pair = start
+}
+
+// bound 记录 Fanuc 程序的分界
+func (x *expander) bound(i, region int, off int64) {
+	x.bounds = append(x.bounds, bound{line: i, region: region})
+	x.offsets[i] = off
+}
+
+// regionAt 第i行所属的 Fanuc 程序，0 为主程序
+func (x *expander) regionAt(i int) int {
+	k := sort.Search(len(x.bounds), func(k int) bool { return x.bounds[k].line > i })
+	if k == 0 {
+		return 0
+	}
+	return x.bounds[k-1].region
+}
+
+// regionEnd 第i行所属的 Fanuc 程序之后的第一行
+func (x *expander) regionEnd(i int) int {
+	k := sort.Search(len(x.bounds), func(k int) bool { return x.bounds[k].line > i })
+	if k == len(x.bounds) {
+		return x.lines
+	}
+	return x.bounds[k].line
+}
+
+// read 读取第i行，不是下一行时回到记录的位置
+func (x *expander) read(i int) (string, error) {
+	if i != x.cur {
+		off, ok := x.offsets[i]
+		if !ok {
+			return "", fmt.Errorf("无法定位第 %d 行", i+1)
+		}
+		if err := x.src.seek(off); err != nil {
+			return "", readError(err)
+		}
+		x.cur = i
+	}
+	line, err := x.src.readLine()
+	if err != nil {
+		return "", readError(err)
+	}
+	x.cur++
+	return string(line), nil
+}
+
+// findNumber 从头读取源程序，查找 Fanuc 程序中的程序段号，找到时记录其位置
+func (x *expander) findNumber(region, n int) (int, error) {
+	if err := x.src.seek(0); err != nil {
+		return 0, readError(err)
+	}
+	x.cur = x.base
+	for i := x.base; ; i++ {
+		off := x.src.pos()
+		line, err := x.src.readLine()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, readError(err)
+		}
+		x.cur = i + 1
+		if number, ok, _ := lineNumber(string(line)); ok && number == n && x.regionAt(i) == region {
+			x.offsets[i] = off
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("找不到程序段 N%d", n)
+}
+
+// lineNumber 读取行首的程序段号 N，返回其后的内容
+func lineNumber(text string) (int, bool, string) {
+	s := strings.TrimLeft(text, " \t")
+	if len(s) < 2 || upper(s[0]) != 'N' || !isDigit(s[1]) {
+		return 0, false, s
+	}
+	end := 1
+	for end < len(s) && isDigit(s[end]) {
+		end++
+	}
+	n, _ := strconv.Atoi(s[1:end])
+	return n, true, strings.TrimLeft(s[end:], " \t")
+}
+
+// classifyLine 识别一行的类型，O 字语句和宏语句前可以有程序段号
+func (x *expander) classifyLine(text string) sourceInfo {
+	var info sourceInfo
+	var s string
+	info.number, info.hasNumber, s = lineNumber(text)
+	if len(s) < 2 {
+		return info
+	}
+
+	if upper(s[0]) == 'O' && (isDigit(s[1]) || s[1] == '<') {
+		end := 1
+		if s[1] == '<' {
+			end = strings.IndexByte(s, '>') + 1
+			if end == 0 {
+				return info
+			}
+		} else {
+			for end < len(s) && isDigit(s[end]) {
+				end++
+			}
+		}
+		label := strings.ToLower(strings.Join(strings.Fields(s[:end]), ""))
+		rest := strings.TrimLeft(s[end:], " \t")
+		kw := 0
+		for kw < len(rest) && isLetter(rest[kw]) {
+			kw++
+		}
+		switch {
+		case x.opts.OWords && kw > 0:
+			info.kind = lineOWord
+			info.label = label
+			info.keyword = strings.ToLower(rest[:kw])
+			info.arg = rest[kw:]
+		case x.opts.Subprograms && s[1] != '<' && strings.TrimSpace(stripComment(rest)) == "":
+			info.kind = lineHeader
+			info.label = "O" + s[1:end]
+		}
+		return info
+	}
+
+	if x.opts.Subprograms {
+		kw := 0
+		for kw < len(s) && isLetter(s[kw]) {
+			kw++
+		}
+		keyword := strings.ToUpper(s[:kw])
+		switch keyword {
+		case "WHILE", "END", "IF", "GOTO":
+			if isKeywordEnd(s[kw:], keyword == "END" || keyword == "GOTO") {
+				info.kind = lineMacro
+				info.keyword = keyword
+				info.arg = s[kw:]
+			}
+		}
+	}
+	return info
+}
+
+// isKeywordEnd 宏语句的关键字之后是否为空格、[、# 或行尾，END1、GOTO10 的编号可以紧跟关键字；
+// 其他字符说明是更长的名称，如 Klipper 的 END_PRINT 宏
+func isKeywordEnd(rest string, number bool) bool {
+	if rest == "" {
+		return true
+	}
+	switch c := rest[0]; {
+	case c == ' ' || c == '\t' || c == '[' || c == '#':
+		return true
+	case number:
+		return isDigit(c)
+	}
+	return false
+}
+
+// stripComment 去掉注释
+func stripComment(s string) string {
+	if i := strings.IndexAny(s, ";("); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+// loopNumber 读取宏语句中关键字之后的编号，如 WHILE [#1 LT 5] DO1 中的 1
+func loopNumber(arg, keyword string) (int, bool) {
+	upperArg := strings.ToUpper(stripComment(arg))
+	i := strings.LastIndex(upperArg, keyword)
+	if i < 0 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(upperArg[i+len(keyword):]))
+	return n, err == nil
+}
+
+// run 从主程序的当前位置开始执行，直到主程序结束
+func (x *expander) run() error {
+	for len(x.stack) > 0 {
+		f := x.stack[len(x.stack)-1]
+		region := 0
+		if f.pc < x.lines {
+			region = x.regionAt(f.pc)
+		}
+		if f.kind == frameProgram && (f.pc >= x.lines || region != f.region) {
+			// Fanuc 子程序没有 M99 时到下一个程序号结束
+			x.returnProgram(f)
+			continue
+		}
+		if f.pc >= x.lines {
+			x.stack = x.stack[:len(x.stack)-1]
+			x.jumped = true
+			continue
+		}
+		if f.kind != frameProgram && region != 0 {
+			// 主程序和 O 字子程序跳过 Fanuc 子程序的内容
+			f.pc = x.regionEnd(f.pc)
+			continue
+		}
+
+		i := f.pc
+		if f.kind != frameMain || i < x.reach {
+			x.steps++
+			if x.steps > x.opts.MaxLines {
+				return fmt.Errorf("子程序和循环重复执行超过 %d 行，可能是死循环", x.opts.MaxLines)
+			}
+		} else {
+			x.reach = i + 1
+		}
+		var err error
+		c := x.controls[i]
+		switch {
+		case c == nil:
+			var text string
+			if text, err = x.read(i); err == nil {
+				f.pc++
+				err = x.statement(f, i, text)
+			}
+		case c.kind == lineOWord:
+			x.prog.Expanded = true
+			err = x.oword(f, i)
+		case c.kind == lineMacro:
+			x.prog.Expanded = true
+			err = x.macro(f, i)
+		default:
+			f.pc++
+		}
+		if err != nil {
+			return fmt.Errorf("第 %d 行: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+// emit 输出一行
+func (x *expander) emit(i int, text string) error {
+	x.line = SourceLine{Text: text, Line: i + 1, Depth: len(x.stack) - 1}
+	x.line.Jump = x.jumped || (x.lastLine > 0 && x.line.Line <= x.lastLine)
+	x.jumped = false
+	x.lastLine = x.line.Line
+	x.prog.ExecutedLines++
+	return x.fn(&x.line)
+}
+
+// jump 跳转到指定行，跳回时计为一次循环
+func (x *expander) jump(f *frame, to int) {
+	if to <= f.pc {
+		x.prog.Loops++
+	}
+	f.pc = to
+	x.jumped = true
+}
+
+// call 调用子程序
+func (x *expander) call(f *frame) error {
+	if len(x.stack) > x.opts.MaxDepth {
+		return fmt.Errorf("子程序调用超过 %d 层，可能是无限递归", x.opts.MaxDepth)
+	}
+	x.stack = append(x.stack, f)
+	x.prog.Calls++
+	x.prog.MaxDepth = max(x.prog.MaxDepth, len(x.stack)-1)
+	x.jumped = true
+	return nil
+}
+
+// unresolved 记录找不到的子程序，同一行只记录一次
+func (x *expander) unresolved(name string, i int) {
+	c := SubprogramCall{Name: name, Line: i + 1}
+	if !x.reported[c] {
+		x.reported[c] = true
+		x.prog.Unresolved = append(x.prog.Unresolved, c)
+	}
+}
+
+// returnProgram 从 M98 子程序返回，还有 L 重复次数时从头再执行
+func (x *expander) returnProgram(f *frame) {
+	x.jumped = true
+	if f.repeat > 0 {
+		f.repeat--
+		f.pc = f.start
+		x.prog.Calls++
+		return
+	}
+	x.stack = x.stack[:len(x.stack)-1]
+}
+
+// condition 计算条件表达式，返回表达式之后的内容
+func (x *expander) condition(f *frame, arg string) (bool, string, error) {
+	p := &exprParser{s: arg, params: f}
+	v, err := p.unary()
+	if err != nil {
+		return false, "", err
+	}
+	return v != 0, p.s[p.pos:], nil
+}
+
+// oword 执行 LinuxCNC O 字语句
+func (x *expander) oword(f *frame, i int) error {
+	info := x.controls[i]
+	switch info.keyword {
+	case "sub":
+		// 按顺序执行到子程序定义时跳过
+		f.pc = info.pair + 1
+	case "endsub", "return":
+		if f.kind != frameSub {
+			f.pc++
+			return nil
+		}
+		if strings.TrimSpace(stripComment(info.arg)) != "" {
+			p := &exprParser{s: info.arg, params: f}
+			v, err := p.unary()
+			if err != nil {
+				return err
+			}
+			f.globals["<_value>"] = v
+		}
+		x.stack = x.stack[:len(x.stack)-1]
+		x.jumped = true
+	case "call":
+		f.pc++
+		start, ok := x.subs[info.label]
+		if !ok {
+			x.unresolved(info.label, i)
+			return nil
+		}
+		locals := map[string]float64{}
+		p := &exprParser{s: info.arg, params: f}
+		for n := 1; p.peek() == '['; n++ {
+			v, err := p.unary()
+			if err != nil {
+				return err
+			}
+			locals[strconv.Itoa(n)] = v
+		}
+		return x.call(&frame{kind: frameSub, pc: start + 1, locals: locals, globals: f.globals})
+	case "if":
+		return x.branch(f, i)
+	case "elseif", "else":
+		// 前一个分支执行完毕
+		f.pc = x.controls[info.owner].pair + 1
+	case "endif", "do":
+		f.pc++
+	case "while":
+		ok, _, err := x.condition(f, info.arg)
+		if err != nil {
+			return err
+		}
+		start := info.pair
+		if start >= 0 && start < i {
+			// do ... while 的结束语句
+			if ok {
+				x.jump(f, start+1)
+			} else {
+				f.pc++
+			}
+			return nil
+		}
+		if ok {
+			f.pc++
+		} else {
+			f.pc = info.pair + 1
+		}
+	case "endwhile":
+		x.jump(f, info.pair)
+	case "repeat":
+		p := &exprParser{s: info.arg, params: f}
+		n, err := p.unary()
+		if err != nil {
+			return err
+		}
+		if f.counters == nil {
+			f.counters = map[int]int{}
+		}
+		f.counters[i] = int(math.Round(n))
+		if f.counters[i] <= 0 {
+			f.pc = info.pair + 1
+		} else {
+			f.pc++
+		}
+	case "endrepeat":
+		start := info.pair
+		if f.counters[start]--; f.counters[start] > 0 {
+			x.jump(f, start+1)
+		} else {
+			f.pc++
+		}
+	case "break":
+		f.pc = x.loopEnd(info.owner) + 1
+	case "continue":
+		loop := info.owner
+		if x.controls[loop].keyword == "while" {
+			x.jump(f, loop)
+		} else {
+			f.pc = x.loopEnd(loop)
+		}
+	}
+	return nil
+}
+
+// loopEnd 返回循环的结束语句
+func (x *expander) loopEnd(loop int) int {
+	return x.controls[loop].pair
+}
+
+// branch 执行 if 语句，条件不成立时依次检查 elseif，都不成立时执行 else
+func (x *expander) branch(f *frame, i int) error {
+	label := x.controls[i].label
+	end := x.controls[i].pair
+	for k := sort.SearchInts(x.order, i); k < len(x.order) && x.order[k] < end; k++ {
+		j := x.order[k]
+		info := x.controls[j]
+		if info.kind != lineOWord || info.label != label {
+			continue
+		}
+		switch info.keyword {
+		case "if", "elseif":
+			if j != i && info.owner != i {
+				continue
+			}
+			ok, _, err := x.condition(f, info.arg)
+			if err != nil {
+				return err
+			}
+			if ok {
+				f.pc = j + 1
+				return nil
+			}
+		case "else":
+			if info.owner == i {
+				f.pc = j + 1
+				return nil
+			}
+		}
+	}
+	f.pc = end + 1
+	return nil
+}
+
+// macro 执行 Fanuc 宏语句
+func (x *expander) macro(f *frame, i int) error {
+	info := x.controls[i]
+	switch info.keyword {
+	case "WHILE":
+		ok, _, err := x.condition(f, info.arg)
+		if err != nil {
+			return err
+		}
+		if ok || info.pair < 0 {
+			f.pc++
+		} else {
+			f.pc = info.pair + 1
+		}
+	case "END":
+		x.jump(f, info.pair)
+	case "GOTO":
+		return x.gotoLine(f, i, info.arg)
+	case "IF":
+		ok, rest, err := x.condition(f, info.arg)
+		if err != nil {
+			return err
+		}
+		rest = strings.TrimLeft(rest, " \t")
+		if len(rest) < 4 || (!strings.EqualFold(rest[:4], "GOTO") && !strings.EqualFold(rest[:4], "THEN")) {
+			return fmt.Errorf("IF 语句缺少 GOTO 或 THEN")
+		}
+		if !ok {
+			f.pc++
+			return nil
+		}
+		if strings.EqualFold(rest[:4], "GOTO") {
+			return x.gotoLine(f, i, rest[4:])
+		}
+		f.pc++
+		return x.statement(f, i, rest[4:])
+	}
+	return nil
+}
+
+// gotoLine 跳转到当前程序中的程序段号
+func (x *expander) gotoLine(f *frame, i int, arg string) error {
+	p := &exprParser{s: arg, params: f}
+	v, err := p.unary()
+	if err != nil {
+		return err
+	}
+	n := int(math.Round(v))
+	key := [2]int{x.regionAt(i), n}
+	j, ok := x.targets[key]
+	if !ok {
+		if j, err = x.findNumber(key[0], n); err != nil {
+			return err
+		}
+		x.targets[key] = j
+	}
+	x.jump(f, j)
+	return nil
+}
+
+// statement 代入参数并执行一行普通程序段，处理参数赋值和 M98/M99
+func (x *expander) statement(f *frame, i int, text string) error {
+	out, assigned, err := substitute(f, text)
+	if err != nil {
+		return err
+	}
+	if out != text || assigned {
+		x.prog.Expanded = true
+	}
+	if x.opts.Subprograms && hasSubprogramCode(out) {
+		return x.subprogram(f, i, out)
+	}
+	if !assigned || strings.TrimSpace(out) != "" {
+		return x.emit(i, out)
+	}
+	return nil
+}
+
+// hasSubprogramCode 快速判断一行是否可能含有 M98/M99
+func hasSubprogramCode(text string) bool {
+	return strings.ContainsAny(text, "Mm") && (strings.Contains(text, "98") || strings.Contains(text, "99"))
+}
+
+// subprogram 执行 M98 调用或 M99 返回，同一段中的其他代码字先输出
+func (x *expander) subprogram(f *frame, i int, text string) error {
+	b := ParseLine(text, i+1)
+	call, ret := b.HasCode("M98"), b.HasCode("M99")
+	if !call && !ret {
+		return x.emit(i, text)
+	}
+	x.prog.Expanded = true
+
+	var words []string
+	for _, w := range b.Words {
+		switch {
+		case w.Letter == 'M' && (w.Value == 98 || w.Value == 99), w.Letter == 'P', call && w.Letter == 'L':
+			continue
+		}
+		words = append(words, string(w.Letter)+w.Text)
+	}
+	if len(words) > 0 {
+		for _, c := range b.Comments {
+			words = append(words, "("+c+")")
+		}
+		if err := x.emit(i, strings.Join(words, " ")); err != nil {
+			return err
+		}
+	}
+
+	if ret {
+		// 主程序中的 M99 表示从头重复执行，按程序结束处理
+		if f.kind == frameProgram {
+			x.returnProgram(f)
+		}
+		return nil
+	}
+
+	p, _ := b.Get('P')
+	number, count := int(p), 1
+	if l, ok := b.Get('L'); ok {
+		count = int(l)
+	} else if number > 9999 {
+		// P 的前几位为重复次数，后四位为程序号，如 P31000 调用 O1000 三次
+		count, number = number/10000, number%10000
+	}
+	start, ok := x.programs[number]
+	if !ok {
+		x.unresolved(fmt.Sprintf("O%d", number), i)
+		return nil
+	}
+	if count <= 0 {
+		return nil
+	}
+	if x.cur == f.pc {
+		// 返回位置是刚读过的行的下一行
+		x.offsets[f.pc] = x.src.pos()
+	}
+	return x.call(&frame{
+		kind:    frameProgram,
+		pc:      start + 1,
+		start:   start + 1,
+		region:  x.controls[start].region,
+		repeat:  count - 1,
+		locals:  f.locals,
+		globals: f.globals,
+	})
+}
+
+// substitute 代入程序段中的参数和表达式，执行参数赋值
+// 同一行中的赋值在整行读取后生效，与 LinuxCNC 相同
+func substitute(f *frame, text string) (string, bool, error) {
+	if !strings.ContainsAny(text, "#[") {
+		return text, false, nil
+	}
+
+	type assignment struct {
+		key   string
+		value float64
+	}
+	var assignments []assignment
+	var out strings.Builder
+	p := &exprParser{s: text, params: f}
+	for p.pos < len(text) {
+		c := text[p.pos]
+		switch {
+		case c == ';':
+			out.WriteString(text[p.pos:])
+			p.pos = len(text)
+		case c == '(':
+			end := strings.IndexByte(text[p.pos:], ')')
+			if end < 0 {
+				end = len(text) - p.pos - 1
+			}
+			out.WriteString(text[p.pos : p.pos+end+1])
+			p.pos += end + 1
+		case c == '#':
+			key, err := p.param()
+			if err != nil {
+				return "", false, err
+			}
+			if err := p.expect('='); err != nil {
+				return "", false, err
+			}
+			v, err := p.expr(0)
+			if err != nil {
+				return "", false, err
+			}
+			assignments = append(assignments, assignment{key, v})
+		case isLetter(c):
+			out.WriteByte(c)
+			p.pos++
+			j := p.pos
+			for j < len(text) && (text[j] == ' ' || text[j] == '\t') {
+				j++
+			}
+			if j < len(text) && isValueStart(text[j:]) {
+				p.pos = j
+				v, err := p.unary()
+				if err != nil {
+					return "", false, err
+				}
+				out.WriteString(formatValue(v))
+			}
+		default:
+			out.WriteByte(c)
+			p.pos++
+		}
+	}
+
+	for _, a := range assignments {
+		f.set(a.key, a.value)
+	}
+	return out.String(), len(assignments) > 0, nil
+}
+
+// isValueStart 代码字的值是否为参数或表达式，如 #1、[#1+2]、-#1
+func isValueStart(s string) bool {
+	if s[0] == '-' || s[0] == '+' {
+		s = s[1:]
+	}
+	return s != "" && (s[0] == '#' || s[0] == '[')
+}
@@ -0,0 +1,242 @@
+package gcode
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var (
+	linuxcnc = ExpandOptions{OWords: true}
+	fanuc    = ExpandOptions{Subprograms: true}
+)
+
+// unseekable 不能定位的读取器，展开时把之后的内容读入内存
+type unseekable struct {
+	io.Reader
+}
+
+// expandText 展开程序，返回各行的内容和行号
+// 分别从可以定位和不能定位的读取器展开，两者的结果应当相同
+func expandText(t *testing.T, src string, opts ExpandOptions) ([]string, []int, *Program) {
+	t.Helper()
+	var texts []string
+	var lines []int
+	prog, err := Stream(strings.NewReader(src), opts, func(l *SourceLine) error {
+		texts = append(texts, l.Text)
+		lines = append(lines, l.Line)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+
+	var buffered []SourceLine
+	bprog, err := Stream(unseekable{strings.NewReader(src)}, opts, func(l *SourceLine) error {
+		buffered = append(buffered, *l)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Stream 不能定位: %v", err)
+	}
+	for i, l := range buffered {
+		if i >= len(texts) || l.Text != texts[i] || l.Line != lines[i] {
+			t.Fatalf("不能定位时第 %d 行为 %+v", i, l)
+		}
+	}
+	if len(buffered) != len(texts) || !reflect.DeepEqual(bprog, prog) {
+		t.Fatalf("不能定位时 prog = %+v, want %+v", *bprog, *prog)
+	}
+	return texts, lines, prog
+}
+
+func TestExpand(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		opts  ExpandOptions
+		want  []string
+		lines []int
+	}{
+		{
+			name:  "不展开",
+			src:   "G0 X1\nM98 P1000\nG1 X2",
+			opts:  ExpandOptions{},
+			want:  []string{"G0 X1", "M98 P1000", "G1 X2"},
+			lines: []int{1, 2, 3},
+		},
+		{
+			name: "O 字子程序和参数",
+			src: "o<hole> sub\nG0 X#1 Y#2\no<hole> endsub\n" +
+				"o<hole> call [1] [2]\no<hole> call [3] [4]\nM2",
+			opts:  linuxcnc,
+			want:  []string{"G0 X1. Y2.", "G0 X3. Y4.", "M2"},
+			lines: []int{2, 2, 6},
+		},
+		{
+			name:  "O 字 while 循环",
+			src:   "#1=0\no100 while [#1 LT 3]\nG1 X#1\n#1=[#1+1]\no100 endwhile\nM2",
+			opts:  linuxcnc,
+			want:  []string{"G1 X0.", "G1 X1.", "G1 X2.", "M2"},
+			lines: []int{3, 3, 3, 6},
+		},
+		{
+			name:  "O 字 if/else",
+			src:   "#1=2\no1 if [#1 EQ 1]\nG0 X1\no1 elseif [#1 EQ 2]\nG0 X2\no1 else\nG0 X3\no1 endif",
+			opts:  linuxcnc,
+			want:  []string{"G0 X2"},
+			lines: []int{5},
+		},
+		{
+			name:  "O 字 repeat",
+			src:   "o1 repeat [2]\nG91 G1 X1\no1 endrepeat",
+			opts:  linuxcnc,
+			want:  []string{"G91 G1 X1", "G91 G1 X1"},
+			lines: []int{2, 2},
+		},
+		{
+			name:  "Fanuc M98 L 重复",
+			src:   "O0001\nG0 X0\nM98 P1000 L2\nM30\n%\nO1000\nG91 G1 X1\nM99\n%",
+			opts:  fanuc,
+			want:  []string{"G0 X0", "G91 G1 X1", "G91 G1 X1", "M30", "%", "%"},
+			lines: []int{2, 7, 7, 4, 5, 9},
+		},
+		{
+			name:  "Fanuc WHILE/END",
+			src:   "#1=0\nWHILE [#1 LT 2] DO1\nG1 X#1\n#1=#1+1\nEND1\nM30",
+			opts:  fanuc,
+			want:  []string{"G1 X0.", "G1 X1.", "M30"},
+			lines: []int{3, 3, 6},
+		},
+		{
+			name:  "GOTO 跳回缓存之前的程序段号",
+			src:   "G0 X0\n#1=0\nN10 G1 X#1\n#1=#1+1\nIF [#1 LT 3] GOTO10\nM30",
+			opts:  fanuc,
+			want:  []string{"G0 X0", "N10 G1 X0.", "N10 G1 X1.", "N10 G1 X2.", "M30"},
+			lines: []int{1, 3, 3, 3, 6},
+		},
+		{
+			name:  "子程序定义在开头",
+			src:   "o100 sub\nG0 X#1\no100 endsub\nG1 X1\r\nG1 X2\no100 call [5]\nG1 X3",
+			opts:  linuxcnc,
+			want:  []string{"G1 X1", "G1 X2", "G0 X5.", "G1 X3"},
+			lines: []int{4, 5, 2, 7},
+		},
+		{
+			name:  "GOTO 跳到子程序中的程序段号",
+			src:   "O0001\nN10 G0 X0\nM98 P1000\nM30\n%\nO1000\n#1=0\nN10 G1 X#1\n#1=#1+1\nIF [#1 LT 2] GOTO10\nM99\n%",
+			opts:  fanuc,
+			want:  []string{"N10 G0 X0", "N10 G1 X0.", "N10 G1 X1.", "M30", "%", "%"},
+			lines: []int{2, 8, 8, 4, 5, 12},
+		},
+		{
+			name:  "END_PRINT 不是宏语句",
+			src:   "G28\nG1 X10 Y10 F100\nEND_PRINT\nGOTOX",
+			opts:  fanuc,
+			want:  []string{"G28", "G1 X10 Y10 F100", "END_PRINT", "GOTOX"},
+			lines: []int{1, 2, 3, 4},
+		},
+		{
+			name:  "通用方言不处理 Fanuc 宏",
+			src:   "G28\nG1 X10 Y10 F100\nEND_PRINT\nM98 P1",
+			opts:  ExpandOptionsFor(Generic),
+			want:  []string{"G28", "G1 X10 Y10 F100", "END_PRINT", "M98 P1"},
+			lines: []int{1, 2, 3, 4},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			texts, lines, _ := expandText(t, tt.src, tt.opts)
+			if !reflect.DeepEqual(texts, tt.want) {
+				t.Errorf("texts = %q, want %q", texts, tt.want)
+			}
+			if !reflect.DeepEqual(lines, tt.lines) {
+				t.Errorf("lines = %v, want %v", lines, tt.lines)
+			}
+		})
+	}
+}
+
+func TestExpandStats(t *testing.T) {
+	src := "O0001\nM98 P1000 L2\nM98 P2000\nM30\n%\nO1000\n#1=0\nWHILE [#1 LT 2] DO1\n#1=#1+1\nEND1\nM99\n%"
+	_, _, prog := expandText(t, src, fanuc)
+	want := Program{
+		SourceLines:   12,
+		ExecutedLines: 3,
+		Expanded:      true,
+		Calls:         2,
+		Loops:         4,
+		MaxDepth:      1,
+		Unresolved:    []SubprogramCall{{Name: "O2000", Line: 3}},
+	}
+	if !reflect.DeepEqual(*prog, want) {
+		t.Errorf("prog = %+v, want %+v", *prog, want)
+	}
+}
+
+func TestExpandErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		opts ExpandOptions
+		err  string
+	}{
+		{"END 没有 WHILE", "G28\nG1 X10\nEND1", fanuc, "第 3 行: END1 没有对应的 WHILE"},
+		{"没有结束语句", "G0 X0\no1 while [1]\nG1 X1", linuxcnc, "第 2 行: o1 while 没有结束语句"},
+		{"找不到程序段号", "G0 X0\nGOTO20", fanuc, "第 2 行: 找不到程序段 N20"},
+		{"死循环", "o1 while [1]\nG1 X1\no1 endwhile", ExpandOptions{OWords: true, MaxLines: 100}, "可能是死循环"},
+		{"无限递归", "o1 sub\no1 call\no1 endsub\no1 call", linuxcnc, "可能是无限递归"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Stream(strings.NewReader(tt.src), tt.opts, func(*SourceLine) error { return nil })
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("err = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestExpandMaxLines(t *testing.T) {
+	// 按顺序执行的行不计入重复执行的行数
+	var src strings.Builder
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&src, "G1 X%d\n", i)
+	}
+	src.WriteString("o1 repeat [5]\nG1 X0\no1 endrepeat\n")
+	opts := ExpandOptions{OWords: true, MaxLines: 20}
+	_, _, prog := expandText(t, src.String(), opts)
+	if prog.ExecutedLines != 1005 {
+		t.Errorf("ExecutedLines = %d, want 1005", prog.ExecutedLines)
+	}
+}
+
+func TestStream(t *testing.T) {
+	// 普通程序段读到后立即输出，不等读完整个文件
+	for _, opts := range []ExpandOptions{{}, linuxcnc, fanuc} {
+		pr, pw := io.Pipe()
+		got := make(chan string)
+		done := make(chan error)
+		go func() {
+			_, err := Stream(pr, opts, func(l *SourceLine) error {
+				got <- l.Text
+				return nil
+			})
+			done <- err
+		}()
+		for i := 0; i < 3; i++ {
+			line := fmt.Sprintf("G1 X%d", i)
+			io.WriteString(pw, line+"\n")
+			if text := <-got; text != line {
+				t.Errorf("%+v: got %q, want %q", opts, text, line)
+			}
+		}
+		pw.Close()
+		if err := <-done; err != nil {
+			t.Errorf("%+v: %v", opts, err)
+		}
+	}
+}
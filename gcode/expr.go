@@ -0,0 +1,310 @@
+package gcode
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// maxLocalParam 子程序的局部编号参数 #1-#30(LinuxCNC)，Fanuc 的 M98 子程序与调用者共用
+const maxLocalParam = 30
+
+// macroFunctions 表达式中的一元函数，三角函数以度为单位
+var macroFunctions = map[string]func(float64) float64{
+	"ABS":   math.Abs,
+	"ACOS":  func(v float64) float64 { return math.Acos(v) * 180 / math.Pi },
+	"ASIN":  func(v float64) float64 { return math.Asin(v) * 180 / math.Pi },
+	"COS":   func(v float64) float64 { return math.Cos(v * math.Pi / 180) },
+	"EXP":   math.Exp,
+	"FIX":   math.Floor,
+	"FUP":   math.Ceil,
+	"LN":    math.Log,
+	"ROUND": math.Round,
+	"SIN":   func(v float64) float64 { return math.Sin(v * math.Pi / 180) },
+	"SQRT":  math.Sqrt,
+	"TAN":   func(v float64) float64 { return math.Tan(v * math.Pi / 180) },
+}
+
+// 二元运算符的优先级，数值越大越先计算
+var macroOperators = map[string]int{
+	"**": 4,
+	"*":  3, "/": 3, "MOD": 3,
+	"+": 2, "-": 2,
+	"EQ": 1, "NE": 1, "GT": 1, "GE": 1, "LT": 1, "LE": 1,
+	"AND": 0, "OR": 0, "XOR": 0,
+}
+
+// exprParser 宏表达式的解析器，按 RS-274/NGC 的语法计算 #参数、[表达式] 和函数
+// 空格在表达式中被忽略，关键字不区分大小写；params 读取和写入参数
+type exprParser struct {
+	s      string
+	pos    int
+	params *frame
+}
+
+// skipSpace 跳过空白
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// peek 返回下一个非空白字符，到行尾时返回0
+func (p *exprParser) peek() byte {
+	p.skipSpace()
+	if p.pos < len(p.s) {
+		return p.s[p.pos]
+	}
+	return 0
+}
+
+// word 读取下一个关键字(字母)，不移动位置
+func (p *exprParser) word() string {
+	p.skipSpace()
+	end := p.pos
+	for end < len(p.s) && isLetter(p.s[end]) {
+		end++
+	}
+	return strings.ToUpper(p.s[p.pos:end])
+}
+
+// expect 读取指定字符
+func (p *exprParser) expect(c byte) error {
+	if p.peek() != c {
+		return fmt.Errorf("缺少 %c", c)
+	}
+	p.pos++
+	return nil
+}
+
+// operator 读取下一个二元运算符，不移动位置，不是运算符时返回空
+func (p *exprParser) operator() string {
+	switch c := p.peek(); c {
+	case '*':
+		if p.pos+1 < len(p.s) && p.s[p.pos+1] == '*' {
+			return "**"
+		}
+		return "*"
+	case '/', '+', '-':
+		return string(c)
+	}
+	if w := p.word(); w != "" {
+		if _, ok := macroOperators[w]; ok {
+			return w
+		}
+	}
+	return ""
+}
+
+// expr 计算优先级不低于 prec 的二元表达式
+func (p *exprParser) expr(prec int) (float64, error) {
+	left, err := p.unary()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op := p.operator()
+		level, ok := macroOperators[op]
+		if !ok || level < prec {
+			return left, nil
+		}
+		p.pos += len(op)
+		// ** 右结合，其他运算符左结合
+		next := level + 1
+		if op == "**" {
+			next = level
+		}
+		right, err := p.expr(next)
+		if err != nil {
+			return 0, err
+		}
+		if left, err = binary(op, left, right); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// binary 计算二元运算，比较和逻辑运算的结果为1或0
+func binary(op string, a, b float64) (float64, error) {
+	truth := func(v bool) float64 {
+		if v {
+			return 1
+		}
+		return 0
+	}
+	switch op {
+	case "**":
+		return math.Pow(a, b), nil
+	case "*":
+		return a * b, nil
+	case "/":
+		if b == 0 {
+			return 0, fmt.Errorf("除数为0")
+		}
+		return a / b, nil
+	case "MOD":
+		if b == 0 {
+			return 0, fmt.Errorf("除数为0")
+		}
+		// 结果与除数同号，与 LinuxCNC 相同
+		m := math.Mod(a, b)
+		if m != 0 && (m < 0) != (b < 0) {
+			m += b
+		}
+		return m, nil
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "EQ":
+		return truth(a == b), nil
+	case "NE":
+		return truth(a != b), nil
+	case "GT":
+		return truth(a > b), nil
+	case "GE":
+		return truth(a >= b), nil
+	case "LT":
+		return truth(a < b), nil
+	case "LE":
+		return truth(a <= b), nil
+	case "AND":
+		return truth(a != 0 && b != 0), nil
+	case "OR":
+		return truth(a != 0 || b != 0), nil
+	case "XOR":
+		return truth((a != 0) != (b != 0)), nil
+	}
+	return 0, fmt.Errorf("未知的运算符 %s", op)
+}
+
+// unary 计算一元值：数值、#参数、[表达式]、函数，可以带正负号
+// 地址字的值只能是一元值，如 X#1、X[#1+2]、X-#1
+func (p *exprParser) unary() (float64, error) {
+	switch c := p.peek(); {
+	case c == '-' || c == '+':
+		p.pos++
+		v, err := p.unary()
+		if c == '-' {
+			v = -v
+		}
+		return v, err
+	case c == '[':
+		p.pos++
+		v, err := p.expr(0)
+		if err != nil {
+			return 0, err
+		}
+		return v, p.expect(']')
+	case c == '#':
+		key, err := p.param()
+		if err != nil {
+			return 0, err
+		}
+		return p.params.get(key), nil
+	case isDigit(c) || c == '.':
+		end, v, ok := lexNumber([]byte(p.s), p.pos)
+		if !ok {
+			return 0, fmt.Errorf("无效的数值")
+		}
+		p.pos = end
+		return v, nil
+	case isLetter(c):
+		return p.function()
+	}
+	return 0, fmt.Errorf("缺少数值")
+}
+
+// function 计算函数调用，ATAN[y]/[x] 有两个参数，EXISTS[#<name>] 检查参数是否已设置
+func (p *exprParser) function() (float64, error) {
+	name := p.word()
+	p.pos += len(name)
+	if p.peek() != '[' {
+		return 0, fmt.Errorf("未知的函数 %s", name)
+	}
+	switch name {
+	case "EXISTS":
+		p.pos++
+		key, err := p.param()
+		if err != nil {
+			return 0, err
+		}
+		_, ok := p.params.lookup(key)
+		if ok {
+			return 1, p.expect(']')
+		}
+		return 0, p.expect(']')
+	case "ATAN":
+		y, err := p.unary()
+		if err != nil {
+			return 0, err
+		}
+		if err := p.expect('/'); err != nil {
+			return 0, err
+		}
+		x, err := p.unary()
+		if err != nil {
+			return 0, err
+		}
+		return math.Atan2(y, x) * 180 / math.Pi, nil
+	}
+	fn, ok := macroFunctions[name]
+	if !ok {
+		return 0, fmt.Errorf("未知的函数 %s", name)
+	}
+	v, err := p.unary()
+	return fn(v), err
+}
+
+// param 读取参数引用，返回参数名：编号参数为数字，命名参数为 <小写名称>
+// 支持 #1、#<name>、#[表达式] 和 ##1 形式的间接引用
+func (p *exprParser) param() (string, error) {
+	if err := p.expect('#'); err != nil {
+		return "", err
+	}
+	if p.peek() == '<' {
+		end := strings.IndexByte(p.s[p.pos:], '>')
+		if end < 0 {
+			return "", fmt.Errorf("参数名缺少 >")
+		}
+		name := strings.ToLower(strings.Join(strings.Fields(p.s[p.pos+1:p.pos+end]), ""))
+		p.pos += end + 1
+		if name == "" {
+			return "", fmt.Errorf("参数名为空")
+		}
+		return "<" + name + ">", nil
+	}
+	v, err := p.unary()
+	if err != nil {
+		return "", err
+	}
+	n := math.Round(v)
+	if n < 0 || math.Abs(v-n) > 0.0001 {
+		return "", fmt.Errorf("无效的参数编号 %v", v)
+	}
+	return strconv.Itoa(int(n)), nil
+}
+
+// isLocalParam 是否为子程序的局部参数：#1-#30 和不以下划线开头的命名参数
+func isLocalParam(key string) bool {
+	if strings.HasPrefix(key, "<") {
+		return !strings.HasPrefix(key, "<_")
+	}
+	n, err := strconv.Atoi(key)
+	return err == nil && n >= 1 && n <= maxLocalParam
+}
+
+// formatValue 格式化代入程序段的参数值，总是带小数点，
+// 避免 Fanuc 等小数点规则把 X#1(#1=10) 解释为 X0.01
+func formatValue(v float64) string {
+	v = math.Round(v*1e9) / 1e9
+	if v == 0 {
+		v = 0 // 去掉 -0
+	}
+	text := strconv.FormatFloat(v, 'f', -1, 64)
+	if !strings.Contains(text, ".") {
+		text += "."
+	}
+	return text
+}
@@ -0,0 +1,80 @@
+package gcode
+
+import (
+	"math"
+	"testing"
+)
+
+func TestExpr(t *testing.T) {
+	params := &frame{
+		locals:  map[string]float64{"1": 3, "2": 4},
+		globals: map[string]float64{"100": 2, "<_depth>": -1.5},
+	}
+	tests := []struct {
+		expr string
+		want float64
+	}{
+		{"[1+2*3]", 7},
+		{"[[1+2]*3]", 9},
+		{"[2**3**2]", 512},
+		{"[10-4-3]", 3},
+		{"[-7 MOD 3]", 2},
+		{"[#1*#2]", 12},
+		{"#[#100-1]", 3},
+		{"##100", 4},
+		{"#<_depth>", -1.5},
+		{"-#1", -3},
+		{"[#1 LT #2]", 1},
+		{"[#1 GT #2 OR #2 EQ 4]", 1},
+		{"[#1 lt 5 and #2 ne 4]", 0},
+		{"SQRT[#1*#1+#2*#2]", 5},
+		{"ATAN[#2]/[#1]", math.Atan2(4, 3) * 180 / math.Pi},
+		{"COS[60]", 0.5},
+		{"FIX[-1.5]", -2},
+		{"EXISTS[#<_depth>]", 1},
+		{"EXISTS[#<missing>]", 0},
+		{"#99", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			p := &exprParser{s: tt.expr, params: params}
+			got, err := p.unary()
+			if err != nil {
+				t.Fatalf("unary(%q): %v", tt.expr, err)
+			}
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("unary(%q) = %v, want %v", tt.expr, got, tt.want)
+			}
+			if p.pos != len(tt.expr) {
+				t.Errorf("unary(%q) 读到 %d，剩余 %q", tt.expr, p.pos, tt.expr[p.pos:])
+			}
+		})
+	}
+}
+
+func TestExprError(t *testing.T) {
+	params := &frame{locals: map[string]float64{}, globals: map[string]float64{}}
+	for _, expr := range []string{"[1/0]", "[1+2", "FOO[1]", "#1.5", "#<>", "[]"} {
+		p := &exprParser{s: expr, params: params}
+		if _, err := p.unary(); err == nil {
+			t.Errorf("unary(%q) 应该返回错误", expr)
+		}
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	tests := []struct {
+		v    float64
+		want string
+	}{
+		{10, "10."},
+		{-0.0, "0."},
+		{1.25, "1.25"},
+		{0.1 + 0.2, "0.3"},
+	}
+	for _, tt := range tests {
+		if got := formatValue(tt.v); got != tt.want {
+			t.Errorf("formatValue(%v) = %q, want %q", tt.v, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,648 @@
+package gcode
+
+import "math"
+
+// inchToMM 英寸到毫米的换算系数
+const inchToMM = 25.4
+
+// State 解释器的模态状态
+type State struct {
+	Position   Point   // 当前位置(mm)，工件坐标
+	Absolute   bool    // 绝对坐标模式 G90
+	Inches     bool    // 英制单位 G20
+	Plane      string  // 当前平面 G17/G18/G19
+	Motion     string  // 当前运动模式 G0/G1/G2/G3，固定循环 G73/G81-G89，G80 为取消
+	Feed       float64 // 当前进给速度(mm/min)
+	FeedSet    bool    // 是否已设置过进给速度
+	Power      float64 // 当前S值
+	SpindleOn  bool    // 主轴/激光是否开启 (M3/M4)
+	SpindleCCW bool    // 主轴反转 M4
+	Mist       bool    // 雾状冷却 M7
+	Flood      bool    // 冷却液 M8
+	Ended      bool    // 是否已执行程序结束 M2/M30
+
+	CoordSystem int      // 当前工件坐标系在 CoordSystems 中的序号，0 为 G54
+	WorkOffsets [9]Point // 各工件坐标系原点的机器坐标，G10 L2/L20 修改
+	ToolLength  float64  // 当前刀具长度补偿(mm)，G43 设置，G49 取消
+	CutterComp  string   // 刀具半径补偿 G41 左补偿/G42 右补偿，G40 取消时为空
+	CompRadius  float64  // 刀具半径补偿的半径(mm)
+	Tool        int      // 主轴上的刀具号，M6 换刀后生效
+	NextTool    int      // T 选择的刀具号，下一次 M6 时装入
+	ToolChanges int      // 换刀次数，装入的刀具与原刀具相同时不计
+	Offset      Point    // G92 坐标偏移
+	SavedOffset Point    // G92.2 暂停的偏移，G92.3 恢复
+	Home        Point    // G28 参考点(机器坐标)，G28.1 设置
+	Home2       Point    // G30 参考点(机器坐标)，G30.1 设置
+	Dwell       float64  // 累计暂停时间(秒)
+
+	ReturnR     bool    // 固定循环退回 R 平面 G99，否则退回起始高度 G98
+	CycleR      float64 // 固定循环的 R 平面，同一系列循环中可以省略
+	CycleBottom float64 // 固定循环的孔底 Z
+	CyclePeck   float64 // 固定循环每次进给的深度 Q
+	CycleDwell  float64 // 固定循环孔底暂停时间 P(秒)
+}
+
+// CoordSystems 工件坐标系，与 State.WorkOffsets 的顺序一致
+var CoordSystems = []string{"G54", "G55", "G56", "G57", "G58", "G59", "G59.1", "G59.2", "G59.3"}
+
+// Interpreter G代码解释器，逐段执行程序并输出绝对坐标的运动段
+// 坐标为当前工件坐标系下的坐标，机器坐标 = 工件坐标 + 工件坐标系原点 + G92 偏移 + 刀具长度补偿(Z)
+type Interpreter struct {
+	State     State
+	Tools     map[int]float64 // 刀具长度表(mm)，G43 H<刀号> 使用，G10 L1 修改
+	Diameters map[int]float64 // 刀具直径表(mm)，G41/G42 D<刀号> 使用
+	Dialect   Dialect         // 控制器方言
+	LaserMode bool            // 激光模式，G0 移动时激光关闭
+	Comp      CompReport      // 刀具半径补偿的统计和问题
+
+	compIssued map[CompIssue]bool
+	segments   []Segment // Execute 返回的运动段，每次执行时重复使用
+}
+
+// NewInterpreter 创建解释器，初始为绝对坐标、公制单位
+func NewInterpreter() *Interpreter {
+	return &Interpreter{
+		State: State{
+			Absolute: true,
+			Plane:    "G17",
+			Motion:   MotionRapid,
+		},
+		Tools:     map[int]float64{},
+		Diameters: map[int]float64{},
+		Dialect:   Generic,
+	}
+}
+
+// blockCommands 程序段中按模态组归类的命令，同组出现多个时以最后一个为准
+type blockCommands struct {
+	motion   string // G0/G1/G2/G3、固定循环或 G80
+	nonModal string // G4/G28/G30/G92 等非模态命令，G53 单独记录
+	machine  bool   // G53 机器坐标
+	coord    string // 工件坐标系 G54-G59.3
+	tool     string // 刀具长度补偿 G43/G43.1/G49
+	comp     string // 刀具半径补偿 G40/G41/G42/G41.1/G42.1
+	plane    string
+	units    string
+	retract  string // G98/G99
+	distance string
+	spindle  string
+	change   bool // M6 换刀
+	mist     bool // M7
+	flood    bool // M8
+	dry      bool // M9
+	stop     string
+}
+
+// classify 将程序段中的G/M命令按模态组归类
+func classify(b *Block) blockCommands {
+	var cmds blockCommands
+	for _, w := range b.Words {
+		if w.Letter != 'G' && w.Letter != 'M' {
+			continue
+		}
+		code := CodeName(w.Letter, w.Value)
+		switch modalGroups[code] {
+		case GroupMotion:
+			switch {
+			case code == MotionRapid, code == MotionLinear, code == MotionCW, code == MotionCCW,
+				code == "G80", IsCycle(code):
+				cmds.motion = code
+			}
+		case GroupNonModal:
+			if code == "G53" {
+				cmds.machine = true
+			} else {
+				cmds.nonModal = code
+			}
+		case GroupCoordSystem:
+			cmds.coord = code
+		case GroupToolLength:
+			cmds.tool = code
+		case GroupCutterComp:
+			cmds.comp = code
+		case GroupPlane:
+			cmds.plane = code
+		case GroupUnits:
+			cmds.units = code
+		case GroupDistance:
+			cmds.distance = code
+		case GroupReturnMode:
+			cmds.retract = code
+		case GroupSpindle:
+			cmds.spindle = code
+		case GroupToolChange:
+			cmds.change = true
+		case GroupCoolant:
+			cmds.mist = cmds.mist || code == "M7"
+			cmds.flood = cmds.flood || code == "M8"
+			cmds.dry = cmds.dry || code == "M9"
+		case GroupStop:
+			cmds.stop = code
+		}
+	}
+	return cmds
+}
+
+// Execute 执行一个程序段，返回产生的运动段
+// 同一段中的命令按 RS-274/NGC 规定的顺序执行，与书写顺序无关：
+// 进给、转速、选刀、换刀、主轴、冷却、暂停、平面、单位、刀具半径补偿、刀具长度补偿、工件坐标系、距离模式、
+// 回参考点或设置坐标、运动，最后是程序停止。执行前先由方言调整程序段
+// 返回的运动段在下一次执行前有效，需要保留时复制
+func (in *Interpreter) Execute(b *Block) []Segment {
+	st := &in.State
+	in.Dialect.Prepare(b, st)
+	cmds := classify(b)
+
+	// 进给速度按本段生效后的单位换算，"G20 F10" 表示 10 英寸/分钟
+	inches := st.Inches
+	if cmds.units != "" {
+		inches = cmds.units == "G20"
+	}
+	if f, ok := b.Get('F'); ok {
+		if inches {
+			f *= inchToMM
+		}
+		st.Feed = f
+		st.FeedSet = true
+	}
+	dwellLetter, dwell, isDwell := dwellWord(b)
+	if s, ok := b.Get('S'); ok && dwellLetter != 'S' {
+		st.Power = s
+	}
+	if t, ok := b.Get('T'); ok {
+		st.NextTool = int(t)
+		if in.Dialect.Defaults().ToolChangeOnSelect {
+			in.changeTool()
+		}
+	}
+	if cmds.change {
+		in.changeTool()
+	}
+	switch cmds.spindle {
+	case "M3", "M4":
+		st.SpindleOn = true
+		st.SpindleCCW = cmds.spindle == "M4"
+	case "M5":
+		st.SpindleOn = false
+	}
+	if cmds.dry {
+		st.Mist, st.Flood = false, false
+	}
+	st.Mist = st.Mist || cmds.mist
+	st.Flood = st.Flood || cmds.flood
+	if isDwell {
+		st.Dwell += dwell
+	}
+	if cmds.plane != "" {
+		st.Plane = cmds.plane
+	}
+	st.Inches = inches
+	if cmds.comp != "" {
+		in.setCutterComp(b, cmds.comp)
+	}
+	axisUsed := isDwell
+	switch cmds.tool {
+	case "G43":
+		h := st.Tool
+		if v, ok := b.Get('H'); ok {
+			h = int(v)
+		}
+		in.reframe(func(st *State) { st.ToolLength = in.Tools[h] })
+	case "G43.1":
+		// 动态刀具长度补偿，Z 为刀具长度
+		if z, ok := b.Get('Z'); ok {
+			in.reframe(func(st *State) { st.ToolLength = in.toMM(z) })
+		}
+		axisUsed = true
+	case "G49":
+		in.reframe(func(st *State) { st.ToolLength = 0 })
+	}
+	if i := coordSystemIndex(cmds.coord); i >= 0 {
+		in.reframe(func(st *State) { st.CoordSystem = i })
+	}
+	switch cmds.distance {
+	case "G90":
+		st.Absolute = true
+	case "G91":
+		st.Absolute = false
+	}
+	if cmds.retract != "" {
+		st.ReturnR = cmds.retract == "G99"
+	}
+
+	// G4 的 X 是暂停时间，G10/G28/G30/G92 的坐标字不是运动目标
+	segments := in.segments[:0]
+	switch cmds.nonModal {
+	case "G10":
+		in.setCoordData(b)
+		axisUsed = true
+	case "G28", "G30":
+		segments = append(segments, in.home(b, cmds.nonModal)...)
+		axisUsed = true
+	case "G28.1":
+		st.Home = in.machine(st.Position)
+	case "G30.1":
+		st.Home2 = in.machine(st.Position)
+	case "G92":
+		in.setOffset(b)
+		axisUsed = true
+	case "G92.1":
+		in.reframe(func(st *State) { st.Offset, st.SavedOffset = Point{}, Point{} })
+	case "G92.2":
+		in.reframe(func(st *State) { st.SavedOffset, st.Offset = st.Offset, Point{} })
+	case "G92.3":
+		in.reframe(func(st *State) { st.Offset = st.SavedOffset })
+	}
+
+	if cmds.motion != "" {
+		st.Motion = cmds.motion
+	}
+	if !axisUsed && hasAxis(b) {
+		if IsCycle(st.Motion) && !cmds.machine {
+			segments = append(segments, in.cycle(b)...)
+		} else {
+			segments = append(segments, in.move(b, cmds.machine))
+		}
+	}
+
+	if cmds.stop == "M2" || cmds.stop == "M30" {
+		st.SpindleOn = false
+		st.Mist, st.Flood = false, false
+		st.CutterComp, st.CompRadius = "", 0
+		st.Ended = true
+	}
+	in.segments = segments
+	return segments
+}
+
+// move 按当前运动模式移动到程序段的目标位置
+// machine为true时(G53)坐标字为机器坐标，不受距离模式和坐标偏移影响
+func (in *Interpreter) move(b *Block, machine bool) Segment {
+	st := &in.State
+	var target Point
+	if machine {
+		target = in.machineTarget(b)
+	} else {
+		target = in.target(b)
+	}
+
+	motion := st.Motion
+	if motion == "G80" {
+		// 取消固定循环后没有运动模式，坐标字按快速移动处理
+		motion = MotionRapid
+	}
+	seg := in.line(b, motion, target)
+	if seg.IsArc() {
+		seg.Center = in.arcCenter(b, seg.From, seg.To, seg.Motion)
+	}
+	return seg
+}
+
+// rapid 快速移动到指定位置，不改变模态运动模式
+func (in *Interpreter) rapid(b *Block, to Point) Segment {
+	return in.line(b, MotionRapid, to)
+}
+
+// line 按指定的运动类型移动到指定位置，不改变模态运动模式
+func (in *Interpreter) line(b *Block, motion string, to Point) Segment {
+	st := &in.State
+	seg := Segment{
+		Line:      b.Line,
+		Motion:    motion,
+		From:      st.Position,
+		To:        to,
+		Feed:      st.Feed,
+		Power:     st.Power,
+		SpindleOn: st.SpindleOn && !(in.LaserMode && motion == MotionRapid),
+		Offset:    in.offset(),
+	}
+	st.Position = to
+	return seg
+}
+
+// cycle 执行固定循环，每个孔展开为定位、加工和退回的直线运动段
+// X/Y 为孔位，Z 为孔底，R/Z/Q/P 省略时沿用上次的值；L 为重复次数，G91 时孔位每次按 X/Y 递增，
+// R 相对当前高度、Z 相对 R。每个孔的第一段进给标记为 Hole
+func (in *Interpreter) cycle(b *Block) []Segment {
+	st := &in.State
+	if v, ok := b.Get('R'); ok {
+		st.CycleR = in.toMM(v)
+		if !st.Absolute {
+			st.CycleR += st.Position.Z
+		}
+	}
+	if v, ok := b.Get('Z'); ok {
+		st.CycleBottom = in.toMM(v)
+		if !st.Absolute {
+			st.CycleBottom += st.CycleR
+		}
+	}
+	if v, ok := b.Get('Q'); ok {
+		st.CyclePeck = math.Abs(in.toMM(v))
+	}
+	if v, ok := b.Get('P'); ok {
+		st.CycleDwell = v
+	}
+	repeat := 1
+	if l, ok := b.Get('L'); ok && l > 1 {
+		repeat = int(l)
+	}
+
+	c := Cycle{
+		Code:   st.Motion,
+		R:      st.CycleR,
+		Bottom: st.CycleBottom,
+		Clear:  st.CycleR,
+		Peck:   st.CyclePeck,
+		Dwell:  st.CycleDwell,
+	}
+	if !st.ReturnR {
+		c.Clear = math.Max(st.Position.Z, st.CycleR)
+	}
+
+	var segments []Segment
+	hole := st.Position
+	for i := 0; i < repeat; i++ {
+		for _, axis := range []axisRef{{'X', &hole.X}, {'Y', &hole.Y}} {
+			if v, ok := b.Get(axis.letter); ok {
+				if st.Absolute {
+					*axis.value = in.toMM(v)
+				} else {
+					*axis.value += in.toMM(v)
+				}
+			}
+		}
+		first := true
+		for _, m := range c.Expand(st.Position, hole.X, hole.Y) {
+			motion := MotionRapid
+			if !m.Rapid {
+				motion = MotionLinear
+			}
+			seg := in.line(b, motion, m.To)
+			seg.Cycle = c.Code
+			seg.Dwell = m.Dwell
+			if !m.Rapid && first {
+				seg.Hole, first = true, false
+			}
+			st.Dwell += m.Dwell
+			segments = append(segments, seg)
+		}
+	}
+	return segments
+}
+
+// home 执行 G28/G30 回参考点
+// 有坐标字时先快速移动到坐标字指定的中间点，再将指定的轴移动到参考点，
+// 方言设置了 HomeDirect 时不经过中间点；没有坐标字时所有轴直接回参考点
+func (in *Interpreter) home(b *Block, code string) []Segment {
+	st := &in.State
+	ref := st.Home
+	if code == "G30" {
+		ref = st.Home2
+	}
+	if !hasAxis(b) {
+		return []Segment{in.rapid(b, in.work(ref))}
+	}
+
+	var segments []Segment
+	if !in.Dialect.Defaults().HomeDirect {
+		segments = append(segments, in.rapid(b, in.target(b)))
+	}
+	end := in.machine(st.Position)
+	refAxes := pointAxes(&ref)
+	for i, axis := range pointAxes(&end) {
+		if b.Has(axis.letter) {
+			*axis.value = *refAxes[i].value
+		}
+	}
+	return append(segments, in.rapid(b, in.work(end)))
+}
+
+// changeTool 执行 M6，装入 T 选择的刀具
+// 刀具长度补偿不随换刀改变，需要程序再次执行 G43
+func (in *Interpreter) changeTool() {
+	st := &in.State
+	if st.NextTool != st.Tool {
+		st.Tool = st.NextTool
+		st.ToolChanges++
+	}
+}
+
+// setCutterComp 执行 G40/G41/G42，G41/G42 的 D 为刀具直径表中的刀号，省略时使用主轴上的刀具
+// G41.1/G42.1 的 D 直接给出刀具直径
+func (in *Interpreter) setCutterComp(b *Block, code string) {
+	st := &in.State
+	switch code {
+	case "G40":
+		st.CutterComp, st.CompRadius = "", 0
+	case "G41", "G42":
+		tool := st.Tool
+		if d, ok := b.Get('D'); ok {
+			tool = int(d)
+		}
+		diameter, ok := in.Diameters[tool]
+		if !ok && tool != 0 {
+			in.compIssue(b.Line, "刀具 T%d 没有设置直径，按半径 0 补偿", tool)
+		}
+		st.CutterComp, st.CompRadius = code, diameter/2
+	case "G41.1", "G42.1":
+		d, _ := b.Get('D')
+		st.CutterComp, st.CompRadius = code[:3], in.toMM(d)/2
+	}
+}
+
+// setOffset 执行 G92，修改坐标偏移使当前位置的坐标变为指定值，不产生运动
+func (in *Interpreter) setOffset(b *Block) {
+	st := &in.State
+	offset := pointAxes(&st.Offset)
+	for i, axis := range pointAxes(&st.Position) {
+		if v, ok := b.Get(axis.letter); ok {
+			v = in.toMM(v)
+			*offset[i].value += *axis.value - v
+			*axis.value = v
+		}
+	}
+}
+
+// target 计算程序段的目标位置(工件坐标)
+func (in *Interpreter) target(b *Block) Point {
+	p := in.State.Position
+	for _, axis := range pointAxes(&p) {
+		if v, ok := b.Get(axis.letter); ok {
+			v = in.toMM(v)
+			if in.State.Absolute {
+				*axis.value = v
+			} else {
+				*axis.value += v
+			}
+		}
+	}
+	return p
+}
+
+// machineTarget 计算 G53 程序段的目标位置，坐标字为机器坐标，返回工件坐标
+func (in *Interpreter) machineTarget(b *Block) Point {
+	p := in.machine(in.State.Position)
+	for _, axis := range pointAxes(&p) {
+		if v, ok := b.Get(axis.letter); ok {
+			*axis.value = in.toMM(v)
+		}
+	}
+	return in.work(p)
+}
+
+// setCoordData 执行 G10：L2 设置工件坐标系原点的机器坐标，L20 设置原点使当前位置的坐标变为指定值，
+// L1 设置刀具长度表。P 为坐标系序号(1 为 G54，0 为当前坐标系)或刀具号
+func (in *Interpreter) setCoordData(b *Block) {
+	st := &in.State
+	l, _ := b.Get('L')
+	p, _ := b.Get('P')
+	switch l {
+	case 1:
+		if z, ok := b.Get('Z'); ok {
+			in.Tools[int(p)] = in.toMM(z)
+		}
+		return
+	case 2, 20:
+	default:
+		return
+	}
+
+	index := int(p) - 1
+	if p == 0 {
+		index = st.CoordSystem
+	}
+	if index < 0 || index >= len(st.WorkOffsets) {
+		return
+	}
+	m := in.machine(st.Position)
+	in.reframe(func(st *State) {
+		origin := pointAxes(&st.WorkOffsets[index])
+		others := pointAxes(&Point{X: st.Offset.X, Y: st.Offset.Y, Z: st.Offset.Z + st.ToolLength})
+		for i, axis := range pointAxes(&m) {
+			v, ok := b.Get(axis.letter)
+			if !ok {
+				continue
+			}
+			v = in.toMM(v)
+			if l == 20 {
+				v = *axis.value - *others[i].value - v
+			}
+			*origin[i].value = v
+		}
+	})
+}
+
+// reframe 修改坐标偏移后重新计算当前工件坐标，机器位置不变
+func (in *Interpreter) reframe(change func(st *State)) {
+	m := in.machine(in.State.Position)
+	change(&in.State)
+	in.State.Position = in.work(m)
+}
+
+// offset 工件坐标到机器坐标的偏移，包括工件坐标系原点、G92 偏移和刀具长度补偿
+func (in *Interpreter) offset() Point {
+	st := &in.State
+	o := st.WorkOffsets[st.CoordSystem]
+	return Point{X: o.X + st.Offset.X, Y: o.Y + st.Offset.Y, Z: o.Z + st.Offset.Z + st.ToolLength}
+}
+
+// machine 将工件坐标转换为机器坐标
+func (in *Interpreter) machine(p Point) Point {
+	o := in.offset()
+	return Point{X: p.X + o.X, Y: p.Y + o.Y, Z: p.Z + o.Z}
+}
+
+// work 将机器坐标转换为工件坐标
+func (in *Interpreter) work(m Point) Point {
+	return subPoint(m, in.offset())
+}
+
+// arcCenter 计算圆弧圆心，支持 I/J 圆心偏移和 R 半径两种方式
+func (in *Interpreter) arcCenter(b *Block, from, to Point, motion string) Point {
+	if r, ok := b.Get('R'); ok {
+		r = in.toMM(r)
+		dx, dy := to.X-from.X, to.Y-from.Y
+		d := math.Hypot(dx, dy)
+		if d == 0 {
+			return from
+		}
+		h2 := r*r - d*d/4
+		if h2 < 0 {
+			h2 = 0
+		}
+		h := math.Sqrt(h2)
+		// 顺时针且R为正时圆心在弦的右侧；R为负表示大于180度的圆弧
+		if (motion == MotionCW) == (r > 0) {
+			h = -h
+		}
+		return Point{
+			X: from.X + dx/2 - h*dy/d,
+			Y: from.Y + dy/2 + h*dx/d,
+			Z: from.Z,
+		}
+	}
+
+	i, _ := b.Get('I')
+	j, _ := b.Get('J')
+	return Point{X: from.X + in.toMM(i), Y: from.Y + in.toMM(j), Z: from.Z}
+}
+
+// toMM 按当前单位转换为毫米
+func (in *Interpreter) toMM(v float64) float64 {
+	if in.State.Inches {
+		return v * inchToMM
+	}
+	return v
+}
+
+// DwellTime 返回 G4 暂停时间(秒)，程序段不是 G4 时返回false
+func DwellTime(b *Block) (float64, bool) {
+	_, seconds, ok := dwellWord(b)
+	return seconds, ok
+}
+
+// dwellWord 返回 G4 暂停时间所在的地址字和数值
+// 依次使用 P(LinuxCNC/Grbl)、X(Fanuc) 和 S(Marlin)，都按秒计算
+func dwellWord(b *Block) (byte, float64, bool) {
+	if !b.HasCode("G4") {
+		return 0, 0, false
+	}
+	for _, letter := range []byte{'P', 'X', 'S'} {
+		if v, ok := b.Get(letter); ok {
+			return letter, v, true
+		}
+	}
+	return 0, 0, true
+}
+
+// coordSystemIndex 返回工件坐标系在 CoordSystems 中的序号，不是工件坐标系时返回-1
+func coordSystemIndex(code string) int {
+	for i, c := range CoordSystems {
+		if c == code {
+			return i
+		}
+	}
+	return -1
+}
+
+// axisRef 坐标点中的一个轴
+type axisRef struct {
+	letter byte
+	value  *float64
+}
+
+// pointAxes 返回坐标点的各个轴，用于按坐标字逐轴修改
+func pointAxes(p *Point) [3]axisRef {
+	return [3]axisRef{{'X', &p.X}, {'Y', &p.Y}, {'Z', &p.Z}}
+}
+
+// subPoint 计算 p - o
+func subPoint(p, o Point) Point {
+	return Point{X: p.X - o.X, Y: p.Y - o.Y, Z: p.Z - o.Z}
+}
+
+// hasAxis 程序段是否包含坐标字
+func hasAxis(b *Block) bool {
+	return b.Has('X') || b.Has('Y') || b.Has('Z')
+}
@@ -0,0 +1,125 @@
+package gcode
+
+import (
+	"math"
+	"testing"
+)
+
+func TestInterpreterOffsets(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		tools   map[int]float64
+		work    Point // 工件坐标
+		machine Point // 机器坐标
+	}{
+		{
+			name:    "G10 L2 设置 G54 原点",
+			src:     "G10 L2 P1 X100 Y50\nG54 G0 X0 Y0\n",
+			work:    Point{},
+			machine: Point{X: 100, Y: 50},
+		},
+		{
+			name:    "切换坐标系时机器位置不变",
+			src:     "G10 L2 P2 X10\nG0 X5\nG55\n",
+			work:    Point{X: -5},
+			machine: Point{X: 5},
+		},
+		{
+			name:    "G10 L20 使当前位置为指定坐标",
+			src:     "G0 X30 Y5\nG10 L20 P1 X0\n",
+			work:    Point{Y: 5},
+			machine: Point{X: 30, Y: 5},
+		},
+		{
+			name:    "G10 P0 修改当前坐标系",
+			src:     "G56\nG10 L2 P0 X7\nG0 X1\n",
+			work:    Point{X: 1},
+			machine: Point{X: 8},
+		},
+		{
+			name:    "英制单位的 G10",
+			src:     "G20\nG10 L2 P1 X1\nG0 X0\n",
+			work:    Point{},
+			machine: Point{X: 25.4},
+		},
+		{
+			name:    "G92 偏移",
+			src:     "G0 X10\nG92 X0\nG0 X5\n",
+			work:    Point{X: 5},
+			machine: Point{X: 15},
+		},
+		{
+			name:    "G92.1 取消偏移",
+			src:     "G0 X10\nG92 X0\nG92.1\n",
+			work:    Point{X: 10},
+			machine: Point{X: 10},
+		},
+		{
+			name:    "G92.2 暂停、G92.3 恢复偏移",
+			src:     "G0 X10\nG92 X0\nG92.2\nG0 X1\nG92.3\n",
+			work:    Point{X: -9},
+			machine: Point{X: 1},
+		},
+		{
+			name:    "G43 刀具长度补偿",
+			src:     "G43 H1\nG0 Z0\n",
+			tools:   map[int]float64{1: 20},
+			work:    Point{},
+			machine: Point{Z: 20},
+		},
+		{
+			name:    "G10 L1 修改刀具长度表",
+			src:     "G10 L1 P2 Z15\nG43 H2\nG0 Z0\n",
+			work:    Point{},
+			machine: Point{Z: 15},
+		},
+		{
+			name:    "G49 取消刀具长度补偿",
+			src:     "G43 H1\nG0 Z0\nG49\n",
+			tools:   map[int]float64{1: 20},
+			work:    Point{Z: 20},
+			machine: Point{Z: 20},
+		},
+		{
+			name:    "G53 机器坐标移动",
+			src:     "G10 L2 P1 X100\nG0 X0\nG53 G0 X0\n",
+			work:    Point{X: -100},
+			machine: Point{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := NewInterpreter()
+			for tool, length := range tt.tools {
+				in.Tools[tool] = length
+			}
+			runSegments(t, in, tt.src)
+			if !nearPoint(in.State.Position, tt.work) {
+				t.Errorf("工件坐标 = %+v, want %+v", in.State.Position, tt.work)
+			}
+			if m := in.machine(in.State.Position); !nearPoint(m, tt.machine) {
+				t.Errorf("机器坐标 = %+v, want %+v", m, tt.machine)
+			}
+		})
+	}
+}
+
+// nearPoint 两点是否在误差范围内相同
+func nearPoint(a, b Point) bool {
+	return math.Abs(a.X-b.X) < 1e-9 && math.Abs(a.Y-b.Y) < 1e-9 && math.Abs(a.Z-b.Z) < 1e-9
+}
+
+func TestSegmentOffset(t *testing.T) {
+	// 运动段的坐标为工件坐标，Offset 换算为机器坐标
+	in := NewInterpreter()
+	in.Tools[1] = 5
+	lines := runSegments(t, in, "G10 L2 P1 X100 Y50\nG43 H1\nG0 X1 Y2 Z3\n")
+	segments := lines[3]
+	if len(segments) != 1 {
+		t.Fatalf("segments = %+v", segments)
+	}
+	if seg := segments[0]; seg.To != (Point{1, 2, 3}) || seg.Offset != (Point{100, 50, 5}) {
+		t.Errorf("segment = %+v", seg)
+	}
+}
@@ -0,0 +1,156 @@
+package gcode
+
+import "strconv"
+
+// TokenKind 词法单元类型
+type TokenKind int
+
+const (
+	TokenWord       TokenKind = iota // 代码字，如 X10.5
+	TokenLineNumber                  // 行首的行号，如 N10
+	TokenComment                     // 注释，分号或括号注释
+	TokenChecksum                    // 校验和，如 *71
+)
+
+// Token 词法单元
+// Text 引用原始行中的字节，不会复制，下一次调用 Lexer.Reset 后失效
+type Token struct {
+	Kind   TokenKind
+	Letter byte    // 地址字母(大写)，行号为 'N'，校验和为 '*'
+	Value  float64 // 数值
+	Text   []byte  // 数值文本(含符号)或注释内容
+	Pos    int     // 在行中的起始位置
+	TextAt int     // Text 在行中的起始位置
+}
+
+// Lexer G代码词法分析器，逐个读取一行中的词法单元，不分配内存
+// 地址字母与数值之间可以有空格，数值为可带符号的十进制小数；
+// 行首的 N 识别为行号，* 之后的数字识别为校验和
+type Lexer struct {
+	line  []byte
+	pos   int
+	words int // 已读取的代码字数量
+}
+
+// Reset 开始分析新的一行
+func (l *Lexer) Reset(line []byte) {
+	l.line = line
+	l.pos = 0
+	l.words = 0
+}
+
+// Next 读取下一个词法单元，没有更多内容时返回false
+func (l *Lexer) Next(tok *Token) bool {
+	line := l.line
+	for l.pos < len(line) {
+		i := l.pos
+		c := line[i]
+		switch {
+		case c == ';':
+			// 行尾注释
+			*tok = Token{Kind: TokenComment, Text: line[i+1:], Pos: i, TextAt: i + 1}
+			l.pos = len(line)
+			return true
+		case c == '(':
+			// 括号注释，未闭合时到行尾
+			end := i + 1
+			for end < len(line) && line[end] != ')' {
+				end++
+			}
+			*tok = Token{Kind: TokenComment, Text: line[i+1 : end], Pos: i, TextAt: i + 1}
+			l.pos = end + 1
+			return true
+		case c == '*':
+			start, end := i+1, i+1
+			for end < len(line) && isDigit(line[end]) {
+				end++
+			}
+			l.pos = end
+			if end == start {
+				continue
+			}
+			_, value, _ := lexNumber(line, start)
+			*tok = Token{Kind: TokenChecksum, Letter: '*', Value: value, Text: line[start:end], Pos: i, TextAt: start}
+			return true
+		case isLetter(c):
+			letter := upper(c)
+			j := i + 1
+			for j < len(line) && (line[j] == ' ' || line[j] == '\t') {
+				j++
+			}
+			end, value, ok := lexNumber(line, j)
+			if !ok {
+				// 不是合法的代码字，跳过字母
+				l.pos = i + 1
+				continue
+			}
+			kind := TokenWord
+			if letter == 'N' && l.words == 0 {
+				kind = TokenLineNumber
+			}
+			*tok = Token{Kind: kind, Letter: letter, Value: value, Text: line[j:end], Pos: i, TextAt: j}
+			l.words++
+			l.pos = end
+			return true
+		default:
+			l.pos++
+		}
+	}
+	return false
+}
+
+// maxExactMantissa 可以精确表示为float64的最大整数
+const maxExactMantissa = 1 << 53
+
+// pow10 可以精确表示为float64的10的幂
+var pow10 = [...]float64{1e0, 1e1, 1e2, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8, 1e9, 1e10,
+	1e11, 1e12, 1e13, 1e14, 1e15, 1e16, 1e17, 1e18, 1e19, 1e20, 1e21, 1e22}
+
+// lexNumber 从start开始读取可带符号的十进制数，返回结束位置和数值，至少需要一位数字
+// 尾数和小数位数都能精确表示时直接计算，结果与 strconv.ParseFloat 相同；
+// 否则回退到 strconv.ParseFloat
+func lexNumber(line []byte, start int) (int, float64, bool) {
+	j := start
+	neg := false
+	if j < len(line) && (line[j] == '-' || line[j] == '+') {
+		neg = line[j] == '-'
+		j++
+	}
+
+	var mantissa uint64
+	digits, frac := 0, 0
+	dot := false
+	exact := true
+	for ; j < len(line); j++ {
+		c := line[j]
+		if c == '.' && !dot {
+			dot = true
+			continue
+		}
+		if !isDigit(c) {
+			break
+		}
+		digits++
+		if dot {
+			frac++
+		}
+		if mantissa >= maxExactMantissa/10 {
+			exact = false
+			continue
+		}
+		mantissa = mantissa*10 + uint64(c-'0')
+	}
+	if digits == 0 {
+		return j, 0, false
+	}
+	if !exact || frac >= len(pow10) {
+		value, err := strconv.ParseFloat(string(line[start:j]), 64)
+		return j, value, err == nil
+	}
+
+	value := float64(mantissa) / pow10[frac]
+	if neg {
+		value = -value
+	}
+	return j, value, true
+}
@@ -0,0 +1,67 @@
+package gcode
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// lexAll 读取一行的所有词法单元，格式为 类型:字母:文本@位置
+func lexAll(line string) string {
+	var lex Lexer
+	var tok Token
+	var out []string
+	kinds := map[TokenKind]string{TokenWord: "W", TokenLineNumber: "N", TokenComment: "C", TokenChecksum: "*"}
+	lex.Reset([]byte(line))
+	for lex.Next(&tok) {
+		if line[tok.TextAt:tok.TextAt+len(tok.Text)] != string(tok.Text) {
+			return fmt.Sprintf("TextAt %d 与 Text %q 不一致", tok.TextAt, tok.Text)
+		}
+		letter := ""
+		if tok.Letter != 0 {
+			letter = string(tok.Letter)
+		}
+		out = append(out, fmt.Sprintf("%s:%s:%s@%d", kinds[tok.Kind], letter, tok.Text, tok.Pos))
+	}
+	return strings.Join(out, " ")
+}
+
+func TestLexer(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"G1 X10", "W:G:1@0 W:X:10@3"},
+		{"N10 G1 N20", "N:N:10@0 W:G:1@4 W:N:20@7"},
+		{"x 1.5y-2", "W:X:1.5@0 W:Y:-2@5"},
+		{"G1 (a;b) X1 ; c*1", "W:G:1@0 C::a;b@3 W:X:1@9 C:: c*1@12"},
+		{"G0 (unclosed", "W:G:0@0 C::unclosed@3"},
+		{"N3 T0*57", "N:N:3@0 W:T:0@3 *:*:57@5"},
+		{"G1 * X1", "W:G:1@0 W:X:1@5"},
+		{"M117 Hello", "W:M:117@0"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			if got := lexAll(tt.line); got != tt.want {
+				t.Errorf("lex(%q) = %s, want %s", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	tests := []struct {
+		data string
+		want int
+	}{
+		{"N3 T0", 57},
+		{"", 0},
+		{"N1 M110", 34},
+	}
+	for _, tt := range tests {
+		if got := Checksum([]byte(tt.data)); got != tt.want {
+			t.Errorf("Checksum(%q) = %d, want %d", tt.data, got, tt.want)
+		}
+	}
+}
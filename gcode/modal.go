@@ -0,0 +1,115 @@
+package gcode
+
+import "fmt"
+
+// ModalGroup RS-274/NGC 模态组，同一程序段中同组的命令只能出现一个
+type ModalGroup struct {
+	Letter byte   // G 或 M
+	Number int    // 标准中的组号
+	Name   string // 说明
+}
+
+// String 返回组的名称，如 "G模态组1(运动)"
+func (g ModalGroup) String() string {
+	return fmt.Sprintf("%c模态组%d(%s)", g.Letter, g.Number, g.Name)
+}
+
+// 模态组
+var (
+	GroupNonModal    = ModalGroup{'G', 0, "非模态"}
+	GroupMotion      = ModalGroup{'G', 1, "运动"}
+	GroupPlane       = ModalGroup{'G', 2, "平面"}
+	GroupDistance    = ModalGroup{'G', 3, "距离模式"}
+	GroupFeedMode    = ModalGroup{'G', 5, "进给模式"}
+	GroupUnits       = ModalGroup{'G', 6, "单位"}
+	GroupCutterComp  = ModalGroup{'G', 7, "刀具半径补偿"}
+	GroupToolLength  = ModalGroup{'G', 8, "刀具长度补偿"}
+	GroupReturnMode  = ModalGroup{'G', 10, "固定循环返回"}
+	GroupCoordSystem = ModalGroup{'G', 12, "坐标系"}
+	GroupPathControl = ModalGroup{'G', 13, "路径控制"}
+	GroupStop        = ModalGroup{'M', 4, "程序停止"}
+	GroupToolChange  = ModalGroup{'M', 6, "换刀"}
+	GroupSpindle     = ModalGroup{'M', 7, "主轴"}
+	GroupCoolant     = ModalGroup{'M', 8, "冷却"}
+	GroupOverride    = ModalGroup{'M', 9, "倍率开关"}
+)
+
+// modalGroups 命令所属的模态组
+var modalGroups = map[string]ModalGroup{
+	"G4": GroupNonModal, "G10": GroupNonModal, "G28": GroupNonModal, "G28.1": GroupNonModal,
+	"G30": GroupNonModal, "G30.1": GroupNonModal, "G53": GroupNonModal,
+	"G92": GroupNonModal, "G92.1": GroupNonModal, "G92.2": GroupNonModal, "G92.3": GroupNonModal,
+
+	"G0": GroupMotion, "G1": GroupMotion, "G2": GroupMotion, "G3": GroupMotion,
+	"G38.2": GroupMotion, "G73": GroupMotion, "G80": GroupMotion, "G81": GroupMotion, "G82": GroupMotion,
+	"G83": GroupMotion, "G84": GroupMotion, "G85": GroupMotion, "G86": GroupMotion,
+	"G87": GroupMotion, "G88": GroupMotion, "G89": GroupMotion,
+
+	"G17": GroupPlane, "G18": GroupPlane, "G19": GroupPlane,
+	"G90": GroupDistance, "G91": GroupDistance,
+	"G93": GroupFeedMode, "G94": GroupFeedMode,
+	"G20": GroupUnits, "G21": GroupUnits,
+	"G40": GroupCutterComp, "G41": GroupCutterComp, "G42": GroupCutterComp, "G41.1": GroupCutterComp, "G42.1": GroupCutterComp,
+	"G43": GroupToolLength, "G43.1": GroupToolLength, "G49": GroupToolLength,
+	"G98": GroupReturnMode, "G99": GroupReturnMode,
+	"G54": GroupCoordSystem, "G55": GroupCoordSystem, "G56": GroupCoordSystem,
+	"G57": GroupCoordSystem, "G58": GroupCoordSystem, "G59": GroupCoordSystem,
+	"G59.1": GroupCoordSystem, "G59.2": GroupCoordSystem, "G59.3": GroupCoordSystem,
+	"G61": GroupPathControl, "G61.1": GroupPathControl, "G64": GroupPathControl,
+
+	"M0": GroupStop, "M1": GroupStop, "M2": GroupStop, "M30": GroupStop, "M60": GroupStop,
+	"M6": GroupToolChange,
+	"M3": GroupSpindle, "M4": GroupSpindle, "M5": GroupSpindle,
+	"M7": GroupCoolant, "M8": GroupCoolant, "M9": GroupCoolant,
+	"M48": GroupOverride, "M49": GroupOverride,
+}
+
+// axisCodes 坐标字不表示运动目标的命令，不能与使用坐标字的运动命令写在同一段
+var axisCodes = map[string]bool{
+	"G10": true, "G28": true, "G30": true, "G43.1": true, "G92": true,
+}
+
+// ModalGroupOf 返回命令所属的模态组，不属于任何组时返回false
+func ModalGroupOf(code string) (ModalGroup, bool) {
+	g, ok := modalGroups[code]
+	return g, ok
+}
+
+// ModalConflicts 检查程序段中的模态组冲突，返回问题说明
+// 包括同组命令重复、同一地址字重复，以及非模态命令与运动命令同时使用坐标字
+func ModalConflicts(b *Block) []string {
+	var problems []string
+	seen := map[ModalGroup]string{}
+	letters := map[byte]bool{}
+	axisCode, motion := "", ""
+	for _, w := range b.Words {
+		if w.Letter != 'G' && w.Letter != 'M' {
+			if letters[w.Letter] {
+				problems = append(problems, fmt.Sprintf("地址字 %c 重复出现", w.Letter))
+			}
+			letters[w.Letter] = true
+			continue
+		}
+
+		code := CodeName(w.Letter, w.Value)
+		group, ok := modalGroups[code]
+		if !ok {
+			continue
+		}
+		// M7 和 M8 可以同时开启
+		if prev, ok := seen[group]; ok && !(group == GroupCoolant && prev != code && prev != "M9" && code != "M9") {
+			problems = append(problems, fmt.Sprintf("%s 和 %s 属于同一%s", prev, code, group))
+		}
+		seen[group] = code
+		switch {
+		case axisCodes[code]:
+			axisCode = code
+		case group == GroupMotion && code != "G80":
+			motion = code
+		}
+	}
+	if axisCode != "" && motion != "" && hasAxis(b) {
+		problems = append(problems, fmt.Sprintf("%s 和 %s 不能同时使用坐标字", axisCode, motion))
+	}
+	return problems
+}
@@ -0,0 +1,101 @@
+package gcode
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// runSegments 执行程序并按行号收集运动段
+func runSegments(t *testing.T, in *Interpreter, src string) map[int][]Segment {
+	t.Helper()
+	lines := map[int][]Segment{}
+	err := Run(strings.NewReader(src), in, func(b *Block, segments []Segment) error {
+		lines[b.Line] = append(lines[b.Line], segments...)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	return lines
+}
+
+func TestModalConflicts(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"G90 G0 G54 X0 Y0", nil},
+		{"G0 G1 X10", []string{"G0 和 G1 属于同一G模态组1(运动)"}},
+		{"G20 G21", []string{"G20 和 G21 属于同一G模态组6(单位)"}},
+		{"M3 M5", []string{"M3 和 M5 属于同一M模态组7(主轴)"}},
+		{"M7 M8", nil},
+		{"M8 M9", []string{"M8 和 M9 属于同一M模态组8(冷却)"}},
+		{"G1 X1 X2", []string{"地址字 X 重复出现"}},
+		{"G92 G1 X0", []string{"G92 和 G1 不能同时使用坐标字"}},
+		{"G28 G0", nil},
+		{"G80 G10 L2 P1 X0", nil},
+		{"G4 P1 G1 X1", nil},
+		{"G100 G101", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			if got := ModalConflicts(ParseLine(tt.line, 1)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ModalConflicts(%q) = %q, want %q", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInterpreterModal(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		end  Point // 工件坐标
+		st   func(st *State) bool
+	}{
+		{
+			name: "一行多个模态命令",
+			src:  "G21 G91 G1 X10 F100\nY5\n",
+			end:  Point{X: 10, Y: 5},
+			st:   func(st *State) bool { return !st.Absolute && st.Motion == MotionLinear && st.Feed == 100 },
+		},
+		{
+			name: "单位在运动之前生效",
+			src:  "G1 G20 X1 F10\n",
+			end:  Point{X: 25.4},
+			st:   func(st *State) bool { return st.Inches },
+		},
+		{
+			name: "省略的轴保持不变",
+			src:  "G1 X10 F100\nG1 Y10\n",
+			end:  Point{X: 10, Y: 10},
+			st:   func(st *State) bool { return true },
+		},
+		{
+			name: "没有运动命令时使用模态运动",
+			src:  "G0 X5\nX7 Y1\n",
+			end:  Point{X: 7, Y: 1},
+			st:   func(st *State) bool { return st.Motion == MotionRapid },
+		},
+		{
+			name: "平面和主轴冷却",
+			src:  "G18 M4 S1200 M7 M8\n",
+			st: func(st *State) bool {
+				return st.Plane == "G18" && st.SpindleOn && st.SpindleCCW && st.Mist && st.Flood
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := NewInterpreter()
+			runSegments(t, in, tt.src)
+			if in.State.Position != tt.end {
+				t.Errorf("Position = %+v, want %+v", in.State.Position, tt.end)
+			}
+			if !tt.st(&in.State) {
+				t.Errorf("State = %+v", in.State)
+			}
+		})
+	}
+}
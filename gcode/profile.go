@@ -0,0 +1,23 @@
+package gcode
+
+import "ok/model"
+
+// NewInterpreterFor 按机器配置创建解释器，控制器方言、工件坐标系原点、刀具长度表和刀具直径表取自机器配置
+// 未知的方言按通用方言处理，加载机器配置时已经校验
+func NewInterpreterFor(profile *model.MachineProfile) *Interpreter {
+	interp := NewInterpreter()
+	if d, ok := LookupDialect(profile.Dialect); ok {
+		interp.Dialect = d
+	}
+	interp.LaserMode = profile.Laser && interp.Dialect.Defaults().LaserMode
+	for i, code := range CoordSystems {
+		interp.State.WorkOffsets[i] = Point(profile.CoordSystemOffset(code))
+	}
+	for tool, length := range profile.ToolLengths {
+		interp.Tools[tool] = length
+	}
+	for tool, diameter := range profile.ToolDiameters {
+		interp.Diameters[tool] = diameter
+	}
+	return interp
+}
@@ -0,0 +1,33 @@
+package gcode
+
+import "io"
+
+// maxLineSize 单行最大长度
+const maxLineSize = 1024 * 1024 // 1MB
+
+// Run 展开子程序和循环后逐段执行G代码，每个程序段执行后调用fn
+// 展开选项取自解释器的方言，程序段的行号为源文件中的行号
+func Run(r io.Reader, interp *Interpreter, fn func(b *Block, segments []Segment) error) error {
+	_, err := RunProgram(r, interp, fn)
+	return err
+}
+
+// RunProgram 与 Run 相同，边展开边执行，不保存整个程序，返回展开的统计
+func RunProgram(r io.Reader, interp *Interpreter, fn func(b *Block, segments []Segment) error) (*Program, error) {
+	run := newRunner(interp, fn)
+	prog, err := Stream(r, ExpandOptionsFor(interp.Dialect), run.line)
+	if err != nil {
+		return nil, err
+	}
+	return prog, run.comp.finish()
+}
+
+// ReadSegments 解释整个G代码输入，返回所有运动段
+func ReadSegments(r io.Reader) ([]Segment, error) {
+	var segments []Segment
+	err := Run(r, NewInterpreter(), func(b *Block, segs []Segment) error {
+		segments = append(segments, segs...)
+		return nil
+	})
+	return segments, err
+}
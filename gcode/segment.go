@@ -0,0 +1,160 @@
+package gcode
+
+import "math"
+
+// 运动类型
+const (
+	MotionRapid  = "G0" // 快速移动
+	MotionLinear = "G1" // 直线插补
+	MotionCW     = "G2" // 顺时针圆弧
+	MotionCCW    = "G3" // 逆时针圆弧
+)
+
+// Point 坐标点(mm)
+type Point struct {
+	X, Y, Z float64
+}
+
+// Distance 计算到另一点的距离
+func (p Point) Distance(o Point) float64 {
+	dx, dy, dz := o.X-p.X, o.Y-p.Y, o.Z-p.Z
+	return math.Sqrt(dx*dx + dy*dy + dz*dz)
+}
+
+// Segment 解析后的运动段，坐标均为绝对坐标(mm)
+type Segment struct {
+	Line      int     // 来源行号
+	Motion    string  // 运动类型 G0/G1/G2/G3
+	From, To  Point   // 起点和终点
+	Center    Point   // 圆弧圆心(仅圆弧有效)
+	Feed      float64 // 进给速度(mm/min)
+	Power     float64 // 主轴转速/激光功率(S值)
+	SpindleOn bool    // 主轴/激光是否开启
+	Offset    Point   // 工件坐标到机器坐标的偏移，机器坐标 = 坐标 + Offset
+	Cycle     string  // 产生该段的固定循环，如 G81、G83，普通运动为空
+	Hole      bool    // 是否为固定循环中一个孔的第一段进给，To 的 X/Y 为孔位
+	Dwell     float64 // 到达终点后的暂停时间(秒)，固定循环孔底暂停使用
+}
+
+// IsArc 是否为圆弧
+func (s *Segment) IsArc() bool {
+	return s.Motion == MotionCW || s.Motion == MotionCCW
+}
+
+// IsRapid 是否为快速移动
+func (s *Segment) IsRapid() bool {
+	return s.Motion == MotionRapid
+}
+
+// Length 计算运动段长度，圆弧按弧长计算
+func (s *Segment) Length() float64 {
+	if !s.IsArc() {
+		return s.From.Distance(s.To)
+	}
+	r := s.Radius()
+	planar := r * math.Abs(s.Sweep())
+	dz := s.To.Z - s.From.Z
+	return math.Sqrt(planar*planar + dz*dz)
+}
+
+// PlanarLength 运动段在 XY 平面上的长度，圆弧按弧长计算
+func (s *Segment) PlanarLength() float64 {
+	if s.IsArc() {
+		return s.Radius() * math.Abs(s.Sweep())
+	}
+	return math.Hypot(s.To.X-s.From.X, s.To.Y-s.From.Y)
+}
+
+// Radius 圆弧半径
+func (s *Segment) Radius() float64 {
+	return math.Hypot(s.From.X-s.Center.X, s.From.Y-s.Center.Y)
+}
+
+// Sweep 圆弧扫过的角度(弧度)，逆时针为正，顺时针为负
+func (s *Segment) Sweep() float64 {
+	a0 := math.Atan2(s.From.Y-s.Center.Y, s.From.X-s.Center.X)
+	a1 := math.Atan2(s.To.Y-s.Center.Y, s.To.X-s.Center.X)
+	sweep := a1 - a0
+	if s.Motion == MotionCCW {
+		if sweep <= 1e-9 {
+			sweep += 2 * math.Pi
+		}
+	} else {
+		if sweep >= -1e-9 {
+			sweep -= 2 * math.Pi
+		}
+	}
+	return sweep
+}
+
+// Bounds 计算运动段的包围盒，圆弧会考虑经过的象限点
+func (s *Segment) Bounds() (min, max Point) {
+	min = Point{math.Min(s.From.X, s.To.X), math.Min(s.From.Y, s.To.Y), math.Min(s.From.Z, s.To.Z)}
+	max = Point{math.Max(s.From.X, s.To.X), math.Max(s.From.Y, s.To.Y), math.Max(s.From.Z, s.To.Z)}
+	if !s.IsArc() {
+		return min, max
+	}
+
+	r := s.Radius()
+	start := math.Atan2(s.From.Y-s.Center.Y, s.From.X-s.Center.X)
+	sweep := s.Sweep()
+	for k := 0; k < 4; k++ {
+		angle := float64(k) * math.Pi / 2
+		if angleWithin(angle, start, sweep) {
+			x := s.Center.X + r*math.Cos(angle)
+			y := s.Center.Y + r*math.Sin(angle)
+			min.X, max.X = math.Min(min.X, x), math.Max(max.X, x)
+			min.Y, max.Y = math.Min(min.Y, y), math.Max(max.Y, y)
+		}
+	}
+	return min, max
+}
+
+// Points 将运动段离散为折线点，圆弧按给定弦高误差细分
+func (s *Segment) Points(tolerance float64) []Point {
+	if !s.IsArc() {
+		return []Point{s.From, s.To}
+	}
+
+	r := s.Radius()
+	sweep := s.Sweep()
+	steps := 1
+	if r > tolerance && tolerance > 0 {
+		maxStep := 2 * math.Acos(1-tolerance/r)
+		steps = int(math.Ceil(math.Abs(sweep) / maxStep))
+	}
+	if steps < 1 {
+		steps = 1
+	}
+
+	start := math.Atan2(s.From.Y-s.Center.Y, s.From.X-s.Center.X)
+	points := make([]Point, 0, steps+1)
+	points = append(points, s.From)
+	for i := 1; i < steps; i++ {
+		t := float64(i) / float64(steps)
+		angle := start + sweep*t
+		points = append(points, Point{
+			X: s.Center.X + r*math.Cos(angle),
+			Y: s.Center.Y + r*math.Sin(angle),
+			Z: s.From.Z + (s.To.Z-s.From.Z)*t,
+		})
+	}
+	return append(points, s.To)
+}
+
+// angleWithin 判断角度是否位于从start开始扫过sweep的区间内
+func angleWithin(angle, start, sweep float64) bool {
+	d := angle - start
+	if sweep >= 0 {
+		d = math.Mod(d, 2*math.Pi)
+		if d < 0 {
+			d += 2 * math.Pi
+		}
+		return d <= sweep
+	}
+	d = math.Mod(-d, 2*math.Pi)
+	if d < 0 {
+		d += 2 * math.Pi
+	}
+	return d <= -sweep
+}
@@ -0,0 +1,126 @@
+package gcode
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// sourceBufferSize 读取源程序的初始缓冲区大小，跳转目标在缓冲区内时不需要重新读取
+const sourceBufferSize = 64 * 1024
+
+// lineSource 按行读取源程序并记录读取位置
+// 源程序可以定位时(如 *os.File、*bytes.Reader)可以回到已读过的位置重新读取
+type lineSource struct {
+	r      io.Reader
+	seeker io.Seeker // 不能定位时为nil
+	origin int64     // 开始读取时r的位置
+	buf    []byte
+	start  int64 // buf[0] 相对 origin 的位置
+	rpos   int   // 下一行在buf中的位置
+	wpos   int   // buf中已读数据的结尾
+	err    error // 读取r返回的错误，缓冲区中的数据读完后返回
+}
+
+func newLineSource(r io.Reader) *lineSource {
+	s := &lineSource{r: r, buf: make([]byte, sourceBufferSize)}
+	if seeker, ok := r.(io.Seeker); ok {
+		if origin, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			s.seeker, s.origin = seeker, origin
+		}
+	}
+	return s
+}
+
+// pos 下一行相对 origin 的位置
+func (s *lineSource) pos() int64 {
+	return s.start + int64(s.rpos)
+}
+
+// readLine 读取一行，去掉行尾的 \r\n，与 bufio.ScanLines 相同；读完时返回 io.EOF
+// 返回的内容在下一次读取前有效
+func (s *lineSource) readLine() ([]byte, error) {
+	for {
+		if i := bytes.IndexByte(s.buf[s.rpos:s.wpos], '\n'); i >= 0 {
+			line := s.buf[s.rpos : s.rpos+i]
+			s.rpos += i + 1
+			return dropCR(line), nil
+		}
+		if s.err != nil {
+			if s.rpos == s.wpos {
+				return nil, s.err
+			}
+			line := s.buf[s.rpos:s.wpos]
+			s.rpos = s.wpos
+			return dropCR(line), nil
+		}
+		if err := s.fill(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// fill 把未读的数据移到缓冲区开头并继续读取，一行超过缓冲区时扩大缓冲区
+func (s *lineSource) fill() error {
+	if s.rpos > 0 {
+		copy(s.buf, s.buf[s.rpos:s.wpos])
+		s.start += int64(s.rpos)
+		s.wpos -= s.rpos
+		s.rpos = 0
+	}
+	if s.wpos == len(s.buf) {
+		if len(s.buf) >= maxLineSize {
+			return bufio.ErrTooLong
+		}
+		buf := make([]byte, min(2*len(s.buf), maxLineSize))
+		copy(buf, s.buf[:s.wpos])
+		s.buf = buf
+	}
+	n, err := s.r.Read(s.buf[s.wpos:])
+	s.wpos += n
+	s.err = err
+	return nil
+}
+
+// seek 回到相对 origin 的位置，位置在缓冲区内时不重新读取
+func (s *lineSource) seek(off int64) error {
+	if off >= s.start && off <= s.start+int64(s.wpos) {
+		s.rpos = int(off - s.start)
+		return nil
+	}
+	if s.seeker == nil {
+		return fmt.Errorf("源程序不能重新读取")
+	}
+	if _, err := s.seeker.Seek(s.origin+off, io.SeekStart); err != nil {
+		return err
+	}
+	s.start, s.rpos, s.wpos, s.err = off, 0, 0, nil
+	return nil
+}
+
+// rest 读取剩余的全部内容
+func (s *lineSource) rest() ([]byte, error) {
+	data := append([]byte(nil), s.buf[s.rpos:s.wpos]...)
+	s.rpos = s.wpos
+	if s.err == nil {
+		more, err := io.ReadAll(s.r)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, more...)
+		s.err = io.EOF
+	}
+	if s.err != io.EOF {
+		return nil, s.err
+	}
+	return data, nil
+}
+
+// dropCR 去掉行尾的 \r
+func dropCR(line []byte) []byte {
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		return line[:len(line)-1]
+	}
+	return line
+}
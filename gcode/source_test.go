@@ -0,0 +1,62 @@
+package gcode
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLineSource(t *testing.T) {
+	long := "G1 X" + strings.Repeat("1", 3*sourceBufferSize)
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{"空", "", nil},
+		{"没有结尾换行", "G0 X0\nG1 X1", []string{"G0 X0", "G1 X1"}},
+		{"CRLF 和空行", "G0 X0\r\n\r\nG1 X1\r\n", []string{"G0 X0", "", "G1 X1"}},
+		{"超过缓冲区的长行", "G0 X0\n" + long + "\nG1 X1", []string{"G0 X0", long, "G1 X1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newLineSource(strings.NewReader(tt.src))
+			var got []string
+			var offsets []int64
+			for {
+				off := s.pos()
+				line, err := s.readLine()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, string(line))
+				offsets = append(offsets, off)
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+				t.Fatalf("lines = %q, want %q", got, tt.want)
+			}
+			// 回到每一行的位置重新读取
+			for i := len(offsets) - 1; i >= 0; i-- {
+				if err := s.seek(offsets[i]); err != nil {
+					t.Fatal(err)
+				}
+				if line, err := s.readLine(); err != nil || string(line) != tt.want[i] {
+					t.Errorf("seek 后第 %d 行 = %q %v", i, line, err)
+				}
+			}
+		})
+	}
+}
+
+func TestLineSourceUnseekable(t *testing.T) {
+	s := newLineSource(unseekable{strings.NewReader(strings.Repeat("G1 X1\n", sourceBufferSize))})
+	for i := 0; i < sourceBufferSize/2; i++ {
+		s.readLine()
+	}
+	if err := s.seek(0); err == nil {
+		t.Error("不能定位的读取器跳回缓冲区之前应当返回错误")
+	}
+}
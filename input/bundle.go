@@ -0,0 +1,271 @@
+package input
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"ok/bgcode"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LayoutFile zip压缩包中声明文件布局的文件名
+const LayoutFile = "gcodelens.json"
+
+// GCodeExtensions 识别为G-code的扩展名
+var GCodeExtensions = []string{".nc", ".gcode", ".gc", ".ngc", ".tap", ".cnc", ".bgcode"}
+
+// metadataSuffix 由 .bgcode 元数据生成的manifest的名称后缀
+const metadataSuffix = " 元数据"
+
+// compressedExtensions 压缩文件扩展名，匹配扩展名前先去掉
+var compressedExtensions = []string{".gz", ".zst"}
+
+// Layout zip压缩包中G-code和manifest的路径
+type Layout struct {
+	GCode    string `json:"gcode"`
+	Manifest string `json:"manifest"`
+}
+
+// Bundle 一个版本的G-code和manifest
+type Bundle struct {
+	GCode        *Content
+	Manifest     []byte // 没有manifest时为空
+	GCodeName    string
+	ManifestName string
+	ArchiveName  string // zip压缩包的文件名，未使用压缩包时为空
+}
+
+// DisplayName 显示名称，格式为 "G-code / Manifest (压缩包)"
+func (b *Bundle) DisplayName() string {
+	name := path.Base(filepath.ToSlash(b.GCodeName))
+	if b.ManifestName != "" {
+		name += " / " + path.Base(filepath.ToSlash(b.ManifestName))
+	}
+	if b.ArchiveName != "" {
+		name += fmt.Sprintf(" (%s)", b.ArchiveName)
+	}
+	return name
+}
+
+// Close 释放G-code内容
+func (b *Bundle) Close() error {
+	if b.GCode == nil {
+		return nil
+	}
+	return b.GCode.Close()
+}
+
+// ReadBundle 从zip压缩包内容中读取G-code和manifest
+func ReadBundle(data []byte) (*Bundle, error) {
+	return ReadZip(bytes.NewReader(data), int64(len(data)))
+}
+
+// Load 读取一个版本的文件，name为文件名
+// zip压缩包从中查找G-code和manifest；其他文件作为G-code读取，压缩的内容会被自动解压；
+// .bgcode 文件没有manifest时，使用其中的元数据作为manifest。
+// G-code超过 SpoolThreshold 时转存到临时文件，使用完后需要调用 Close
+func Load(ra io.ReaderAt, size int64, name string) (*Bundle, error) {
+	header := make([]byte, 4)
+	n, _ := ra.ReadAt(header, 0)
+	if Detect(header[:n]) == FormatZip {
+		bundle, err := ReadZip(ra, size)
+		if err != nil {
+			return nil, err
+		}
+		bundle.ArchiveName = name
+		return bundle, nil
+	}
+
+	content, meta, err := SpoolGCode(io.NewSectionReader(ra, 0, size))
+	if err != nil {
+		return nil, err
+	}
+	bundle := &Bundle{GCode: content, GCodeName: name}
+	if err := bundle.setMetadata(meta); err != nil {
+		bundle.Close()
+		return nil, err
+	}
+	return bundle, nil
+}
+
+// setMetadata 没有manifest时使用 .bgcode 元数据生成manifest
+func (b *Bundle) setMetadata(meta *bgcode.Metadata) error {
+	if meta == nil || b.Manifest != nil {
+		return nil
+	}
+	manifest, err := meta.Manifest()
+	if err != nil {
+		return fmt.Errorf("转换bgcode元数据失败: %v", err)
+	}
+	b.Manifest = manifest
+	b.ManifestName = b.GCodeName + metadataSuffix
+	return nil
+}
+
+// ReadZip 从zip压缩包中读取G-code和manifest
+// 压缩包中有 gcodelens.json 时按其声明的路径查找，否则按扩展名查找：
+// G-code为 .nc/.gcode 等(可以再用gzip/zstd压缩)，manifest为 .json
+func ReadZip(ra io.ReaderAt, size int64) (*Bundle, error) {
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return nil, fmt.Errorf("读取zip失败: %v", err)
+	}
+
+	files := make(map[string]*zip.File)
+	var names []string
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || ignoredEntry(f.Name) {
+			continue
+		}
+		files[f.Name] = f
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+
+	layout, err := readLayout(files)
+	if err != nil {
+		return nil, err
+	}
+	if layout.GCode == "" {
+		if layout.GCode, err = findEntry(names, isGCodeName, "G-code"); err != nil {
+			return nil, err
+		}
+	}
+	if layout.Manifest == "" {
+		layout.Manifest, _ = findEntry(names, isManifestName, "manifest")
+	}
+
+	bundle := &Bundle{GCodeName: layout.GCode, ManifestName: layout.Manifest}
+	if layout.Manifest != "" {
+		if bundle.Manifest, err = readEntry(files, layout.Manifest); err != nil {
+			return nil, err
+		}
+	}
+	var meta *bgcode.Metadata
+	if bundle.GCode, meta, err = spoolEntry(files, layout.GCode); err != nil {
+		return nil, err
+	}
+	if err := bundle.setMetadata(meta); err != nil {
+		bundle.Close()
+		return nil, err
+	}
+	return bundle, nil
+}
+
+// readLayout 读取布局声明文件，不存在时返回空布局
+func readLayout(files map[string]*zip.File) (Layout, error) {
+	var layout Layout
+	if _, ok := files[LayoutFile]; !ok {
+		return layout, nil
+	}
+	data, err := readEntry(files, LayoutFile)
+	if err != nil {
+		return layout, err
+	}
+	if err := json.Unmarshal(data, &layout); err != nil {
+		return layout, fmt.Errorf("解析 %s 失败: %v", LayoutFile, err)
+	}
+	return layout, nil
+}
+
+// findEntry 查找唯一匹配的文件，有多个时优先选择根目录下的文件
+func findEntry(names []string, match func(name string) bool, kind string) (string, error) {
+	var found []string
+	for _, name := range names {
+		if match(name) {
+			found = append(found, name)
+		}
+	}
+	if len(found) > 1 {
+		var root []string
+		for _, name := range found {
+			if !strings.Contains(name, "/") {
+				root = append(root, name)
+			}
+		}
+		if len(root) == 1 {
+			return root[0], nil
+		}
+		return "", fmt.Errorf("压缩包中有多个%s文件 (%s)，请在 %s 中指定", kind, strings.Join(found, ", "), LayoutFile)
+	}
+	if len(found) == 0 {
+		return "", fmt.Errorf("压缩包中没有找到%s文件", kind)
+	}
+	return found[0], nil
+}
+
+// readEntry 读取并解压压缩包中的文件
+func readEntry(files map[string]*zip.File, name string) ([]byte, error) {
+	rc, err := openEntry(files, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("读取 %s 失败: %v", name, err)
+	}
+	return data, nil
+}
+
+// spoolEntry 解压并转存压缩包中的G-code，文件为 .bgcode 时同时返回其中的元数据
+func spoolEntry(files map[string]*zip.File, name string) (*Content, *bgcode.Metadata, error) {
+	rc, err := openEntry(files, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rc.Close()
+	content, meta, err := SpoolGCode(rc)
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取 %s 失败: %v", name, err)
+	}
+	return content, meta, nil
+}
+
+// openEntry 打开压缩包中的文件，解压后的大小不超过 MaxDecompressedSize
+func openEntry(files map[string]*zip.File, name string) (io.ReadCloser, error) {
+	f, ok := files[name]
+	if !ok {
+		return nil, fmt.Errorf("压缩包中没有 %s", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("打开 %s 失败: %v", name, err)
+	}
+	return &reader{Reader: limitDecompressed(rc, MaxDecompressedSize), closers: []io.Closer{rc}}, nil
+}
+
+// ignoredEntry 忽略系统生成的文件，如 macOS 的 __MACOSX 目录和隐藏文件
+func ignoredEntry(name string) bool {
+	return strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(path.Base(name), ".")
+}
+
+// baseExt 去掉压缩扩展名后的扩展名(小写)
+func baseExt(name string) string {
+	name = strings.ToLower(name)
+	for _, ext := range compressedExtensions {
+		name = strings.TrimSuffix(name, ext)
+	}
+	return path.Ext(name)
+}
+
+// isGCodeName 按扩展名判断是否为G-code文件
+func isGCodeName(name string) bool {
+	ext := baseExt(name)
+	for _, e := range GCodeExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// isManifestName 按扩展名判断是否为manifest文件
+func isManifestName(name string) bool {
+	return baseExt(name) == ".json" && path.Base(name) != LayoutFile
+}
@@ -0,0 +1,266 @@
+package input
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"ok/bgcode"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// 输入格式
+const (
+	FormatPlain  = "plain" // 未压缩
+	FormatGzip   = "gzip"
+	FormatZstd   = "zstd"
+	FormatZip    = "zip"
+	FormatBGCode = "bgcode" // Prusa 二进制G-code
+)
+
+// 各格式文件头
+var (
+	magicGzip = []byte{0x1f, 0x8b}
+	magicZstd = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	magicZip  = []byte{'P', 'K', 0x03, 0x04}
+)
+
+// maxNesting 最多解压的嵌套层数，如 .gz 中的 .zst
+const maxNesting = 3
+
+// MaxDecompressedSize 每一层解压后的最大大小(字节)，防止压缩炸弹占满磁盘，0 表示不限制
+var MaxDecompressedSize int64 = 16 << 30 // 16GB
+
+// MaxReadAllSize ReadAll 读入内存的最大大小(字节)，用于manifest等小文件，0 表示不限制
+var MaxReadAllSize int64 = 64 << 20 // 64MB
+
+// Detect 根据文件头判断输入格式
+func Detect(header []byte) string {
+	switch {
+	case bytes.HasPrefix(header, magicGzip):
+		return FormatGzip
+	case bytes.HasPrefix(header, magicZstd):
+		return FormatZstd
+	case bytes.HasPrefix(header, magicZip):
+		return FormatZip
+	case bytes.HasPrefix(header, bgcode.Magic):
+		return FormatBGCode
+	}
+	return FormatPlain
+}
+
+// NewReader 检测并透明解压 gzip/zstd 压缩的输入，.bgcode 解码为文本G-code，未压缩时原样读取
+// zip 需要随机访问，使用 ReadZip 读取
+func NewReader(r io.Reader) (io.ReadCloser, error) {
+	var closers []io.Closer
+	br := bufio.NewReader(r)
+	for depth := 0; ; depth++ {
+		header, _ := br.Peek(4)
+		format := Detect(header)
+		if format == FormatPlain {
+			return &reader{Reader: br, closers: closers}, nil
+		}
+		if depth >= maxNesting {
+			closeAll(closers)
+			return nil, fmt.Errorf("压缩嵌套层数超过 %d 层", maxNesting)
+		}
+
+		var next io.Reader
+		switch format {
+		case FormatGzip:
+			zr, err := gzip.NewReader(br)
+			if err != nil {
+				closeAll(closers)
+				return nil, fmt.Errorf("读取gzip失败: %v", err)
+			}
+			closers = append(closers, zr)
+			next = limitDecompressed(zr, MaxDecompressedSize)
+		case FormatZstd:
+			zr, err := zstd.NewReader(br)
+			if err != nil {
+				closeAll(closers)
+				return nil, fmt.Errorf("读取zstd失败: %v", err)
+			}
+			closers = append(closers, zr.IOReadCloser())
+			next = limitDecompressed(zr, MaxDecompressedSize)
+		case FormatBGCode:
+			gr, err := bgcode.NewGCodeReader(br)
+			if err != nil {
+				closeAll(closers)
+				return nil, fmt.Errorf("读取bgcode失败: %v", err)
+			}
+			return &reader{Reader: limitDecompressed(gr, MaxDecompressedSize), closers: closers, bgcode: gr}, nil
+		case FormatZip:
+			closeAll(closers)
+			return nil, fmt.Errorf("zip压缩包需要包含G-code和manifest，不能作为单个文件读取")
+		}
+		br = bufio.NewReader(next)
+	}
+}
+
+// ReadAll 读取并解压全部内容，解压后超过 MaxReadAllSize 时返回错误
+func ReadAll(r io.Reader) ([]byte, error) {
+	data, _, err := ReadGCode(r)
+	return data, err
+}
+
+// ReadGCode 读取并解压全部G-code，输入为 .bgcode 时同时返回其中的元数据
+// 内容读入内存，解压后超过 MaxReadAllSize 时返回错误
+func ReadGCode(r io.Reader) ([]byte, *bgcode.Metadata, error) {
+	rc, err := NewReader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(limitDecompressed(rc, MaxReadAllSize))
+	if err != nil {
+		return nil, nil, fmt.Errorf("解压失败: %v", err)
+	}
+	return data, Metadata(rc), nil
+}
+
+// SpoolGCode 解压G-code并转存，大文件保存到临时文件中，内存占用不随文件大小增长
+// 输入为 .bgcode 时同时返回其中的元数据
+func SpoolGCode(r io.Reader) (*Content, *bgcode.Metadata, error) {
+	rc, err := NewReader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rc.Close()
+	content, err := Spool(rc)
+	if err != nil {
+		return nil, nil, fmt.Errorf("解压失败: %v", err)
+	}
+	return content, Metadata(rc), nil
+}
+
+// Metadata 返回 NewReader 读取的 .bgcode 文件中的元数据，其他格式返回nil
+func Metadata(r io.Reader) *bgcode.Metadata {
+	if gr := bgcodeReader(r); gr != nil {
+		return gr.Metadata()
+	}
+	return nil
+}
+
+// File 可随机访问的文件，如 *os.File 和 multipart.File
+type File interface {
+	io.ReaderAt
+	io.Closer
+}
+
+// OpenFile 打开G-code文件，压缩文件会被透明解压，zip压缩包返回其中的G-code
+func OpenFile(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return OpenFrom(f, info.Size())
+}
+
+// OpenFrom 与 Open 相同，关闭时同时关闭文件f，打开失败时f也会被关闭
+func OpenFrom(f File, size int64) (io.ReadCloser, error) {
+	rc, err := Open(f, size)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &reader{Reader: rc, closers: []io.Closer{f, rc}, bgcode: bgcodeReader(rc)}, nil
+}
+
+// Open 读取G-code，压缩的内容会被透明解压，zip压缩包返回其中的G-code
+func Open(ra io.ReaderAt, size int64) (io.ReadCloser, error) {
+	header := make([]byte, 4)
+	n, _ := ra.ReadAt(header, 0)
+	if Detect(header[:n]) == FormatZip {
+		bundle, err := ReadZip(ra, size)
+		if err != nil {
+			return nil, err
+		}
+		rc, err := bundle.GCode.Open()
+		if err != nil {
+			bundle.Close()
+			return nil, err
+		}
+		return &reader{Reader: rc, closers: []io.Closer{bundle, rc}}, nil
+	}
+	if Detect(header[:n]) == FormatPlain {
+		// 未压缩的内容直接读取，可以定位
+		return &reader{Reader: io.NewSectionReader(ra, 0, size)}, nil
+	}
+	return NewReader(io.NewSectionReader(ra, 0, size))
+}
+
+// ErrTooLarge 解压后的内容超过大小限制
+var ErrTooLarge = errors.New("解压后的内容超过大小限制")
+
+// limitedReader 读取超过限制时返回 ErrTooLarge 的读取器
+type limitedReader struct {
+	r     io.Reader
+	limit int64
+	read  int64
+}
+
+// limitDecompressed 限制解压后的大小，limit为0时不限制
+func limitDecompressed(r io.Reader, limit int64) io.Reader {
+	if limit <= 0 {
+		return r
+	}
+	// 多读一个字节，用于区分正好达到限制和超过限制
+	return &limitedReader{r: io.LimitReader(r, limit+1), limit: limit}
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.read > l.limit {
+		return n - int(l.read-l.limit), fmt.Errorf("%w (%d 字节)", ErrTooLarge, l.limit)
+	}
+	return n, err
+}
+
+// reader 解压读取器，关闭时依次关闭所有解压器
+type reader struct {
+	io.Reader
+	closers []io.Closer
+	bgcode  *bgcode.GCodeReader // 输入为 .bgcode 时的解码器
+}
+
+// bgcodeReader 取出读取器中的 .bgcode 解码器
+func bgcodeReader(r io.Reader) *bgcode.GCodeReader {
+	if rd, ok := r.(*reader); ok {
+		return rd.bgcode
+	}
+	return nil
+}
+
+// Seek 未压缩的内容可以定位，展开子程序时按需重新读取；解压的内容返回错误
+func (r *reader) Seek(offset int64, whence int) (int64, error) {
+	if s, ok := r.Reader.(io.Seeker); ok {
+		return s.Seek(offset, whence)
+	}
+	return 0, errors.New("压缩的内容不能定位")
+}
+
+func (r *reader) Close() error {
+	return closeAll(r.closers)
+}
+
+// closeAll 从内到外关闭
+func closeAll(closers []io.Closer) error {
+	var first error
+	for i := len(closers) - 1; i >= 0; i-- {
+		if err := closers[i].Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,130 @@
+package input
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func gzipData(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(data)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zstdData(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw, err := zstd.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw.Write(data)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zipData(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestNewReader(t *testing.T) {
+	gcode := []byte("G1 X10 Y10\nG1 X20\n")
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"未压缩", gcode},
+		{"gzip", gzipData(t, gcode)},
+		{"zstd", zstdData(t, gcode)},
+		{"gzip中的zstd", gzipData(t, zstdData(t, gcode))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc, err := NewReader(bytes.NewReader(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rc.Close()
+			got, err := io.ReadAll(rc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, gcode) {
+				t.Errorf("got %q, want %q", got, gcode)
+			}
+		})
+	}
+}
+
+func TestDecompressionLimit(t *testing.T) {
+	defer func(max, all int64) { MaxDecompressedSize, MaxReadAllSize = max, all }(MaxDecompressedSize, MaxReadAllSize)
+	MaxDecompressedSize, MaxReadAllSize = 1000, 100
+
+	exact := bytes.Repeat([]byte("G"), 1000)
+	bomb := bytes.Repeat([]byte("G1 X0\n"), 100000)
+	tests := []struct {
+		name     string
+		read     func() error
+		tooLarge bool
+	}{
+		{"gzip 正好达到限制", func() error {
+			rc, err := NewReader(bytes.NewReader(gzipData(t, exact)))
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(io.Discard, rc)
+			return err
+		}, false},
+		{"gzip", func() error {
+			_, _, err := SpoolGCode(bytes.NewReader(gzipData(t, bomb)))
+			return err
+		}, true},
+		{"zstd", func() error {
+			_, _, err := SpoolGCode(bytes.NewReader(zstdData(t, bomb)))
+			return err
+		}, true},
+		{"zip", func() error {
+			data := zipData(t, map[string][]byte{"a.gcode": bomb})
+			_, err := ReadBundle(data)
+			return err
+		}, true},
+		{"manifest", func() error {
+			_, err := ReadAll(bytes.NewReader(gzipData(t, []byte(strings.Repeat(" ", 101)))))
+			return err
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.read()
+			if got := err != nil && strings.Contains(err.Error(), ErrTooLarge.Error()); got != tt.tooLarge {
+				t.Errorf("err = %v, want ErrTooLarge: %v", err, tt.tooLarge)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package input
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// SpoolThreshold 内容超过该大小时转存到临时文件，未超过时保存在内存中
+var SpoolThreshold int64 = 32 << 20 // 32MB
+
+// spoolPattern 临时文件名
+const spoolPattern = "gcodelens-spool-*"
+
+// Content 可重复读取的G-code内容
+// 小文件保存在内存中，大文件保存在临时文件中，分析时按需多次流式读取
+type Content struct {
+	data []byte
+	path string // 临时文件路径，内容在内存中时为空
+	size int64
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// NewContent 使用内存中的数据创建内容
+func NewContent(data []byte) *Content {
+	return &Content{data: data, size: int64(len(data))}
+}
+
+// Size 内容大小(字节)
+func (c *Content) Size() int64 {
+	return c.size
+}
+
+// Open 打开内容用于读取，可以同时打开多次
+// 返回的读取器可以定位，展开子程序时按需重新读取，不需要把内容读入内存
+func (c *Content) Open() (io.ReadSeekCloser, error) {
+	if c.path == "" {
+		return nopCloser{bytes.NewReader(c.data)}, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, fmt.Errorf("内容已释放")
+	}
+	return os.Open(c.path)
+}
+
+// nopCloser 内存中内容的读取器，关闭时不需要释放
+type nopCloser struct {
+	*bytes.Reader
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// Bytes 读取全部内容，需要随机访问整个文件时使用
+func (c *Content) Bytes() ([]byte, error) {
+	if c.path == "" {
+		return c.data, nil
+	}
+	rc, err := c.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// Close 释放内容，删除临时文件
+func (c *Content) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed || c.path == "" {
+		c.closed = true
+		return nil
+	}
+	c.closed = true
+	return os.Remove(c.path)
+}
+
+// Spooler 写入内容，超过 SpoolThreshold 后转存到临时文件
+type Spooler struct {
+	buf  bytes.Buffer
+	file *os.File
+	size int64
+	err  error
+}
+
+// NewSpooler 创建转存写入器
+func NewSpooler() *Spooler {
+	return &Spooler{}
+}
+
+// Write 写入数据
+func (s *Spooler) Write(p []byte) (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	if s.file == nil && s.size+int64(len(p)) > SpoolThreshold {
+		if s.err = s.spill(); s.err != nil {
+			return 0, s.err
+		}
+	}
+
+	var n int
+	if s.file != nil {
+		n, s.err = s.file.Write(p)
+	} else {
+		n, _ = s.buf.Write(p)
+	}
+	s.size += int64(n)
+	return n, s.err
+}
+
+// spill 将内存中的数据转存到临时文件
+func (s *Spooler) spill() error {
+	f, err := os.CreateTemp("", spoolPattern)
+	if err != nil {
+		return fmt.Errorf("创建临时文件失败: %v", err)
+	}
+	if _, err := f.Write(s.buf.Bytes()); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return fmt.Errorf("写入临时文件失败: %v", err)
+	}
+	s.buf = bytes.Buffer{}
+	s.file = f
+	return nil
+}
+
+// Content 结束写入并返回内容，之后不能再写入
+func (s *Spooler) Content() (*Content, error) {
+	if s.file == nil {
+		if s.err != nil {
+			return nil, s.err
+		}
+		return NewContent(s.buf.Bytes()), nil
+	}
+
+	path := s.file.Name()
+	err := s.file.Close()
+	if s.err != nil {
+		err = s.err
+	}
+	s.file = nil
+	if err != nil {
+		os.Remove(path)
+		return nil, fmt.Errorf("写入临时文件失败: %v", err)
+	}
+	return &Content{path: path, size: s.size}, nil
+}
+
+// Discard 放弃写入的内容，删除临时文件
+func (s *Spooler) Discard() {
+	if s.file != nil {
+		s.file.Close()
+		os.Remove(s.file.Name())
+		s.file = nil
+	}
+	s.buf = bytes.Buffer{}
+}
+
+// Spool 读取r的全部内容，超过 SpoolThreshold 时转存到临时文件
+func Spool(r io.Reader) (*Content, error) {
+	s := NewSpooler()
+	if _, err := io.Copy(s, r); err != nil {
+		s.Discard()
+		return nil, err
+	}
+	return s.Content()
+}
@@ -0,0 +1,134 @@
+package input
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// withThreshold 临时修改 SpoolThreshold
+func withThreshold(t *testing.T, n int64) {
+	t.Helper()
+	old := SpoolThreshold
+	SpoolThreshold = n
+	t.Cleanup(func() { SpoolThreshold = old })
+}
+
+func TestSpool(t *testing.T) {
+	withThreshold(t, 16)
+	tests := []struct {
+		name    string
+		data    string
+		spilled bool
+	}{
+		{"空内容", "", false},
+		{"未超过阈值保存在内存中", "G0 X0\nG1 X1\n", false},
+		{"等于阈值保存在内存中", "0123456789abcdef", false},
+		{"超过阈值转存到临时文件", strings.Repeat("G1 X1 Y1\n", 10), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := Spool(strings.NewReader(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+			if (c.path != "") != tt.spilled {
+				t.Errorf("path = %q, spilled want %v", c.path, tt.spilled)
+			}
+			if c.Size() != int64(len(tt.data)) {
+				t.Errorf("Size = %d, want %d", c.Size(), len(tt.data))
+			}
+
+			// 可以同时打开多次，各自从头读取
+			r1, err := c.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r1.Close()
+			r2, err := c.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r2.Close()
+			for _, r := range []io.Reader{r1, r2} {
+				got, err := io.ReadAll(r)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != tt.data {
+					t.Errorf("读取 %q, want %q", got, tt.data)
+				}
+			}
+			if got, err := c.Bytes(); err != nil || string(got) != tt.data {
+				t.Errorf("Bytes = %q, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestSpoolClose(t *testing.T) {
+	withThreshold(t, 4)
+	c, err := Spool(strings.NewReader("G1 X1 Y1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := c.path
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("关闭后临时文件仍然存在: %v", err)
+	}
+	if _, err := c.Open(); err == nil {
+		t.Error("关闭后仍然可以打开")
+	}
+	if err := c.Close(); err != nil {
+		t.Errorf("重复关闭: %v", err)
+	}
+}
+
+func TestSpoolerDiscard(t *testing.T) {
+	withThreshold(t, 4)
+	s := NewSpooler()
+	if _, err := s.Write([]byte("G1 X1 Y1\n")); err != nil {
+		t.Fatal(err)
+	}
+	path := s.file.Name()
+	s.Discard()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("放弃后临时文件仍然存在: %v", err)
+	}
+}
+
+func TestContentSeek(t *testing.T) {
+	withThreshold(t, 4)
+	data := "O100\nG1 X1\nM99\n"
+	for _, spilled := range []bool{false, true} {
+		var c *Content
+		if spilled {
+			var err error
+			if c, err = Spool(strings.NewReader(data)); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			c = NewContent([]byte(data))
+		}
+		r, err := c.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 展开子程序时定位到子程序的位置重新读取
+		if _, err := r.Seek(5, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		got, _ := io.ReadAll(r)
+		if !bytes.Equal(got, []byte("G1 X1\nM99\n")) {
+			t.Errorf("spilled=%v: 定位后读取 %q", spilled, got)
+		}
+		r.Close()
+		c.Close()
+	}
+}
@@ -0,0 +1,260 @@
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"ok/gcode"
+	"ok/model"
+	"sort"
+)
+
+// 严重级别
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityInfo    = "info"
+	SeverityOff     = "off"
+)
+
+// MaxIssues 单个报告最多保留的问题数量
+const MaxIssues = 1000
+
+// RuleMeta 规则描述信息
+type RuleMeta struct {
+	ID          string `json:"id"`          // 规则ID
+	Description string `json:"description"` // 规则说明
+	Severity    string `json:"severity"`    // 默认严重级别
+}
+
+// Rule 检查规则。规则实例在每次检查时重新创建，可以保存检查过程中的状态
+type Rule interface {
+	// Meta 返回规则描述
+	Meta() RuleMeta
+	// Configure 应用规则配置项
+	Configure(options map[string]interface{}) error
+	// Check 检查一个程序段
+	Check(ctx *Context)
+	// Finish 文件检查结束时调用
+	Finish(ctx *Context)
+}
+
+// registry 已注册的规则工厂
+var registry = map[string]func() Rule{}
+
+// Register 注册规则，重复注册会覆盖
+func Register(id string, factory func() Rule) {
+	registry[id] = factory
+}
+
+// Rules 返回所有已注册规则的描述，按ID排序
+func Rules() []RuleMeta {
+	metas := make([]RuleMeta, 0, len(registry))
+	for _, factory := range registry {
+		metas = append(metas, factory().Meta())
+	}
+	sort.Slice(metas, func(i, j int) bool { return metas[i].ID < metas[j].ID })
+	return metas
+}
+
+// Config 检查配置
+type Config struct {
+	Rules map[string]RuleConfig `json:"rules"` // 按规则ID配置
+}
+
+// RuleConfig 单条规则的配置
+type RuleConfig struct {
+	Severity string                 `json:"severity"` // 覆盖默认严重级别，off表示禁用
+	Options  map[string]interface{} `json:"options"`  // 规则配置项
+}
+
+// ParseConfig 解析JSON格式的检查配置
+func ParseConfig(data []byte) (*Config, error) {
+	cfg := &Config{}
+	if len(data) == 0 {
+		return cfg, nil
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("解析检查配置失败: %v", err)
+	}
+	return cfg, nil
+}
+
+// Context 规则检查上下文
+type Context struct {
+	Profile  *model.MachineProfile // 机器配置
+	Block    *gcode.Block          // 当前程序段
+	Before   gcode.State           // 执行前的状态
+	State    gcode.State           // 执行后的状态
+	Segments []gcode.Segment       // 当前程序段产生的运动段
+	Dialect  gcode.Dialect         // 控制器方言
+	Program  *gcode.Program        // 子程序和循环的展开统计，只在 Finish 中有效
+	Comp     *gcode.CompReport     // 刀具半径补偿的统计和问题，程序执行完后完整
+
+	linter *Linter
+	rule   *activeRule
+}
+
+// Report 报告当前程序段的问题
+func (ctx *Context) Report(format string, args ...interface{}) {
+	line := 0
+	if ctx.Block != nil {
+		line = ctx.Block.Line
+	}
+	ctx.ReportLine(line, format, args...)
+}
+
+// ReportLine 报告指定行的问题，line为0表示整个文件
+func (ctx *Context) ReportLine(line int, format string, args ...interface{}) {
+	ctx.linter.add(model.LintIssue{
+		RuleID:   ctx.rule.meta.ID,
+		Severity: ctx.rule.severity,
+		Line:     line,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// activeRule 已启用的规则
+type activeRule struct {
+	rule     Rule
+	meta     RuleMeta
+	severity string
+}
+
+// Linter G代码检查器
+type Linter struct {
+	profile  *model.MachineProfile
+	rules    []*activeRule
+	report   *model.LintReport
+	current  *gcode.Block
+	reported map[issueKey]bool
+}
+
+// issueKey 问题的唯一标识，子程序和循环中的同一行多次执行时只报告一次
+type issueKey struct {
+	rule    string
+	line    int
+	message string
+}
+
+// New 根据配置创建检查器
+func New(cfg *Config, profile *model.MachineProfile) (*Linter, error) {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	if profile == nil {
+		profile = &model.MachineProfile{}
+	}
+
+	for id := range cfg.Rules {
+		if _, ok := registry[id]; !ok {
+			return nil, fmt.Errorf("未知的检查规则: %s", id)
+		}
+	}
+
+	l := &Linter{profile: profile}
+	for _, meta := range Rules() {
+		rule := registry[meta.ID]()
+		severity := meta.Severity
+		if rc, ok := cfg.Rules[meta.ID]; ok {
+			if rc.Severity != "" {
+				if !validSeverity(rc.Severity) {
+					return nil, fmt.Errorf("规则 %s 的严重级别无效: %s", meta.ID, rc.Severity)
+				}
+				severity = rc.Severity
+			}
+			if err := rule.Configure(rc.Options); err != nil {
+				return nil, fmt.Errorf("规则 %s 配置无效: %v", meta.ID, err)
+			}
+		}
+		if severity == SeverityOff {
+			continue
+		}
+		l.rules = append(l.rules, &activeRule{rule: rule, meta: meta, severity: severity})
+	}
+
+	return l, nil
+}
+
+// Run 检查G代码内容
+func (l *Linter) Run(r io.Reader) (*model.LintReport, error) {
+	l.report = &model.LintReport{
+		Rules:  make([]model.LintRule, 0, len(l.rules)),
+		Issues: make([]model.LintIssue, 0),
+	}
+	for _, ar := range l.rules {
+		l.report.Rules = append(l.report.Rules, model.LintRule{
+			ID:          ar.meta.ID,
+			Description: ar.meta.Description,
+			Severity:    ar.severity,
+		})
+	}
+
+	interp := gcode.NewInterpreterFor(l.profile)
+	l.reported = map[issueKey]bool{}
+
+	ctx := &Context{Profile: l.profile, Dialect: interp.Dialect, Comp: &interp.Comp, Before: interp.State, linter: l}
+	// 程序段执行后检查，执行后的状态是下一段执行前的状态
+	prog, err := gcode.RunProgram(r, interp, func(block *gcode.Block, segments []gcode.Segment) error {
+		ctx.Block = block
+		ctx.Segments = segments
+		ctx.State = interp.State
+
+		l.current = block
+		for _, ar := range l.rules {
+			ctx.rule = ar
+			ar.rule.Check(ctx)
+		}
+		ctx.Before = interp.State
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx.Block, ctx.Program = nil, prog
+	for _, ar := range l.rules {
+		ctx.rule = ar
+		ar.rule.Finish(ctx)
+	}
+
+	sort.SliceStable(l.report.Issues, func(i, j int) bool {
+		return l.report.Issues[i].Line < l.report.Issues[j].Line
+	})
+	return l.report, nil
+}
+
+// add 添加问题并更新统计
+func (l *Linter) add(issue model.LintIssue) {
+	key := issueKey{issue.RuleID, issue.Line, issue.Message}
+	if l.reported[key] {
+		return
+	}
+	l.reported[key] = true
+
+	switch issue.Severity {
+	case SeverityError:
+		l.report.Summary.Errors++
+	case SeverityWarning:
+		l.report.Summary.Warnings++
+	default:
+		l.report.Summary.Infos++
+	}
+
+	if len(l.report.Issues) >= MaxIssues {
+		l.report.Truncated = true
+		return
+	}
+	if l.current != nil && l.current.Line == issue.Line {
+		issue.Content = l.current.Raw
+	}
+	l.report.Issues = append(l.report.Issues, issue)
+}
+
+func validSeverity(s string) bool {
+	switch s {
+	case SeverityError, SeverityWarning, SeverityInfo, SeverityOff:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,471 @@
+package lint
+
+import (
+	"fmt"
+	"ok/gcode"
+	"ok/model"
+	"strings"
+)
+
+func init() {
+	Register("out-of-bounds", func() Rule { return &outOfBoundsRule{} })
+	Register("feed-not-set", func() Rule { return &feedNotSetRule{} })
+	Register("unsupported-command", func() Rule { return &unsupportedCommandRule{allow: map[string]bool{}} })
+	Register("zero-length-move", func() Rule { return &zeroLengthRule{tolerance: 0.0001} })
+	Register("duplicate-line", func() Rule { return &duplicateLineRule{} })
+	Register("laser-on-rapid", func() Rule { return &laserOnRapidRule{} })
+	Register("missing-m5", func() Rule { return &missingM5Rule{} })
+	Register("suspicious-feed", func() Rule { return &suspiciousFeedRule{min: 10, max: 60000} })
+	Register("bad-checksum", func() Rule { return &badChecksumRule{} })
+	Register("line-number-sequence", func() Rule { return &lineNumberSequenceRule{} })
+	Register("modal-conflict", func() Rule { return &modalConflictRule{} })
+	Register("power-out-of-range", func() Rule { return &powerOutOfRangeRule{} })
+	Register("unresolved-subprogram", func() Rule { return &unresolvedSubprogramRule{} })
+	Register("cutter-comp", func() Rule { return &cutterCompRule{} })
+	Register("cycle-peck", func() Rule { return &cyclePeckRule{} })
+}
+
+// outOfBoundsRule 检查移动是否超出机器行程(软限位)
+type outOfBoundsRule struct {
+	margin float64
+}
+
+func (r *outOfBoundsRule) Meta() RuleMeta {
+	return RuleMeta{ID: "out-of-bounds", Description: "移动超出机器行程范围", Severity: SeverityError}
+}
+
+func (r *outOfBoundsRule) Configure(options map[string]interface{}) error {
+	return floatOption(options, "margin", &r.margin)
+}
+
+func (r *outOfBoundsRule) Check(ctx *Context) {
+	limits := ctx.Profile.Limits()
+	for i := range ctx.Segments {
+		min, max := ctx.Segments[i].Bounds()
+		offset := ctx.Segments[i].Offset
+		violations := limits.Check(
+			model.Offset{X: min.X + offset.X, Y: min.Y + offset.Y, Z: min.Z + offset.Z},
+			model.Offset{X: max.X + offset.X, Y: max.Y + offset.Y, Z: max.Z + offset.Z},
+			r.margin,
+		)
+		if len(violations) > 0 {
+			v := violations[0]
+			ctx.Report("%s轴移动到 %.3f，超出行程 [%.3f, %.3f]", v.Axis, v.Value, v.Limit.Min, v.Limit.Max)
+			return
+		}
+	}
+}
+
+func (r *outOfBoundsRule) Finish(ctx *Context) {}
+
+// feedNotSetRule 检查在设置进给速度之前执行的加工移动
+type feedNotSetRule struct {
+	reported bool
+}
+
+func (r *feedNotSetRule) Meta() RuleMeta {
+	return RuleMeta{ID: "feed-not-set", Description: "加工移动前未设置进给速度F", Severity: SeverityError}
+}
+
+func (r *feedNotSetRule) Configure(options map[string]interface{}) error { return nil }
+
+func (r *feedNotSetRule) Check(ctx *Context) {
+	if r.reported || ctx.State.FeedSet {
+		return
+	}
+	for i := range ctx.Segments {
+		if !ctx.Segments[i].IsRapid() {
+			ctx.Report("%s 移动前未设置进给速度F", ctx.Segments[i].Motion)
+			r.reported = true
+			return
+		}
+	}
+}
+
+func (r *feedNotSetRule) Finish(ctx *Context) {}
+
+// unsupportedCommandRule 检查不支持的命令
+type unsupportedCommandRule struct {
+	allow map[string]bool
+}
+
+func (r *unsupportedCommandRule) Meta() RuleMeta {
+	return RuleMeta{ID: "unsupported-command", Description: "使用了不支持的G/M命令", Severity: SeverityWarning}
+}
+
+func (r *unsupportedCommandRule) Configure(options map[string]interface{}) error {
+	var allow []string
+	if err := stringsOption(options, "allow", &allow); err != nil {
+		return err
+	}
+	for _, code := range allow {
+		r.allow[strings.ToUpper(code)] = true
+	}
+	return nil
+}
+
+func (r *unsupportedCommandRule) Check(ctx *Context) {
+	for _, code := range ctx.Block.Codes() {
+		if _, ok := ctx.Dialect.Describe(code); !ok && !r.allow[code] {
+			ctx.Report("%s 不支持的命令 %s", ctx.Dialect.Name(), code)
+		}
+	}
+}
+
+func (r *unsupportedCommandRule) Finish(ctx *Context) {}
+
+// zeroLengthRule 检查长度为零的移动
+type zeroLengthRule struct {
+	tolerance float64
+}
+
+func (r *zeroLengthRule) Meta() RuleMeta {
+	return RuleMeta{ID: "zero-length-move", Description: "移动长度为零", Severity: SeverityInfo}
+}
+
+func (r *zeroLengthRule) Configure(options map[string]interface{}) error {
+	return floatOption(options, "tolerance", &r.tolerance)
+}
+
+func (r *zeroLengthRule) Check(ctx *Context) {
+	for i := range ctx.Segments {
+		seg := &ctx.Segments[i]
+		// 整圆的起点和终点重合，但长度不为零
+		if seg.Length() <= r.tolerance {
+			ctx.Report("%s 移动长度为零", seg.Motion)
+		}
+	}
+}
+
+func (r *zeroLengthRule) Finish(ctx *Context) {}
+
+// duplicateLineRule 检查连续重复的行
+type duplicateLineRule struct {
+	last string
+}
+
+func (r *duplicateLineRule) Meta() RuleMeta {
+	return RuleMeta{ID: "duplicate-line", Description: "与上一行内容完全相同", Severity: SeverityWarning}
+}
+
+func (r *duplicateLineRule) Configure(options map[string]interface{}) error { return nil }
+
+func (r *duplicateLineRule) Check(ctx *Context) {
+	line := strings.TrimSpace(ctx.Block.Raw)
+	if line == "" || ctx.Block.Empty() {
+		return
+	}
+	// 循环或子程序重复执行同一行不算重复
+	if line == r.last && !ctx.Block.Jump {
+		ctx.Report("与上一行重复")
+	}
+	r.last = line
+}
+
+func (r *duplicateLineRule) Finish(ctx *Context) {}
+
+// laserOnRapidRule 检查快速移动时激光/主轴仍处于开启状态
+type laserOnRapidRule struct{}
+
+func (r *laserOnRapidRule) Meta() RuleMeta {
+	return RuleMeta{ID: "laser-on-rapid", Description: "G0快速移动时激光处于开启状态", Severity: SeverityWarning}
+}
+
+func (r *laserOnRapidRule) Configure(options map[string]interface{}) error { return nil }
+
+func (r *laserOnRapidRule) Check(ctx *Context) {
+	if !ctx.Profile.Laser {
+		return
+	}
+	for i := range ctx.Segments {
+		seg := &ctx.Segments[i]
+		if seg.IsRapid() && seg.SpindleOn && seg.Power > 0 {
+			ctx.Report("G0 快速移动时激光开启 (S%g)", seg.Power)
+			return
+		}
+	}
+}
+
+func (r *laserOnRapidRule) Finish(ctx *Context) {}
+
+// missingM5Rule 检查程序结束时主轴/激光未关闭
+type missingM5Rule struct {
+	lastLine  int
+	spindleOn bool
+	ended     bool
+}
+
+func (r *missingM5Rule) Meta() RuleMeta {
+	return RuleMeta{ID: "missing-m5", Description: "程序结束前未使用M5关闭主轴/激光", Severity: SeverityWarning}
+}
+
+func (r *missingM5Rule) Configure(options map[string]interface{}) error { return nil }
+
+func (r *missingM5Rule) Check(ctx *Context) {
+	if ctx.Block.HasCode("M2") || ctx.Block.HasCode("M30") {
+		// 程序结束会关闭主轴，不能按执行后的状态判断；同一段中的 M3/M4/M5 先于程序结束生效
+		spindleOn := ctx.Before.SpindleOn
+		switch {
+		case ctx.Block.HasCode("M5"):
+			spindleOn = false
+		case ctx.Block.HasCode("M3") || ctx.Block.HasCode("M4"):
+			spindleOn = true
+		}
+		if spindleOn && !r.ended {
+			ctx.Report("程序结束时主轴/激光仍处于开启状态")
+		}
+		r.ended = true
+	}
+	r.spindleOn = ctx.State.SpindleOn
+	r.lastLine = ctx.Block.Line
+}
+
+func (r *missingM5Rule) Finish(ctx *Context) {
+	if !r.ended && r.spindleOn {
+		ctx.ReportLine(r.lastLine, "文件结束时主轴/激光仍处于开启状态，缺少M5")
+	}
+}
+
+// suspiciousFeedRule 检查异常的进给速度
+type suspiciousFeedRule struct {
+	min, max float64
+}
+
+func (r *suspiciousFeedRule) Meta() RuleMeta {
+	return RuleMeta{ID: "suspicious-feed", Description: "进给速度异常(过小、过大或超过机器最大速度)", Severity: SeverityWarning}
+}
+
+func (r *suspiciousFeedRule) Configure(options map[string]interface{}) error {
+	if err := floatOption(options, "min", &r.min); err != nil {
+		return err
+	}
+	return floatOption(options, "max", &r.max)
+}
+
+func (r *suspiciousFeedRule) Check(ctx *Context) {
+	f, ok := ctx.Block.Get('F')
+	if !ok {
+		return
+	}
+	max := r.max
+	if ctx.Profile.MaxFeed > 0 && ctx.Profile.MaxFeed < max {
+		max = ctx.Profile.MaxFeed
+	}
+	feed := ctx.State.Feed
+	switch {
+	case f <= 0:
+		ctx.Report("进给速度 F%g 无效", f)
+	case feed < r.min:
+		ctx.Report("进给速度 %.1f mm/min 低于 %.1f mm/min", feed, r.min)
+	case feed > max:
+		ctx.Report("进给速度 %.1f mm/min 超过 %.1f mm/min", feed, max)
+	}
+}
+
+func (r *suspiciousFeedRule) Finish(ctx *Context) {}
+
+// badChecksumRule 检查 RepRap 风格的 * 校验和
+type badChecksumRule struct{}
+
+func (r *badChecksumRule) Meta() RuleMeta {
+	return RuleMeta{ID: "bad-checksum", Description: "校验和与行内容不一致", Severity: SeverityError}
+}
+
+func (r *badChecksumRule) Configure(options map[string]interface{}) error { return nil }
+
+func (r *badChecksumRule) Check(ctx *Context) {
+	b := ctx.Block
+	if b.HasChecksum && !b.ChecksumOK {
+		line := b.Raw[:b.ChecksumPos]
+		ctx.Report("校验和 *%d 错误，应为 *%d", b.Checksum, gcode.Checksum([]byte(line)))
+	}
+}
+
+func (r *badChecksumRule) Finish(ctx *Context) {}
+
+// lineNumberSequenceRule 检查程序段号顺序
+// 带校验和的行按 RepRap 协议要求连续递增，M110 N<n> 重新设置当前段号；
+// 其他行只要求递增，配置项 step 不为0时要求按固定步长递增，如 N10、N20
+type lineNumberSequenceRule struct {
+	step float64
+	last int
+	seen bool
+}
+
+func (r *lineNumberSequenceRule) Meta() RuleMeta {
+	return RuleMeta{ID: "line-number-sequence", Description: "程序段号N不连续或没有递增", Severity: SeverityWarning}
+}
+
+func (r *lineNumberSequenceRule) Configure(options map[string]interface{}) error {
+	return floatOption(options, "step", &r.step)
+}
+
+func (r *lineNumberSequenceRule) Check(ctx *Context) {
+	b := ctx.Block
+	// M110 重新设置当前段号，参数N优先于行首的段号
+	if b.HasCode("M110") {
+		if n, ok := b.Get('N'); ok {
+			r.last, r.seen = int(n), true
+		} else if b.HasNumber {
+			r.last, r.seen = b.Number, true
+		}
+		return
+	}
+	if !b.HasNumber {
+		return
+	}
+
+	step := int(r.step)
+	if b.HasChecksum {
+		step = 1
+	}
+	switch {
+	case !r.seen, b.Jump:
+		// 子程序调用、返回和循环跳转后重新开始计算
+	case step > 0 && b.Number != r.last+step:
+		ctx.Report("程序段号 N%d 不连续，应为 N%d", b.Number, r.last+step)
+	case step <= 0 && b.Number <= r.last:
+		ctx.Report("程序段号 N%d 没有递增，上一个为 N%d", b.Number, r.last)
+	}
+	r.last = b.Number
+	r.seen = true
+}
+
+func (r *lineNumberSequenceRule) Finish(ctx *Context) {}
+
+// modalConflictRule 检查同一程序段中的模态组冲突，如 G0 G1 X10、M3 M5
+type modalConflictRule struct{}
+
+func (r *modalConflictRule) Meta() RuleMeta {
+	return RuleMeta{ID: "modal-conflict", Description: "同一程序段中使用了同一模态组的多个命令", Severity: SeverityError}
+}
+
+func (r *modalConflictRule) Configure(options map[string]interface{}) error { return nil }
+
+func (r *modalConflictRule) Check(ctx *Context) {
+	for _, problem := range gcode.ModalConflicts(ctx.Block) {
+		ctx.Report("%s", problem)
+	}
+}
+
+func (r *modalConflictRule) Finish(ctx *Context) {}
+
+// powerOutOfRangeRule 检查超出控制器范围的S值，如 GRBL 的 S 默认为 0-1000
+type powerOutOfRangeRule struct {
+	max float64
+}
+
+func (r *powerOutOfRangeRule) Meta() RuleMeta {
+	return RuleMeta{ID: "power-out-of-range", Description: "S值超出控制器的功率/转速范围", Severity: SeverityWarning}
+}
+
+func (r *powerOutOfRangeRule) Configure(options map[string]interface{}) error {
+	return floatOption(options, "max", &r.max)
+}
+
+func (r *powerOutOfRangeRule) Check(ctx *Context) {
+	max := r.max
+	if max <= 0 {
+		max = ctx.Dialect.Defaults().MaxPower
+	}
+	s, ok := ctx.Block.Get('S')
+	// G4 S 是暂停时间
+	if !ok || max <= 0 || s != ctx.State.Power {
+		return
+	}
+	if s < 0 || s > max {
+		ctx.Report("S%g 超出 %s 的范围 [0, %g]", s, ctx.Dialect.Name(), max)
+	}
+}
+
+func (r *powerOutOfRangeRule) Finish(ctx *Context) {}
+
+// unresolvedSubprogramRule 检查文件中找不到的子程序，这些调用没有展开，分析结果不包含其中的移动
+type unresolvedSubprogramRule struct{}
+
+func (r *unresolvedSubprogramRule) Meta() RuleMeta {
+	return RuleMeta{ID: "unresolved-subprogram", Description: "调用的子程序不在文件中，没有展开", Severity: SeverityWarning}
+}
+
+func (r *unresolvedSubprogramRule) Configure(options map[string]interface{}) error { return nil }
+
+func (r *unresolvedSubprogramRule) Check(ctx *Context) {}
+
+func (r *unresolvedSubprogramRule) Finish(ctx *Context) {
+	for _, call := range ctx.Program.Unresolved {
+		ctx.ReportLine(call.Line, "子程序 %s 不在文件中，调用没有展开", call.Name)
+	}
+}
+
+// cutterCompRule 检查刀具半径补偿的问题：内拐角过切、圆弧半径小于刀具半径、缺少刀具直径等
+type cutterCompRule struct{}
+
+func (r *cutterCompRule) Meta() RuleMeta {
+	return RuleMeta{ID: "cutter-comp", Description: "刀具半径补偿会过切或无法计算", Severity: SeverityError}
+}
+
+func (r *cutterCompRule) Configure(options map[string]interface{}) error { return nil }
+
+func (r *cutterCompRule) Check(ctx *Context) {}
+
+func (r *cutterCompRule) Finish(ctx *Context) {
+	for _, issue := range ctx.Comp.Issues {
+		ctx.ReportLine(issue.Line, "%s", issue.Message)
+	}
+}
+
+// cyclePeckRule 检查 G73/G83 的啄钻深度 Q 过小，每个孔的进给次数超过 gcode.MaxPecks
+type cyclePeckRule struct{}
+
+func (r *cyclePeckRule) Meta() RuleMeta {
+	return RuleMeta{ID: "cycle-peck", Description: "啄钻深度Q过小，每个孔的进给次数过多", Severity: SeverityWarning}
+}
+
+func (r *cyclePeckRule) Configure(options map[string]interface{}) error { return nil }
+
+func (r *cyclePeckRule) Check(ctx *Context) {
+	st := &ctx.State
+	if len(ctx.Segments) == 0 || (st.Motion != "G73" && st.Motion != "G83") {
+		return
+	}
+	c := gcode.Cycle{R: st.CycleR, Bottom: st.CycleBottom, Peck: st.CyclePeck}
+	if n := c.Pecks(); n > gcode.MaxPecks {
+		ctx.Report("%s 啄钻深度 %gmm 需要进给 %d 次，按 %d 次平分孔深", st.Motion, st.CyclePeck, n, gcode.MaxPecks)
+	}
+}
+
+func (r *cyclePeckRule) Finish(ctx *Context) {}
+
+// floatOption 读取数值配置项
+func floatOption(options map[string]interface{}, key string, dst *float64) error {
+	v, ok := options[key]
+	if !ok {
+		return nil
+	}
+	f, ok := v.(float64)
+	if !ok {
+		return fmt.Errorf("配置项 %s 应为数值", key)
+	}
+	*dst = f
+	return nil
+}
+
+// stringsOption 读取字符串列表配置项
+func stringsOption(options map[string]interface{}, key string, dst *[]string) error {
+	v, ok := options[key]
+	if !ok {
+		return nil
+	}
+	list, ok := v.([]interface{})
+	if !ok {
+		return fmt.Errorf("配置项 %s 应为字符串数组", key)
+	}
+	for _, item := range list {
+		s, ok := item.(string)
+		if !ok {
+			return fmt.Errorf("配置项 %s 应为字符串数组", key)
+		}
+		*dst = append(*dst, s)
+	}
+	return nil
+}
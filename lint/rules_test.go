@@ -0,0 +1,95 @@
+package lint
+
+import (
+	"fmt"
+	"ok/gcode"
+	"strings"
+	"testing"
+)
+
+// runRule 只启用一条规则检查G代码，返回报告的问题信息
+func runRule(t *testing.T, id, src string) []string {
+	t.Helper()
+	cfg := &Config{Rules: map[string]RuleConfig{}}
+	for _, meta := range Rules() {
+		if meta.ID != id {
+			cfg.Rules[meta.ID] = RuleConfig{Severity: SeverityOff}
+		}
+	}
+	l, err := New(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := l.Run(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var messages []string
+	for _, issue := range report.Issues {
+		messages = append(messages, fmt.Sprintf("%d: %s", issue.Line, issue.Message))
+	}
+	return messages
+}
+
+func TestBadChecksum(t *testing.T) {
+	want := gcode.Checksum([]byte("N1 G1 X1"))
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{"正确", fmt.Sprintf("N1 G1 X1*%d\n", want), nil},
+		{"错误", "N1 G1 X1*0\n", []string{fmt.Sprintf("1: 校验和 *0 错误，应为 *%d", want)}},
+		{"注释中有星号", "N1 G1 X1*0 ; a*b\n", []string{fmt.Sprintf("1: 校验和 *0 错误，应为 *%d", want)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runRule(t, "bad-checksum", tt.src)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCyclePeck(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{"正常", "G0 Z5\nG83 X0 Y0 Z-10 R1 Q2 F100\n", nil},
+		{"没有Q", "G0 Z5\nG83 X0 Y0 Z-10 R1 F100\n", nil},
+		{"Q过小", "G0 Z5\nG83 X0 Y0 Z-1000 R0 Q0.000001 F100\n", []string{"2: G83 啄钻深度 1e-06mm 需要进给 1000000000 次，按 1000 次平分孔深"}},
+		{"非啄钻循环", "G0 Z5\nG81 X0 Y0 Z-1000 R0 Q0.000001 F100\n", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runRule(t, "cycle-peck", tt.src)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMissingM5(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{"M5后结束", "M3 S100\nG1 X1 F100\nM5\nM30\n", nil},
+		{"同一段M5和M30", "M3 S100\nG1 X1 F100\nM5 M30\n", nil},
+		{"结束时未关闭", "M3 S100\nG1 X1 F100\nM30\n", []string{"3: 程序结束时主轴/激光仍处于开启状态"}},
+		{"没有结束", "M3 S100\nG1 X1 F100\n", []string{"2: 文件结束时主轴/激光仍处于开启状态，缺少M5"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runRule(t, "missing-m5", tt.src)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
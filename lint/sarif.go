@@ -0,0 +1,117 @@
+package lint
+
+import (
+	"encoding/json"
+	"ok/model"
+)
+
+// SARIF 2.1.0 输出结构，只包含需要的字段
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string       `json:"id"`
+	ShortDescription     sarifMessage `json:"shortDescription"`
+	DefaultConfiguration struct {
+		Level string `json:"level"`
+	} `json:"defaultConfiguration"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			URI string `json:"uri"`
+		} `json:"artifactLocation"`
+		Region *sarifRegion `json:"region,omitempty"`
+	} `json:"physicalLocation"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+// ToSARIF 将检查报告转换为SARIF格式
+func ToSARIF(report *model.LintReport) ([]byte, error) {
+	return ToSARIFReports([]*model.LintReport{report})
+}
+
+// ToSARIFReports 将多个文件的检查报告转换为一个SARIF日志，所有文件的结果放在同一次运行中
+// 各报告的规则按ID合并
+func ToSARIFReports(reports []*model.LintReport) ([]byte, error) {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:  "GcodeLens",
+			Rules: make([]sarifRule, 0),
+		}},
+		Results: make([]sarifResult, 0),
+	}
+
+	seen := map[string]bool{}
+	for _, report := range reports {
+		for _, meta := range report.Rules {
+			if seen[meta.ID] {
+				continue
+			}
+			seen[meta.ID] = true
+			rule := sarifRule{ID: meta.ID, ShortDescription: sarifMessage{Text: meta.Description}}
+			rule.DefaultConfiguration.Level = sarifLevel(meta.Severity)
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, rule)
+		}
+
+		for _, issue := range report.Issues {
+			loc := sarifLocation{}
+			loc.PhysicalLocation.ArtifactLocation.URI = report.File
+			if issue.Line > 0 {
+				loc.PhysicalLocation.Region = &sarifRegion{StartLine: issue.Line}
+			}
+			run.Results = append(run.Results, sarifResult{
+				RuleID:    issue.RuleID,
+				Level:     sarifLevel(issue.Severity),
+				Message:   sarifMessage{Text: issue.Message},
+				Locations: []sarifLocation{loc},
+			})
+		}
+	}
+
+	return json.MarshalIndent(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	}, "", "  ")
+}
+
+// sarifLevel 严重级别转换为SARIF级别
+func sarifLevel(severity string) string {
+	if severity == SeverityInfo {
+		return "note"
+	}
+	return severity
+}
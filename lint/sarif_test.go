@@ -0,0 +1,44 @@
+package lint
+
+import (
+	"encoding/json"
+	"ok/model"
+	"testing"
+)
+
+func TestToSARIFReports(t *testing.T) {
+	rules := []model.LintRule{{ID: "feed-not-set", Description: "未设置进给速度", Severity: SeverityError}}
+	reports := []*model.LintReport{
+		{File: "a.gcode", Rules: rules, Issues: []model.LintIssue{{RuleID: "feed-not-set", Severity: SeverityError, Line: 1, Message: "a"}}},
+		{File: "b.gcode", Rules: rules, Issues: []model.LintIssue{{RuleID: "feed-not-set", Severity: SeverityInfo, Line: 2, Message: "b"}}},
+	}
+	data, err := ToSARIFReports(reports)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var log sarifLog
+	if err := json.Unmarshal(data, &log); err != nil {
+		t.Fatalf("不是合法的JSON: %v", err)
+	}
+	if len(log.Runs) != 1 {
+		t.Fatalf("runs = %d, want 1", len(log.Runs))
+	}
+	run := log.Runs[0]
+	if len(run.Tool.Driver.Rules) != 1 {
+		t.Errorf("rules = %d, want 1", len(run.Tool.Driver.Rules))
+	}
+	if len(run.Results) != 2 {
+		t.Fatalf("results = %d, want 2", len(run.Results))
+	}
+	for i, want := range []struct {
+		uri   string
+		level string
+		line  int
+	}{{"a.gcode", "error", 1}, {"b.gcode", "note", 2}} {
+		r := run.Results[i]
+		loc := r.Locations[0].PhysicalLocation
+		if loc.ArtifactLocation.URI != want.uri || r.Level != want.level || loc.Region.StartLine != want.line {
+			t.Errorf("result %d = %s %s %d, want %s %s %d", i, loc.ArtifactLocation.URI, r.Level, loc.Region.StartLine, want.uri, want.level, want.line)
+		}
+	}
+}
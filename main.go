@@ -1,12 +1,21 @@
 package main
 
 import (
+	"ok/cli"
 	"ok/config"
+	"ok/input"
 	"ok/router"
+	"os"
 )
 
 func main() {
+	// 带子命令参数时以命令行工具方式运行
+	if len(os.Args) > 1 && cli.IsCommand(os.Args[1]) {
+		os.Exit(cli.Run(os.Args[1:]))
+	}
+
 	cfg := config.GetConfig()
+	input.MaxDecompressedSize = cfg.MaxDecompressedSize
 	r := router.SetupRouter()
 	r.Run(cfg.ServerPort)
 }
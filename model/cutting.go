@@ -0,0 +1,53 @@
+package model
+
+// CuttingStats 激光/等离子切割的穿孔和引入引出统计
+// 每次激光/割炬开启后的第一段切割移动为一次穿孔，穿孔到关闭或快速移动之间为一条切割路径
+type CuttingStats struct {
+	Pierces       int     `json:"pierces"`         // 穿孔次数
+	PierceTime    float64 `json:"pierce_time"`     // 穿孔前的暂停时间(秒)，上一条切割路径结束后到穿孔之间的 G4
+	Closed        int     `json:"closed"`          // 包含闭合轮廓的切割路径数
+	LeadIns       int     `json:"lead_ins"`        // 有引入线的闭合轮廓数
+	LeadOuts      int     `json:"lead_outs"`       // 有引出线的闭合轮廓数
+	Overcuts      int     `json:"overcuts"`        // 有过切的闭合轮廓数
+	LeadInLength  float64 `json:"lead_in_length"`  // 引入线总长(mm)
+	LeadOutLength float64 `json:"lead_out_length"` // 引出线总长(mm)
+	OvercutLength float64 `json:"overcut_length"`  // 过切总长(mm)，轮廓闭合后沿轮廓继续切割的长度
+}
+
+// CuttingReport 切割统计，元素按 manifest 的 elements 和 G-code 中的元素标记对应
+type CuttingReport struct {
+	CuttingStats
+	Elements []ElementCutting `json:"elements"` // 各元素的统计，无法对应元素时为空
+}
+
+// ElementCutting 一个元素的切割统计
+type ElementCutting struct {
+	Index    int     `json:"index"`     // 元素序号，与 manifest 中 elements 的序号相同
+	Name     string  `json:"name"`      // G-code 中元素标记的名称，没有标记时为空
+	OverDist float64 `json:"over_dist"` // manifest 声明的过切距离 overDist(mm)
+	CuttingStats
+}
+
+// CuttingChange A/B两个版本的切割变化
+type CuttingChange struct {
+	Same            bool                   `json:"same"`              // 穿孔、引入引出和过切是否相同
+	PiercesDelta    int                    `json:"pierces_delta"`     // 穿孔次数变化(B-A)
+	PierceTimeDelta float64                `json:"pierce_time_delta"` // 穿孔暂停时间变化(B-A，秒)
+	Elements        []ElementCuttingChange `json:"elements"`          // 按序号对应的各元素
+}
+
+// ElementCuttingChange 一个元素在A/B两个版本中的切割统计
+type ElementCuttingChange struct {
+	Index     int            `json:"index"`     // 元素序号
+	A         ElementCutting `json:"a"`         // A的统计
+	B         ElementCutting `json:"b"`         // B的统计
+	Different bool           `json:"different"` // 统计是否不同
+}
+
+// MeanOvercut 每个闭合轮廓的平均过切长度(mm)
+func (s CuttingStats) MeanOvercut() float64 {
+	if s.Closed == 0 {
+		return 0
+	}
+	return s.OvercutLength / float64(s.Closed)
+}
@@ -0,0 +1,46 @@
+package model
+
+// Envelope 加工包络(各轴坐标范围)
+type Envelope struct {
+	X     AxisRange `json:"x"`
+	Y     AxisRange `json:"y"`
+	Z     AxisRange `json:"z"`
+	Empty bool      `json:"empty"` // 没有任何移动
+}
+
+// EnvelopeReport 包络与软限位检查结果
+type EnvelopeReport struct {
+	Work           Envelope         `json:"work"`            // 工件坐标系下的包络
+	Machine        Envelope         `json:"machine"`         // 机床坐标系下的包络
+	Limits         TravelLimits     `json:"limits"`          // 使用的行程限位
+	WithinLimits   bool             `json:"within_limits"`   // 是否所有移动都在限位内
+	ViolationCount int              `json:"violation_count"` // 超限移动总数
+	Violations     []LimitViolation `json:"violations"`      // 超限移动(最多保留1000条)
+	CoordSystems   []string         `json:"coord_systems"`   // 程序中使用过的工件坐标系，如 G54、G55
+	ToolLengths    []float64        `json:"tool_lengths"`    // 程序中使用过的刀具长度补偿值(mm)
+}
+
+// LimitViolation 超出行程限位的移动
+type LimitViolation struct {
+	Line  int       `json:"line"`  // 行号
+	Axis  string    `json:"axis"`  // 超限的轴
+	Value float64   `json:"value"` // 超限的机床坐标
+	Limit AxisRange `json:"limit"` // 该轴的行程
+}
+
+// EnvelopeChange A/B两个版本的包络变化(B-A)
+type EnvelopeChange struct {
+	X     AxisRangeChange `json:"x"`
+	Y     AxisRangeChange `json:"y"`
+	Z     AxisRangeChange `json:"z"`
+	Same  bool            `json:"same"`   // 包络是否相同
+	AFits bool            `json:"a_fits"` // A是否在限位内
+	BFits bool            `json:"b_fits"` // B是否在限位内
+}
+
+// AxisRangeChange 单轴范围变化
+type AxisRangeChange struct {
+	MinDelta  float64 `json:"min_delta"`  // 最小值变化
+	MaxDelta  float64 `json:"max_delta"`  // 最大值变化
+	SizeDelta float64 `json:"size_delta"` // 尺寸变化
+}
@@ -2,6 +2,7 @@ package model
 
 // CompareResult 总的比较结果
 type CompareResult struct {
+	ID           string        `json:"id"` // 结果ID，用于再次获取结果和渲染图片
 	File1Name    string        `json:"file1_name"`
 	File2Name    string        `json:"file2_name"`
 	GCodeDiff    *GCodeDiff    `json:"gcode_diff"`    // G-code差异
@@ -19,10 +20,15 @@ type GCodeDiff struct {
 
 // ChangeAnalysis 变化分析
 type ChangeAnalysis struct {
-	PathLengthChange float64 `json:"path_length_change"` // 路径长度变化率
-	AreaChange       float64 `json:"area_change"`        // 加工区域变化率
-	SpeedChange      float64 `json:"speed_change"`       // 速度变化率
-	CommandChange    float64 `json:"command_change"`     // 命令结构变化率
+	PathLengthChange float64        `json:"path_length_change"` // 路径长度变化率
+	AreaChange       float64        `json:"area_change"`        // 加工区域变化率
+	SpeedChange      float64        `json:"speed_change"`       // 速度变化率
+	CommandChange    float64        `json:"command_change"`     // 命令结构变化率
+	Envelope         EnvelopeChange `json:"envelope"`           // 加工包络变化
+	Tooling          ToolingChange  `json:"tooling"`            // 刀具变化
+	Holes            HoleChange     `json:"holes"`              // 孔的变化
+	Kerf             KerfCheck      `json:"kerf"`               // 切缝补偿检查
+	Cutting          CuttingChange  `json:"cutting"`            // 穿孔和引入引出的变化
 }
 
 // GCodeStatistics G-code统计信息
@@ -47,6 +53,9 @@ type TimeAnalysis struct {
 	WorkingTime float64 `json:"working_time"` // 工作时间(秒)
 	RapidTime   float64 `json:"rapid_time"`   // 快速移动时间(秒)
 	AccelTime   float64 `json:"accel_time"`   // 加减速时间(秒)
+	DwellTime   float64 `json:"dwell_time"`   // 固定循环孔底暂停时间(秒)
+
+	SettingCommands int `json:"setting_commands"` // 文件中修改运动限制的设置命令数(M203/M204/SET_VELOCITY_LIMIT/$110 等)
 }
 
 // GCodeAnalysis G-code分析结果
@@ -88,6 +97,45 @@ type GCodeAnalysis struct {
 
 	// 时间分析
 	Time TimeAnalysis `json:"time"`
+
+	// 包络与软限位
+	Envelope EnvelopeReport `json:"envelope"`
+
+	// 注释、程序段号与校验和
+	Comments CommentSummary `json:"comments"`
+
+	// 刀具、主轴与冷却
+	Tooling ToolingReport `json:"tooling"`
+
+	// 固定循环加工的孔
+	Holes HoleReport `json:"holes"`
+
+	// 子程序和循环展开
+	Program ProgramExpansion `json:"program"`
+
+	// 激光/等离子切割的穿孔和引入引出
+	Cutting CuttingReport `json:"cutting"`
+
+	// 空行程与切割顺序优化
+	Travel TravelReport `json:"travel"`
+}
+
+// CommentSummary 注释统计，包括CAM元数据、分段标记以及程序段号和校验和的检查结果
+type CommentSummary struct {
+	Count        int               `json:"count"`         // 注释数量
+	Metadata     map[string]string `json:"metadata"`      // 形如 key: value 的元数据注释，每个键保留第一次出现的值
+	Markers      []CommentMarker   `json:"markers"`       // 图层、元素、工序等分段标记
+	LineNumbers  int               `json:"line_numbers"`  // 带程序段号N的行数
+	Checksums    int               `json:"checksums"`     // 带校验和的行数
+	BadChecksums int               `json:"bad_checksums"` // 校验和错误的行数
+	Truncated    bool              `json:"truncated"`     // 元数据或分段标记超出数量上限
+}
+
+// CommentMarker 分段标记注释
+type CommentMarker struct {
+	Line int    `json:"line"` // 所在行号
+	Kind string `json:"kind"` // 类型: layer/element/operation/type/tool
+	Name string `json:"name"` // 名称，如图层号或元素名
 }
 
 // ManifestDiff Manifest文件差异
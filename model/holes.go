@@ -0,0 +1,34 @@
+package model
+
+// HoleReport 固定循环钻孔统计
+type HoleReport struct {
+	Count     int            `json:"count"`     // 孔数
+	Cycles    map[string]int `json:"cycles"`    // 各固定循环的孔数，如 G81、G83
+	Holes     []Hole         `json:"holes"`     // 孔(最多保留1000个)
+	Truncated bool           `json:"truncated"` // 孔数超出保留的上限
+}
+
+// Hole 固定循环加工的一个孔，坐标为工件坐标(mm)
+type Hole struct {
+	Line   int     `json:"line"`   // 行号
+	Cycle  string  `json:"cycle"`  // 固定循环，如 G81
+	Tool   int     `json:"tool"`   // 刀具号
+	X      float64 `json:"x"`      // 孔位 X
+	Y      float64 `json:"y"`      // 孔位 Y
+	Top    float64 `json:"top"`    // 开始进给的高度(R 平面)
+	Bottom float64 `json:"bottom"` // 孔底 Z
+}
+
+// HoleChange A/B两个版本的孔变化，按孔位(0.001mm)匹配，只比较保留的孔
+type HoleChange struct {
+	Same     bool           `json:"same"`     // 孔是否相同
+	Added    []Hole         `json:"added"`    // 只有B有的孔
+	Removed  []Hole         `json:"removed"`  // 只有A有的孔
+	Modified []HoleModified `json:"modified"` // 孔位相同但循环、刀具或深度不同的孔
+}
+
+// HoleModified 孔位相同但加工方式不同的孔
+type HoleModified struct {
+	A Hole `json:"a"`
+	B Hole `json:"b"`
+}
@@ -0,0 +1,30 @@
+package model
+
+// 切缝补偿检查结果
+const (
+	KerfMatch        = "match"         // 实际偏移与声明的切缝补偿变化一致
+	KerfMismatch     = "mismatch"      // 实际偏移与声明的变化不一致
+	KerfShapeChanged = "shape_changed" // 轮廓形状改变，不只是偏移
+	KerfUnknown      = "unknown"       // 没有可比较的闭合轮廓
+)
+
+// KerfCheck 切缝补偿检查，按 manifest 的元素比较A/B中的轮廓，估计实际偏移距离
+// 偏移以零件变大为正：外轮廓向外、内孔向内
+type KerfCheck struct {
+	Elements   []KerfElement `json:"elements"`   // 各元素的检查结果
+	Mismatches int           `json:"mismatches"` // 偏移与声明不一致或形状改变的元素数
+}
+
+// KerfElement 一个元素的切缝补偿检查
+type KerfElement struct {
+	Index        int     `json:"index"`         // manifest 中 elements 的序号
+	Name         string  `json:"name"`          // G-code 中元素标记的名称，没有标记时为空
+	KerfA        float64 `json:"kerf_a"`        // A声明的切缝补偿距离(mm)，未启用时为0
+	KerfB        float64 `json:"kerf_b"`        // B声明的切缝补偿距离(mm)，未启用时为0
+	Expected     float64 `json:"expected"`      // 声明的偏移变化(B-A)
+	Observed     float64 `json:"observed"`      // 按闭合轮廓面积变化估计的实际偏移(mm)
+	MeanDistance float64 `json:"mean_distance"` // B的轮廓到A的轮廓的平均距离(mm)
+	Contours     int     `json:"contours"`      // B中参与比较的闭合轮廓数
+	Status       string  `json:"status"`        // 检查结果: match/mismatch/shape_changed/unknown
+	Note         string  `json:"note"`          // 无法比较的原因
+}
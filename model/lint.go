@@ -0,0 +1,33 @@
+package model
+
+// LintReport G-code检查报告
+type LintReport struct {
+	File      string      `json:"file"`      // 文件名
+	Rules     []LintRule  `json:"rules"`     // 启用的规则
+	Issues    []LintIssue `json:"issues"`    // 问题列表
+	Summary   LintSummary `json:"summary"`   // 问题统计
+	Truncated bool        `json:"truncated"` // 问题过多时是否已截断
+}
+
+// LintRule 检查规则说明
+type LintRule struct {
+	ID          string `json:"id"`          // 规则ID
+	Description string `json:"description"` // 规则说明
+	Severity    string `json:"severity"`    // 严重级别
+}
+
+// LintSummary 检查问题统计
+type LintSummary struct {
+	Errors   int `json:"errors"`   // 错误数量
+	Warnings int `json:"warnings"` // 警告数量
+	Infos    int `json:"infos"`    // 提示数量
+}
+
+// LintIssue 检查发现的单个问题
+type LintIssue struct {
+	RuleID   string `json:"rule_id"`  // 规则ID
+	Severity string `json:"severity"` // 严重级别 (error/warning/info)
+	Line     int    `json:"line"`     // 行号，0表示整个文件
+	Message  string `json:"message"`  // 问题描述
+	Content  string `json:"content"`  // 对应行内容
+}
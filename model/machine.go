@@ -0,0 +1,96 @@
+package model
+
+// MachineProfile 机器配置
+type MachineProfile struct {
+	Name       string       `json:"name"`        // 机器名称
+	BedWidth   float64      `json:"bed_width"`   // 工作台宽度(mm)
+	BedHeight  float64      `json:"bed_height"`  // 工作台高度(mm)
+	MaxFeed    float64      `json:"max_feed"`    // 最大进给速度(mm/min)，0表示不限制
+	Laser      bool         `json:"laser"`       // 是否为激光设备
+	Dialect    string       `json:"dialect"`     // 控制器方言: grbl、marlin、klipper、linuxcnc、fanuc、ruida，为空表示通用
+	Travel     TravelLimits `json:"travel"`      // 各轴行程(软限位)，机床坐标
+	WorkOffset Offset       `json:"work_offset"` // 工件坐标系原点在机床坐标系中的位置，work_offsets 未配置 G54 时用作 G54
+
+	WorkOffsets   map[string]Offset `json:"work_offsets,omitempty"`   // 各工件坐标系(G54-G59.3)原点的机床坐标
+	ToolLengths   map[int]float64   `json:"tool_lengths,omitempty"`   // 刀具长度表，G43 H<刀号> 使用(mm)
+	ToolDiameters map[int]float64   `json:"tool_diameters,omitempty"` // 刀具直径表，G41/G42 D<刀号> 使用(mm)
+}
+
+// AxisRange 轴范围
+type AxisRange struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+// Contains 值是否在范围内
+func (r AxisRange) Contains(v float64) bool {
+	return v >= r.Min && v <= r.Max
+}
+
+// TravelLimits 各轴行程，为空表示该轴不限制
+type TravelLimits struct {
+	X *AxisRange `json:"x,omitempty"`
+	Y *AxisRange `json:"y,omitempty"`
+	Z *AxisRange `json:"z,omitempty"`
+}
+
+// Offset 坐标偏移
+type Offset struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	Z float64 `json:"z"`
+}
+
+// CoordSystemOffset 返回工件坐标系原点的机床坐标，code 为 G54-G59.3
+// G54 未单独配置时使用 WorkOffset，其他坐标系未配置时为机床原点
+func (p *MachineProfile) CoordSystemOffset(code string) Offset {
+	if offset, ok := p.WorkOffsets[code]; ok {
+		return offset
+	}
+	if code == "G54" {
+		return p.WorkOffset
+	}
+	return Offset{}
+}
+
+// Limits 返回实际生效的行程，未配置的X/Y轴行程取工作台尺寸
+func (p *MachineProfile) Limits() TravelLimits {
+	limits := p.Travel
+	if limits.X == nil && p.BedWidth > 0 {
+		limits.X = &AxisRange{Min: 0, Max: p.BedWidth}
+	}
+	if limits.Y == nil && p.BedHeight > 0 {
+		limits.Y = &AxisRange{Min: 0, Max: p.BedHeight}
+	}
+	return limits
+}
+
+// Check 检查机床坐标包围盒[min, max]是否超出行程，margin为允许的余量
+// 返回每个超限轴的记录(行号由调用方填写)
+func (l TravelLimits) Check(min, max Offset, margin float64) []LimitViolation {
+	axes := []struct {
+		name     string
+		limit    *AxisRange
+		min, max float64
+	}{
+		{"X", l.X, min.X, max.X},
+		{"Y", l.Y, min.Y, max.Y},
+		{"Z", l.Z, min.Z, max.Z},
+	}
+
+	var violations []LimitViolation
+	for _, axis := range axes {
+		if axis.limit == nil {
+			continue
+		}
+		value := axis.min
+		if value >= axis.limit.Min-margin {
+			value = axis.max
+			if value <= axis.limit.Max+margin {
+				continue
+			}
+		}
+		violations = append(violations, LimitViolation{Axis: axis.name, Value: value, Limit: *axis.limit})
+	}
+	return violations
+}
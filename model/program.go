@@ -0,0 +1,19 @@
+package model
+
+// ProgramExpansion 子程序、宏和循环的展开统计
+// 展开后的移动仍按源文件行号报告
+type ProgramExpansion struct {
+	Expanded      bool             `json:"expanded"`       // 是否含有子程序、宏变量或流程控制
+	SourceLines   int              `json:"source_lines"`   // 源文件行数
+	ExecutedLines int              `json:"executed_lines"` // 展开后执行的程序段行数
+	Calls         int              `json:"calls"`          // 子程序执行次数
+	Loops         int              `json:"loops"`          // 循环跳回的次数
+	MaxDepth      int              `json:"max_depth"`      // 最大调用深度
+	Unresolved    []SubprogramCall `json:"unresolved"`     // 文件中找不到、没有展开的子程序调用
+}
+
+// SubprogramCall 子程序调用
+type SubprogramCall struct {
+	Name string `json:"name"` // 子程序名，如 o<drill>、O1000
+	Line int    `json:"line"` // 调用所在的行号
+}
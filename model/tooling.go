@@ -0,0 +1,68 @@
+package model
+
+// ToolingReport 刀具、主轴与冷却分析
+type ToolingReport struct {
+	Tools       []ToolUsage  `json:"tools"`        // 使用过的刀具，按首次使用的顺序
+	Sequence    []int        `json:"sequence"`     // 刀具顺序，每次换刀后有运动的刀具
+	ToolChanges int          `json:"tool_changes"` // 换刀次数
+	Spindle     SpindleUsage `json:"spindle"`      // 主轴
+	Coolant     CoolantUsage `json:"coolant"`      // 冷却
+
+	Compensation CompensationReport `json:"compensation"` // 刀具半径补偿
+}
+
+// ToolUsage 单把刀具的使用情况，刀具号0表示程序没有换刀时主轴上的刀具
+type ToolUsage struct {
+	Tool          int       `json:"tool"`           // 刀具号
+	WorkingLength float64   `json:"working_length"` // 加工长度(mm)
+	RapidLength   float64   `json:"rapid_length"`   // 快速移动长度(mm)
+	Time          float64   `json:"time"`           // 估算时间(秒)，按进给速度计算，包括暂停，不含加减速
+	Spindle       AxisRange `json:"spindle"`        // 加工时的主轴转速范围(S)
+	Loads         int       `json:"loads"`          // 装入次数
+}
+
+// SpindleUsage 主轴使用情况
+type SpindleUsage struct {
+	Range     AxisRange `json:"range"`      // 加工时的主轴转速范围(S)
+	Starts    int       `json:"starts"`     // 启动次数(M3/M4)
+	Reverse   bool      `json:"reverse"`    // 是否使用过反转 M4
+	OffLength float64   `json:"off_length"` // 主轴关闭时的加工长度(mm)
+}
+
+// CoolantUsage 冷却使用情况
+type CoolantUsage struct {
+	MistLength  float64 `json:"mist_length"`  // 雾状冷却(M7)下的加工长度(mm)
+	FloodLength float64 `json:"flood_length"` // 冷却液(M8)下的加工长度(mm)
+	DryLength   float64 `json:"dry_length"`   // 没有冷却的加工长度(mm)
+	Starts      int     `json:"starts"`       // 开启次数
+}
+
+// CompensationReport 刀具半径补偿(G41/G42)，刀具直径取自机器配置的刀具直径表
+// 长度只统计补偿生效期间的加工移动，包括建立和取消补偿的移动
+type CompensationReport struct {
+	Used              bool                `json:"used"`               // 是否使用了刀具半径补偿
+	ProgrammedLength  float64             `json:"programmed_length"`  // 编程路径长度(mm)
+	CompensatedLength float64             `json:"compensated_length"` // 补偿后刀具中心路径长度(mm)
+	Issues            []CompensationIssue `json:"issues"`             // 过切等补偿问题
+}
+
+// CompensationIssue 刀具半径补偿的问题
+type CompensationIssue struct {
+	Line    int    `json:"line"`    // 行号
+	Message string `json:"message"` // 问题说明
+}
+
+// ToolingChange A/B两个版本的刀具变化
+type ToolingChange struct {
+	Same             bool           `json:"same"`               // 刀具顺序是否相同
+	Sequence         []SequenceEdit `json:"sequence"`           // 刀具顺序的差异
+	AddedTools       []int          `json:"added_tools"`        // 只有B使用的刀具
+	RemovedTools     []int          `json:"removed_tools"`      // 只有A使用的刀具
+	ToolChangesDelta int            `json:"tool_changes_delta"` // 换刀次数变化(B-A)
+}
+
+// SequenceEdit 刀具顺序的一项差异
+type SequenceEdit struct {
+	Type string `json:"type"` // 类型: same/add/remove
+	Tool int    `json:"tool"` // 刀具号
+}
@@ -0,0 +1,25 @@
+package model
+
+// TravelReport 空行程分析：把切割路径按最近邻加 2-opt 重新排序，估计可以节省的空行程
+// 空行程按相邻切割路径之间的 XY 直线距离计算；只在同一元素、同一刀具和坐标系的连续切割路径之间重新排序，
+// 每个分组从进入该分组时的位置开始
+type TravelReport struct {
+	Contours    int             `json:"contours"`     // 切割路径数
+	Groups      int             `json:"groups"`       // 分组数
+	Fixed       int             `json:"fixed"`        // 包含固定循环、刀具半径补偿等无法重新排序的分组数
+	Travel      float64         `json:"travel"`       // 当前顺序的空行程(mm)
+	Optimized   float64         `json:"optimized"`    // 重新排序后的空行程(mm)
+	Savings     float64         `json:"savings"`      // 可节省的空行程(mm)
+	TimeSavings float64         `json:"time_savings"` // 按快速移动速度估算可节省的时间(秒)
+	Elements    []ElementTravel `json:"elements"`     // 各元素的空行程，无法对应元素时为空
+}
+
+// ElementTravel 一个元素的空行程
+type ElementTravel struct {
+	Index     int     `json:"index"`     // 元素序号，与 manifest 中 elements 的序号相同
+	Name      string  `json:"name"`      // G-code 中元素标记的名称，没有标记时为空
+	Contours  int     `json:"contours"`  // 切割路径数
+	Travel    float64 `json:"travel"`    // 当前顺序的空行程(mm)
+	Optimized float64 `json:"optimized"` // 重新排序后的空行程(mm)
+	Savings   float64 `json:"savings"`   // 可节省的空行程(mm)
+}
@@ -0,0 +1,293 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"ok/gcode"
+)
+
+// 叠加图颜色
+var (
+	ColorBackground = color.RGBA{255, 255, 255, 255} // 背景
+	ColorCommon     = color.RGBA{140, 149, 159, 255} // A、B共有的路径
+	ColorOnlyA      = color.RGBA{209, 36, 47, 255}   // 仅A有的路径
+	ColorOnlyB      = color.RGBA{26, 127, 55, 255}   // 仅B有的路径
+)
+
+// maxImageSize 图片最大边长(px)
+const maxImageSize = 8000
+
+// OverlayOptions 叠加图渲染参数
+type OverlayOptions struct {
+	Width         int       // 图片宽度(px)，高度按比例计算
+	Viewport      *Viewport // 显示区域，为空时自动适应两个版本的所有路径
+	Zoom          float64   // 缩放倍数
+	ZoomToDiff    bool      // 缩放到差异区域
+	LineWidth     int       // 线宽(px)
+	Tolerance     int       // 判断为共有路径时允许的偏差(px)
+	IncludeRapids bool      // 是否包含快速移动
+}
+
+// DefaultOverlayOptions 默认叠加图渲染参数
+func DefaultOverlayOptions() OverlayOptions {
+	return OverlayOptions{Width: 1000, Zoom: 1, LineWidth: 2, Tolerance: 1}
+}
+
+// OverlayStats 叠加图的像素统计
+type OverlayStats struct {
+	Viewport     Viewport  `json:"viewport"`      // 实际显示区域(mm)
+	CommonPixels int       `json:"common_pixels"` // 共有路径像素数
+	OnlyAPixels  int       `json:"only_a_pixels"` // 仅A有的像素数
+	OnlyBPixels  int       `json:"only_b_pixels"` // 仅B有的像素数
+	DiffBounds   *Viewport `json:"diff_bounds"`   // 差异区域(mm)，无差异时为空
+}
+
+// Overlay 将A、B两个版本的路径叠加渲染为一张图片
+// 仅A有的路径为红色，仅B有的路径为绿色，共有路径为灰色
+func Overlay(a, b []gcode.Segment, opts OverlayOptions) (*image.RGBA, OverlayStats) {
+	if opts.Width <= 0 {
+		opts.Width = DefaultOverlayOptions().Width
+	}
+	if opts.LineWidth <= 0 {
+		opts.LineWidth = 1
+	}
+	if !opts.IncludeRapids {
+		a, b = cutsOnly(a), cutsOnly(b)
+	}
+
+	var vp Viewport
+	if opts.Viewport != nil {
+		vp = *opts.Viewport
+	} else {
+		vp = Bounds(a, b).Pad(0.02)
+	}
+	vp = vp.Zoom(opts.Zoom)
+
+	img, stats := drawOverlay(a, b, vp, opts)
+	if opts.ZoomToDiff && stats.DiffBounds != nil {
+		// 以差异区域重新渲染，保留一定边距以便看清上下文
+		img, stats = drawOverlay(a, b, stats.DiffBounds.Pad(0.1), opts)
+	}
+	return img, stats
+}
+
+// drawOverlay 在指定显示区域内绘制叠加图
+func drawOverlay(a, b []gcode.Segment, vp Viewport, opts OverlayOptions) (*image.RGBA, OverlayStats) {
+	if vp.Width() <= 0 || vp.Height() <= 0 {
+		vp = Viewport{MinX: 0, MinY: 0, MaxX: 100, MaxY: 100}
+	}
+	width := opts.Width
+	if width > maxImageSize {
+		width = maxImageSize
+	}
+	height := int(math.Round(float64(width) * vp.Height() / vp.Width()))
+	if height > maxImageSize {
+		height = maxImageSize
+		width = int(math.Round(float64(height) * vp.Width() / vp.Height()))
+	}
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+
+	r := &raster{vp: vp, w: width, h: height, scale: float64(width) / vp.Width()}
+	maskA := r.draw(a, opts.LineWidth)
+	maskB := r.draw(b, opts.LineWidth)
+	nearA := dilate(maskA, width, height, opts.Tolerance)
+	nearB := dilate(maskB, width, height, opts.Tolerance)
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	stats := OverlayStats{Viewport: vp}
+	minX, minY, maxX, maxY := width, height, -1, -1
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := y*width + x
+			c := ColorBackground
+			diff := false
+			switch {
+			case maskA[i] && nearB[i], maskB[i] && nearA[i]:
+				c = ColorCommon
+				stats.CommonPixels++
+			case maskA[i]:
+				c = ColorOnlyA
+				stats.OnlyAPixels++
+				diff = true
+			case maskB[i]:
+				c = ColorOnlyB
+				stats.OnlyBPixels++
+				diff = true
+			}
+			img.SetRGBA(x, y, c)
+			if diff {
+				minX, minY = min(minX, x), min(minY, y)
+				maxX, maxY = max(maxX, x), max(maxY, y)
+			}
+		}
+	}
+
+	if maxX >= 0 {
+		stats.DiffBounds = &Viewport{
+			MinX: vp.MinX + float64(minX)/r.scale,
+			MaxX: vp.MinX + float64(maxX+1)/r.scale,
+			MinY: vp.MaxY - float64(maxY+1)/r.scale,
+			MaxY: vp.MaxY - float64(minY)/r.scale,
+		}
+	}
+	return img, stats
+}
+
+// raster 简单的线段光栅化
+type raster struct {
+	vp    Viewport
+	w, h  int
+	scale float64 // px/mm
+}
+
+// draw 绘制运动段，返回像素掩码
+func (r *raster) draw(segments []gcode.Segment, lineWidth int) []bool {
+	mask := make([]bool, r.w*r.h)
+	radius := float64(lineWidth) / 2
+	// 圆弧离散的弦高误差取半个像素
+	tolerance := 0.5 / r.scale
+	for i := range segments {
+		seg := &segments[i]
+		min, max := seg.Bounds()
+		if !r.vp.Intersects(Viewport{MinX: min.X, MinY: min.Y, MaxX: max.X, MaxY: max.Y}) {
+			continue
+		}
+		points := seg.Points(tolerance)
+		for j := 1; j < len(points); j++ {
+			x0, y0 := r.toPixel(points[j-1])
+			x1, y1 := r.toPixel(points[j])
+			r.line(mask, x0, y0, x1, y1, radius)
+		}
+	}
+	return mask
+}
+
+// toPixel 坐标转换为像素位置
+func (r *raster) toPixel(p gcode.Point) (float64, float64) {
+	return (p.X - r.vp.MinX) * r.scale, (r.vp.MaxY - p.Y) * r.scale
+}
+
+// line 以给定半径绘制一条线段，只绘制图片范围内的部分
+func (r *raster) line(mask []bool, x0, y0, x1, y1, radius float64) {
+	x0, y0, x1, y1, ok := clipLine(x0, y0, x1, y1, -radius, -radius, float64(r.w)+radius, float64(r.h)+radius)
+	if !ok {
+		// 线段完全在图片外
+		return
+	}
+	length := math.Hypot(x1-x0, y1-y0)
+	steps := int(math.Ceil(length * 2))
+	if steps < 1 {
+		steps = 1
+	}
+	for i := 0; i <= steps; i++ {
+		t := float64(i) / float64(steps)
+		r.stamp(mask, x0+(x1-x0)*t, y0+(y1-y0)*t, radius)
+	}
+}
+
+// clipLine 按 Liang-Barsky 算法将线段裁剪到矩形内，线段与矩形不相交时返回false
+func clipLine(x0, y0, x1, y1, minX, minY, maxX, maxY float64) (float64, float64, float64, float64, bool) {
+	dx, dy := x1-x0, y1-y0
+	t0, t1 := 0.0, 1.0
+	for _, edge := range [4][2]float64{{-dx, x0 - minX}, {dx, maxX - x0}, {-dy, y0 - minY}, {dy, maxY - y0}} {
+		p, q := edge[0], edge[1]
+		if p == 0 {
+			if q < 0 {
+				return 0, 0, 0, 0, false
+			}
+			continue
+		}
+		t := q / p
+		if p < 0 {
+			t0 = math.Max(t0, t)
+		} else {
+			t1 = math.Min(t1, t)
+		}
+		if t0 > t1 {
+			return 0, 0, 0, 0, false
+		}
+	}
+	return x0 + t0*dx, y0 + t0*dy, x0 + t1*dx, y0 + t1*dy, true
+}
+
+// stamp 在指定位置绘制一个圆点
+func (r *raster) stamp(mask []bool, cx, cy, radius float64) {
+	x0, x1 := int(math.Floor(cx-radius)), int(math.Ceil(cx+radius))
+	y0, y1 := int(math.Floor(cy-radius)), int(math.Ceil(cy+radius))
+	for y := max(y0, 0); y < min(y1, r.h); y++ {
+		for x := max(x0, 0); x < min(x1, r.w); x++ {
+			dx, dy := float64(x)+0.5-cx, float64(y)+0.5-cy
+			if dx*dx+dy*dy <= radius*radius+0.25 {
+				mask[y*r.w+x] = true
+			}
+		}
+	}
+}
+
+// dilate 按方形窗口膨胀掩码
+func dilate(mask []bool, w, h, radius int) []bool {
+	if radius <= 0 {
+		return mask
+	}
+	tmp := make([]bool, len(mask))
+	out := make([]bool, len(mask))
+	// 先水平方向，再垂直方向
+	for y := 0; y < h; y++ {
+		last := -radius - 1
+		for x := 0; x < w; x++ {
+			if mask[y*w+x] {
+				last = x
+			}
+			if x-last <= radius {
+				tmp[y*w+x] = true
+			}
+		}
+		last = w + radius + 1
+		for x := w - 1; x >= 0; x-- {
+			if mask[y*w+x] {
+				last = x
+			}
+			if last-x <= radius {
+				tmp[y*w+x] = true
+			}
+		}
+	}
+	for x := 0; x < w; x++ {
+		last := -radius - 1
+		for y := 0; y < h; y++ {
+			if tmp[y*w+x] {
+				last = y
+			}
+			if y-last <= radius {
+				out[y*w+x] = true
+			}
+		}
+		last = h + radius + 1
+		for y := h - 1; y >= 0; y-- {
+			if tmp[y*w+x] {
+				last = y
+			}
+			if last-y <= radius {
+				out[y*w+x] = true
+			}
+		}
+	}
+	return out
+}
+
+// cutsOnly 过滤掉快速移动
+func cutsOnly(segments []gcode.Segment) []gcode.Segment {
+	cuts := make([]gcode.Segment, 0, len(segments))
+	for _, seg := range segments {
+		if !seg.IsRapid() {
+			cuts = append(cuts, seg)
+		}
+	}
+	return cuts
+}
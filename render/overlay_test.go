@@ -0,0 +1,81 @@
+package render
+
+import (
+	"image/color"
+	"ok/gcode"
+	"testing"
+	"time"
+)
+
+func TestClipLine(t *testing.T) {
+	tests := []struct {
+		name           string
+		x0, y0, x1, y1 float64
+		want           [4]float64
+		ok             bool
+	}{
+		{"内部", 1, 1, 5, 5, [4]float64{1, 1, 5, 5}, true},
+		{"穿过", -10, 5, 20, 5, [4]float64{0, 5, 10, 5}, true},
+		{"一端在外", 5, 5, 5, 100, [4]float64{5, 5, 5, 10}, true},
+		{"完全在外", -5, -5, -1, 20, [4]float64{}, false},
+		{"对角穿过", -10, -10, 20, 20, [4]float64{0, 0, 10, 10}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x0, y0, x1, y1, ok := clipLine(tt.x0, tt.y0, tt.x1, tt.y1, 0, 0, 10, 10)
+			if ok != tt.ok || (ok && [4]float64{x0, y0, x1, y1} != tt.want) {
+				t.Errorf("got %v %v %v %v %v, want %v %v", x0, y0, x1, y1, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestOverlayLargeZoom(t *testing.T) {
+	a := []gcode.Segment{{Motion: gcode.MotionLinear, From: gcode.Point{X: -1000}, To: gcode.Point{X: 1000, Y: 1}}}
+	b := []gcode.Segment{{Motion: gcode.MotionLinear, To: gcode.Point{X: 1, Y: 1}}}
+	start := time.Now()
+	opts := DefaultOverlayOptions()
+	opts.Zoom = 1e9
+	Overlay(a, b, opts)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("渲染用时 %v", elapsed)
+	}
+}
+
+func TestOverlayClassify(t *testing.T) {
+	line := func(motion string, y float64) gcode.Segment {
+		return gcode.Segment{Motion: motion, From: gcode.Point{X: 10, Y: y}, To: gcode.Point{X: 90, Y: y}}
+	}
+	a := []gcode.Segment{line(gcode.MotionLinear, 20), line(gcode.MotionLinear, 50), line(gcode.MotionRapid, 65)}
+	b := []gcode.Segment{line(gcode.MotionLinear, 50), line(gcode.MotionLinear, 80)}
+	opts := DefaultOverlayOptions()
+	opts.Width = 100
+	opts.Viewport = &Viewport{MinX: 0, MinY: 0, MaxX: 100, MaxY: 100}
+	img, stats := Overlay(a, b, opts)
+
+	// 图片的行从上往下，Y 为 20mm 的路径在第 80 行
+	tests := []struct {
+		name string
+		y    int
+		want color.RGBA
+	}{
+		{"仅A", 80, ColorOnlyA},
+		{"共有", 50, ColorCommon},
+		{"快速移动不绘制", 35, ColorBackground},
+		{"仅B", 20, ColorOnlyB},
+		{"背景", 5, ColorBackground},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := img.RGBAAt(50, tt.y); got != tt.want {
+				t.Errorf("像素(50, %d) = %v, want %v", tt.y, got, tt.want)
+			}
+		})
+	}
+	if stats.CommonPixels == 0 || stats.OnlyAPixels == 0 || stats.OnlyBPixels == 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+	if d := stats.DiffBounds; d == nil || d.MinY > 20 || d.MaxY < 80 || d.MinX > 10 || d.MaxX < 90 {
+		t.Errorf("DiffBounds = %+v", stats.DiffBounds)
+	}
+}
@@ -0,0 +1,329 @@
+package render
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"ok/gcode"
+	"strconv"
+	"strings"
+)
+
+// 图层名称
+const (
+	LayerRapid = "rapids" // 快速移动
+	LayerCut   = "cuts"   // 直线加工
+	LayerArc   = "arcs"   // 圆弧加工
+	LayerPower = "power"  // 激光功率强度
+	LayerHoles = "holes"  // 固定循环的孔位
+)
+
+// DefaultLayers 默认显示的图层
+var DefaultLayers = []string{LayerRapid, LayerCut, LayerArc, LayerHoles}
+
+// powerLevels 功率图层的颜色分级数量
+const powerLevels = 10
+
+// Viewport 显示区域(mm)
+type Viewport struct {
+	MinX float64 `json:"min_x"`
+	MinY float64 `json:"min_y"`
+	MaxX float64 `json:"max_x"`
+	MaxY float64 `json:"max_y"`
+}
+
+// Width 显示区域宽度
+func (v Viewport) Width() float64 { return v.MaxX - v.MinX }
+
+// Height 显示区域高度
+func (v Viewport) Height() float64 { return v.MaxY - v.MinY }
+
+// Intersects 是否与另一个区域相交
+func (v Viewport) Intersects(o Viewport) bool {
+	return v.MinX <= o.MaxX && o.MinX <= v.MaxX && v.MinY <= o.MaxY && o.MinY <= v.MaxY
+}
+
+// MaxZoom 最大缩放倍数，更大的倍数会使路径离散和光栅化的计算量失控
+const MaxZoom = 1000
+
+// Zoom 以中心为基准缩放显示区域，factor大于1为放大，超过 MaxZoom 时按 MaxZoom 缩放
+func (v Viewport) Zoom(factor float64) Viewport {
+	if factor <= 0 || factor == 1 {
+		return v
+	}
+	factor = math.Min(factor, MaxZoom)
+	cx, cy := (v.MinX+v.MaxX)/2, (v.MinY+v.MaxY)/2
+	hw, hh := v.Width()/2/factor, v.Height()/2/factor
+	return Viewport{MinX: cx - hw, MinY: cy - hh, MaxX: cx + hw, MaxY: cy + hh}
+}
+
+// Pad 向四周扩展显示区域，ratio为相对于长边的比例
+func (v Viewport) Pad(ratio float64) Viewport {
+	pad := math.Max(v.Width(), v.Height()) * ratio
+	if pad == 0 {
+		pad = 1
+	}
+	return Viewport{MinX: v.MinX - pad, MinY: v.MinY - pad, MaxX: v.MaxX + pad, MaxY: v.MaxY + pad}
+}
+
+// ParseViewport 解析 "minX,minY,maxX,maxY" 格式的显示区域
+func ParseViewport(s string) (*Viewport, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("显示区域格式应为 minX,minY,maxX,maxY")
+	}
+	values := make([]float64, 4)
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, fmt.Errorf("显示区域数值无效: %s", part)
+		}
+		values[i] = v
+	}
+	vp := &Viewport{MinX: values[0], MinY: values[1], MaxX: values[2], MaxY: values[3]}
+	if vp.Width() <= 0 || vp.Height() <= 0 {
+		return nil, fmt.Errorf("显示区域宽高必须大于0")
+	}
+	return vp, nil
+}
+
+// Options 渲染参数
+type Options struct {
+	Width    int       // 图片宽度(px)，高度按比例计算
+	Viewport *Viewport // 显示区域，为空时自动适应所有运动段
+	Zoom     float64   // 缩放倍数，以显示区域中心为基准
+	Layers   []string  // 显示的图层，为空时使用默认图层
+}
+
+// DefaultOptions 默认渲染参数
+func DefaultOptions() Options {
+	return Options{Width: 800, Zoom: 1}
+}
+
+// Bounds 计算一组或多组运动段的XY包围区域
+func Bounds(sets ...[]gcode.Segment) Viewport {
+	vp := Viewport{MinX: math.MaxFloat64, MinY: math.MaxFloat64, MaxX: -math.MaxFloat64, MaxY: -math.MaxFloat64}
+	empty := true
+	for _, segments := range sets {
+		for i := range segments {
+			min, max := segments[i].Bounds()
+			vp.MinX, vp.MinY = math.Min(vp.MinX, min.X), math.Min(vp.MinY, min.Y)
+			vp.MaxX, vp.MaxY = math.Max(vp.MaxX, max.X), math.Max(vp.MaxY, max.Y)
+			empty = false
+		}
+	}
+	if empty {
+		return Viewport{}
+	}
+	return vp
+}
+
+// resolveViewport 根据参数确定最终显示区域
+func resolveViewport(segments []gcode.Segment, opts Options) Viewport {
+	var vp Viewport
+	if opts.Viewport != nil {
+		vp = *opts.Viewport
+	} else {
+		vp = Bounds(segments).Pad(0.02)
+	}
+	return vp.Zoom(opts.Zoom)
+}
+
+// segmentLayer 运动段所属的基础图层
+func segmentLayer(seg *gcode.Segment) string {
+	switch {
+	case seg.IsRapid():
+		return LayerRapid
+	case seg.IsArc():
+		return LayerArc
+	default:
+		return LayerCut
+	}
+}
+
+// SVG 将运动段渲染为SVG图片
+func SVG(w io.Writer, segments []gcode.Segment, opts Options) error {
+	if opts.Width <= 0 {
+		opts.Width = DefaultOptions().Width
+	}
+	layers := opts.Layers
+	if len(layers) == 0 {
+		layers = DefaultLayers
+	}
+	for _, layer := range layers {
+		switch layer {
+		case LayerRapid, LayerCut, LayerArc, LayerPower, LayerHoles:
+		default:
+			return fmt.Errorf("未知的图层: %s", layer)
+		}
+	}
+
+	vp := resolveViewport(segments, opts)
+	if vp.Width() <= 0 || vp.Height() <= 0 {
+		vp = Viewport{MinX: 0, MinY: 0, MaxX: 100, MaxY: 100}
+	}
+	height := int(math.Round(float64(opts.Width) * vp.Height() / vp.Width()))
+	if height < 1 {
+		height = 1
+	}
+
+	bw := bufio.NewWriter(w)
+	// G代码Y轴向上，SVG的Y轴向下，通过 scale(1,-1) 翻转
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="%s %s %s %s">`+"\n",
+		opts.Width, height, num(vp.MinX), num(-vp.MaxY), num(vp.Width()), num(vp.Height()))
+	fmt.Fprintln(bw, `<rect x="-1e6" y="-1e6" width="2e6" height="2e6" fill="#ffffff"/>`)
+	fmt.Fprintln(bw, `<g transform="scale(1,-1)" fill="none" stroke-linecap="round" stroke-linejoin="round">`)
+
+	for _, layer := range layers {
+		switch layer {
+		case LayerRapid:
+			writeLayer(bw, segments, vp, layer, `stroke="#9aa5b1" stroke-width="1" stroke-dasharray="4 3"`, nil)
+		case LayerCut:
+			writeLayer(bw, segments, vp, layer, `stroke="#1f6feb" stroke-width="1.2"`, nil)
+		case LayerArc:
+			writeLayer(bw, segments, vp, layer, `stroke="#2da44e" stroke-width="1.2"`, nil)
+		case LayerPower:
+			writePowerLayer(bw, segments, vp)
+		case LayerHoles:
+			writeHoleLayer(bw, segments, vp)
+		}
+	}
+
+	fmt.Fprintln(bw, "</g>")
+	fmt.Fprintln(bw, "</svg>")
+	return bw.Flush()
+}
+
+// writeLayer 输出一个图层，filter为空时按运动类型筛选
+func writeLayer(w *bufio.Writer, segments []gcode.Segment, vp Viewport, id, style string, filter func(seg *gcode.Segment) bool) {
+	fmt.Fprintf(w, `<g id="%s" %s>`+"\n", id, style)
+	path := &pathBuilder{}
+	for i := range segments {
+		seg := &segments[i]
+		if filter != nil {
+			if !filter(seg) {
+				continue
+			}
+		} else if segmentLayer(seg) != id {
+			continue
+		}
+		min, max := seg.Bounds()
+		if !vp.Intersects(Viewport{MinX: min.X, MinY: min.Y, MaxX: max.X, MaxY: max.Y}) {
+			continue
+		}
+		path.add(seg)
+		if path.len() > 4000 {
+			path.flush(w)
+		}
+	}
+	path.flush(w)
+	fmt.Fprintln(w, "</g>")
+}
+
+// writePowerLayer 按激光功率分级输出加工路径，颜色越深功率越大
+func writePowerLayer(w *bufio.Writer, segments []gcode.Segment, vp Viewport) {
+	maxPower := 0.0
+	for i := range segments {
+		if !segments[i].IsRapid() && segments[i].SpindleOn {
+			maxPower = math.Max(maxPower, segments[i].Power)
+		}
+	}
+
+	fmt.Fprintf(w, `<g id="%s">`+"\n", LayerPower)
+	if maxPower > 0 {
+		for level := 1; level <= powerLevels; level++ {
+			lo := maxPower * float64(level-1) / powerLevels
+			hi := maxPower * float64(level) / powerLevels
+			ratio := float64(level) / powerLevels
+			// 功率从低到高，颜色从浅橙到深红
+			style := fmt.Sprintf(`stroke="rgb(%d,%d,%d)" stroke-width="1.5"`,
+				int(255-55*ratio), int(200-190*ratio), int(120-110*ratio))
+			writeLayer(w, segments, vp, fmt.Sprintf("power-%d", level), style, func(seg *gcode.Segment) bool {
+				if seg.IsRapid() || !seg.SpindleOn || seg.Power <= 0 {
+					return false
+				}
+				return seg.Power > lo && (seg.Power <= hi || level == powerLevels)
+			})
+		}
+	}
+	fmt.Fprintln(w, "</g>")
+}
+
+// writeHoleLayer 在固定循环的孔位画圆，钻孔只有 Z 向移动，在路径图层中不可见
+// 圆的大小与显示区域成比例
+func writeHoleLayer(w *bufio.Writer, segments []gcode.Segment, vp Viewport) {
+	fmt.Fprintf(w, `<g id="%s" stroke="#cf222e" stroke-width="0.8">`+"\n", LayerHoles)
+	r := num(math.Max(vp.Width(), vp.Height()) * 0.006)
+	for i := range segments {
+		seg := &segments[i]
+		if !seg.Hole || !vp.Intersects(Viewport{MinX: seg.To.X, MinY: seg.To.Y, MaxX: seg.To.X, MaxY: seg.To.Y}) {
+			continue
+		}
+		fmt.Fprintf(w, `<circle cx="%s" cy="%s" r="%s"/>`+"\n", num(seg.To.X), num(seg.To.Y), r)
+	}
+	fmt.Fprintln(w, "</g>")
+}
+
+// pathBuilder 将连续的运动段合并为一个SVG路径
+type pathBuilder struct {
+	sb      strings.Builder
+	last    gcode.Point
+	hasLast bool
+}
+
+func (p *pathBuilder) len() int { return p.sb.Len() }
+
+// add 追加运动段
+func (p *pathBuilder) add(seg *gcode.Segment) {
+	if !p.hasLast || p.last.X != seg.From.X || p.last.Y != seg.From.Y {
+		fmt.Fprintf(&p.sb, "M%s %s", num(seg.From.X), num(seg.From.Y))
+	}
+
+	if seg.IsArc() {
+		r := seg.Radius()
+		sweep := seg.Sweep()
+		flag := 0
+		if sweep > 0 {
+			flag = 1
+		}
+		if math.Abs(sweep) >= 2*math.Pi-1e-9 {
+			// 整圆需要拆分为两段圆弧
+			mx := 2*seg.Center.X - seg.From.X
+			my := 2*seg.Center.Y - seg.From.Y
+			fmt.Fprintf(&p.sb, "A%s %s 0 0 %d %s %s", num(r), num(r), flag, num(mx), num(my))
+		}
+		large := 0
+		if math.Abs(sweep) > math.Pi && math.Abs(sweep) < 2*math.Pi-1e-9 {
+			large = 1
+		}
+		fmt.Fprintf(&p.sb, "A%s %s 0 %d %d %s %s", num(r), num(r), large, flag, num(seg.To.X), num(seg.To.Y))
+	} else {
+		fmt.Fprintf(&p.sb, "L%s %s", num(seg.To.X), num(seg.To.Y))
+	}
+
+	p.last = seg.To
+	p.hasLast = true
+}
+
+// flush 输出当前路径
+func (p *pathBuilder) flush(w *bufio.Writer) {
+	if p.sb.Len() == 0 {
+		return
+	}
+	// 线宽不随缩放变化
+	fmt.Fprintf(w, `<path vector-effect="non-scaling-stroke" d="%s"/>`+"\n", p.sb.String())
+	p.sb.Reset()
+	p.hasLast = false
+}
+
+// num 格式化坐标，保留3位小数并去掉多余的0
+func num(v float64) string {
+	s := strconv.FormatFloat(v, 'f', 3, 64)
+	s = strings.TrimRight(s, "0")
+	s = strings.TrimSuffix(s, ".")
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
@@ -12,7 +12,7 @@ func SetupRouter() *gin.Engine {
 	r := gin.Default()
 
 	// 加载模板
-	r.LoadHTMLGlob("templates/*")
+	r.LoadHTMLFiles("templates/index.html")
 
 	// 设置静态文件路径
 	r.Static("/static", "./static")
@@ -27,6 +27,14 @@ func SetupRouter() *gin.Engine {
 	// G-code相关路由
 	r.GET("/", gcodeController.ShowGCodeCompare)
 	r.POST("/gcode/compare", gcodeController.CompareFiles)
+	r.POST("/gcode/lint", gcodeController.LintFile)
+	r.POST("/gcode/render", gcodeController.RenderFile)
+	r.POST("/gcode/canonicalize", gcodeController.CanonicalizeFile)
+	r.GET("/gcode/results/:id", gcodeController.GetResult)
+	r.GET("/gcode/results/:id/:version/render.svg", gcodeController.RenderResult)
+	r.GET("/gcode/results/:id/:version/optimized.nc", gcodeController.OptimizeResult)
+	r.GET("/gcode/results/:id/overlay.png", gcodeController.RenderOverlay)
+	r.GET("/gcode/results/:id/export", gcodeController.ExportResult)
 
 	return r
 }
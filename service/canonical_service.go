@@ -0,0 +1,39 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"ok/gcode"
+	"ok/input"
+	"ok/model"
+)
+
+// Canonicalize 将G-code改写为规范形式，按机器配置的控制器方言解释和输出，profile 为空时使用默认机器配置
+func (s *GCodeService) Canonicalize(w io.Writer, content io.Reader, profile *model.MachineProfile, opts gcode.CanonicalOptions) error {
+	if profile == nil {
+		profile = DefaultMachineProfile()
+	}
+	if err := gcode.Canonicalize(w, content, gcode.NewInterpreterFor(profile), opts); err != nil {
+		return fmt.Errorf("规范化G-code失败: %v", err)
+	}
+	return nil
+}
+
+// CanonicalizeContent 规范化G-code内容，用作比较前的预处理
+// 结果同样按大小转存，原内容在规范化后被释放
+func (s *GCodeService) CanonicalizeContent(content *input.Content, profile *model.MachineProfile, opts gcode.CanonicalOptions) (*input.Content, error) {
+	defer content.Close()
+
+	r, err := content.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	spooler := input.NewSpooler()
+	if err := s.Canonicalize(spooler, r, profile, opts); err != nil {
+		spooler.Discard()
+		return nil, err
+	}
+	return spooler.Content()
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"ok/gcode"
+	"ok/model"
+)
+
+// 注释统计中保留的最大数量
+const (
+	maxMetadata = 200
+	maxMarkers  = 1000
+)
+
+// commentCounter 逐行统计注释，提取CAM元数据和分段标记，并检查 RepRap 校验和
+type commentCounter struct {
+	summary model.CommentSummary
+	lex     gcode.Lexer
+	tok     gcode.Token
+	lineNum int
+}
+
+func newCommentCounter() *commentCounter {
+	return &commentCounter{summary: model.CommentSummary{
+		Metadata: make(map[string]string),
+		Markers:  make([]model.CommentMarker, 0),
+	}}
+}
+
+// line 统计下一行
+func (c *commentCounter) line(line []byte) {
+	c.lineNum++
+	c.lex.Reset(line)
+	for c.lex.Next(&c.tok) {
+		switch c.tok.Kind {
+		case gcode.TokenLineNumber:
+			c.summary.LineNumbers++
+		case gcode.TokenChecksum:
+			c.summary.Checksums++
+			if gcode.Checksum(line[:c.tok.Pos]) != int(c.tok.Value) {
+				c.summary.BadChecksums++
+			}
+		case gcode.TokenComment:
+			c.summary.Count++
+			c.addComment(string(c.tok.Text))
+		}
+	}
+}
+
+// analyzeComments 统计注释，提取CAM元数据和分段标记，并检查 RepRap 校验和
+func (s *GCodeService) analyzeComments(r io.Reader) (model.CommentSummary, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxScanTokenSize)
+
+	c := newCommentCounter()
+	for scanner.Scan() {
+		c.line(scanner.Bytes())
+	}
+	if err := scanner.Err(); err != nil {
+		return c.summary, fmt.Errorf("读取G-code失败: %v", err)
+	}
+	return c.summary, nil
+}
+
+// addComment 识别分段标记和元数据注释
+func (c *commentCounter) addComment(text string) {
+	summary, line := &c.summary, c.lineNum
+	if kind, name, ok := gcode.Marker(text); ok {
+		if len(summary.Markers) >= maxMarkers {
+			summary.Truncated = true
+			return
+		}
+		summary.Markers = append(summary.Markers, model.CommentMarker{Line: line, Kind: kind, Name: name})
+		return
+	}
+	key, value, ok := gcode.ParseComment(text)
+	if !ok {
+		return
+	}
+	if _, exists := summary.Metadata[key]; exists {
+		return
+	}
+	if len(summary.Metadata) >= maxMetadata {
+		summary.Truncated = true
+		return
+	}
+	summary.Metadata[key] = value
+}
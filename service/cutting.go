@@ -0,0 +1,300 @@
+package service
+
+import (
+	"io"
+	"math"
+	"ok/gcode"
+	"ok/model"
+)
+
+// 穿孔和引入引出检测的参数
+const (
+	cuttingTolerance = 0.01 // 判断轮廓闭合、过切沿轮廓切割的距离容差(mm)
+	maxLeadSegments  = 8    // 引入线最多包含的运动段数
+)
+
+// elementOverDists 读取 manifest 中各元素的过切距离 overDist
+func elementOverDists(manifest map[string]interface{}) []float64 {
+	elements, _ := manifest["elements"].([]interface{})
+	dists := make([]float64, len(elements))
+	for i, e := range elements {
+		if m, ok := e.(map[string]interface{}); ok {
+			dists[i], _ = m["overDist"].(float64)
+		}
+	}
+	return dists
+}
+
+// cuttingAnalyzer 按执行顺序统计激光/等离子切割的穿孔、闭合轮廓、引入引出和过切，不是激光设备时不统计
+type cuttingAnalyzer struct {
+	report   model.CuttingReport
+	laser    bool
+	markers  *elementMarkers
+	stats    []model.CuttingStats // 各元素的统计
+	run      []gcode.Segment      // 当前切割路径
+	element  int                  // 当前切割路径所属的元素
+	dwell    float64              // 上一条切割路径结束后的暂停时间
+	detector cutDetector
+}
+
+func newCuttingAnalyzer(profile *model.MachineProfile) *cuttingAnalyzer {
+	return &cuttingAnalyzer{
+		report:   model.CuttingReport{Elements: make([]model.ElementCutting, 0)},
+		laser:    profile.Laser,
+		markers:  newElementMarkers(),
+		detector: cutDetector{laser: true},
+	}
+}
+
+// block 累加一个程序段的运动段
+func (c *cuttingAnalyzer) block(b *gcode.Block, st *gcode.State, segments []gcode.Segment) {
+	if !c.laser {
+		return
+	}
+	current := c.markers.update(b)
+	c.detector.block(b)
+	if t, ok := gcode.DwellTime(b); ok {
+		c.dwell += t
+	}
+	for i := range segments {
+		seg := &segments[i]
+		if !c.detector.cutting(seg) {
+			c.endRun()
+			c.dwell = 0
+			continue
+		}
+		if c.run == nil {
+			c.element = current
+			c.report.Pierces++
+			c.report.PierceTime += c.dwell
+			if c.element >= 0 {
+				stats := c.elementStats(c.element)
+				stats.Pierces++
+				stats.PierceTime += c.dwell
+			}
+		}
+		c.run = append(c.run, *seg)
+		c.dwell = 0
+	}
+}
+
+// elementStats 返回元素的统计，需要时扩展
+func (c *cuttingAnalyzer) elementStats(element int) *model.CuttingStats {
+	for len(c.stats) <= element {
+		c.stats = append(c.stats, model.CuttingStats{})
+	}
+	return &c.stats[element]
+}
+
+// endRun 结束当前切割路径，统计到总数和所属元素
+func (c *cuttingAnalyzer) endRun() {
+	if c.run == nil {
+		return
+	}
+	shape := measureRun(c.run)
+	shape.add(&c.report.CuttingStats)
+	if c.element >= 0 {
+		shape.add(c.elementStats(c.element))
+	}
+	c.run = nil
+}
+
+// finish 结束最后的切割路径，按元素标记和 manifest 中各元素的过切距离汇总
+// 元素按元素标记注释对应 manifest 的 elements，没有元素标记时整个程序只能对应唯一的元素
+func (c *cuttingAnalyzer) finish(overDists []float64) model.CuttingReport {
+	if !c.laser {
+		return c.report
+	}
+	c.endRun()
+	report := c.report
+	names, stats := c.markers.names, c.stats
+
+	count := len(overDists)
+	if len(names) > count {
+		count = len(names)
+	}
+	if len(names) == 0 {
+		// 没有元素标记时整个程序对应唯一的元素
+		if count != 1 {
+			return report
+		}
+		stats = []model.CuttingStats{report.CuttingStats}
+	}
+	for i := 0; i < count; i++ {
+		el := model.ElementCutting{Index: i}
+		if i < len(names) {
+			el.Name = names[i]
+		}
+		if i < len(overDists) {
+			el.OverDist = overDists[i]
+		}
+		if i < len(stats) {
+			el.CuttingStats = stats[i]
+		}
+		report.Elements = append(report.Elements, el)
+	}
+	return report
+}
+
+// analyzeCutting 统计激光/等离子切割的穿孔、闭合轮廓、引入引出和过切
+func (s *GCodeService) analyzeCutting(r io.Reader, profile *model.MachineProfile, overDists []float64) (model.CuttingReport, error) {
+	if profile == nil {
+		profile = DefaultMachineProfile()
+	}
+	c := newCuttingAnalyzer(profile)
+	if !profile.Laser {
+		return c.finish(overDists), nil
+	}
+	_, err := runAnalyzers(r, gcode.NewInterpreterFor(profile), c)
+	return c.finish(overDists), err
+}
+
+// cutDetector 判断运动段是否在切割：激光设备按激光/割炬开关和功率判断，其他设备非快速移动即为切割
+type cutDetector struct {
+	laser    bool
+	powerSet bool // 程序是否设置过功率 S
+}
+
+// block 读取程序段中的功率设置
+func (d *cutDetector) block(b *gcode.Block) {
+	if _, ok := b.Get('S'); ok && !b.HasCode("G4") {
+		d.powerSet = true
+	}
+}
+
+// cutting 运动段是否在切割
+func (d *cutDetector) cutting(seg *gcode.Segment) bool {
+	if seg.IsRapid() {
+		return false
+	}
+	if !d.laser {
+		return true
+	}
+	// 没有设置功率的程序(如等离子)只按 M3/M5 判断割炬开关
+	return seg.SpindleOn && (!d.powerSet || seg.Power > 0)
+}
+
+// runShape 一条切割路径的形状：引入线、闭合轮廓、过切和引出线
+type runShape struct {
+	closed  bool
+	leadIn  float64 // 穿孔点到轮廓起点的长度
+	overcut float64 // 轮廓闭合后沿轮廓继续切割的长度
+	leadOut float64 // 离开轮廓的长度
+}
+
+// add 累加到统计
+func (r runShape) add(stats *model.CuttingStats) {
+	if !r.closed {
+		return
+	}
+	stats.Closed++
+	if r.leadIn > cuttingTolerance {
+		stats.LeadIns++
+		stats.LeadInLength += r.leadIn
+	}
+	if r.overcut > cuttingTolerance {
+		stats.Overcuts++
+		stats.OvercutLength += r.overcut
+	}
+	if r.leadOut > cuttingTolerance {
+		stats.LeadOuts++
+		stats.LeadOutLength += r.leadOut
+	}
+}
+
+// measureRun 识别切割路径中的闭合轮廓
+// 从前 maxLeadSegments 段中依次取起点，找到最先回到该点的位置即为闭合轮廓，起点之前为引入线；
+// 闭合之后仍在轮廓上的运动段为过切，其余为引出线。只比较 XY，忽略只有 Z 移动的段
+func measureRun(segments []gcode.Segment) runShape {
+	var planar []gcode.Segment
+	for i := range segments {
+		if segments[i].PlanarLength() > cuttingTolerance/10 {
+			planar = append(planar, segments[i])
+		}
+	}
+	var shape runShape
+	for k := 0; k < len(planar) && k < maxLeadSegments && !shape.closed; k++ {
+		start := planar[k].From
+		length := 0.0
+		for m := k; m < len(planar); m++ {
+			length += planar[m].PlanarLength()
+			if length <= cuttingTolerance || math.Hypot(planar[m].To.X-start.X, planar[m].To.Y-start.Y) > cuttingTolerance {
+				continue
+			}
+			shape = splitRun(planar, k, m)
+			break
+		}
+	}
+	return shape
+}
+
+// splitRun 按闭合轮廓 planar[k..m] 计算引入线、过切和引出线的长度
+func splitRun(planar []gcode.Segment, k, m int) runShape {
+	shape := runShape{closed: true}
+	for i := 0; i < k; i++ {
+		shape.leadIn += planar[i].PlanarLength()
+	}
+	loop := gcode.Contour{Segments: planar[k : m+1]}
+	points := loop.Points(cuttingTolerance)
+	onLoop := true
+	for i := m + 1; i < len(planar); i++ {
+		seg := &planar[i]
+		if onLoop {
+			for _, p := range seg.Points(cuttingTolerance) {
+				if polylineDistance(p, points) > cuttingTolerance {
+					onLoop = false
+					break
+				}
+			}
+		}
+		if onLoop {
+			shape.overcut += seg.PlanarLength()
+		} else {
+			shape.leadOut += seg.PlanarLength()
+		}
+	}
+	return shape
+}
+
+// compareCutting 比较A/B两个版本的穿孔和引入引出，元素按序号对应
+func (s *GCodeService) compareCutting(a, b model.CuttingReport) model.CuttingChange {
+	change := model.CuttingChange{
+		PiercesDelta:    b.Pierces - a.Pierces,
+		PierceTimeDelta: b.PierceTime - a.PierceTime,
+		Elements:        make([]model.ElementCuttingChange, 0),
+	}
+	change.Same = sameCutting(a.CuttingStats, b.CuttingStats)
+
+	count := len(a.Elements)
+	if len(b.Elements) > count {
+		count = len(b.Elements)
+	}
+	for i := 0; i < count; i++ {
+		el := model.ElementCuttingChange{
+			Index: i,
+			A:     model.ElementCutting{Index: i},
+			B:     model.ElementCutting{Index: i},
+		}
+		if i < len(a.Elements) {
+			el.A = a.Elements[i]
+		}
+		if i < len(b.Elements) {
+			el.B = b.Elements[i]
+		}
+		el.Different = !sameCutting(el.A.CuttingStats, el.B.CuttingStats)
+		if el.Different {
+			change.Same = false
+		}
+		change.Elements = append(change.Elements, el)
+	}
+	return change
+}
+
+// sameCutting 两个统计是否相同，长度和时间按 0.001 比较
+func sameCutting(a, b model.CuttingStats) bool {
+	near := func(x, y float64) bool { return math.Abs(x-y) <= 0.001 }
+	return a.Pierces == b.Pierces && a.Closed == b.Closed &&
+		a.LeadIns == b.LeadIns && a.LeadOuts == b.LeadOuts && a.Overcuts == b.Overcuts &&
+		near(a.PierceTime, b.PierceTime) && near(a.LeadInLength, b.LeadInLength) &&
+		near(a.LeadOutLength, b.LeadOutLength) && near(a.OvercutLength, b.OvercutLength)
+}
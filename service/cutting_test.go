@@ -0,0 +1,92 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+// 从 (0,5) 开始逆时针切割 10x10 的正方形
+const cutSquare = "G1 X0 Y0 F1000\nX10\nY10\nX0\nY5\n"
+
+func TestAnalyzeCutting(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		laser   bool
+		pierces int
+		closed  int
+		leadIn  float64 // 引入线总长，0 表示没有
+		overcut float64
+		leadOut float64
+		dwell   float64 // 穿孔前的暂停时间
+	}{
+		{"没有引入线", "G0 X0 Y5\nM3 S500\n" + cutSquare + "M5\n", true, 1, 1, 0, 0, 0, 0},
+		{"引入线", "G0 X2 Y5\nM3 S500\nG1 X0 Y5 F1000\n" + cutSquare + "M5\n", true, 1, 1, 2, 0, 0, 0},
+		{"过切和引出线", "G0 X2 Y5\nM3 S500\nG1 X0 Y5 F1000\n" + cutSquare + "G1 Y3\nX-2\nM5\n", true, 1, 1, 2, 2, 2, 0},
+		{"穿孔暂停", "G0 X0 Y5\nG4 P0.5\nM3 S500\n" + cutSquare + "M5\n", true, 1, 1, 0, 0, 0, 0.5},
+		{"开放路径", "G0 X0 Y0\nM3 S500\nG1 X10 F1000\nG1 Y10\nM5\n", true, 1, 0, 0, 0, 0, 0},
+		{"快速移动分隔两次穿孔", "G0 X0 Y5\nM3 S500\n" + cutSquare + "G0 X20 Y5\nG1 X30 Y5\nM5\n", true, 2, 1, 0, 0, 0, 0},
+		{"功率为0不是切割", "G0 X0 Y5\nM3 S0\n" + cutSquare + "M5\n", true, 0, 0, 0, 0, 0, 0},
+		{"不是激光设备时不统计", "G0 X0 Y5\nM3 S500\n" + cutSquare + "M5\n", false, 0, 0, 0, 0, 0, 0},
+	}
+	s := NewGCodeService()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile := DefaultMachineProfile()
+			profile.Laser = tt.laser
+			report, err := s.analyzeCutting(strings.NewReader(tt.src), profile, nil)
+			if err != nil {
+				t.Fatalf("analyzeCutting: %v", err)
+			}
+			got := fmt.Sprintf("pierces=%d closed=%d leadIn=%.3f overcut=%.3f leadOut=%.3f dwell=%.3f",
+				report.Pierces, report.Closed, report.LeadInLength, report.OvercutLength, report.LeadOutLength, report.PierceTime)
+			want := fmt.Sprintf("pierces=%d closed=%d leadIn=%.3f overcut=%.3f leadOut=%.3f dwell=%.3f",
+				tt.pierces, tt.closed, tt.leadIn, tt.overcut, tt.leadOut, tt.dwell)
+			if got != want {
+				t.Errorf("got  %s\nwant %s", got, want)
+			}
+		})
+	}
+}
+
+func TestAnalyzeCuttingElements(t *testing.T) {
+	src := "; element: A\nG0 X2 Y5\nM3 S500\nG1 X0 Y5 F1000\n" + cutSquare + "M5\n" +
+		"; element: B\nG0 X0 Y5\nM3 S500\n" + cutSquare + "M5\nG0 X0 Y5\nM3 S500\n" + cutSquare + "M5\n"
+	report, err := NewGCodeService().analyzeCutting(strings.NewReader(src), nil, []float64{0, 0.5, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, el := range report.Elements {
+		got = append(got, fmt.Sprintf("%d %s over=%g pierces=%d leadIns=%d", el.Index, el.Name, el.OverDist, el.Pierces, el.LeadIns))
+	}
+	// manifest 中第三个元素在 G-code 中没有标记
+	want := []string{"0 A over=0 pierces=1 leadIns=1", "1 B over=0.5 pierces=2 leadIns=0", "2  over=1 pierces=0 leadIns=0"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Elements = %v, want %v", got, want)
+	}
+}
+
+func TestCompareCutting(t *testing.T) {
+	s := NewGCodeService()
+	a, err := s.analyzeCutting(strings.NewReader("G0 X0 Y5\nM3 S500\n"+cutSquare+"M5\n"), nil, []float64{0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := s.analyzeCutting(strings.NewReader("G0 X2 Y5\nG4 P0.2\nM3 S500\nG1 X0 Y5 F1000\n"+cutSquare+"M5\n"), nil, []float64{0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	change := s.compareCutting(a, b)
+	if change.Same || change.PiercesDelta != 0 || math.Abs(change.PierceTimeDelta-0.2) > 1e-9 {
+		t.Errorf("change = %+v", change)
+	}
+	if len(change.Elements) != 1 || !change.Elements[0].Different {
+		t.Errorf("Elements = %+v", change.Elements)
+	}
+	if !s.compareCutting(a, a).Same {
+		t.Error("相同的切割统计 Same = false")
+	}
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"io"
+	"math"
+	"ok/gcode"
+	"ok/model"
+)
+
+// maxViolations 最多保留的超限记录数量
+const maxViolations = 1000
+
+// envelopeBuilder 包络累加器
+type envelopeBuilder struct {
+	min, max gcode.Point
+	empty    bool
+}
+
+func newEnvelopeBuilder() *envelopeBuilder {
+	return &envelopeBuilder{
+		min:   gcode.Point{X: math.MaxFloat64, Y: math.MaxFloat64, Z: math.MaxFloat64},
+		max:   gcode.Point{X: -math.MaxFloat64, Y: -math.MaxFloat64, Z: -math.MaxFloat64},
+		empty: true,
+	}
+}
+
+// add 扩展包络
+func (e *envelopeBuilder) add(min, max gcode.Point) {
+	e.min = gcode.Point{X: math.Min(e.min.X, min.X), Y: math.Min(e.min.Y, min.Y), Z: math.Min(e.min.Z, min.Z)}
+	e.max = gcode.Point{X: math.Max(e.max.X, max.X), Y: math.Max(e.max.Y, max.Y), Z: math.Max(e.max.Z, max.Z)}
+	e.empty = false
+}
+
+// envelope 生成包络结果
+func (e *envelopeBuilder) envelope() model.Envelope {
+	if e.empty {
+		return model.Envelope{Empty: true}
+	}
+	return model.Envelope{
+		X: model.AxisRange{Min: e.min.X, Max: e.max.X},
+		Y: model.AxisRange{Min: e.min.Y, Max: e.max.Y},
+		Z: model.AxisRange{Min: e.min.Z, Max: e.max.Z},
+	}
+}
+
+// envelopeAnalyzer 按执行顺序累加工件坐标和机床坐标下的包络，并按机器行程检查软限位
+type envelopeAnalyzer struct {
+	report        model.EnvelopeReport
+	work, machine *envelopeBuilder
+	usedSystems   map[int]bool
+	usedLengths   map[float64]bool
+}
+
+func newEnvelopeAnalyzer(profile *model.MachineProfile) *envelopeAnalyzer {
+	return &envelopeAnalyzer{
+		report: model.EnvelopeReport{
+			Limits:       profile.Limits(),
+			Violations:   make([]model.LimitViolation, 0),
+			CoordSystems: make([]string, 0),
+			ToolLengths:  make([]float64, 0),
+		},
+		work:        newEnvelopeBuilder(),
+		machine:     newEnvelopeBuilder(),
+		usedSystems: map[int]bool{},
+		usedLengths: map[float64]bool{},
+	}
+}
+
+// block 累加一个程序段的运动段，st为该段执行后的状态
+func (e *envelopeAnalyzer) block(b *gcode.Block, st *gcode.State, segments []gcode.Segment) {
+	report := &e.report
+	if len(segments) > 0 {
+		if !e.usedSystems[st.CoordSystem] {
+			e.usedSystems[st.CoordSystem] = true
+			report.CoordSystems = append(report.CoordSystems, gcode.CoordSystems[st.CoordSystem])
+		}
+		if length := st.ToolLength; length != 0 && !e.usedLengths[length] {
+			e.usedLengths[length] = true
+			report.ToolLengths = append(report.ToolLengths, length)
+		}
+	}
+	for _, seg := range segments {
+		min, max := seg.Bounds()
+		e.work.add(min, max)
+		min, max = addOffset(min, seg.Offset), addOffset(max, seg.Offset)
+		e.machine.add(min, max)
+
+		violations := report.Limits.Check(model.Offset(min), model.Offset(max), 0)
+		for _, v := range violations {
+			report.ViolationCount++
+			if len(report.Violations) < maxViolations {
+				v.Line = b.Line
+				report.Violations = append(report.Violations, v)
+			}
+		}
+	}
+}
+
+// finish 生成包络结果
+func (e *envelopeAnalyzer) finish() model.EnvelopeReport {
+	e.report.Work = e.work.envelope()
+	e.report.Machine = e.machine.envelope()
+	e.report.WithinLimits = e.report.ViolationCount == 0
+	return e.report
+}
+
+// analyzeEnvelope 计算工件坐标和机床坐标下的加工包络，并按机器行程检查软限位
+// 机床坐标按每段运动时生效的工件坐标系、G92 偏移和刀具长度补偿换算
+func (s *GCodeService) analyzeEnvelope(r io.Reader, profile *model.MachineProfile) (model.EnvelopeReport, error) {
+	if profile == nil {
+		profile = DefaultMachineProfile()
+	}
+	e := newEnvelopeAnalyzer(profile)
+	if _, err := runAnalyzers(r, gcode.NewInterpreterFor(profile), e); err != nil {
+		return e.report, err
+	}
+	return e.finish(), nil
+}
+
+// compareEnvelopes 比较A/B两个版本的包络
+func (s *GCodeService) compareEnvelopes(a, b model.EnvelopeReport) model.EnvelopeChange {
+	axisChange := func(ra, rb model.AxisRange) model.AxisRangeChange {
+		return model.AxisRangeChange{
+			MinDelta:  rb.Min - ra.Min,
+			MaxDelta:  rb.Max - ra.Max,
+			SizeDelta: (rb.Max - rb.Min) - (ra.Max - ra.Min),
+		}
+	}
+
+	change := model.EnvelopeChange{
+		X:     axisChange(a.Work.X, b.Work.X),
+		Y:     axisChange(a.Work.Y, b.Work.Y),
+		Z:     axisChange(a.Work.Z, b.Work.Z),
+		AFits: a.WithinLimits,
+		BFits: b.WithinLimits,
+	}
+	change.Same = a.Work == b.Work
+	return change
+}
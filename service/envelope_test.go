@@ -0,0 +1,88 @@
+package service
+
+import (
+	"fmt"
+	"ok/model"
+	"strings"
+	"testing"
+)
+
+func TestAnalyzeEnvelope(t *testing.T) {
+	tests := []struct {
+		name       string
+		src        string
+		work       model.Envelope
+		violations []string // 轴和超限的机床坐标
+		systems    []string
+	}{
+		{
+			name:    "行程内",
+			src:     "G0 X10 Y10\nG1 X90 Y50 F100\n",
+			work:    model.Envelope{X: model.AxisRange{Max: 90}, Y: model.AxisRange{Max: 50}},
+			systems: []string{"G54"},
+		},
+		{
+			name:       "超出X行程",
+			src:        "G0 X10 Y10\nG1 X120 F100\n",
+			work:       model.Envelope{X: model.AxisRange{Max: 120}, Y: model.AxisRange{Max: 10}},
+			violations: []string{"2 X 120"},
+			systems:    []string{"G54"},
+		},
+		{
+			name:       "工件坐标系偏移后超出",
+			src:        "G10 L2 P2 X50 Y0\nG55 G0 X60 Y10\n",
+			work:       model.Envelope{X: model.AxisRange{Min: -50, Max: 60}, Y: model.AxisRange{Max: 10}},
+			violations: []string{"2 X 110"},
+			systems:    []string{"G55"},
+		},
+		{
+			name:       "刀具长度补偿后超出Z行程",
+			src:        "G43.1 Z10\nG0 Z-5\n",
+			work:       model.Envelope{Z: model.AxisRange{Min: -10, Max: -5}}, // 刀长补偿后机床原点的工件 Z 为 -10
+			violations: []string{"2 Z 5"},
+			systems:    []string{"G54"},
+		},
+	}
+
+	s := NewGCodeService()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile := DefaultMachineProfile()
+			profile.BedWidth, profile.BedHeight = 100, 100
+			profile.Travel.Z = &model.AxisRange{Min: -50, Max: 0}
+			report, err := s.analyzeEnvelope(strings.NewReader(tt.src), profile)
+			if err != nil {
+				t.Fatalf("analyzeEnvelope: %v", err)
+			}
+			if report.Work != tt.work {
+				t.Errorf("Work = %+v, want %+v", report.Work, tt.work)
+			}
+			var violations []string
+			for _, v := range report.Violations {
+				violations = append(violations, fmt.Sprintf("%d %s %g", v.Line, v.Axis, v.Value))
+			}
+			if fmt.Sprint(violations) != fmt.Sprint(tt.violations) {
+				t.Errorf("Violations = %v, want %v", violations, tt.violations)
+			}
+			if report.WithinLimits != (len(tt.violations) == 0) || report.ViolationCount != len(tt.violations) {
+				t.Errorf("WithinLimits = %v, ViolationCount = %d", report.WithinLimits, report.ViolationCount)
+			}
+			if fmt.Sprint(report.CoordSystems) != fmt.Sprint(tt.systems) {
+				t.Errorf("CoordSystems = %v, want %v", report.CoordSystems, tt.systems)
+			}
+		})
+	}
+}
+
+func TestCompareEnvelopes(t *testing.T) {
+	a := model.EnvelopeReport{Work: model.Envelope{X: model.AxisRange{Min: 0, Max: 100}}, WithinLimits: true}
+	b := model.EnvelopeReport{Work: model.Envelope{X: model.AxisRange{Min: -10, Max: 120}}}
+	change := NewGCodeService().compareEnvelopes(a, b)
+	want := model.AxisRangeChange{MinDelta: -10, MaxDelta: 20, SizeDelta: 30}
+	if change.X != want || change.Same || !change.AFits || change.BFits {
+		t.Errorf("change = %+v", change)
+	}
+	if !NewGCodeService().compareEnvelopes(a, a).Same {
+		t.Error("相同的包络 Same = false")
+	}
+}
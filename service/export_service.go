@@ -0,0 +1,148 @@
+package service
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"image/png"
+	"io"
+	"ok/export"
+	"ok/gcode"
+	"ok/input"
+	"ok/model"
+	"ok/render"
+	"strings"
+)
+
+// reportPreviewWidth 报告中预览图的宽度(px)
+const reportPreviewWidth = 600
+
+// maxDiffContentSize 生成统一差异时每个文件的最大大小，差异算法需要将整个文件读入内存
+const maxDiffContentSize = 256 << 20 // 256MB
+
+// ExportHTML 将保存的比较结果导出为独立的HTML报告
+func (s *GCodeService) ExportHTML(w io.Writer, stored *StoredResult) error {
+	previews, err := s.reportPreviews(stored)
+	if err != nil {
+		return err
+	}
+	return export.HTML(w, stored.Result, previews)
+}
+
+// ExportCSV 将保存的比较结果导出为CSV
+// table为空时导出所有表格的zip压缩包，否则只导出指定表格
+func (s *GCodeService) ExportCSV(w io.Writer, stored *StoredResult, table string) error {
+	tables := export.Tables(stored.Result)
+	if table == "" {
+		return export.CSVZip(w, tables)
+	}
+	t, ok := export.FindTable(tables, table)
+	if !ok {
+		return fmt.Errorf("未知的表格: %s", table)
+	}
+	return export.CSV(w, t)
+}
+
+// ExportXLSX 将保存的比较结果导出为多工作表的Excel工作簿
+func (s *GCodeService) ExportXLSX(w io.Writer, stored *StoredResult) error {
+	return export.XLSX(w, export.Tables(stored.Result))
+}
+
+// ExportMarkdown 将保存的比较结果导出为Markdown摘要
+func (s *GCodeService) ExportMarkdown(w io.Writer, stored *StoredResult) error {
+	return export.Markdown(w, stored.Result)
+}
+
+// ExportUnifiedDiff 将两个版本的G-code导出为统一差异格式
+func (s *GCodeService) ExportUnifiedDiff(w io.Writer, stored *StoredResult, context int) error {
+	nameA := "a/" + gcodeFileName(stored.Result.File1Name, "a.nc")
+	nameB := "b/" + gcodeFileName(stored.Result.File2Name, "b.nc")
+	contentA, err := diffContent(stored.GCodeA)
+	if err != nil {
+		return fmt.Errorf("G-code A: %v", err)
+	}
+	contentB, err := diffContent(stored.GCodeB)
+	if err != nil {
+		return fmt.Errorf("G-code B: %v", err)
+	}
+	return export.Unified(w, nameA, nameB, contentA, contentB, context)
+}
+
+// diffContent 读取生成差异所需的完整内容
+func diffContent(content *input.Content) ([]byte, error) {
+	if content.Size() > maxDiffContentSize {
+		return nil, fmt.Errorf("文件过大(%d MB)，超过 %d MB 的文件不能生成统一差异",
+			content.Size()>>20, maxDiffContentSize>>20)
+	}
+	return content.Bytes()
+}
+
+// ExportListing 输出规范化的G-code列表，用于 git textconv
+func (s *GCodeService) ExportListing(w io.Writer, gcode io.Reader, name string) error {
+	return export.Listing(w, gcode, name)
+}
+
+// gcodeFileName 从 "G-code文件名 / Manifest文件名" 格式的显示名称中取出G-code文件名
+func gcodeFileName(displayName, fallback string) string {
+	name, _, _ := strings.Cut(displayName, " / ")
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return fallback
+	}
+	return name
+}
+
+// reportPreviews 生成报告中的路径预览图
+func (s *GCodeService) reportPreviews(stored *StoredResult) (export.Previews, error) {
+	var previews export.Previews
+
+	segmentsA, err := contentSegments(stored.GCodeA, stored.ProfileA)
+	if err != nil {
+		return previews, fmt.Errorf("解析G-code A失败: %v", err)
+	}
+	segmentsB, err := contentSegments(stored.GCodeB, stored.ProfileB)
+	if err != nil {
+		return previews, fmt.Errorf("解析G-code B失败: %v", err)
+	}
+
+	// 两个版本使用相同的显示区域，便于对照
+	vp := render.Bounds(segmentsA, segmentsB).Pad(0.02)
+	opts := render.Options{Width: reportPreviewWidth, Viewport: &vp}
+
+	buf := new(bytes.Buffer)
+	if err := render.SVG(buf, segmentsA, opts); err != nil {
+		return previews, err
+	}
+	previews.A = dataURI("image/svg+xml", buf.Bytes())
+
+	buf.Reset()
+	if err := render.SVG(buf, segmentsB, opts); err != nil {
+		return previews, err
+	}
+	previews.B = dataURI("image/svg+xml", buf.Bytes())
+
+	buf.Reset()
+	img, _ := render.Overlay(segmentsA, segmentsB, render.DefaultOverlayOptions())
+	if err := png.Encode(buf, img); err != nil {
+		return previews, fmt.Errorf("生成叠加图失败: %v", err)
+	}
+	previews.Overlay = dataURI("image/png", buf.Bytes())
+
+	return previews, nil
+}
+
+// contentSegments 打开内容并按机器配置读取所有运动段
+func contentSegments(content *input.Content, profile *model.MachineProfile) ([]gcode.Segment, error) {
+	r, err := content.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return readSegments(r, profile)
+}
+
+// dataURI 生成内嵌图片使用的 data URI
+func dataURI(mimeType string, data []byte) template.URL {
+	return template.URL("data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data))
+}
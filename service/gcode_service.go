@@ -2,60 +2,78 @@ package service
 
 import (
 	"bufio"
-	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
+	"log"
 	"math"
+	"ok/gcode"
+	"ok/input"
 	"ok/model"
 	"reflect"
-	"regexp"
-	"strconv"
-	"strings"
 	"sync"
 )
 
-type GCodeService struct{}
-
-// GCommand G代码命令结构
-type GCommand struct {
-	Type    string // G0/G1/G2/G3
-	X, Y, Z float64
-	F       float64 // 速度
-	Raw     string  // 原始命令
+type GCodeService struct {
+	results *resultStore // 最近的比较结果
 }
 
 // MachineParams 机器参数结构体
 type MachineParams struct {
-	RapidSpeed   float64 // G0快速移动速度 (mm/min)
-	WorkingSpeed float64 // G1工作速度 (mm/min)
-	RapidAccel   float64 // G0加速度 (mm/s²)
-	WorkingAccel float64 // G1加速度 (mm/s²)
+	RapidSpeed   float64       // G0快速移动速度 (mm/min)
+	WorkingSpeed float64       // G1工作速度 (mm/min)
+	RapidAccel   float64       // G0加速度 (mm/s²)
+	WorkingAccel float64       // G1加速度 (mm/s²)
+	Kerfs        []ElementKerf // manifest 中各元素声明的切缝补偿
+	OverDists    []float64     // manifest 中各元素的过切距离
 }
 
 func NewGCodeService() *GCodeService {
-	return &GCodeService{}
+	return &GCodeService{
+		results: newResultStore(),
+	}
 }
 
 // CompareVersions 比较两个版本的文件
+// profile 为可选的机器配置，为空时从各自的manifest中读取。
+// G-code内容交由保存的结果持有，结果被淘汰时释放；比较失败时立即释放
 func (s *GCodeService) CompareVersions(
-	gcodeA, manifestA,
-	gcodeB, manifestB []byte,
-) (*model.CompareResult, error) {
-	// 从manifest中解析机器参数
-	paramsA, err := s.extractMachineParams(manifestA)
+	gcodeA *input.Content, manifestA []byte,
+	gcodeB *input.Content, manifestB []byte,
+	profile []byte,
+) (result *model.CompareResult, err error) {
+	defer func() {
+		if err != nil {
+			gcodeA.Close()
+			gcodeB.Close()
+		}
+	}()
+
+	profileA, err := s.LoadMachineProfile(manifestA, profile)
+	if err != nil {
+		return nil, fmt.Errorf("加载机器配置A失败: %v", err)
+	}
+
+	profileB, err := s.LoadMachineProfile(manifestB, profile)
+	if err != nil {
+		return nil, fmt.Errorf("加载机器配置B失败: %v", err)
+	}
+
+	// 从manifest中解析机器参数，未指定的使用控制器方言的默认值
+	paramsA, err := s.extractMachineParams(manifestA, profileA)
 	if err != nil {
 		return nil, fmt.Errorf("解析manifest A参数失败: %v", err)
 	}
 
-	paramsB, err := s.extractMachineParams(manifestB)
+	paramsB, err := s.extractMachineParams(manifestB, profileB)
 	if err != nil {
 		return nil, fmt.Errorf("解析manifest B参数失败: %v", err)
 	}
 
-	result := &model.CompareResult{}
+	result = &model.CompareResult{}
 
 	// 比较G-code文件
-	gcodeDiff, err := s.compareGCode(gcodeA, gcodeB, paramsA, paramsB)
+	gcodeDiff, err := s.compareGCode(gcodeA, gcodeB, paramsA, paramsB, profileA, profileB)
 	if err != nil {
 		return nil, fmt.Errorf("比较G-code文件失败: %v", err)
 	}
@@ -68,20 +86,68 @@ func (s *GCodeService) CompareVersions(
 	}
 	result.ManifestDiff = manifestDiff
 
+	// 保存结果，供后续渲染和导出
+	result.ID = s.results.save(&StoredResult{
+		Result:    result,
+		GCodeA:    gcodeA,
+		GCodeB:    gcodeB,
+		ManifestA: manifestA,
+		ManifestB: manifestB,
+		ProfileA:  profileA,
+		ProfileB:  profileB,
+	})
+
 	return result, nil
 }
 
+// AnalyzeGCode 使用默认机器参数分析单个G-code文件
+func (s *GCodeService) AnalyzeGCode(r io.Reader) (model.GCodeAnalysis, error) {
+	return s.analyzeGCode(r, nil, nil)
+}
+
+// GetResult 获取保存的比较结果
+func (s *GCodeService) GetResult(id string) (*StoredResult, bool) {
+	return s.results.get(id)
+}
+
 // compareGCode 比较G-code文件
-func (s *GCodeService) compareGCode(contentA, contentB []byte, paramsA, paramsB *MachineParams) (*model.GCodeDiff, error) {
+// 每个文件只执行一次解释器，路径、包络、刀具、孔、穿孔、空行程和元素轮廓的分析共用执行结果；
+// 逐行比较同时统计两个文件的注释。三者各自流式读取内容，并行执行
+func (s *GCodeService) compareGCode(contentA, contentB *input.Content, paramsA, paramsB *MachineParams, profileA, profileB *model.MachineProfile) (*model.GCodeDiff, error) {
 	// 创建差异结果
 	diff := &model.GCodeDiff{
 		Statistics:  model.GCodeStatistics{},
 		LineChanges: make([]model.GCodeChange, 0),
 	}
 
-	// 分析两个文件
-	analysisA := s.analyzeGCode(contentA, paramsA)
-	analysisB := s.analyzeGCode(contentB, paramsB)
+	// 有元素启用切缝补偿时按元素比较轮廓
+	kerf := kerfEnabled(paramsA) || kerfEnabled(paramsB)
+	var (
+		analysisA, analysisB model.GCodeAnalysis
+		elementsA, elementsB *elementPaths
+		commentsA, commentsB model.CommentSummary
+	)
+	tasks := []func() error{
+		// 分析两个文件
+		func() (err error) {
+			analysisA, elementsA, err = s.analyzeFile(contentA, paramsA, profileA, kerf)
+			return wrapError("分析G-code A失败", err)
+		},
+		func() (err error) {
+			analysisB, elementsB, err = s.analyzeFile(contentB, paramsB, profileB, kerf)
+			return wrapError("分析G-code B失败", err)
+		},
+		// 逐行比较并统计注释
+		func() (err error) {
+			commentsA, commentsB, err = s.diffContent(contentA, contentB, diff)
+			return wrapError("逐行比较失败", err)
+		},
+	}
+	if err := runParallel(tasks); err != nil {
+		return nil, err
+	}
+	analysisA.Comments = commentsA
+	analysisB.Comments = commentsB
 
 	// 设置两个文件的分析结果
 	diff.AnalysisA = analysisA
@@ -93,40 +159,138 @@ func (s *GCodeService) compareGCode(contentA, contentB []byte, paramsA, paramsB
 		AreaChange:       s.calculateChangeRate(analysisA.Path.Area.Size, analysisB.Path.Area.Size),
 		SpeedChange:      s.calculateChangeRate(analysisA.Speed.AvgSpeed, analysisB.Speed.AvgSpeed),
 		CommandChange:    s.calculateCommandChange(analysisA.Commands, analysisB.Commands),
+		Envelope:         s.compareEnvelopes(analysisA.Envelope, analysisB.Envelope),
+		Tooling:          s.compareTooling(analysisA.Tooling, analysisB.Tooling),
+		Holes:            s.compareHoles(analysisA.Holes, analysisB.Holes),
+		Kerf:             s.compareKerf(elementsA, elementsB, paramsA, paramsB),
+		Cutting:          s.compareCutting(analysisA.Cutting, analysisB.Cutting),
+	}
+
+	return diff, nil
+}
+
+// blockAnalyzer 按执行顺序接收程序段的分析，多个分析可以共用一次解释器执行
+type blockAnalyzer interface {
+	// block 累加一个程序段，st为该段执行后的状态
+	block(b *gcode.Block, st *gcode.State, segments []gcode.Segment)
+}
+
+// runAnalyzers 执行一次程序，每个程序段依次交给各个分析
+func runAnalyzers(r io.Reader, interp *gcode.Interpreter, analyzers ...blockAnalyzer) (*gcode.Program, error) {
+	return gcode.RunProgram(r, interp, func(b *gcode.Block, segments []gcode.Segment) error {
+		for _, a := range analyzers {
+			a.block(b, &interp.State, segments)
+		}
+		return nil
+	})
+}
+
+// analyzeFile 打开内容并执行一次程序，同时分析路径、包络、刀具、孔、穿孔和空行程
+// kerf 为 true 时同时按元素分组运动段
+func (s *GCodeService) analyzeFile(content *input.Content, params *MachineParams, profile *model.MachineProfile, kerf bool) (model.GCodeAnalysis, *elementPaths, error) {
+	analysis := model.GCodeAnalysis{}
+	r, err := content.Open()
+	if err != nil {
+		return analysis, nil, err
+	}
+	defer r.Close()
+	if profile == nil {
+		profile = DefaultMachineProfile()
+	}
+	if params == nil {
+		params = defaultMachineParams()
+	}
+
+	interp := gcode.NewInterpreterFor(profile)
+	path := newPathAnalyzer(&analysis, params)
+	envelope := newEnvelopeAnalyzer(profile)
+	tooling := newToolingBuilder(params)
+	holes := newHoleAnalyzer()
+	cutting := newCuttingAnalyzer(profile)
+	travel := newTravelPlanner(interp, profile, false)
+	analyzers := []blockAnalyzer{path, envelope, tooling, holes, cutting, travel}
+	var elements *elementReader
+	if kerf {
+		elements = newElementReader()
+		analyzers = append(analyzers, elements)
 	}
 
+	prog, err := runAnalyzers(r, interp, analyzers...)
+	if err != nil {
+		return analysis, nil, err
+	}
+	analysis.Program = programExpansion(prog)
+	path.finish()
+	analysis.Envelope = envelope.finish()
+	analysis.Tooling = tooling.finish(interp)
+	analysis.Holes = holes.report
+	analysis.Cutting = cutting.finish(params.OverDists)
+	analysis.Travel = travel.finish().report(len(params.OverDists), params.RapidSpeed)
+	if elements != nil {
+		return analysis, elements.finish(), nil
+	}
+	return analysis, nil, nil
+}
+
+// programExpansion 汇总子程序和循环的展开情况
+func programExpansion(prog *gcode.Program) model.ProgramExpansion {
+	expansion := model.ProgramExpansion{
+		Expanded:      prog.Expanded,
+		SourceLines:   prog.SourceLines,
+		ExecutedLines: prog.ExecutedLines,
+		Calls:         prog.Calls,
+		Loops:         prog.Loops,
+		MaxDepth:      prog.MaxDepth,
+		Unresolved:    make([]model.SubprogramCall, 0, len(prog.Unresolved)),
+	}
+	for _, c := range prog.Unresolved {
+		expansion.Unresolved = append(expansion.Unresolved, model.SubprogramCall{Name: c.Name, Line: c.Line})
+	}
+	return expansion
+}
+
+// diffContent 打开两个内容并逐行比较，比较时同时统计两个文件的注释
+func (s *GCodeService) diffContent(contentA, contentB *input.Content, diff *model.GCodeDiff) (commentsA, commentsB model.CommentSummary, err error) {
+	rA, err := contentA.Open()
+	if err != nil {
+		return commentsA, commentsB, err
+	}
+	defer rA.Close()
+	rB, err := contentB.Open()
+	if err != nil {
+		return commentsA, commentsB, err
+	}
+	defer rB.Close()
+	a, b := newCommentCounter(), newCommentCounter()
+	err = s.diffLines(rA, rB, diff, a, b)
+	return a.summary, b.summary, err
+}
+
+// diffLines 按行号逐行比较两个文件，只保存前1000处差异，读到的每一行同时交给 commentsA、commentsB 统计注释
+func (s *GCodeService) diffLines(rA, rB io.Reader, diff *model.GCodeDiff, commentsA, commentsB *commentCounter) error {
 	// 使用 bufio.Scanner 按行读取
-	scannerA := bufio.NewScanner(bytes.NewReader(contentA))
-	scannerB := bufio.NewScanner(bytes.NewReader(contentB))
+	scannerA := bufio.NewScanner(rA)
+	scannerB := bufio.NewScanner(rB)
 
 	// 增加缓冲区大小，处理长行
-	const maxScanTokenSize = 1024 * 1024 // 1MB
-	bufA := make([]byte, maxScanTokenSize)
-	bufB := make([]byte, maxScanTokenSize)
-	scannerA.Buffer(bufA, maxScanTokenSize)
-	scannerB.Buffer(bufB, maxScanTokenSize)
+	scannerA.Buffer(make([]byte, 64*1024), maxScanTokenSize)
+	scannerB.Buffer(make([]byte, 64*1024), maxScanTokenSize)
 
 	// 计数器
 	lineNum := 0
-	totalLines := 0
 	changedLines := 0
 	addedLines := 0
 	removedLines := 0
 
-	// 先计算总行数
-	for scannerB.Scan() {
-		totalLines++
-	}
-	scannerB = bufio.NewScanner(bytes.NewReader(contentB))
-	scannerB.Buffer(bufB, maxScanTokenSize)
-
 	// 比较文件
 	for scannerB.Scan() {
 		lineNum++
+		commentsB.line(scannerB.Bytes())
 		lineB := scannerB.Text()
 
 		// 如果A还有行，读取并比较
 		if scannerA.Scan() {
+			commentsA.line(scannerA.Bytes())
 			lineA := scannerA.Text()
 			if lineA != lineB {
 				changedLines++
@@ -151,11 +315,17 @@ func (s *GCodeService) compareGCode(contentA, contentB []byte, paramsA, paramsB
 			}
 		}
 	}
+	if err := scannerB.Err(); err != nil {
+		return fmt.Errorf("读取G-code B失败: %v", err)
+	}
+	// B的行数即为总行数
+	totalLines := lineNum
 
 	// 检查A是否还有剩余行
 	for scannerA.Scan() {
 		lineNum++
 		removedLines++
+		commentsA.line(scannerA.Bytes())
 		if len(diff.LineChanges) < 1000 {
 			diff.LineChanges = append(diff.LineChanges, model.GCodeChange{
 				LineNum: lineNum,
@@ -164,6 +334,9 @@ func (s *GCodeService) compareGCode(contentA, contentB []byte, paramsA, paramsB
 			})
 		}
 	}
+	if err := scannerA.Err(); err != nil {
+		return fmt.Errorf("读取G-code A失败: %v", err)
+	}
 
 	// 设置统计信息
 	diff.Statistics.TotalLines = totalLines
@@ -181,7 +354,35 @@ func (s *GCodeService) compareGCode(contentA, contentB []byte, paramsA, paramsB
 		})
 	}
 
-	return diff, nil
+	return nil
+}
+
+// runParallel 并行执行任务，返回第一个错误
+func runParallel(tasks []func() error) error {
+	errs := make([]error, len(tasks))
+	var wg sync.WaitGroup
+	for i, task := range tasks {
+		wg.Add(1)
+		go func(i int, task func() error) {
+			defer wg.Done()
+			errs[i] = task()
+		}(i, task)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// wrapError 为错误添加说明，err为nil时返回nil
+func wrapError(msg string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("%s: %v", msg, err)
 }
 
 // calculateChangeRate 计算变化率
@@ -208,64 +409,6 @@ func (s *GCodeService) calculateCommandChange(cmdsA, cmdsB struct {
 	return 0
 }
 
-// parseGCommand 解析G代码命令
-func (s *GCodeService) parseGCommand(line string) *GCommand {
-	cmd := &GCommand{Raw: line}
-
-	// 跳过注释和空行
-	if strings.HasPrefix(line, ";") || strings.TrimSpace(line) == "" {
-		return nil
-	}
-
-	// 解析命令类型
-	if match := regexp.MustCompile(`G[0-3]`).FindString(line); match != "" {
-		cmd.Type = match
-	}
-
-	// 使用正则表达式提取参数
-	reX := regexp.MustCompile(`X(-?\d*\.?\d+)`)
-	reY := regexp.MustCompile(`Y(-?\d*\.?\d+)`)
-	reZ := regexp.MustCompile(`Z(-?\d*\.?\d+)`)
-	reF := regexp.MustCompile(`F(-?\d*\.?\d+)`)
-
-	// 提取坐标和速度
-	if matches := reX.FindStringSubmatch(line); len(matches) > 1 {
-		cmd.X, _ = strconv.ParseFloat(matches[1], 64)
-	}
-	if matches := reY.FindStringSubmatch(line); len(matches) > 1 {
-		cmd.Y, _ = strconv.ParseFloat(matches[1], 64)
-	}
-	if matches := reZ.FindStringSubmatch(line); len(matches) > 1 {
-		cmd.Z, _ = strconv.ParseFloat(matches[1], 64)
-	}
-	if matches := reF.FindStringSubmatch(line); len(matches) > 1 {
-		cmd.F, _ = strconv.ParseFloat(matches[1], 64)
-	}
-
-	return cmd
-}
-
-// parseFloat 解析浮点数
-func (s *GCodeService) parseFloat(str string) float64 {
-	value, _ := strconv.ParseFloat(str, 64)
-	return value
-}
-
-// calculateLength 计算路径长度
-func (s *GCodeService) calculateLength(cmd *GCommand, lastX, lastY float64) float64 {
-
-	// 只有当当前点和目标点都有效时才计算长度
-	if (cmd.X != 0 || cmd.Y != 0) && (lastX != 0 || lastY != 0) {
-		dx := cmd.X - lastX
-		dy := cmd.Y - lastY
-		length := math.Sqrt(dx*dx + dy*dy)
-		return length
-	}
-
-	fmt.Printf("坐标无效，返回长度0\n")
-	return 0
-}
-
 // compareManifest 比较 Manifest 文件
 func (s *GCodeService) compareManifest(contentA, contentB []byte) (*model.ManifestDiff, error) {
 	var jsonA, jsonB map[string]interface{}
@@ -418,289 +561,152 @@ func (s *GCodeService) hasAnyDifference(params []model.Parameter) bool {
 	return false
 }
 
-// analyzeGCode 分析G-code文件
-func (s *GCodeService) analyzeGCode(content []byte, params *MachineParams) model.GCodeAnalysis {
-	analysis := model.GCodeAnalysis{}
-	lines := bytes.Split(content, []byte("\n"))
-
-	// 创建工作通道和结果通道
-	const workerCount = 4
-	workChan := make(chan [][]byte)
-	resultChan := make(chan struct {
-		commands struct {
-			g0, g1, g2, g3 int
-		}
-		path struct {
-			rapid, working, total  float64
-			minX, maxX, minY, maxY float64
-		}
-		speeds []float64
-	}, workerCount)
-
-	// 启动工作协程
-	var wg sync.WaitGroup
-	for i := 0; i < workerCount; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			result := struct {
-				commands struct {
-					g0, g1, g2, g3 int
-				}
-				path struct {
-					rapid, working, total  float64
-					minX, maxX, minY, maxY float64
-				}
-				speeds []float64
-			}{
-				path: struct {
-					rapid, working, total  float64
-					minX, maxX, minY, maxY float64
-				}{
-					minX: math.MaxFloat64,
-					minY: math.MaxFloat64,
-					maxX: -math.MaxFloat64,
-					maxY: -math.MaxFloat64,
-				},
-				speeds: make([]float64, 0),
-			}
+// maxScanTokenSize 单行最大长度
+const maxScanTokenSize = 1024 * 1024 // 1MB
+
+// pathAnalyzer 按执行顺序累加解释器输出的运动段，计算命令数、路径长度、范围、速度和加工时间
+// 长度和范围按展开子程序、固定循环并换算单位和坐标偏移后的运动段计算，刀具半径补偿生效时为刀具中心路径
+type pathAnalyzer struct {
+	analysis   *model.GCodeAnalysis
+	min, max   gcode.Point // 机器坐标的范围
+	bounded    bool
+	planner    *motionPlanner
+	lex        gcode.Lexer
+	totalSpeed float64
+	speedCount int
+}
 
-			var lastX, lastY float64
-			var hasLastPoint bool
-
-			for chunk := range workChan {
-				for _, line := range chunk {
-					if cmd := s.parseGCommand(string(line)); cmd != nil && cmd.Type != "" {
-						// 更新命令计数
-						switch cmd.Type {
-						case "G0":
-							result.commands.g0++
-						case "G1":
-							result.commands.g1++
-						case "G2":
-							result.commands.g2++
-						case "G3":
-							result.commands.g3++
-						}
-
-						// 更新坐标范围和路径长度
-						if cmd.X != 0 || cmd.Y != 0 {
-							// 更新坐标范围
-							result.path.minX = math.Min(result.path.minX, cmd.X)
-							result.path.maxX = math.Max(result.path.maxX, cmd.X)
-							result.path.minY = math.Min(result.path.minY, cmd.Y)
-							result.path.maxY = math.Max(result.path.maxY, cmd.Y)
-
-							// 计算路径长度
-							if hasLastPoint {
-								dx := cmd.X - lastX
-								dy := cmd.Y - lastY
-								length := math.Sqrt(dx*dx + dy*dy)
-
-								if length > 0.001 { // 1微米的阈值
-									if cmd.Type == "G0" {
-										result.path.rapid += length
-									} else {
-										result.path.working += length
-									}
-									result.path.total += length
-								}
-							}
-							lastX, lastY = cmd.X, cmd.Y
-							hasLastPoint = true
-						}
-
-						// 收集速度数据
-						if cmd.F > 0 {
-							result.speeds = append(result.speeds, cmd.F)
-						}
-					}
-				}
-			}
-			resultChan <- result
-		}()
-	}
-
-	// 分发工作
-	chunkSize := len(lines) / workerCount
-	go func() {
-		for i := 0; i < workerCount; i++ {
-			start := i * chunkSize
-			end := start + chunkSize
-			if i == workerCount-1 {
-				end = len(lines)
-			}
-			workChan <- lines[start:end]
-		}
-		close(workChan)
-	}()
+func newPathAnalyzer(analysis *model.GCodeAnalysis, params *MachineParams) *pathAnalyzer {
+	return &pathAnalyzer{analysis: analysis, planner: newMotionPlanner(params, &analysis.Time)}
+}
 
-	// 等待所有完成
-	go func() {
-		wg.Wait()
-		close(resultChan)
-	}()
+// block 累加一个程序段，st为该段执行后的状态
+func (a *pathAnalyzer) block(b *gcode.Block, st *gcode.State, segments []gcode.Segment) {
+	// 设置命令只修改之后移动的运动限制
+	if limits := settingLimits(b, &a.lex); limits != nil {
+		a.planner.apply(limits)
+		return
+	}
 
-	// 合并结果
-	var totalSpeed float64
-	var speedCount int
-	for result := range resultChan {
-		// 合并命令计数
-		analysis.Commands.G0Count += result.commands.g0
-		analysis.Commands.G1Count += result.commands.g1
-		analysis.Commands.G2Count += result.commands.g2
-		analysis.Commands.G3Count += result.commands.g3
-
-		// 合并路径数据
-		analysis.Path.RapidLength += result.path.rapid
-		analysis.Path.WorkingLength += result.path.working
-		analysis.Path.TotalLength += result.path.total
-
-		// 更新坐标范围
-		analysis.Path.Area.Width = math.Max(analysis.Path.Area.Width, result.path.maxX-result.path.minX)
-		analysis.Path.Area.Height = math.Max(analysis.Path.Area.Height, result.path.maxY-result.path.minY)
-
-		// 更新速度统计
-		for _, speed := range result.speeds {
-			if analysis.Speed.MaxSpeed == 0 || speed > analysis.Speed.MaxSpeed {
-				analysis.Speed.MaxSpeed = speed
-			}
-			if analysis.Speed.MinSpeed == 0 || speed < analysis.Speed.MinSpeed {
-				analysis.Speed.MinSpeed = speed
-			}
-			totalSpeed += speed
-			speedCount++
+	// 更新速度统计，不保存每个速度值
+	if b.Has('F') && st.Feed > 0 {
+		speed := &a.analysis.Speed
+		if speed.MaxSpeed == 0 || st.Feed > speed.MaxSpeed {
+			speed.MaxSpeed = st.Feed
+		}
+		if speed.MinSpeed == 0 || st.Feed < speed.MinSpeed {
+			speed.MinSpeed = st.Feed
+		}
+		a.totalSpeed += st.Feed
+		a.speedCount++
+	}
+
+	// 更新命令计数，固定循环展开的移动不计入
+	if len(segments) > 0 && segments[0].Cycle == "" {
+		switch segments[0].Motion {
+		case gcode.MotionRapid:
+			a.analysis.Commands.G0Count++
+		case gcode.MotionLinear:
+			a.analysis.Commands.G1Count++
+		case gcode.MotionCW:
+			a.analysis.Commands.G2Count++
+		case gcode.MotionCCW:
+			a.analysis.Commands.G3Count++
 		}
 	}
 
-	// 计算最终结果
-	if speedCount > 0 {
-		analysis.Speed.AvgSpeed = totalSpeed / float64(speedCount)
+	for i := range segments {
+		a.segment(&segments[i])
 	}
-
-	analysis.Path.Area.Size = analysis.Path.Area.Width * analysis.Path.Area.Height
-
-	// 确保参数有效
-	if params == nil {
-		params = &MachineParams{
-			RapidSpeed:   6000, // 默认值 mm/min
-			WorkingSpeed: 2880, // 默认值 mm/min
-			RapidAccel:   2500, // 默认值 mm/s²
-			WorkingAccel: 2500, // 默认值 mm/s²
-		}
+	if seconds, ok := gcode.DwellTime(b); ok && seconds > 0 {
+		a.planner.dwell(seconds)
 	}
-
-	// 添加日志以确认时间计算被触发
-	fmt.Printf("开始计算加工时间，路径总长: %.2fmm, 工作长度: %.2fmm, 快速移动长度: %.2fmm\n",
-		analysis.Path.TotalLength, analysis.Path.WorkingLength, analysis.Path.RapidLength)
-
-	// 计算加工时间
-	s.calculateProcessingTime(&analysis, params)
-
-	// 添加日志以确认计算结果
-	fmt.Printf("加工时间计算完成 - 总时间: %.2fs, 工作时间: %.2fs, 快速移动时间: %.2fs, 加速时间: %.2fs\n",
-		analysis.Time.TotalTime, analysis.Time.WorkingTime, analysis.Time.RapidTime, analysis.Time.AccelTime)
-
-	return analysis
 }
 
-// calculateProcessingTime 计算加工时间
-func (s *GCodeService) calculateProcessingTime(analysis *model.GCodeAnalysis, params *MachineParams) {
-	const (
-		MIN_SEGMENT_LENGTH = 0.5     // mm，最小线段长度
-		MIN_SPEED          = 100.0   // mm/min，最小速度
-		COMMAND_OVERHEAD   = 0.00001 // 秒，每条指令的基本处理时间
-		CORNER_OVERHEAD    = 0.0001  // 秒，拐角处理时间
-	)
-
-	// 参数验证和默认值设置
-	if params.RapidSpeed <= 0 || params.WorkingSpeed <= 0 ||
-		params.RapidAccel <= 0 || params.WorkingAccel <= 0 {
-		params = &MachineParams{
-			RapidSpeed:   3000, // 修改为实际速度
-			WorkingSpeed: 9000, // 修改为实际速度
-			RapidAccel:   3000, // 修改为实际加速度
-			WorkingAccel: 3000, // 修改为实际加速度
-		}
+// segment 累加一个运动段的长度、范围和时间
+func (a *pathAnalyzer) segment(seg *gcode.Segment) {
+	length := seg.Length()
+	path := &a.analysis.Path
+	if seg.IsRapid() {
+		path.RapidLength += length
+	} else {
+		path.WorkingLength += length
 	}
+	path.TotalLength += length
 
-	// 速度单位转换 (mm/min -> mm/s)
-	g0SpeedMmS := params.RapidSpeed / 60.0
-	workingSpeedMmS := params.WorkingSpeed / 60.0
-	minSpeedMmS := MIN_SPEED / 60.0
-
-	// 重置时间统计
-	analysis.Time = model.TimeAnalysis{}
-
-	// 计算工作时间 (G1/G2/G3)
-	if analysis.Path.WorkingLength > 0 {
-		workingCommands := float64(analysis.Commands.G1Count + analysis.Commands.G2Count + analysis.Commands.G3Count)
-		if workingCommands > 0 {
-			avgSegmentLength := analysis.Path.WorkingLength / workingCommands
-
-			// 计算实际工作速度
-			var effectiveSpeed float64
-			if avgSegmentLength < MIN_SEGMENT_LENGTH {
-				// 短线段降速处理
-				effectiveSpeed = workingSpeedMmS * 0.8 // 降低到80%速度
-			} else {
-				effectiveSpeed = workingSpeedMmS * 0.95 // 考虑实际效率
-			}
-
-			// 基础工作时间
-			analysis.Time.WorkingTime = analysis.Path.WorkingLength / effectiveSpeed
-
-			// 加减速时间补偿
-			if effectiveSpeed > minSpeedMmS {
-				// 每个命令的加减速时间
-				accelTime := (effectiveSpeed - minSpeedMmS) / params.WorkingAccel
-				// 考虑实际加减速比例
-				analysis.Time.AccelTime = accelTime * workingCommands * 0.1 // 降低加减速时间比例
-			}
-		}
+	min, max := seg.Bounds()
+	min, max = addOffset(min, seg.Offset), addOffset(max, seg.Offset)
+	if !a.bounded {
+		a.min, a.max, a.bounded = min, max, true
+	} else {
+		a.min.X, a.min.Y = math.Min(a.min.X, min.X), math.Min(a.min.Y, min.Y)
+		a.max.X, a.max.Y = math.Max(a.max.X, max.X), math.Max(a.max.Y, max.Y)
 	}
 
-	// 计算快速移动时间 (G0)
-	if analysis.Path.RapidLength > 0 && analysis.Commands.G0Count > 0 {
-		avgG0Length := analysis.Path.RapidLength / float64(analysis.Commands.G0Count)
+	a.planner.add(seg)
+	if seg.Dwell > 0 {
+		a.planner.dwell(seg.Dwell)
+	}
+}
 
-		// 计算实际G0速度
-		effectiveG0Speed := g0SpeedMmS * 0.9 // 考虑实际效率
-		if avgG0Length < MIN_SEGMENT_LENGTH {
-			effectiveG0Speed *= 0.8 // 短距离G0降速
-		}
+// finish 计算平均速度、加工区域和加工时间
+func (a *pathAnalyzer) finish() {
+	a.planner.flush()
+	if a.speedCount > 0 {
+		a.analysis.Speed.AvgSpeed = a.totalSpeed / float64(a.speedCount)
+	}
+	if a.bounded {
+		a.analysis.Path.Area.Width = a.max.X - a.min.X
+		a.analysis.Path.Area.Height = a.max.Y - a.min.Y
+		a.analysis.Path.Area.Size = a.analysis.Path.Area.Width * a.analysis.Path.Area.Height
+	}
+}
 
-		// 基础G0时间
-		analysis.Time.RapidTime = analysis.Path.RapidLength / effectiveG0Speed
+// addOffset 工件坐标加上偏移得到机器坐标
+func addOffset(p, offset gcode.Point) gcode.Point {
+	return gcode.Point{X: p.X + offset.X, Y: p.Y + offset.Y, Z: p.Z + offset.Z}
+}
 
-		// G0加减速补偿
-		if analysis.Commands.G0Count > 1 {
-			g0AccelTime := effectiveG0Speed / params.RapidAccel
-			analysis.Time.AccelTime += g0AccelTime * float64(analysis.Commands.G0Count) * 0.1
-		}
+// defaultMachineParams 没有 manifest 时使用的机器参数
+func defaultMachineParams() *MachineParams {
+	return &MachineParams{
+		RapidSpeed:   6000, // 默认值 mm/min
+		WorkingSpeed: 2880, // 默认值 mm/min
+		RapidAccel:   2500, // 默认值 mm/s²
+		WorkingAccel: 2500, // 默认值 mm/s²
 	}
+}
 
-	// 计算指令处理开销
-	commandCount := float64(analysis.Commands.G0Count + analysis.Commands.G1Count +
-		analysis.Commands.G2Count + analysis.Commands.G3Count)
+// analyzeGCode 展开子程序和循环后用解释器执行G-code，按输出的运动段计算路径、速度和时间
+// profile 为空时使用默认机器配置，params 为空时使用默认机器参数
+func (s *GCodeService) analyzeGCode(r io.Reader, params *MachineParams, profile *model.MachineProfile) (model.GCodeAnalysis, error) {
+	analysis := model.GCodeAnalysis{}
+	if profile == nil {
+		profile = DefaultMachineProfile()
+	}
+	// 确保参数有效
+	if params == nil {
+		params = defaultMachineParams()
+	}
 
-	// 基本指令处理开销
-	processingOverhead := commandCount * COMMAND_OVERHEAD
+	a := newPathAnalyzer(&analysis, params)
+	prog, err := runAnalyzers(r, gcode.NewInterpreterFor(profile), a)
+	if err != nil {
+		return analysis, err
+	}
+	analysis.Program = programExpansion(prog)
+	a.finish()
 
-	// 拐角处理开销
-	cornerCount := float64(analysis.Commands.G0Count+analysis.Commands.G1Count) * 0.15
-	cornerOverhead := cornerCount * CORNER_OVERHEAD
+	// 添加日志以确认计算结果
+	log.Printf("加工时间计算完成 - 路径总长: %.2fmm, 总时间: %.2fs, 工作时间: %.2fs, 快速移动时间: %.2fs, 加速时间: %.2fs, 设置命令: %d\n",
+		analysis.Path.TotalLength, analysis.Time.TotalTime, analysis.Time.WorkingTime,
+		analysis.Time.RapidTime, analysis.Time.AccelTime, analysis.Time.SettingCommands)
 
-	// 计算总时间
-	analysis.Time.TotalTime = analysis.Time.WorkingTime +
-		analysis.Time.RapidTime +
-		analysis.Time.AccelTime +
-		processingOverhead +
-		cornerOverhead
+	return analysis, nil
 }
 
-// extractMachineParams 从manifest提取参数
-func (s *GCodeService) extractMachineParams(manifestContent []byte) (*MachineParams, error) {
+// extractMachineParams 从manifest提取参数，manifest未指定的加速度使用控制器方言的默认值
+func (s *GCodeService) extractMachineParams(manifestContent []byte, profile *model.MachineProfile) (*MachineParams, error) {
 	var manifest map[string]interface{}
 	if err := json.Unmarshal(manifestContent, &manifest); err != nil {
 		return nil, err
@@ -712,6 +718,13 @@ func (s *GCodeService) extractMachineParams(manifestContent []byte) (*MachinePar
 		RapidAccel:   2500, // 默认值
 		WorkingAccel: 2500, // 默认值
 	}
+	if dialect, ok := gcode.LookupDialect(profile.Dialect); ok {
+		defaults := dialect.Defaults()
+		if defaults.Accel > 0 {
+			params.RapidAccel = defaults.Accel
+			params.WorkingAccel = defaults.Accel
+		}
+	}
 
 	// 从manifest中提取参数
 	if settings, ok := manifest["machine_settings"].(map[string]interface{}); ok {
@@ -728,6 +741,8 @@ func (s *GCodeService) extractMachineParams(manifestContent []byte) (*MachinePar
 			params.WorkingAccel = accel
 		}
 	}
+	params.Kerfs = elementKerfs(manifest)
+	params.OverDists = elementOverDists(manifest)
 
 	return params, nil
 }
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"ok/input"
+	"strings"
+	"testing"
+)
+
+func TestAnalyzeGCodePath(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		rapid   float64
+		working float64
+	}{
+		{"换坐标系的快速移动", "G0 X10 Y10\nG0 G90 G54 X0 Y0\n", 20 * math.Sqrt2, 0},
+		{"相对坐标", "G91\nG1 X10 F100\nG1 Y10\n", 0, 20},
+		{"省略的轴保持不变", "G1 X10 F100\nG1 Y10\n", 0, 20},
+		{"圆弧按弧长计算", "G0 X1 Y1\nG2 X3 Y1 I1 J0 F100\n", math.Sqrt2, math.Pi},
+		{"英制单位", "G20\nG1 X1 F10\n", 0, 25.4},
+	}
+
+	s := NewGCodeService()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := s.AnalyzeGCode(strings.NewReader(tt.src))
+			if err != nil {
+				t.Fatalf("AnalyzeGCode: %v", err)
+			}
+			if math.Abs(a.Path.RapidLength-tt.rapid) > 1e-6 {
+				t.Errorf("RapidLength = %v, want %v", a.Path.RapidLength, tt.rapid)
+			}
+			if math.Abs(a.Path.WorkingLength-tt.working) > 1e-6 {
+				t.Errorf("WorkingLength = %v, want %v", a.Path.WorkingLength, tt.working)
+			}
+		})
+	}
+}
+
+func TestAnalyzeGCodeBounds(t *testing.T) {
+	src := "G10 L2 P1 X100 Y50\nG54\nG0 X0 Y0\nG1 X10 Y20 F100\n"
+	a, err := NewGCodeService().AnalyzeGCode(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("AnalyzeGCode: %v", err)
+	}
+	// 从机床原点移动到 G54 原点 (100,50)，区域包含两者
+	if a.Path.Area.Width != 110 || a.Path.Area.Height != 70 {
+		t.Errorf("Area = %vx%v, want 110x70", a.Path.Area.Width, a.Path.Area.Height)
+	}
+	if a.Commands.G0Count != 1 || a.Commands.G1Count != 1 {
+		t.Errorf("Commands = %+v", a.Commands)
+	}
+}
+
+func TestAnalyzeGCodeCompensation(t *testing.T) {
+	profile := DefaultMachineProfile()
+	profile.ToolDiameters = map[int]float64{1: 2}
+	src := "G0 X0 Y-5\nG41 D1 G1 Y0 F100\nY10\nX10\nG40 G1 X15\n"
+	a, err := NewGCodeService().analyzeGCode(strings.NewReader(src), nil, profile)
+	if err != nil {
+		t.Fatalf("analyzeGCode: %v", err)
+	}
+	// 加工长度按补偿后的刀具中心路径计算
+	want := 2*math.Hypot(1, 5) + 20 + math.Pi/2
+	if math.Abs(a.Path.WorkingLength-want) > 1e-9 {
+		t.Errorf("WorkingLength = %v, want %v", a.Path.WorkingLength, want)
+	}
+}
+
+func TestAnalyzeGCodeCycle(t *testing.T) {
+	// G91 下 R 相对起始高度，Z 相对 R：R=2，孔底 Z=-3，G98 退回 Z=10
+	src := "G0 X0 Y0 Z10\nG91 G98 G81 X10 R-8 Z-5 L2 F100\n"
+	a, err := NewGCodeService().AnalyzeGCode(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("AnalyzeGCode: %v", err)
+	}
+	// 每个孔：快速移动到孔位 10，下降到 R 8，进给 5，退回 13
+	if a.Path.WorkingLength != 10 || a.Path.RapidLength != 2*(10+8+13)+10 {
+		t.Errorf("WorkingLength = %v, RapidLength = %v", a.Path.WorkingLength, a.Path.RapidLength)
+	}
+}
+
+func TestAnalyzeGCodeMacroNames(t *testing.T) {
+	// 通用方言不处理 Fanuc 宏语句，END_PRINT 等宏调用按普通程序段执行
+	src := "G28\nG1 X10 Y10 F100\nEND_PRINT\n"
+	a, err := NewGCodeService().AnalyzeGCode(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("AnalyzeGCode: %v", err)
+	}
+	if a.Program.ExecutedLines != 3 || a.Program.Expanded {
+		t.Errorf("Program = %+v", a.Program)
+	}
+}
+
+func TestCompareVersionsSpooled(t *testing.T) {
+	var a, b strings.Builder
+	for i := 0; i < 500; i++ {
+		fmt.Fprintf(&a, "G0 X%d Y0\nM3 S500\nG1 X%d Y10 F1000\nM5\n", i, i)
+		fmt.Fprintf(&b, "G0 X%d Y0\nM3 S500\nG1 X%d Y%d F1000\nM5\n", i, i, 10+i%3)
+	}
+	manifest := []byte("{}")
+	compare := func(content func(s string) *input.Content) []byte {
+		t.Helper()
+		result, err := NewGCodeService().CompareVersions(content(a.String()), manifest, content(b.String()), manifest, nil)
+		if err != nil {
+			t.Fatalf("CompareVersions: %v", err)
+		}
+		data, err := json.Marshal(result.GCodeDiff)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	memory := compare(func(s string) *input.Content { return input.NewContent([]byte(s)) })
+	// 转存到临时文件的内容按流读取，结果与内存中的相同
+	old := input.SpoolThreshold
+	input.SpoolThreshold = 1024
+	defer func() { input.SpoolThreshold = old }()
+	spooled := compare(func(s string) *input.Content {
+		c, err := input.Spool(strings.NewReader(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	})
+	if !bytes.Equal(memory, spooled) {
+		t.Errorf("转存后的比较结果不同:\n%s\n%s", memory, spooled)
+	}
+}
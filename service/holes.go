@@ -0,0 +1,110 @@
+package service
+
+import (
+	"io"
+	"math"
+	"ok/gcode"
+	"ok/model"
+)
+
+// maxHoles 最多保留的孔数量
+const maxHoles = 1000
+
+// holeAnalyzer 按执行顺序统计固定循环加工的孔，孔位为每个孔第一段进给的位置
+type holeAnalyzer struct {
+	report model.HoleReport
+}
+
+func newHoleAnalyzer() *holeAnalyzer {
+	return &holeAnalyzer{report: model.HoleReport{
+		Cycles: map[string]int{},
+		Holes:  make([]model.Hole, 0),
+	}}
+}
+
+// block 累加一个程序段中的孔，st为该段执行后的状态
+func (h *holeAnalyzer) block(b *gcode.Block, st *gcode.State, segments []gcode.Segment) {
+	report := &h.report
+	for i := range segments {
+		seg := &segments[i]
+		if !seg.Hole {
+			continue
+		}
+		report.Count++
+		report.Cycles[seg.Cycle]++
+		if len(report.Holes) == maxHoles {
+			report.Truncated = true
+			continue
+		}
+		report.Holes = append(report.Holes, model.Hole{
+			Line:   b.Line,
+			Cycle:  seg.Cycle,
+			Tool:   st.Tool,
+			X:      seg.To.X,
+			Y:      seg.To.Y,
+			Top:    seg.From.Z,
+			Bottom: st.CycleBottom,
+		})
+	}
+}
+
+// analyzeHoles 统计固定循环加工的孔
+func (s *GCodeService) analyzeHoles(r io.Reader, profile *model.MachineProfile) (model.HoleReport, error) {
+	if profile == nil {
+		profile = DefaultMachineProfile()
+	}
+	h := newHoleAnalyzer()
+	_, err := runAnalyzers(r, gcode.NewInterpreterFor(profile), h)
+	return h.report, err
+}
+
+// holeKey 按 0.001mm 取整的孔位
+type holeKey struct {
+	x, y int64
+}
+
+func keyOf(h *model.Hole) holeKey {
+	return holeKey{int64(math.Round(h.X * 1000)), int64(math.Round(h.Y * 1000))}
+}
+
+// compareHoles 按孔位比较A/B两个版本的孔，同一位置有多个孔时按顺序配对
+func (s *GCodeService) compareHoles(a, b model.HoleReport) model.HoleChange {
+	change := model.HoleChange{
+		Added:    make([]model.Hole, 0),
+		Removed:  make([]model.Hole, 0),
+		Modified: make([]model.HoleModified, 0),
+	}
+
+	byPosition := map[holeKey][]model.Hole{}
+	paired := map[holeKey]int{}
+	for _, h := range a.Holes {
+		key := keyOf(&h)
+		byPosition[key] = append(byPosition[key], h)
+	}
+	for _, h := range b.Holes {
+		key := keyOf(&h)
+		list := byPosition[key]
+		if len(list) == 0 {
+			change.Added = append(change.Added, h)
+			continue
+		}
+		old := list[0]
+		byPosition[key] = list[1:]
+		paired[key]++
+		if old.Cycle != h.Cycle || old.Tool != h.Tool ||
+			math.Abs(old.Bottom-h.Bottom) > 0.0005 || math.Abs(old.Top-h.Top) > 0.0005 {
+			change.Modified = append(change.Modified, model.HoleModified{A: old, B: h})
+		}
+	}
+	// 按A中的顺序输出没有配对的孔，同一位置前面的孔已经配对
+	seen := map[holeKey]int{}
+	for _, h := range a.Holes {
+		key := keyOf(&h)
+		if seen[key]++; seen[key] > paired[key] {
+			change.Removed = append(change.Removed, h)
+		}
+	}
+
+	change.Same = a.Count == b.Count && len(change.Added) == 0 && len(change.Removed) == 0 && len(change.Modified) == 0
+	return change
+}
@@ -0,0 +1,317 @@
+package service
+
+import (
+	"io"
+	"math"
+	"ok/gcode"
+	"ok/model"
+)
+
+// 切缝补偿检查的容差
+const (
+	kerfTolerance      = 0.02 // 偏移一致的绝对容差(mm)
+	kerfRelTolerance   = 0.1  // 偏移一致的相对容差，按声明的偏移变化计算
+	kerfShapeTolerance = 0.05 // 平均距离与估计偏移的差超过该值(加估计偏移的25%)时认为形状改变(mm)
+	kerfChordTolerance = 0.01 // 轮廓离散为折线的弦高误差(mm)
+	maxKerfSamples     = 500  // 计算平均距离时每个元素最多取的采样点
+)
+
+// ElementKerf manifest 中一个元素声明的切缝补偿
+type ElementKerf struct {
+	Enabled  bool    // enableKerf
+	Distance float64 // kerfDistance，轮廓向零件外侧偏移的距离(mm)
+}
+
+// Offset 声明的偏移距离，未启用时为0
+func (k ElementKerf) Offset() float64 {
+	if !k.Enabled {
+		return 0
+	}
+	return k.Distance
+}
+
+// elementKerfs 读取 manifest 中各元素的 enableKerf 和 kerfDistance
+func elementKerfs(manifest map[string]interface{}) []ElementKerf {
+	elements, _ := manifest["elements"].([]interface{})
+	kerfs := make([]ElementKerf, len(elements))
+	for i, e := range elements {
+		m, ok := e.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		kerfs[i].Enabled, _ = m["enableKerf"].(bool)
+		kerfs[i].Distance, _ = m["kerfDistance"].(float64)
+	}
+	return kerfs
+}
+
+// kerfEnabled 是否有元素启用了切缝补偿
+func kerfEnabled(params *MachineParams) bool {
+	if params == nil {
+		return false
+	}
+	for _, k := range params.Kerfs {
+		if k.Enabled {
+			return true
+		}
+	}
+	return false
+}
+
+// elementPaths 按元素标记注释分组的运动段
+// 第 i 个出现的元素标记对应 manifest 的 elements[i]，同名标记再次出现时属于同一元素
+type elementPaths struct {
+	names    []string          // 元素标记的名称，按首次出现的顺序
+	segments [][]gcode.Segment // 各元素的运动段
+	unmarked []gcode.Segment   // 第一个元素标记之前的运动段，没有标记时为全部运动段
+}
+
+// element 返回 manifest 第 i 个元素的运动段，count 为 manifest 中的元素数
+// 没有元素标记时整个程序只能对应唯一的元素
+func (p *elementPaths) element(i, count int) (string, []gcode.Segment, bool) {
+	if len(p.names) == 0 {
+		return "", p.unmarked, count == 1 && i == 0
+	}
+	if i >= len(p.names) {
+		return "", nil, false
+	}
+	return p.names[i], p.segments[i], true
+}
+
+// elementMarkers 按元素标记注释确定程序段所属的元素
+// 第 i 个出现的元素标记对应 manifest 的 elements[i]，同名标记再次出现时属于同一元素
+type elementMarkers struct {
+	names   []string       // 元素标记的名称，按首次出现的顺序
+	index   map[string]int // 名称对应的序号
+	current int            // 当前元素的序号，第一个元素标记之前为-1
+}
+
+func newElementMarkers() *elementMarkers {
+	return &elementMarkers{index: map[string]int{}, current: -1}
+}
+
+// update 读取程序段中的元素标记，返回程序段所属元素的序号
+func (m *elementMarkers) update(b *gcode.Block) int {
+	for _, comment := range b.Comments {
+		kind, name, ok := gcode.Marker(comment)
+		if !ok || kind != "element" {
+			continue
+		}
+		i, seen := m.index[name]
+		if !seen {
+			i = len(m.names)
+			m.index[name] = i
+			m.names = append(m.names, name)
+		}
+		m.current = i
+	}
+	return m.current
+}
+
+// elementReader 按元素标记注释把运动段分组
+type elementReader struct {
+	paths   *elementPaths
+	markers *elementMarkers
+}
+
+func newElementReader() *elementReader {
+	return &elementReader{paths: &elementPaths{}, markers: newElementMarkers()}
+}
+
+// block 把程序段的运动段加入所属元素
+func (e *elementReader) block(b *gcode.Block, st *gcode.State, segments []gcode.Segment) {
+	paths := e.paths
+	i := e.markers.update(b)
+	if i < 0 {
+		paths.unmarked = append(paths.unmarked, segments...)
+		return
+	}
+	for len(paths.segments) <= i {
+		paths.segments = append(paths.segments, nil)
+	}
+	paths.segments[i] = append(paths.segments[i], segments...)
+}
+
+// finish 补齐没有运动段的元素
+func (e *elementReader) finish() *elementPaths {
+	paths := e.paths
+	paths.names = e.markers.names
+	for len(paths.segments) < len(paths.names) {
+		paths.segments = append(paths.segments, nil)
+	}
+	return paths
+}
+
+// readElements 执行程序并按元素标记注释把运动段分组
+func (s *GCodeService) readElements(r io.Reader, profile *model.MachineProfile) (*elementPaths, error) {
+	if profile == nil {
+		profile = DefaultMachineProfile()
+	}
+	e := newElementReader()
+	_, err := runAnalyzers(r, gcode.NewInterpreterFor(profile), e)
+	return e.finish(), err
+}
+
+// compareKerf 按元素比较A/B的轮廓，估计实际偏移并与声明的切缝补偿变化对照
+// a、b 为空(两个版本都没有启用切缝补偿)时不检查
+func (s *GCodeService) compareKerf(a, b *elementPaths, paramsA, paramsB *MachineParams) model.KerfCheck {
+	check := model.KerfCheck{Elements: make([]model.KerfElement, 0)}
+	if a == nil || b == nil {
+		return check
+	}
+	kerfsA, kerfsB := paramsA.Kerfs, paramsB.Kerfs
+	count := len(kerfsA)
+	if len(kerfsB) > count {
+		count = len(kerfsB)
+	}
+	for i := 0; i < count; i++ {
+		el := model.KerfElement{Index: i, Status: model.KerfUnknown}
+		if i < len(kerfsA) {
+			el.KerfA = kerfsA[i].Offset()
+		}
+		if i < len(kerfsB) {
+			el.KerfB = kerfsB[i].Offset()
+		}
+		el.Expected = el.KerfB - el.KerfA
+
+		nameA, segmentsA, okA := a.element(i, len(kerfsA))
+		nameB, segmentsB, okB := b.element(i, len(kerfsB))
+		el.Name = nameB
+		if el.Name == "" {
+			el.Name = nameA
+		}
+		switch {
+		case i >= len(kerfsA) || i >= len(kerfsB):
+			el.Note = "元素只在一个版本的 manifest 中"
+		case !okA || !okB:
+			el.Note = "G-code 中没有对应的元素标记"
+		default:
+			measureOffset(&el, segmentsA, segmentsB)
+		}
+		if el.Status == model.KerfMismatch || el.Status == model.KerfShapeChanged {
+			check.Mismatches++
+		}
+		check.Elements = append(check.Elements, el)
+	}
+	return check
+}
+
+// measureOffset 估计B的轮廓相对A的偏移
+// 轮廓整体偏移 d 时零件面积的变化约为 d 乘以平均周长(凸轮廓时精确相等)，由此得到带方向的偏移；
+// B的轮廓到A的轮廓的平均距离应与偏移的大小相同，相差较大说明轮廓形状改变
+func measureOffset(el *model.KerfElement, a, b []gcode.Segment) {
+	contoursA, contoursB := closedContours(a), closedContours(b)
+	el.Contours = len(contoursB)
+	if len(contoursA) == 0 || len(contoursB) == 0 {
+		el.Note = "没有闭合轮廓"
+		return
+	}
+	areaA, perimeterA := materialArea(contoursA)
+	areaB, perimeterB := materialArea(contoursB)
+	el.Observed = (areaB - areaA) / ((perimeterA + perimeterB) / 2)
+	el.MeanDistance = meanDistance(contoursB, contoursA)
+
+	switch {
+	case math.Abs(el.MeanDistance-math.Abs(el.Observed)) > kerfShapeTolerance+0.25*math.Abs(el.Observed):
+		el.Status = model.KerfShapeChanged
+	case math.Abs(el.Observed-el.Expected) <= kerfTolerance+kerfRelTolerance*math.Abs(el.Expected):
+		el.Status = model.KerfMatch
+	default:
+		el.Status = model.KerfMismatch
+	}
+}
+
+// kerfContour 参与比较的闭合轮廓及其折线和包围盒
+type kerfContour struct {
+	contour  gcode.Contour
+	points   []gcode.Point
+	min, max gcode.Point
+}
+
+// closedContours 取出运动段中的闭合轮廓
+func closedContours(segments []gcode.Segment) []kerfContour {
+	var contours []kerfContour
+	for _, c := range gcode.Contours(segments) {
+		if !c.Closed {
+			continue
+		}
+		min, max := c.Bounds()
+		contours = append(contours, kerfContour{contour: c, points: c.Points(kerfChordTolerance), min: min, max: max})
+	}
+	return contours
+}
+
+// materialArea 按嵌套层数计算零件面积和轮廓总长：偶数层为外轮廓，奇数层为内孔
+func materialArea(contours []kerfContour) (area, perimeter float64) {
+	for i := range contours {
+		p := contours[i].contour.Start()
+		depth := 0
+		for j := range contours {
+			o := &contours[j]
+			if j != i && p.X >= o.min.X && p.X <= o.max.X && p.Y >= o.min.Y && p.Y <= o.max.Y &&
+				o.contour.Contains(p, kerfChordTolerance) {
+				depth++
+			}
+		}
+		a := math.Abs(contours[i].contour.Area())
+		if depth%2 == 1 {
+			a = -a
+		}
+		area += a
+		perimeter += contours[i].contour.Length()
+	}
+	return area, perimeter
+}
+
+// meanDistance 在 from 的轮廓上均匀采样，计算采样点到 to 的轮廓的平均最近距离
+func meanDistance(from, to []kerfContour) float64 {
+	total := 0
+	for i := range from {
+		total += len(from[i].points)
+	}
+	step := (total + maxKerfSamples - 1) / maxKerfSamples
+	sum, samples := 0.0, 0
+	k := 0
+	for i := range from {
+		for _, p := range from[i].points {
+			k++
+			if k%step != 0 {
+				continue
+			}
+			sum += nearestDistance(p, to)
+			samples++
+		}
+	}
+	if samples == 0 {
+		return 0
+	}
+	return sum / float64(samples)
+}
+
+// nearestDistance 点到轮廓折线的最近距离(XY)
+func nearestDistance(p gcode.Point, contours []kerfContour) float64 {
+	best := math.Inf(1)
+	for i := range contours {
+		best = math.Min(best, polylineDistance(p, contours[i].points))
+	}
+	return best
+}
+
+// polylineDistance 点到折线的最近距离(XY)
+func polylineDistance(p gcode.Point, points []gcode.Point) float64 {
+	best := math.Inf(1)
+	for j := 1; j < len(points); j++ {
+		best = math.Min(best, pointSegmentDistance(p, points[j-1], points[j]))
+	}
+	return best
+}
+
+// pointSegmentDistance 点到线段的距离(XY)
+func pointSegmentDistance(p, a, b gcode.Point) float64 {
+	dx, dy := b.X-a.X, b.Y-a.Y
+	t := 0.0
+	if l2 := dx*dx + dy*dy; l2 > 0 {
+		t = math.Max(0, math.Min(1, ((p.X-a.X)*dx+(p.Y-a.Y)*dy)/l2))
+	}
+	return math.Hypot(p.X-(a.X+t*dx), p.Y-(a.Y+t*dy))
+}
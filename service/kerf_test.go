@@ -0,0 +1,125 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"ok/gcode"
+	"ok/model"
+	"strings"
+	"testing"
+)
+
+// rectPath 矩形轮廓的切割段，从左下角逆时针
+func rectPath(x0, y0, x1, y1 float64) []gcode.Segment {
+	points := []gcode.Point{{X: x0, Y: y0}, {X: x1, Y: y0}, {X: x1, Y: y1}, {X: x0, Y: y1}, {X: x0, Y: y0}}
+	segments := make([]gcode.Segment, 0, len(points)-1)
+	for i := 1; i < len(points); i++ {
+		segments = append(segments, gcode.Segment{Motion: gcode.MotionLinear, From: points[i-1], To: points[i], SpindleOn: true})
+	}
+	return segments
+}
+
+// joinPaths 连接多个轮廓，轮廓之间快速移动
+func joinPaths(paths ...[]gcode.Segment) []gcode.Segment {
+	var segments []gcode.Segment
+	for _, p := range paths {
+		if n := len(segments); n > 0 {
+			segments = append(segments, gcode.Segment{Motion: gcode.MotionRapid, From: segments[n-1].To, To: p[0].From})
+		}
+		segments = append(segments, p...)
+	}
+	return segments
+}
+
+func TestMaterialArea(t *testing.T) {
+	tests := []struct {
+		name      string
+		segments  []gcode.Segment
+		area      float64
+		perimeter float64
+	}{
+		{"单个外轮廓", rectPath(0, 0, 10, 10), 100, 40},
+		{"内孔的面积扣除", joinPaths(rectPath(0, 0, 10, 10), rectPath(4, 4, 6, 6)), 96, 48},
+		{"并列的两个零件", joinPaths(rectPath(0, 0, 10, 10), rectPath(20, 0, 22, 2)), 104, 48},
+		{"孔中的零件", joinPaths(rectPath(0, 0, 10, 10), rectPath(2, 2, 8, 8), rectPath(4, 4, 6, 6)), 100 - 36 + 4, 40 + 24 + 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			area, perimeter := materialArea(closedContours(tt.segments))
+			if math.Abs(area-tt.area) > 1e-9 || math.Abs(perimeter-tt.perimeter) > 1e-9 {
+				t.Errorf("materialArea = %v, %v, want %v, %v", area, perimeter, tt.area, tt.perimeter)
+			}
+		})
+	}
+}
+
+func TestMeasureOffset(t *testing.T) {
+	part := joinPaths(rectPath(0, 0, 10, 10), rectPath(4, 4, 6, 6))
+	tests := []struct {
+		name     string
+		b        []gcode.Segment
+		expected float64
+		observed float64
+		status   string
+	}{
+		{"向外偏移与声明一致", joinPaths(rectPath(-0.1, -0.1, 10.1, 10.1), rectPath(4.1, 4.1, 5.9, 5.9)), 0.1, 0.1, model.KerfMatch},
+		{"没有声明偏移", joinPaths(rectPath(-0.1, -0.1, 10.1, 10.1), rectPath(4.1, 4.1, 5.9, 5.9)), 0, 0.1, model.KerfMismatch},
+		{"偏移方向相反", joinPaths(rectPath(0.1, 0.1, 9.9, 9.9), rectPath(3.9, 3.9, 6.1, 6.1)), 0.1, -0.1, model.KerfMismatch},
+		{"没有变化", part, 0, 0, model.KerfMatch},
+		{"轮廓移动", joinPaths(rectPath(3, 0, 13, 10), rectPath(7, 4, 9, 6)), 0, 0, model.KerfShapeChanged},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			el := model.KerfElement{Expected: tt.expected}
+			measureOffset(&el, part, tt.b)
+			if el.Status != tt.status || math.Abs(el.Observed-tt.observed) > 0.005 {
+				t.Errorf("Status = %s, Observed = %.4f, want %s, %.4f", el.Status, el.Observed, tt.status, tt.observed)
+			}
+			if el.Contours != 2 {
+				t.Errorf("Contours = %d, want 2", el.Contours)
+			}
+		})
+	}
+
+	el := model.KerfElement{Status: model.KerfUnknown}
+	open := []gcode.Segment{{Motion: gcode.MotionLinear, To: gcode.Point{X: 10}, SpindleOn: true}}
+	measureOffset(&el, open, open)
+	if el.Status != model.KerfUnknown || el.Note == "" {
+		t.Errorf("没有闭合轮廓: %+v", el)
+	}
+}
+
+func TestCompareKerf(t *testing.T) {
+	square := func(d float64) string {
+		return fmt.Sprintf("G0 X%[1]g Y%[1]g\nM3 S500\nG1 X%[2]g F1000\nY%[2]g\nX%[1]g\nY%[1]g\nM5\n", -d, 10+d)
+	}
+	s := NewGCodeService()
+	read := func(src string) *elementPaths {
+		t.Helper()
+		paths, err := s.readElements(strings.NewReader(src), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return paths
+	}
+	a := read("; element: 外框\n" + square(0) + "; element: 内件\n" + square(0))
+	b := read("; element: 外框\n" + square(0.1) + "; element: 内件\n" + square(0.2))
+	paramsA := &MachineParams{Kerfs: []ElementKerf{{Enabled: false}, {Enabled: false}, {Enabled: true, Distance: 1}}}
+	paramsB := &MachineParams{Kerfs: []ElementKerf{{Enabled: true, Distance: 0.1}, {Enabled: true, Distance: 0.1}}}
+
+	check := s.compareKerf(a, b, paramsA, paramsB)
+	var got []string
+	for _, el := range check.Elements {
+		got = append(got, fmt.Sprintf("%d %s %s", el.Index, el.Name, el.Status))
+	}
+	want := []string{"0 外框 match", "1 内件 mismatch", "2  unknown"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Elements = %v, want %v", got, want)
+	}
+	if check.Mismatches != 1 {
+		t.Errorf("Mismatches = %d, want 1", check.Mismatches)
+	}
+	if empty := s.compareKerf(nil, nil, paramsA, paramsB); len(empty.Elements) != 0 {
+		t.Errorf("没有启用切缝补偿时检查了 %d 个元素", len(empty.Elements))
+	}
+}
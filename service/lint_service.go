@@ -0,0 +1,23 @@
+package service
+
+import (
+	"io"
+	"ok/lint"
+	"ok/model"
+)
+
+// Lint 检查G-code文件
+func (s *GCodeService) Lint(name string, gcode io.Reader, profile *model.MachineProfile, cfg *lint.Config) (*model.LintReport, error) {
+	linter, err := lint.New(cfg, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := linter.Run(gcode)
+	if err != nil {
+		return nil, err
+	}
+	report.File = name
+
+	return report, nil
+}
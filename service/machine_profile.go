@@ -0,0 +1,62 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"ok/gcode"
+	"ok/model"
+)
+
+// DefaultMachineProfile 默认机器配置
+func DefaultMachineProfile() *model.MachineProfile {
+	return &model.MachineProfile{
+		Name:      "default",
+		BedWidth:  400,
+		BedHeight: 400,
+		Laser:     true,
+	}
+}
+
+// LoadMachineProfile 加载机器配置
+// 先读取manifest中的machine_settings，再用单独上传的配置文件覆盖
+func (s *GCodeService) LoadMachineProfile(manifestContent, profileContent []byte) (*model.MachineProfile, error) {
+	profile := DefaultMachineProfile()
+
+	if len(manifestContent) > 0 {
+		var manifest map[string]interface{}
+		if err := json.Unmarshal(manifestContent, &manifest); err != nil {
+			return nil, fmt.Errorf("解析manifest失败: %v", err)
+		}
+		if settings, ok := manifest["machine_settings"].(map[string]interface{}); ok {
+			if name, ok := settings["name"].(string); ok {
+				profile.Name = name
+			}
+			if width, ok := settings["bed_width"].(float64); ok {
+				profile.BedWidth = width
+			}
+			if height, ok := settings["bed_height"].(float64); ok {
+				profile.BedHeight = height
+			}
+			if feed, ok := settings["max_feed"].(float64); ok {
+				profile.MaxFeed = feed
+			}
+			if laser, ok := settings["laser"].(bool); ok {
+				profile.Laser = laser
+			}
+			if dialect, ok := settings["dialect"].(string); ok {
+				profile.Dialect = dialect
+			}
+		}
+	}
+
+	if len(profileContent) > 0 {
+		if err := json.Unmarshal(profileContent, profile); err != nil {
+			return nil, fmt.Errorf("解析机器配置失败: %v", err)
+		}
+	}
+	if _, ok := gcode.LookupDialect(profile.Dialect); !ok {
+		return nil, fmt.Errorf("未知的控制器方言: %s", profile.Dialect)
+	}
+
+	return profile, nil
+}
@@ -0,0 +1,423 @@
+package service
+
+import (
+	"bytes"
+	"math"
+	"ok/gcode"
+	"ok/model"
+	"strconv"
+	"strings"
+)
+
+// 运动规划的默认值
+const (
+	defaultJunctionDeviation = 0.02 // 拐角偏差(mm)
+	minPlannerSpeed          = 1.0  // 最小速度(mm/s)，避免除以0
+)
+
+// motionLimits 运动规划使用的机器限制，文件中的设置命令可以在程序中途修改
+// 作为设置命令的修改内容时，值为0表示不修改
+type motionLimits struct {
+	workingFeed       float64    // 未设置F时的加工速度(mm/min)
+	rapidFeed         float64    // 快速移动速度(mm/min)
+	maxFeed           float64    // 合成速度上限(mm/min)，0表示不限制
+	axisFeed          [2]float64 // X/Y 轴速度上限(mm/min)，0表示不限制
+	accel             float64    // 加工加速度(mm/s²)
+	rapidAccel        float64    // 快速移动加速度(mm/s²)
+	axisAccel         [2]float64 // X/Y 轴加速度上限(mm/s²)，0表示不限制
+	junctionDeviation float64    // 拐角偏差(mm)
+	cornerVelocity    float64    // 直角拐角速度(mm/s)，不为0时代替拐角偏差
+}
+
+// newMotionLimits 使用机器参数创建运动限制
+func newMotionLimits(params *MachineParams) motionLimits {
+	return motionLimits{
+		workingFeed:       params.WorkingSpeed,
+		rapidFeed:         params.RapidSpeed,
+		accel:             params.WorkingAccel,
+		rapidAccel:        params.RapidAccel,
+		junctionDeviation: defaultJunctionDeviation,
+	}
+}
+
+// apply 应用设置命令的修改
+func (l *motionLimits) apply(c *motionLimits) {
+	set := func(dst *float64, v float64) {
+		if v > 0 {
+			*dst = v
+		}
+	}
+	set(&l.maxFeed, c.maxFeed)
+	set(&l.accel, c.accel)
+	set(&l.rapidAccel, c.rapidAccel)
+	for i := range l.axisFeed {
+		set(&l.axisFeed[i], c.axisFeed[i])
+		set(&l.axisAccel[i], c.axisAccel[i])
+	}
+	// 拐角偏差和拐角速度是两种拐角模型，以最后设置的为准
+	if c.junctionDeviation > 0 {
+		l.junctionDeviation, l.cornerVelocity = c.junctionDeviation, 0
+	}
+	if c.cornerVelocity > 0 {
+		l.cornerVelocity = c.cornerVelocity
+	}
+}
+
+// speed 计算移动的目标速度(mm/s)，ux/uy为单位方向，feed为当前F值
+func (l *motionLimits) speed(ux, uy float64, rapid bool, feed float64) float64 {
+	v := l.rapidFeed
+	if !rapid {
+		v = feed
+		if v <= 0 {
+			v = l.workingFeed
+		}
+	}
+	if l.maxFeed > 0 {
+		v = math.Min(v, l.maxFeed)
+	}
+	return math.Max(axisLimited(v, l.axisFeed, ux, uy)/60, minPlannerSpeed)
+}
+
+// acceleration 计算移动的加速度(mm/s²)
+func (l *motionLimits) acceleration(ux, uy float64, rapid bool) float64 {
+	a := l.accel
+	if rapid {
+		a = l.rapidAccel
+	}
+	return math.Max(axisLimited(a, l.axisAccel, ux, uy), minPlannerSpeed)
+}
+
+// axisLimited 按各轴上限限制合成值，单轴分量不能超过该轴的上限
+func axisLimited(v float64, limits [2]float64, ux, uy float64) float64 {
+	for i, u := range [2]float64{ux, uy} {
+		if u = math.Abs(u); limits[i] > 0 && u > 1e-9 {
+			v = math.Min(v, limits[i]/u)
+		}
+	}
+	return v
+}
+
+// direction 单位方向
+type direction struct {
+	x, y, z float64
+}
+
+// plannedMove 等待规划的移动
+type plannedMove struct {
+	length   float64
+	in, out  direction // 起点和终点的运动方向，直线两者相同，圆弧为切线方向
+	speed    float64   // 目标速度(mm/s)
+	accel    float64   // 加速度(mm/s²)
+	junction float64   // 与上一段连接处的最大速度(mm/s)
+	rapid    bool
+}
+
+// plannerBufferSize 规划缓冲区的移动数，与 GRBL/Marlin 的默认值相同
+const plannerBufferSize = 16
+
+// motionPlanner 简化的运动规划器，按梯形速度曲线估算每段移动的时间
+// 拐角速度按 GRBL/Marlin 的拐角偏差算法计算；和固件一样只缓冲有限的移动，
+// 反向规划假设缓冲区的最后一段要停止，保证之后的移动都能及时减速
+type motionPlanner struct {
+	limits motionLimits
+	time   *model.TimeAnalysis
+	moves  []plannedMove // 规划缓冲区
+	entry  float64       // 缓冲区第一段的入口速度(mm/s)
+}
+
+func newMotionPlanner(params *MachineParams, time *model.TimeAnalysis) *motionPlanner {
+	return &motionPlanner{
+		limits: newMotionLimits(params),
+		time:   time,
+		moves:  make([]plannedMove, 0, plannerBufferSize+1),
+	}
+}
+
+// apply 应用文件中的设置命令，之后的移动使用新的限制
+func (p *motionPlanner) apply(change *motionLimits) {
+	p.limits.apply(change)
+	p.time.SettingCommands++
+}
+
+// add 添加一个运动段，圆弧按弧长和起点、终点的切线方向规划
+func (p *motionPlanner) add(seg *gcode.Segment) {
+	length := seg.Length()
+	if length <= 0 {
+		return
+	}
+	m := plannedMove{length: length, rapid: seg.IsRapid()}
+	m.in, m.out = segmentDirections(seg, length)
+	m.speed = p.limits.speed(m.in.x, m.in.y, m.rapid, seg.Feed)
+	m.accel = p.limits.acceleration(m.in.x, m.in.y, m.rapid)
+	if n := len(p.moves); n > 0 {
+		m.junction = p.junctionSpeed(&p.moves[n-1], &m)
+	}
+
+	p.moves = append(p.moves, m)
+	if len(p.moves) > plannerBufferSize {
+		p.next()
+	}
+}
+
+// next 规划缓冲区的第一段移动并移出缓冲区
+// 反向从最后一段的停止速度推算第二段的最大入口速度，作为第一段的出口速度
+func (p *motionPlanner) next() {
+	exit := 0.0
+	for i := len(p.moves) - 1; i > 0; i-- {
+		m := &p.moves[i]
+		exit = math.Min(m.junction, math.Sqrt(exit*exit+2*m.accel*m.length))
+	}
+	p.finish(&p.moves[0], exit)
+	p.moves = p.moves[:copy(p.moves, p.moves[1:])]
+}
+
+// stop 规划缓冲区的所有移动，最后一段减速到停止
+func (p *motionPlanner) stop() {
+	for len(p.moves) > 0 {
+		p.next()
+	}
+}
+
+// dwell 暂停，之前的移动减速到停止
+func (p *motionPlanner) dwell(seconds float64) {
+	p.stop()
+	p.time.DwellTime += seconds
+}
+
+// flush 规划剩余的移动，结束时停止
+func (p *motionPlanner) flush() {
+	p.stop()
+	p.time.TotalTime = p.time.WorkingTime + p.time.RapidTime + p.time.AccelTime + p.time.DwellTime
+}
+
+// junctionSpeed 计算两段移动连接处的最大速度(mm/s)
+func (p *motionPlanner) junctionSpeed(a, b *plannedMove) float64 {
+	vmax := math.Min(a.speed, b.speed)
+	cos := -(a.out.x*b.in.x + a.out.y*b.in.y + a.out.z*b.in.z)
+	switch {
+	case cos > 0.999999:
+		// 反向
+		return 0
+	case cos < -0.999999:
+		// 同一方向
+		return vmax
+	}
+	accel := math.Min(a.accel, b.accel)
+	deviation := p.limits.junctionDeviation
+	if cv := p.limits.cornerVelocity; cv > 0 {
+		// Klipper 的直角拐角速度换算为拐角偏差
+		deviation = cv * cv * (math.Sqrt2 - 1) / accel
+	}
+	sinHalf := math.Sqrt(0.5 * (1 - cos))
+	return math.Min(vmax, math.Sqrt(accel*deviation*sinHalf/(1-sinHalf)))
+}
+
+// finish 按梯形速度曲线计算一段移动的时间，exit为出口速度上限
+// 匀速部分计入加工或快速移动时间，加减速多用的时间计入加减速时间
+func (p *motionPlanner) finish(m *plannedMove, exit float64) {
+	v, a, length := m.speed, m.accel, m.length
+	v0 := math.Min(p.entry, v)
+	v1 := math.Min(math.Min(exit, v), math.Sqrt(v0*v0+2*a*length))
+
+	var t float64
+	accelDist := (v*v - v0*v0) / (2 * a)
+	decelDist := (v*v - v1*v1) / (2 * a)
+	if accelDist+decelDist <= length {
+		t = (v-v0)/a + (v-v1)/a + (length-accelDist-decelDist)/v
+	} else {
+		// 达不到目标速度，反向规划保证能从 v0 减速到 v1
+		peak := math.Sqrt((2*a*length + v0*v0 + v1*v1) / 2)
+		t = (peak-v0)/a + (peak-v1)/a
+	}
+
+	cruise := length / v
+	if m.rapid {
+		p.time.RapidTime += cruise
+	} else {
+		p.time.WorkingTime += cruise
+	}
+	p.time.AccelTime += math.Max(t-cruise, 0)
+	p.entry = v1
+}
+
+// segmentDirections 计算运动段起点和终点的单位方向，length为运动段长度
+// 圆弧的平面方向为切线方向，螺旋线的 Z 分量按升高占长度的比例计算
+func segmentDirections(seg *gcode.Segment, length float64) (direction, direction) {
+	if !seg.IsArc() {
+		d := direction{(seg.To.X - seg.From.X) / length, (seg.To.Y - seg.From.Y) / length, (seg.To.Z - seg.From.Z) / length}
+		return d, d
+	}
+	uz := (seg.To.Z - seg.From.Z) / length
+	planar := math.Sqrt(math.Max(0, 1-uz*uz))
+	r := seg.Radius()
+	tangent := func(p gcode.Point) direction {
+		rx, ry := (p.X-seg.Center.X)/r, (p.Y-seg.Center.Y)/r
+		if seg.Motion == gcode.MotionCW {
+			return direction{ry * planar, -rx * planar, uz}
+		}
+		return direction{-ry * planar, rx * planar, uz}
+	}
+	if r <= 0 {
+		return direction{z: 1}, direction{z: 1}
+	}
+	return tangent(seg.From), tangent(seg.To)
+}
+
+// velocityLimitName Klipper 修改运动限制的命令
+const velocityLimitName = "SET_VELOCITY_LIMIT"
+
+var velocityLimitCommand = []byte(velocityLimitName)
+
+// isSettingLine 是否为 GRBL 设置或 Klipper SET_VELOCITY_LIMIT 命令
+func isSettingLine(line []byte) bool {
+	line = bytes.TrimLeft(line, " \t")
+	if len(line) == 0 {
+		return false
+	}
+	if line[0] == '$' {
+		return true
+	}
+	return len(line) >= len(velocityLimitCommand) && bytes.EqualFold(line[:len(velocityLimitCommand)], velocityLimitCommand)
+}
+
+// settingLimits 返回修改运动限制的设置命令的修改内容，不是设置命令时返回nil
+// 支持 Marlin 的 M201/M203/M204/M205、Klipper 的 SET_VELOCITY_LIMIT 和 GRBL 的 $11、$110/$111、$120/$121；
+// Marlin/Klipper 方言把 M201-M205 转为扩展命令，按原始内容解析
+func settingLimits(b *gcode.Block, lex *gcode.Lexer) *motionLimits {
+	raw := strings.TrimLeft(b.Raw, " \t")
+	isSetting := strings.HasPrefix(raw, "$") ||
+		(len(raw) >= len(velocityLimitName) && strings.EqualFold(raw[:len(velocityLimitName)], velocityLimitName))
+	if b.Command == "" && !isSetting && !hasSettingCode(b) {
+		return nil
+	}
+	limits := &motionLimits{}
+	line := bytes.TrimLeft([]byte(b.Raw), " \t")
+	switch {
+	case len(line) > 0 && line[0] == '$':
+		if !parseGrblSetting(line[1:], limits) {
+			return nil
+		}
+	case isSettingLine(line):
+		parseVelocityLimit(line[len(velocityLimitCommand):], limits)
+	default:
+		if !parseMarlinSetting(line, lex, limits) {
+			return nil
+		}
+	}
+	return limits
+}
+
+// hasSettingCode 程序段中是否有修改运动限制的 M 命令
+func hasSettingCode(b *gcode.Block) bool {
+	for _, w := range b.Words {
+		if w.Letter == 'M' && isSettingCode(w.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseGrblSetting 解析 GRBL 的 $<编号>=<值> 设置
+func parseGrblSetting(line []byte, limits *motionLimits) bool {
+	if i := bytes.IndexAny(line, ";("); i >= 0 {
+		line = line[:i]
+	}
+	key, value, ok := bytes.Cut(line, []byte("="))
+	if !ok {
+		return false
+	}
+	v, err := strconv.ParseFloat(string(bytes.TrimSpace(value)), 64)
+	if err != nil || v <= 0 {
+		return false
+	}
+	switch string(bytes.TrimSpace(key)) {
+	case "11":
+		limits.junctionDeviation = v
+	case "110":
+		limits.axisFeed[0] = v
+	case "111":
+		limits.axisFeed[1] = v
+	case "120":
+		limits.axisAccel[0] = v
+	case "121":
+		limits.axisAccel[1] = v
+	default:
+		return false
+	}
+	return true
+}
+
+// parseVelocityLimit 解析 Klipper 的 SET_VELOCITY_LIMIT 参数，速度单位为 mm/s
+func parseVelocityLimit(params []byte, limits *motionLimits) {
+	if i := bytes.IndexByte(params, ';'); i >= 0 {
+		params = params[:i]
+	}
+	for _, field := range bytes.Fields(params) {
+		name, value, ok := bytes.Cut(field, []byte("="))
+		if !ok {
+			continue
+		}
+		v, err := strconv.ParseFloat(string(value), 64)
+		if err != nil || v <= 0 {
+			continue
+		}
+		switch string(bytes.ToUpper(name)) {
+		case "VELOCITY":
+			limits.maxFeed = v * 60
+		case "ACCEL":
+			limits.accel, limits.rapidAccel = v, v
+		case "SQUARE_CORNER_VELOCITY":
+			limits.cornerVelocity = v
+		}
+	}
+}
+
+// parseMarlinSetting 解析 Marlin 的运动设置命令，速度单位为 mm/s
+// M201 X/Y 轴最大加速度；M203 X/Y 轴最大速度；M204 P 加工、T 空程、S 两者的加速度；
+// M205 J 拐角偏差，X/Y 为 jerk，按直角拐角速度处理
+func parseMarlinSetting(line []byte, lex *gcode.Lexer, limits *motionLimits) bool {
+	var tok gcode.Token
+	code := 0.0
+	lex.Reset(line)
+	for lex.Next(&tok) {
+		if tok.Kind != gcode.TokenWord {
+			continue
+		}
+		if tok.Letter == 'M' {
+			code = tok.Value
+			continue
+		}
+		v := tok.Value
+		if v <= 0 {
+			continue
+		}
+		switch {
+		case code == 201 && tok.Letter == 'X':
+			limits.axisAccel[0] = v
+		case code == 201 && tok.Letter == 'Y':
+			limits.axisAccel[1] = v
+		case code == 203 && tok.Letter == 'X':
+			limits.axisFeed[0] = v * 60
+		case code == 203 && tok.Letter == 'Y':
+			limits.axisFeed[1] = v * 60
+		case code == 204 && tok.Letter == 'S':
+			limits.accel, limits.rapidAccel = v, v
+		case code == 204 && tok.Letter == 'P':
+			limits.accel = v
+		case code == 204 && tok.Letter == 'T':
+			limits.rapidAccel = v
+		case code == 205 && tok.Letter == 'J':
+			limits.junctionDeviation = v
+		case code == 205 && (tok.Letter == 'X' || tok.Letter == 'Y'):
+			if limits.cornerVelocity == 0 || v < limits.cornerVelocity {
+				limits.cornerVelocity = v
+			}
+		}
+	}
+	return isSettingCode(code)
+}
+
+// isSettingCode 是否为修改运动限制的 M 命令
+func isSettingCode(code float64) bool {
+	return code == 201 || code == 203 || code == 204 || code == 205
+}
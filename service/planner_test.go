@@ -0,0 +1,91 @@
+package service
+
+import (
+	"math"
+	"ok/gcode"
+	"ok/model"
+	"testing"
+)
+
+// planTime 规划一组直线移动，返回总时间
+func planTime(points []gcode.Point, feed float64) model.TimeAnalysis {
+	var time model.TimeAnalysis
+	p := newMotionPlanner(&MachineParams{RapidSpeed: 6000, WorkingSpeed: 1200, RapidAccel: 1000, WorkingAccel: 1000}, &time)
+	for i := 1; i < len(points); i++ {
+		p.add(&gcode.Segment{Motion: gcode.MotionLinear, From: points[i-1], To: points[i], Feed: feed})
+	}
+	p.flush()
+	return time
+}
+
+// trapezoidTime 从静止加速到 v 再减速到静止走完 length 的时间
+func trapezoidTime(length, v, a float64) float64 {
+	if v*v/a > length {
+		return 2 * math.Sqrt(length/a)
+	}
+	return length/v + v/a
+}
+
+func TestMotionPlanner(t *testing.T) {
+	line := func(n int, length float64) []gcode.Point {
+		points := make([]gcode.Point, n+1)
+		for i := range points {
+			points[i].X = length * float64(i) / float64(n)
+		}
+		return points
+	}
+	tests := []struct {
+		name   string
+		points []gcode.Point
+		feed   float64
+		want   float64
+	}{
+		{"单段", line(1, 100), 1200, trapezoidTime(100, 20, 1000)},
+		{"同一直线分成多段", line(50, 100), 1200, trapezoidTime(100, 20, 1000)},
+		// 每段都很短，只看一段时最后几段来不及减速
+		{"短段达不到目标速度", line(12, 2), 6000, trapezoidTime(2, 100, 1000)},
+		{"反向在连接处停止", []gcode.Point{{}, {X: 10}, {}}, 1200, 2 * trapezoidTime(10, 20, 1000)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			time := planTime(tt.points, tt.feed)
+			if math.Abs(time.TotalTime-tt.want) > 1e-9 {
+				t.Errorf("TotalTime = %v, want %v", time.TotalTime, tt.want)
+			}
+		})
+	}
+}
+
+func TestMotionPlannerCorner(t *testing.T) {
+	straight := planTime([]gcode.Point{{}, {X: 10}, {X: 20}}, 1200).TotalTime
+	corner := planTime([]gcode.Point{{}, {X: 10}, {X: 10, Y: 10}}, 1200).TotalTime
+	stop := 2 * trapezoidTime(10, 20, 1000)
+	// 直角拐角要减速，但不需要停止
+	if !(straight < corner && corner < stop) {
+		t.Errorf("straight %v, corner %v, stop %v", straight, corner, stop)
+	}
+}
+
+func TestSettingLimits(t *testing.T) {
+	lex := &gcode.Lexer{}
+	tests := []struct {
+		line string
+		want *motionLimits
+	}{
+		{"G1 X10", nil},
+		{"$110=3000", &motionLimits{axisFeed: [2]float64{3000, 0}}},
+		{"$11=0.05", &motionLimits{junctionDeviation: 0.05}},
+		{"SET_VELOCITY_LIMIT VELOCITY=100 ACCEL=2000", &motionLimits{maxFeed: 6000, accel: 2000, rapidAccel: 2000}},
+		{"M204 P800 T1500", &motionLimits{accel: 800, rapidAccel: 1500}},
+		{"M203 X200 Y100", &motionLimits{axisFeed: [2]float64{12000, 6000}}},
+		{"M205 J0.01", &motionLimits{junctionDeviation: 0.01}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got := settingLimits(gcode.ParseLine(tt.line, 1), lex)
+			if (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+				t.Errorf("settingLimits(%q) = %+v, want %+v", tt.line, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"fmt"
+	"image/png"
+	"io"
+	"ok/gcode"
+	"ok/model"
+	"ok/render"
+)
+
+// RenderSVG 将G-code渲染为SVG图片
+// profile 为可选的机器配置，设置了刀具直径时按刀具半径补偿后的路径渲染
+func (s *GCodeService) RenderSVG(w io.Writer, content io.Reader, profile *model.MachineProfile, opts render.Options) error {
+	segments, err := readSegments(content, profile)
+	if err != nil {
+		return err
+	}
+	return render.SVG(w, segments, opts)
+}
+
+// RenderOverlayPNG 将A、B两个版本的路径叠加渲染为PNG图片
+func (s *GCodeService) RenderOverlayPNG(w io.Writer, contentA, contentB io.Reader, profileA, profileB *model.MachineProfile, opts render.OverlayOptions) (render.OverlayStats, error) {
+	segmentsA, err := readSegments(contentA, profileA)
+	if err != nil {
+		return render.OverlayStats{}, fmt.Errorf("解析G-code A失败: %v", err)
+	}
+	segmentsB, err := readSegments(contentB, profileB)
+	if err != nil {
+		return render.OverlayStats{}, fmt.Errorf("解析G-code B失败: %v", err)
+	}
+
+	img, stats := render.Overlay(segmentsA, segmentsB, opts)
+	if err := png.Encode(w, img); err != nil {
+		return stats, fmt.Errorf("生成PNG失败: %v", err)
+	}
+	return stats, nil
+}
+
+// RenderStoredOverlayPNG 将保存的比较结果中A、B两个版本叠加渲染为PNG图片
+func (s *GCodeService) RenderStoredOverlayPNG(w io.Writer, stored *StoredResult, opts render.OverlayOptions) (render.OverlayStats, error) {
+	contentA, err := stored.GCodeA.Open()
+	if err != nil {
+		return render.OverlayStats{}, err
+	}
+	defer contentA.Close()
+	contentB, err := stored.GCodeB.Open()
+	if err != nil {
+		return render.OverlayStats{}, err
+	}
+	defer contentB.Close()
+	return s.RenderOverlayPNG(w, contentA, contentB, stored.ProfileA, stored.ProfileB, opts)
+}
+
+// readSegments 读取所有运动段，profile 为空时按通用方言解释
+// 使用机器配置时方言、工件坐标系和刀具表都取自配置，刀具半径补偿按刀具直径计算
+func readSegments(r io.Reader, profile *model.MachineProfile) ([]gcode.Segment, error) {
+	if profile == nil {
+		return gcode.ReadSegments(r)
+	}
+	var segments []gcode.Segment
+	err := gcode.Run(r, gcode.NewInterpreterFor(profile), func(b *gcode.Block, segs []gcode.Segment) error {
+		segments = append(segments, segs...)
+		return nil
+	})
+	return segments, err
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"ok/input"
+	"ok/model"
+	"sync"
+)
+
+// maxStoredResults 内存中最多保留的比较结果数量
+const maxStoredResults = 20
+
+// StoredResult 保存的比较结果及其原始文件，供渲染和导出使用
+type StoredResult struct {
+	Result    *model.CompareResult
+	GCodeA    *input.Content
+	GCodeB    *input.Content
+	ManifestA []byte
+	ManifestB []byte
+	ProfileA  *model.MachineProfile // 比较时使用的机器配置，渲染时按其中的刀具直径计算半径补偿
+	ProfileB  *model.MachineProfile
+}
+
+// GCode 返回指定版本(a/b)的G-code内容
+func (r *StoredResult) GCode(version string) (*input.Content, bool) {
+	switch version {
+	case "a", "A":
+		return r.GCodeA, true
+	case "b", "B":
+		return r.GCodeB, true
+	}
+	return nil, false
+}
+
+// Profile 返回指定版本(a/b)的机器配置
+func (r *StoredResult) Profile(version string) *model.MachineProfile {
+	switch version {
+	case "a", "A":
+		return r.ProfileA
+	case "b", "B":
+		return r.ProfileB
+	}
+	return nil
+}
+
+// Close 释放G-code内容，删除转存的临时文件
+func (r *StoredResult) Close() error {
+	errA := r.GCodeA.Close()
+	if err := r.GCodeB.Close(); err != nil {
+		return err
+	}
+	return errA
+}
+
+// resultStore 比较结果缓存，超出容量时淘汰最早的结果并释放其G-code内容
+type resultStore struct {
+	mu    sync.Mutex
+	items map[string]*StoredResult
+	order []string
+}
+
+func newResultStore() *resultStore {
+	return &resultStore{items: make(map[string]*StoredResult)}
+}
+
+// save 保存结果并返回ID
+func (s *resultStore) save(item *StoredResult) string {
+	id := newResultID()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.items[id] = item
+	s.order = append(s.order, id)
+	for len(s.order) > maxStoredResults {
+		s.items[s.order[0]].Close()
+		delete(s.items, s.order[0])
+		s.order = s.order[1:]
+	}
+	return id
+}
+
+// get 获取结果
+func (s *resultStore) get(id string) (*StoredResult, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.items[id]
+	return item, ok
+}
+
+// newResultID 生成随机结果ID
+func newResultID() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
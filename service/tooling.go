@@ -0,0 +1,296 @@
+package service
+
+import (
+	"io"
+	"math"
+	"ok/gcode"
+	"ok/model"
+	"sort"
+)
+
+// toolingBuilder 刀具、主轴与冷却统计的累加器
+type toolingBuilder struct {
+	report  model.ToolingReport
+	params  *MachineParams
+	tools   map[int]*model.ToolUsage
+	ranges  map[int]*rangeBuilder // 每把刀加工时的主轴转速范围
+	order   []int
+	changes int // 最后一次记录刀具顺序时的换刀次数，-1 表示还没有运动
+	dwell   float64
+	spindle rangeBuilder
+	// 上一段执行后的状态，用于统计启动次数
+	spindleOn, coolantOn bool
+}
+
+// rangeBuilder 数值范围累加器
+type rangeBuilder struct {
+	min, max float64
+	empty    bool
+}
+
+func newRangeBuilder() rangeBuilder {
+	return rangeBuilder{min: math.MaxFloat64, max: -math.MaxFloat64, empty: true}
+}
+
+func (r *rangeBuilder) add(v float64) {
+	r.min, r.max = math.Min(r.min, v), math.Max(r.max, v)
+	r.empty = false
+}
+
+func (r *rangeBuilder) axisRange() model.AxisRange {
+	if r.empty {
+		return model.AxisRange{}
+	}
+	return model.AxisRange{Min: r.min, Max: r.max}
+}
+
+// tool 返回刀具的统计，第一次使用时创建
+func (t *toolingBuilder) tool(n int) *model.ToolUsage {
+	usage, ok := t.tools[n]
+	if !ok {
+		usage = &model.ToolUsage{Tool: n}
+		r := newRangeBuilder()
+		t.tools[n], t.ranges[n] = usage, &r
+		t.order = append(t.order, n)
+	}
+	return usage
+}
+
+func newToolingBuilder(params *MachineParams) *toolingBuilder {
+	return &toolingBuilder{
+		report: model.ToolingReport{
+			Tools:    make([]model.ToolUsage, 0),
+			Sequence: make([]int, 0),
+		},
+		params:  params,
+		tools:   map[int]*model.ToolUsage{},
+		ranges:  map[int]*rangeBuilder{},
+		changes: -1,
+		spindle: newRangeBuilder(),
+	}
+}
+
+// block 累加一个程序段执行后的状态和产生的运动段
+func (t *toolingBuilder) block(b *gcode.Block, st *gcode.State, segments []gcode.Segment) {
+	if st.SpindleOn && !t.spindleOn {
+		t.report.Spindle.Starts++
+	}
+	if st.SpindleOn && st.SpindleCCW {
+		t.report.Spindle.Reverse = true
+	}
+	coolantOn := st.Mist || st.Flood
+	if coolantOn && !t.coolantOn {
+		t.report.Coolant.Starts++
+	}
+	t.spindleOn, t.coolantOn = st.SpindleOn, coolantOn
+
+	if st.Dwell > t.dwell {
+		t.tool(st.Tool).Time += st.Dwell - t.dwell
+		t.dwell = st.Dwell
+	}
+	if len(segments) == 0 {
+		return
+	}
+
+	usage := t.tool(st.Tool)
+	if st.ToolChanges != t.changes {
+		t.changes = st.ToolChanges
+		t.report.Sequence = append(t.report.Sequence, st.Tool)
+		usage.Loads++
+	}
+	for i := range segments {
+		seg := &segments[i]
+		length := seg.Length()
+		// 速度未设置(为0)时不估算时间
+		if seg.IsRapid() {
+			usage.RapidLength += length
+			if t.params.RapidSpeed > 0 {
+				usage.Time += length / t.params.RapidSpeed * 60
+			}
+			continue
+		}
+
+		feed := seg.Feed
+		if feed <= 0 {
+			feed = t.params.WorkingSpeed
+		}
+		usage.WorkingLength += length
+		if feed > 0 {
+			usage.Time += length / feed * 60
+		}
+
+		if seg.SpindleOn {
+			t.spindle.add(seg.Power)
+			t.ranges[st.Tool].add(seg.Power)
+		} else {
+			t.report.Spindle.OffLength += length
+		}
+		switch {
+		case st.Flood:
+			t.report.Coolant.FloodLength += length
+		case st.Mist:
+			t.report.Coolant.MistLength += length
+		default:
+			t.report.Coolant.DryLength += length
+		}
+	}
+}
+
+// finish 汇总各刀具的统计，换刀次数和刀具半径补偿取自执行结束后的解释器
+func (t *toolingBuilder) finish(interp *gcode.Interpreter) model.ToolingReport {
+	report := t.report
+	report.ToolChanges = interp.State.ToolChanges
+	report.Compensation = compensationReport(&interp.Comp)
+	report.Spindle.Range = t.spindle.axisRange()
+	for _, n := range t.order {
+		usage := *t.tools[n]
+		usage.Spindle = t.ranges[n].axisRange()
+		report.Tools = append(report.Tools, usage)
+	}
+	return report
+}
+
+// analyzeTooling 统计刀具、主轴和冷却的使用情况
+// 刀具按 T 选择、M6 装入，每把刀的时间按进给速度估算；主轴转速和冷却只统计加工(G1/G2/G3)移动
+func (s *GCodeService) analyzeTooling(r io.Reader, profile *model.MachineProfile, params *MachineParams) (model.ToolingReport, error) {
+	if profile == nil {
+		profile = DefaultMachineProfile()
+	}
+	if params == nil {
+		params = defaultMachineParams()
+	}
+	t := newToolingBuilder(params)
+	interp := gcode.NewInterpreterFor(profile)
+	if _, err := runAnalyzers(r, interp, t); err != nil {
+		return t.report, err
+	}
+	return t.finish(interp), nil
+}
+
+// compensationReport 转换解释器的刀具半径补偿统计
+func compensationReport(comp *gcode.CompReport) model.CompensationReport {
+	report := model.CompensationReport{
+		Used:              comp.Used,
+		ProgrammedLength:  comp.Programmed,
+		CompensatedLength: comp.Compensated,
+		Issues:            make([]model.CompensationIssue, 0, len(comp.Issues)),
+	}
+	for _, issue := range comp.Issues {
+		report.Issues = append(report.Issues, model.CompensationIssue{Line: issue.Line, Message: issue.Message})
+	}
+	return report
+}
+
+// compareTooling 比较A/B两个版本的刀具顺序和使用的刀具
+func (s *GCodeService) compareTooling(a, b model.ToolingReport) model.ToolingChange {
+	change := model.ToolingChange{
+		Sequence:         diffSequence(a.Sequence, b.Sequence),
+		AddedTools:       make([]int, 0),
+		RemovedTools:     make([]int, 0),
+		ToolChangesDelta: b.ToolChanges - a.ToolChanges,
+	}
+	change.Same = true
+	for _, edit := range change.Sequence {
+		if edit.Type != "same" {
+			change.Same = false
+			break
+		}
+	}
+
+	usedA, usedB := map[int]bool{}, map[int]bool{}
+	for _, t := range a.Tools {
+		usedA[t.Tool] = true
+	}
+	for _, t := range b.Tools {
+		usedB[t.Tool] = true
+		if !usedA[t.Tool] {
+			change.AddedTools = append(change.AddedTools, t.Tool)
+		}
+	}
+	for _, t := range a.Tools {
+		if !usedB[t.Tool] {
+			change.RemovedTools = append(change.RemovedTools, t.Tool)
+		}
+	}
+	sort.Ints(change.AddedTools)
+	sort.Ints(change.RemovedTools)
+	return change
+}
+
+// maxSequenceCells 刀具顺序差异的动态规划表最多的单元数，超过时不同的部分按全部删除再新增处理
+const maxSequenceCells = 1 << 20
+
+// diffSequence 按最长公共子序列计算两个刀具顺序的差异
+// 相同的开头和结尾直接输出，只有中间不同的部分使用动态规划
+func diffSequence(a, b []int) []model.SequenceEdit {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	edits := make([]model.SequenceEdit, 0, max(len(a), len(b)))
+	for _, tool := range a[:prefix] {
+		edits = append(edits, model.SequenceEdit{Type: "same", Tool: tool})
+	}
+	edits = lcsEdits(edits, a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])
+	for _, tool := range a[len(a)-suffix:] {
+		edits = append(edits, model.SequenceEdit{Type: "same", Tool: tool})
+	}
+	return edits
+}
+
+// lcsEdits 按最长公共子序列把 a 到 b 的差异追加到 edits
+// 动态规划表超过 maxSequenceCells 时删除 a 中的全部再新增 b 中的全部
+func lcsEdits(edits []model.SequenceEdit, a, b []int) []model.SequenceEdit {
+	if (len(a)+1)*(len(b)+1) > maxSequenceCells {
+		for _, tool := range a {
+			edits = append(edits, model.SequenceEdit{Type: "remove", Tool: tool})
+		}
+		for _, tool := range b {
+			edits = append(edits, model.SequenceEdit{Type: "add", Tool: tool})
+		}
+		return edits
+	}
+
+	// lcs[i][j] 为 a[i:] 和 b[j:] 的最长公共子序列长度
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			edits = append(edits, model.SequenceEdit{Type: "same", Tool: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			edits = append(edits, model.SequenceEdit{Type: "remove", Tool: a[i]})
+			i++
+		default:
+			edits = append(edits, model.SequenceEdit{Type: "add", Tool: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		edits = append(edits, model.SequenceEdit{Type: "remove", Tool: a[i]})
+	}
+	for ; j < len(b); j++ {
+		edits = append(edits, model.SequenceEdit{Type: "add", Tool: b[j]})
+	}
+	return edits
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"encoding/json"
+	"math"
+	"ok/model"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestAnalyzeTooling(t *testing.T) {
+	src := "T1 M6\nM3 S1000\nM8\nG0 X10\nG1 X20 F600\n" +
+		"T2 M6\nM4 S2000\nM9\nG1 X30\nM5\nT1 M6\nG0 X0\n"
+	params := &MachineParams{RapidSpeed: 6000, WorkingSpeed: 3000}
+	report, err := NewGCodeService().analyzeTooling(strings.NewReader(src), nil, params)
+	if err != nil {
+		t.Fatalf("analyzeTooling: %v", err)
+	}
+
+	if !reflect.DeepEqual(report.Sequence, []int{1, 2, 1}) || report.ToolChanges != 3 {
+		t.Errorf("Sequence = %v, ToolChanges = %d", report.Sequence, report.ToolChanges)
+	}
+	want := []model.ToolUsage{
+		{Tool: 1, WorkingLength: 10, RapidLength: 40, Time: 1.4, Spindle: model.AxisRange{Min: 1000, Max: 1000}, Loads: 2},
+		{Tool: 2, WorkingLength: 10, Time: 1, Spindle: model.AxisRange{Min: 2000, Max: 2000}, Loads: 1},
+	}
+	if len(report.Tools) != len(want) {
+		t.Fatalf("Tools = %+v", report.Tools)
+	}
+	for i, w := range want {
+		got := report.Tools[i]
+		if math.Abs(got.Time-w.Time) > 1e-9 {
+			t.Errorf("T%d Time = %v, want %v", w.Tool, got.Time, w.Time)
+		}
+		got.Time = w.Time
+		if got != w {
+			t.Errorf("Tools[%d] = %+v, want %+v", i, got, w)
+		}
+	}
+
+	spindle := model.SpindleUsage{Range: model.AxisRange{Min: 1000, Max: 2000}, Starts: 1, Reverse: true}
+	if report.Spindle != spindle {
+		t.Errorf("Spindle = %+v, want %+v", report.Spindle, spindle)
+	}
+	coolant := model.CoolantUsage{FloodLength: 10, DryLength: 10, Starts: 1}
+	if report.Coolant != coolant {
+		t.Errorf("Coolant = %+v, want %+v", report.Coolant, coolant)
+	}
+}
+
+func TestAnalyzeToolingZeroSpeed(t *testing.T) {
+	// 没有设置速度时不估算时间，结果可以编码为 JSON
+	src := "T1 M6\nG0 X10\nG1 X20\nG1 X30 F600\n"
+	params := &MachineParams{RapidSpeed: 0, WorkingSpeed: 0}
+	report, err := NewGCodeService().analyzeTooling(strings.NewReader(src), nil, params)
+	if err != nil {
+		t.Fatalf("analyzeTooling: %v", err)
+	}
+	if got := report.Tools[0].Time; got != 1 {
+		t.Errorf("Time = %v, want 1", got)
+	}
+	if _, err := json.Marshal(report); err != nil {
+		t.Errorf("json.Marshal: %v", err)
+	}
+}
+
+func TestDiffSequence(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []int
+		want string // 每项为类型的首字母加刀具号，如 s1 表示相同的 T1
+	}{
+		{"相同", []int{1, 2, 3}, []int{1, 2, 3}, "s1 s2 s3"},
+		{"都为空", nil, nil, ""},
+		{"新增刀具", []int{1, 3}, []int{1, 2, 3}, "s1 a2 s3"},
+		{"删除刀具", []int{1, 2, 3}, []int{1, 3}, "s1 r2 s3"},
+		{"交换顺序", []int{1, 2, 3}, []int{1, 3, 2}, "s1 r2 s3 a2"},
+		{"完全不同", []int{1, 2}, []int{3, 4}, "r1 r2 a3 a4"},
+		{"重复使用的刀具", []int{1, 2, 1, 2}, []int{1, 2, 2}, "s1 s2 r1 s2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sequenceText(diffSequence(tt.a, tt.b)); got != tt.want {
+				t.Errorf("diffSequence = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffSequenceLong(t *testing.T) {
+	// 不同的部分超过动态规划的上限时按全部删除再新增处理，相同的开头和结尾保持不变
+	n := 2000
+	a, b := make([]int, n), make([]int, n)
+	for i := range a {
+		a[i], b[i] = 10+i%7, 20+i%5
+	}
+	a[0], b[0] = 1, 1
+	a[n-1], b[n-1] = 2, 2
+	edits := diffSequence(a, b)
+	if len(edits) != 2*n-2 {
+		t.Fatalf("len = %d, want %d", len(edits), 2*n-2)
+	}
+	if edits[0].Type != "same" || edits[len(edits)-1].Type != "same" {
+		t.Errorf("开头和结尾 = %+v %+v", edits[0], edits[len(edits)-1])
+	}
+	if edits[1].Type != "remove" || edits[n-1].Type != "add" {
+		t.Errorf("中间 = %+v %+v", edits[1], edits[n-1])
+	}
+}
+
+// sequenceText 把刀具顺序差异写成 s1 a2 r3 的形式
+func sequenceText(edits []model.SequenceEdit) string {
+	parts := make([]string, len(edits))
+	for i, e := range edits {
+		parts[i] = e.Type[:1] + strconv.Itoa(e.Tool)
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,586 @@
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"ok/gcode"
+	"ok/model"
+	"strconv"
+	"strings"
+)
+
+// 切割顺序优化的参数
+const (
+	maxTravelContours = 5000 // 每个分组最多重新排序的切割路径数，超过时保持原顺序
+	maxTwoOptContours = 1000 // 使用 2-opt 改进的最多切割路径数，超过时只用最近邻
+	maxTwoOptPasses   = 50   // 2-opt 最多的改进轮数
+)
+
+// travelState 切割路径前后的模态状态，重新排序后按此恢复
+type travelState struct {
+	position   gcode.Point
+	feed       float64
+	feedSet    bool
+	power      float64
+	spindleOn  bool
+	spindleCCW bool
+	motion     string
+	inches     bool
+	absolute   bool
+}
+
+func stateOf(st *gcode.State) travelState {
+	return travelState{
+		position:   st.Position,
+		feed:       st.Feed,
+		feedSet:    st.FeedSet,
+		power:      st.Power,
+		spindleOn:  st.SpindleOn,
+		spindleCCW: st.SpindleCCW,
+		motion:     st.Motion,
+		inches:     st.Inches,
+		absolute:   st.Absolute,
+	}
+}
+
+// travelFrame 切割路径所属的元素、刀具和坐标系，只在相同的连续切割路径之间重新排序
+type travelFrame struct {
+	element     int
+	tool        int
+	coordSystem int
+	offset      gcode.Point
+	toolLength  float64
+}
+
+func frameOf(st *gcode.State, element int) travelFrame {
+	return travelFrame{
+		element:     element,
+		tool:        st.Tool,
+		coordSystem: st.CoordSystem,
+		offset:      st.Offset,
+		toolLength:  st.ToolLength,
+	}
+}
+
+// travelChunk 重新排序的单位：一条切割路径及其之前的空行程
+// lines[first:motion] 为之前不含运动的程序段，lines[motion:last+1] 为空行程和切割路径；
+// 换刀、元素标记等改变 frame 的程序段之后才开始 motion，分组的第一个切割路径的 lines[first:motion] 保持在原位置
+type travelChunk struct {
+	first, motion, last int
+	start, end          gcode.Point
+	before, after       travelState // motion 之前和 last 之后的状态
+	frame               travelFrame
+	fixed               bool // 没有自己的 XY 空行程，或包含固定循环、刀具半径补偿、G28/G30/G53、增量或圆弧空行程，不能移动
+	modalMotion         bool // 第一个运动程序段没有写出运动命令，沿用之前的模态
+	modalFeed           bool // 第一个进给运动之前没有设置 F，沿用之前的进给速度
+}
+
+// travelGroup 可以重新排序的一组连续切割路径 chunks[lo:hi]
+type travelGroup struct {
+	lo, hi int
+	fixed  bool
+	order  []int // 优化后的顺序，为 chunks 的序号
+	travel float64
+	best   float64
+}
+
+// travelPlan 程序的切割路径和优化后的顺序
+type travelPlan struct {
+	lines    []string // 展开后的各行，只有输出优化后的程序时保存
+	chunks   []travelChunk
+	groups   []travelGroup
+	rewrites map[int]gcode.Point // 空行程程序段改写后的 XY，坐标为程序单位
+	initial  travelState         // 程序开始时的状态
+	names    []string            // 元素标记的名称
+	// decimalPoint 改写的坐标总是带小数点，方言(如 Fanuc)把不带小数点的坐标按最小设定单位解释
+	decimalPoint bool
+}
+
+// travelPlanner 按执行顺序把切割路径按空行程分块
+type travelPlanner struct {
+	plan      *travelPlan
+	keepLines bool
+	markers   *elementMarkers
+	detector  cutDetector
+	k         int         // 当前程序段在 lines 中的序号
+	last      travelState // 上一程序段执行后的状态
+	frame     travelFrame // 上一程序段执行后的 frame
+	open      bool        // 当前切割路径是否还在继续
+	next      int         // 下一个切割路径的第一行
+	motion    int         // 下一个切割路径的第一个运动程序段
+	before    travelState // motion 之前的状态
+	travelled bool        // 下一个切割路径是否有自己的 XY 空行程
+	fixed     bool        // 下一个切割路径的空行程不能移动
+	modal     bool        // 下一个切割路径的第一个运动程序段沿用之前的运动模态
+	feedSet   bool        // 下一个切割路径从 motion 开始是否设置过 F
+	feedUsed  bool        // 下一个切割路径在设置 F 之前有进给运动
+	previous  gcode.Point // 上一个切割运动段的终点
+}
+
+// newTravelPlanner interp 为还没有执行的解释器，keepLines 为 true 时保存展开后的各行，用于输出优化后的程序
+func newTravelPlanner(interp *gcode.Interpreter, profile *model.MachineProfile, keepLines bool) *travelPlanner {
+	st := &interp.State
+	return &travelPlanner{
+		plan: &travelPlan{
+			rewrites:     map[int]gcode.Point{},
+			initial:      stateOf(st),
+			decimalPoint: interp.Dialect.Defaults().DecimalPoint,
+		},
+		keepLines: keepLines,
+		markers:   newElementMarkers(),
+		detector:  cutDetector{laser: profile.Laser},
+		k:         -1,
+		last:      stateOf(st),
+		frame:     frameOf(st, -1),
+		motion:    -1,
+	}
+}
+
+// block 累加一个程序段，st为该段执行后的状态
+func (t *travelPlanner) block(b *gcode.Block, st *gcode.State, segments []gcode.Segment) {
+	plan := t.plan
+	t.k++
+	k := t.k
+	if t.keepLines {
+		plan.lines = append(plan.lines, b.Raw)
+	}
+	element := t.markers.update(b)
+	t.detector.block(b)
+	if t.motion >= 0 && b.Has('F') {
+		t.feedSet = true
+	}
+	for i := range segments {
+		seg := &segments[i]
+		if n := len(plan.chunks); n > 0 && plan.chunks[n-1].last == k {
+			// 一个程序段只属于一个切割路径，如固定循环的多次进给
+			c := &plan.chunks[n-1]
+			if t.detector.cutting(seg) {
+				c.end, c.after, t.previous = seg.To, stateOf(st), seg.To
+			}
+			t.open = t.open && t.detector.cutting(seg)
+			continue
+		}
+		if t.motion < 0 {
+			t.motion, t.before = k, t.last
+			t.modal = !hasMotionCode(b)
+			t.feedSet, t.feedUsed = b.Has('F'), false
+		}
+		if !seg.IsRapid() && !t.feedSet {
+			t.feedUsed = true
+		}
+		if !t.detector.cutting(seg) {
+			t.open = false
+			// 只有 Z 移动的空行程不需要改写；到达当前位置的 XY 空行程在重新排序后仍需要
+			if planarDistance(seg.From, seg.To) <= gcode.ContourTolerance && !b.Has('X') && !b.Has('Y') {
+				continue
+			}
+			if seg.IsArc() || seg.Cycle != "" || !st.Absolute ||
+				b.HasCode("G28") || b.HasCode("G30") || b.HasCode("G53") {
+				t.fixed = true
+				continue
+			}
+			to := seg.To
+			if st.Inches {
+				to = gcode.Point{X: to.X / 25.4, Y: to.Y / 25.4}
+			}
+			plan.rewrites[k] = to
+			t.travelled = true
+			continue
+		}
+		if t.open && planarDistance(t.previous, seg.From) > gcode.ContourTolerance {
+			t.open = false
+		}
+		if !t.open {
+			plan.chunks = append(plan.chunks, travelChunk{
+				first:       t.next,
+				motion:      t.motion,
+				start:       seg.From,
+				before:      t.before,
+				frame:       frameOf(st, element),
+				fixed:       t.fixed || !t.travelled,
+				modalMotion: t.modal,
+				modalFeed:   t.feedUsed,
+			})
+			t.open, t.fixed, t.travelled = true, false, false
+		}
+		c := &plan.chunks[len(plan.chunks)-1]
+		c.end, c.last, c.after = seg.To, k, stateOf(st)
+		if seg.Cycle != "" || st.CutterComp != "" {
+			c.fixed = true
+		}
+		t.previous = seg.To
+		t.next, t.motion = k+1, -1
+	}
+	if f := frameOf(st, element); f != t.frame {
+		if n := len(plan.chunks); n > 0 && plan.chunks[n-1].last == k {
+			// 切割路径中改变了 frame
+			plan.chunks[n-1].fixed = true
+		}
+		// 改变 frame 的程序段及之前的空行程留在分组开头，之后的切割运动属于新的切割路径
+		t.open, t.motion, t.fixed, t.travelled = false, -1, false, false
+		t.frame = f
+	}
+	t.last = stateOf(st)
+}
+
+// finish 计算优化后的顺序
+func (t *travelPlanner) finish() *travelPlan {
+	t.plan.names = t.markers.names
+	t.plan.optimize()
+	return t.plan
+}
+
+// planTravel 执行程序，按空行程把切割路径分块并计算优化后的顺序
+// keepLines 为 true 时保存展开后的各行，用于输出优化后的程序
+func (s *GCodeService) planTravel(r io.Reader, profile *model.MachineProfile, keepLines bool) (*travelPlan, error) {
+	if profile == nil {
+		profile = DefaultMachineProfile()
+	}
+	interp := gcode.NewInterpreterFor(profile)
+	t := newTravelPlanner(interp, profile, keepLines)
+	if _, err := runAnalyzers(r, interp, t); err != nil {
+		return nil, err
+	}
+	return t.finish(), nil
+}
+
+// optimize 按 frame 把连续的切割路径分组，计算每组优化后的顺序
+func (p *travelPlan) optimize() {
+	for lo := 0; lo < len(p.chunks); {
+		hi := lo + 1
+		for hi < len(p.chunks) && p.chunks[hi].frame == p.chunks[lo].frame {
+			hi++
+		}
+		g := travelGroup{lo: lo, hi: hi, fixed: hi-lo > maxTravelContours}
+		for i := lo; i < hi; i++ {
+			g.fixed = g.fixed || p.chunks[i].fixed
+			g.order = append(g.order, i)
+		}
+		entry := p.chunks[lo].before.position
+		g.travel = p.cost(entry, g.order)
+		g.best = g.travel
+		if !g.fixed && hi-lo > 1 {
+			order := p.nearestNeighbour(entry, lo, hi)
+			if len(order) <= maxTwoOptContours {
+				p.twoOpt(entry, order)
+			}
+			if cost := p.cost(entry, order); cost < g.travel-1e-9 {
+				g.order, g.best = order, cost
+			}
+		}
+		p.groups = append(p.groups, g)
+		lo = hi
+	}
+}
+
+// link 从切割路径 i 的终点到 j 的起点的空行程，i 为-1时从 entry 出发
+func (p *travelPlan) link(entry gcode.Point, i, j int) float64 {
+	from := entry
+	if i >= 0 {
+		from = p.chunks[i].end
+	}
+	return planarDistance(from, p.chunks[j].start)
+}
+
+// cost 从 entry 出发按顺序切割的空行程
+func (p *travelPlan) cost(entry gcode.Point, order []int) float64 {
+	total, prev := 0.0, -1
+	for _, i := range order {
+		total += p.link(entry, prev, i)
+		prev = i
+	}
+	return total
+}
+
+// nearestNeighbour 从 entry 出发，每次选择起点离当前位置最近的切割路径
+func (p *travelPlan) nearestNeighbour(entry gcode.Point, lo, hi int) []int {
+	visited := make([]bool, hi-lo)
+	order := make([]int, 0, hi-lo)
+	prev := -1
+	for len(order) < hi-lo {
+		best, bestDist := -1, math.Inf(1)
+		for i := lo; i < hi; i++ {
+			if visited[i-lo] {
+				continue
+			}
+			if d := p.link(entry, prev, i); d < bestDist {
+				best, bestDist = i, d
+			}
+		}
+		visited[best-lo] = true
+		order = append(order, best)
+		prev = best
+	}
+	return order
+}
+
+// twoOpt 反转顺序中的一段以缩短空行程，直到没有改进
+// 起点和终点不同的切割路径反转后空行程不对称，段内的空行程随反转范围增量计算
+func (p *travelPlan) twoOpt(entry gcode.Point, order []int) {
+	n := len(order)
+	at := func(i int) int {
+		if i < 0 {
+			return -1
+		}
+		return order[i]
+	}
+	for pass := 0; pass < maxTwoOptPasses; pass++ {
+		improved := false
+		for i := 0; i < n-1; i++ {
+			forward, reverse := 0.0, 0.0
+			for j := i + 1; j < n; j++ {
+				forward += p.link(entry, order[j-1], order[j])
+				reverse += p.link(entry, order[j], order[j-1])
+				old := p.link(entry, at(i-1), order[i]) + forward
+				changed := p.link(entry, at(i-1), order[j]) + reverse
+				if j+1 < n {
+					old += p.link(entry, order[j], order[j+1])
+					changed += p.link(entry, order[i], order[j+1])
+				}
+				if changed < old-1e-9 {
+					for a, b := i, j; a < b; a, b = a+1, b-1 {
+						order[a], order[b] = order[b], order[a]
+					}
+					improved = true
+					forward, reverse = reverse, forward
+				}
+			}
+		}
+		if !improved {
+			return
+		}
+	}
+}
+
+// report 汇总空行程分析，rapidSpeed 为快速移动速度(mm/min)
+func (p *travelPlan) report(elements int, rapidSpeed float64) model.TravelReport {
+	report := model.TravelReport{Contours: len(p.chunks), Groups: len(p.groups), Elements: make([]model.ElementTravel, 0)}
+	var stats []model.ElementTravel
+	for _, g := range p.groups {
+		if g.fixed {
+			report.Fixed++
+		}
+		report.Travel += g.travel
+		report.Optimized += g.best
+		element := p.chunks[g.lo].frame.element
+		if element < 0 {
+			continue
+		}
+		for len(stats) <= element {
+			stats = append(stats, model.ElementTravel{Index: len(stats)})
+		}
+		stats[element].Contours += g.hi - g.lo
+		stats[element].Travel += g.travel
+		stats[element].Optimized += g.best
+	}
+	report.Savings = report.Travel - report.Optimized
+	if rapidSpeed > 0 {
+		report.TimeSavings = report.Savings / rapidSpeed * 60
+	}
+
+	count := elements
+	if len(p.names) > count {
+		count = len(p.names)
+	}
+	if len(p.names) == 0 {
+		// 没有元素标记时整个程序对应唯一的元素
+		if count != 1 {
+			return report
+		}
+		stats = []model.ElementTravel{{Contours: report.Contours, Travel: report.Travel, Optimized: report.Optimized}}
+	}
+	for i := 0; i < count; i++ {
+		el := model.ElementTravel{Index: i}
+		if i < len(stats) {
+			el = stats[i]
+			el.Index = i
+		}
+		if i < len(p.names) {
+			el.Name = p.names[i]
+		}
+		el.Savings = el.Travel - el.Optimized
+		report.Elements = append(report.Elements, el)
+	}
+	return report
+}
+
+// write 按优化后的顺序输出程序
+// 切割路径不在原来的位置时，先恢复原来切割前的单位、距离模式、主轴和进给，空行程改写为绝对坐标的 XY
+func (p *travelPlan) write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	emit := func(from, to int, rewrite bool) {
+		for k := from; k < to; k++ {
+			line := p.lines[k]
+			if xy, ok := p.rewrites[k]; ok && rewrite {
+				line = p.rewriteXY(line, xy)
+			}
+			bw.WriteString(line)
+			bw.WriteByte('\n')
+		}
+	}
+	if len(p.chunks) == 0 {
+		emit(0, len(p.lines), false)
+		return bw.Flush()
+	}
+
+	previous, state := -1, p.initial
+	for _, g := range p.groups {
+		head := &p.chunks[g.lo]
+		emit(head.first, head.motion, false)
+		if previous == g.lo-1 {
+			// 分组开头的程序段接着上一个切割路径按原顺序执行，之后的状态就是第一个切割路径之前的状态
+			state = head.before
+		}
+		for _, i := range g.order {
+			c := &p.chunks[i]
+			if i != g.lo {
+				emit(c.first, c.motion, false)
+			}
+			if i != previous+1 {
+				p.writeState(bw, state, c.restore())
+			}
+			emit(c.motion, c.last+1, !g.fixed)
+			previous, state = i, c.after
+		}
+	}
+	tail := &p.chunks[len(p.chunks)-1]
+	if previous != len(p.chunks)-1 {
+		p.writeState(bw, state, tail.after)
+	}
+	emit(tail.last+1, len(p.lines), false)
+	return bw.Flush()
+}
+
+// restore 移动切割路径时需要恢复的状态：切割路径自己写出运动命令和 F 时不恢复运动模态和进给速度
+func (c *travelChunk) restore() travelState {
+	to := c.before
+	if !c.modalMotion {
+		to.motion = ""
+	}
+	if !c.modalFeed {
+		to.feedSet = false
+	}
+	return to
+}
+
+// writeState 输出把模态状态从 from 恢复为 to 的程序段，每行一个命令
+// 两个切割路径之间的程序段只会把状态设为 to 中的值，只输出与 from 不同的部分即可。
+// to 的高度高于当前高度时先快速抬到该高度，避免在加工深度上移动；低于当前高度时不下降
+func (p *travelPlan) writeState(w *bufio.Writer, from, to travelState) {
+	scale := 1.0
+	if to.inches {
+		scale = 25.4
+	}
+	if to.inches != from.inches {
+		if to.inches {
+			w.WriteString("G20\n")
+		} else {
+			w.WriteString("G21\n")
+		}
+	}
+	if to.absolute != from.absolute {
+		if to.absolute {
+			w.WriteString("G90\n")
+		} else {
+			w.WriteString("G91\n")
+		}
+	}
+	if to.position.Z > from.position.Z+gcode.ContourTolerance {
+		fmt.Fprintf(w, "G0 Z%s\n", p.coord(to.position.Z/scale))
+		from.motion = gcode.MotionRapid
+	}
+	power := "S" + travelNumber(to.power)
+	switch {
+	case to.spindleOn && (!from.spindleOn || to.spindleCCW != from.spindleCCW || to.power != from.power):
+		if to.spindleCCW {
+			fmt.Fprintf(w, "M4 %s\n", power)
+		} else {
+			fmt.Fprintf(w, "M3 %s\n", power)
+		}
+	case !to.spindleOn && from.spindleOn:
+		fmt.Fprintf(w, "M5\n%s\n", power)
+	case !to.spindleOn && to.power != from.power:
+		fmt.Fprintf(w, "%s\n", power)
+	}
+	var parts []string
+	if to.motion != from.motion && isMotion(to.motion) {
+		parts = append(parts, to.motion)
+	}
+	if to.feedSet && to.feed != from.feed {
+		parts = append(parts, "F"+travelNumber(to.feed/scale))
+	}
+	if len(parts) > 0 {
+		w.WriteString(strings.Join(parts, " ") + "\n")
+	}
+}
+
+// isMotion 是否为 G0/G1/G2/G3
+func isMotion(code string) bool {
+	return code == gcode.MotionRapid || code == gcode.MotionLinear || code == gcode.MotionCW || code == gcode.MotionCCW
+}
+
+// rewriteXY 把程序段的 X/Y 改写为给定的绝对坐标，保留其他代码字和注释，去掉校验和
+func (p *travelPlan) rewriteXY(line string, xy gcode.Point) string {
+	b := gcode.ParseLine(line, 0)
+	var parts []string
+	if b.HasNumber {
+		parts = append(parts, "N"+strconv.Itoa(b.Number))
+	}
+	for _, w := range b.Words {
+		if w.Letter != 'X' && w.Letter != 'Y' {
+			parts = append(parts, string(w.Letter)+w.Text)
+		}
+	}
+	parts = append(parts, "X"+p.coord(xy.X), "Y"+p.coord(xy.Y))
+	if b.Comment != "" {
+		parts = append(parts, ";"+b.Comment)
+	}
+	return strings.Join(parts, " ")
+}
+
+// travelNumber 格式化坐标和速度，保留4位小数并去掉末尾的0
+func travelNumber(v float64) string {
+	return strconv.FormatFloat(math.Round(v*1e4)/1e4, 'f', -1, 64)
+}
+
+// coord 格式化改写的坐标，方言要求时总是带小数点
+func (p *travelPlan) coord(v float64) string {
+	s := travelNumber(v)
+	if p.decimalPoint && !strings.Contains(s, ".") {
+		s += "."
+	}
+	return s
+}
+
+// hasMotionCode 程序段是否写出了运动命令
+func hasMotionCode(b *gcode.Block) bool {
+	for _, w := range b.Words {
+		if w.Letter != 'G' {
+			continue
+		}
+		if code := gcode.CodeName('G', w.Value); isMotion(code) || gcode.IsCycle(code) {
+			return true
+		}
+	}
+	return false
+}
+
+// planarDistance 两点在 XY 平面上的距离
+func planarDistance(a, b gcode.Point) float64 {
+	return math.Hypot(b.X-a.X, b.Y-a.Y)
+}
+
+// OptimizeTravel 按优化后的切割顺序输出G-code，返回空行程分析
+// rapidSpeed 为快速移动速度(mm/min)，用于估算节省的时间
+func (s *GCodeService) OptimizeTravel(w io.Writer, r io.Reader, profile *model.MachineProfile, rapidSpeed float64) (model.TravelReport, error) {
+	plan, err := s.planTravel(r, profile, true)
+	if err != nil {
+		return model.TravelReport{}, fmt.Errorf("分析切割顺序失败: %v", err)
+	}
+	if err := plan.write(w); err != nil {
+		return model.TravelReport{}, fmt.Errorf("写入G-code失败: %v", err)
+	}
+	return plan.report(0, rapidSpeed), nil
+}
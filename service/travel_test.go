@@ -0,0 +1,98 @@
+package service
+
+import (
+	"bytes"
+	"math/rand"
+	"ok/gcode"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestOptimizeTravel(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect string
+		src     string
+		want    string
+	}{
+		{
+			name: "开头的模态设置不重复输出",
+			src:  "G21 G90\nM3 S500\nG1 F1000\nG0 X100 Y0\nG1 X101 Y0\nG0 X0 Y0\nG1 X1 Y0\nG0 X50 Y0\nG1 X51 Y0\nM5\n",
+			want: "G21 G90\nM3 S500\nG1 F1000\nG0 X0 Y0\nG1 X1 Y0\nG0 X50 Y0\nG1 X51 Y0\nG0 X100 Y0\nG1 X101 Y0\nM5\n",
+		},
+		{
+			name: "切割路径之间的状态随路径移动",
+			src:  "G0 X100 Y0\nM3 S500\nG1 X101 Y0 F1000\nG0 X0 Y0\nM3 S800\nG1 X1 Y0\nM5\n",
+			want: "M3 S500\nF1000\nG0 X0 Y0\nM3 S800\nG1 X1 Y0\nM5\nS0\n" +
+				"G0 X100 Y0\nM3 S500\nG1 X101 Y0 F1000\nM3 S800\nM5\n",
+		},
+		{
+			name: "已经是最短顺序时原样输出",
+			src:  "M3 S500\nG0 X0 Y0\nG1 X1 Y0 F1000\nG0 X2 Y0\nG1 X3 Y0\nM5\n",
+			want: "M3 S500\nG0 X0 Y0\nG1 X1 Y0 F1000\nG0 X2 Y0\nG1 X3 Y0\nM5\n",
+		},
+		{
+			name:    "Fanuc 改写的坐标带小数点",
+			dialect: "fanuc",
+			src:     "M3 S500\nG0 X100000 Y0\nG1 X101. Y0. F1000\nG0 X0. Y0.\nG1 X1. Y0.\nG0 X50. Y0.\nG1 X51. Y0.\nM5\n",
+			want:    "M3 S500\nF1000\nG0 X0. Y0.\nG1 X1. Y0.\nG0 X50. Y0.\nG1 X51. Y0.\nG0 X100. Y0.\nG1 X101. Y0. F1000\nM5\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile := DefaultMachineProfile()
+			profile.Dialect = tt.dialect
+			var out bytes.Buffer
+			if _, err := NewGCodeService().OptimizeTravel(&out, strings.NewReader(tt.src), profile, 6000); err != nil {
+				t.Fatalf("OptimizeTravel: %v", err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+// pointPlan 每个切割路径为一个点的计划，起点和终点相同
+func pointPlan(points []gcode.Point) *travelPlan {
+	p := &travelPlan{}
+	for _, pt := range points {
+		p.chunks = append(p.chunks, travelChunk{start: pt, end: pt})
+	}
+	return p
+}
+
+func TestTwoOpt(t *testing.T) {
+	// 0->1->2->3 的空行程交叉，反转 1、2 后没有交叉
+	p := pointPlan([]gcode.Point{{X: 0, Y: 0}, {X: 10, Y: 10}, {X: 10, Y: 0}, {X: 0, Y: 10}})
+	order := []int{0, 1, 2, 3}
+	p.twoOpt(gcode.Point{}, order)
+	if cost := p.cost(gcode.Point{}, order); cost != 30 {
+		t.Errorf("order %v cost = %v, want 30", order, cost)
+	}
+}
+
+func TestTwoOptRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for round := 0; round < 20; round++ {
+		points := make([]gcode.Point, 40)
+		for i := range points {
+			points[i] = gcode.Point{X: rng.Float64() * 100, Y: rng.Float64() * 100}
+		}
+		p := pointPlan(points)
+		order := p.nearestNeighbour(gcode.Point{}, 0, len(points))
+		before := p.cost(gcode.Point{}, order)
+		p.twoOpt(gcode.Point{}, order)
+		if after := p.cost(gcode.Point{}, order); after > before+1e-9 {
+			t.Errorf("round %d: 2-opt 后空行程 %v 大于之前的 %v", round, after, before)
+		}
+		sorted := append([]int(nil), order...)
+		sort.Ints(sorted)
+		for i, v := range sorted {
+			if v != i {
+				t.Fatalf("round %d: order %v 不是排列", round, order)
+			}
+		}
+	}
+}
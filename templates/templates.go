@@ -0,0 +1,8 @@
+package templates
+
+import "embed"
+
+// FS 内嵌的模板文件，导出报告时使用，不依赖运行目录
+//
+//go:embed report.html report.md
+var FS embed.FS
@@ -3,8 +3,8 @@ package utils
 import (
 	"fmt"
 	"math"
+	"ok/gcode"
 	"strconv"
-	"strings"
 )
 
 // GCodeCommand G代码命令结构
@@ -16,40 +16,29 @@ type GCodeCommand struct {
 }
 
 // ParseGCodeCommand 解析G代码命令
+// 注释中的内容、行首的程序段号和校验和不会被当作代码字
 func ParseGCodeCommand(line string) *GCodeCommand {
 	cmd := &GCodeCommand{Raw: line}
-	
-	// 解析命令类型
-	if strings.HasPrefix(line, "G0") {
-		cmd.Type = "G0"
-	} else if strings.HasPrefix(line, "G1") {
-		cmd.Type = "G1"
-	} else if strings.HasPrefix(line, "G2") {
-		cmd.Type = "G2"
-	} else if strings.HasPrefix(line, "G3") {
-		cmd.Type = "G3"
-	}
-	
-	// 解析参数
-	parts := strings.Fields(line)
-	for _, part := range parts {
-		if len(part) < 2 {
-			continue
-		}
-		
-		value := parseFloat(part[1:])
-		switch part[0] {
+
+	block := gcode.ParseLine(line, 0)
+	for _, word := range block.Words {
+		switch word.Letter {
+		case 'G':
+			// 解析命令类型
+			if cmd.Type == "" && word.Value >= 0 && word.Value <= 3 && word.Value == float64(int(word.Value)) {
+				cmd.Type = gcode.CodeName('G', word.Value)
+			}
 		case 'X':
-			cmd.X = value
+			cmd.X = word.Value
 		case 'Y':
-			cmd.Y = value
+			cmd.Y = word.Value
 		case 'Z':
-			cmd.Z = value
+			cmd.Z = word.Value
 		case 'F':
-			cmd.F = value
+			cmd.F = word.Value
 		}
 	}
-	
+
 	return cmd
 }
 
@@ -98,6 +87,26 @@ func FormatSpeed(speed float64) string {
 	return fmt.Sprintf("%.0f mm/min", speed)
 }
 
+// FormatArea 格式化面积显示
+func FormatArea(area float64) string {
+	if area >= 1000000 {
+		return fmt.Sprintf("%.2f m²", area/1000000)
+	}
+	return fmt.Sprintf("%.2f mm²", area)
+}
+
+// FormatDuration 格式化时间显示
+func FormatDuration(seconds float64) string {
+	if seconds < 60 {
+		return fmt.Sprintf("%.1f秒", seconds)
+	}
+	total := int(math.Round(seconds))
+	if total < 3600 {
+		return fmt.Sprintf("%d分%d秒", total/60, total%60)
+	}
+	return fmt.Sprintf("%d时%d分%d秒", total/3600, total%3600/60, total%60)
+}
+
 // CalculateWorkArea 计算工作区域
 type WorkArea struct {
 	MinX, MinY float64